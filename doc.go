@@ -39,6 +39,7 @@ contain two types of parameters:
  Syntax    	Type
  {name}     	named parameter
  {name:*}	catch-all parameter
+ {name:**}	catch-all parameter split into segments
 
 Named parameters are dynamic path segments. They match anything until the
 next '/' or the path end:
@@ -61,6 +62,15 @@ until the end, catch-all parameters must always be the final path element.
   /files/templates/article.html       match: filepath="/templates/article.html"
   /files                              no match, but the router would redirect
 
+Catch-all parameters defined as {name:**} save the value as a []string with
+the path segments, skipping the empty ones:
+ Path: /files/{filepath:**}
+
+ Requests:
+  /files/                             match: filepath=[]string{}
+  /files/templates/article.html       match: filepath=[]string{"templates", "article.html"}
+  /files/templates//article.html      match: filepath=[]string{"templates", "article.html"}
+
 The value of parameters is saved in ctx.UserValue(<key>), consisting
 each of a key and a value. The slice is passed to the Handle func as a third
 parameter.
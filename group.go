@@ -2,7 +2,10 @@ package router
 
 import (
 	"io/fs"
+	"time"
 
+	"github.com/fasthttp/router/radix"
+	"github.com/savsgio/gotils/strconv"
 	"github.com/valyala/fasthttp"
 )
 
@@ -11,83 +14,248 @@ import (
 func (g *Group) Group(path string) *Group {
 	validatePath(path)
 
-	if len(g.prefix) > 0 && path == "/" {
+	if path == "/" {
 		return g
 	}
 
-	return g.router.Group(g.prefix + path)
+	group := g.router.Group(g.prefix + path)
+	group.middleware = append(group.middleware, g.middleware...)
+	group.SaveMatchedRoutePath = g.SaveMatchedRoutePath
+	group.SaveMatchedGroupPrefix = g.SaveMatchedGroupPrefix
+	group.ErrorHandler = g.ErrorHandler
+
+	return group
+}
+
+// fullPath returns the given path under the group prefix.
+// The full paths are appended to the buffer of the group, which is only
+// replaced by a bigger one when it's full, so the returned strings are kept.
+func (g *Group) fullPath(path string) string {
+	size := len(g.prefix) + len(path)
+
+	if cap(g.paths)-len(g.paths) < size {
+		g.paths = make([]byte, 0, max(size, 2*cap(g.paths), groupPathsBufferSize))
+	}
+
+	start := len(g.paths)
+	g.paths = append(g.paths, g.prefix...)
+	g.paths = append(g.paths, path...)
+
+	return strconv.B2S(g.paths[start:])
+}
+
+// wrapHandler wraps the handler of the given full path with the group
+// middleware and, if enabled, saves the matched route path
+func (g *Group) wrapHandler(path string, handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if handler == nil {
+		return nil
+	}
+
+	handler = g.applyMiddleware(handler)
+
+	if g.SaveMatchedRoutePath && !g.router.SaveMatchedRoutePath {
+		handler = g.router.saveMatchedRoutePath(path, handler)
+	}
+
+	return handler
+}
+
+// errHandler adapts the error-returning handler to a request handler,
+// which passes the returned errors to the group error handler
+func (g *Group) errHandler(handler ErrRequestHandler) fasthttp.RequestHandler {
+	if handler == nil {
+		return nil
+	}
+
+	errorHandler := g.ErrorHandler
+	if errorHandler == nil {
+		errorHandler = defaultErrorHandler
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		if err := handler(ctx); err != nil {
+			errorHandler(ctx, err)
+		}
+	}
+}
+
+// description describes the group in the registration errors
+func (g *Group) description() string {
+	if g.prefix == "" {
+		return "scope"
+	}
+
+	return "group '" + g.prefix + "'"
+}
+
+// applyMiddleware wraps the handler with the group middleware,
+// so the first added middleware is the outermost one
+func (g *Group) applyMiddleware(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	wrapper := g.router.MiddlewareWrapper
+
+	for i := len(g.middleware) - 1; i >= 0; i-- {
+		m := g.middleware[i]
+		handler = m.middleware(handler)
+
+		if wrapper != nil && m.name != "" {
+			handler = wrapper(m.name, handler)
+		}
+	}
+
+	return handler
+}
+
+// AddMiddleware appends the given middleware to the group,
+// so they run inside the already added ones, right before the handler.
+// Only the routes registered afterwards are wrapped with them.
+func (g *Group) AddMiddleware(middleware ...Middleware) {
+	g.middleware = append(g.middleware, toNamedMiddleware(middleware)...)
+}
+
+// AddNamedMiddleware appends the given middleware to the group like
+// AddMiddleware, with a name to be wrapped by the Router.MiddlewareWrapper.
+func (g *Group) AddNamedMiddleware(name string, middleware Middleware) {
+	if name == "" {
+		panic("middleware name must not be empty")
+	}
+
+	if middleware == nil {
+		panic("middleware must not be nil")
+	}
+
+	g.middleware = append(g.middleware, namedMiddleware{name: name, middleware: middleware})
+}
+
+// PrependMiddleware inserts the given middleware at the front of the group,
+// so they run outside the already added ones (e.g. panic recovery or request id).
+// Only the routes registered afterwards are wrapped with them.
+func (g *Group) PrependMiddleware(middleware ...Middleware) {
+	g.middleware = append(toNamedMiddleware(middleware), g.middleware...)
+}
+
+// Handler serves the requests like Router.Handler, but only the ones whose
+// path is under the group prefix, so it could be used as the handler of
+// a server which must only serve the routes of the group (e.g. on another
+// listener). The routes are the ones of the router under the group prefix,
+// including the subgroups and the ones registered by other groups
+// with the same prefix.
+//
+// The requests out of the group prefix are handled as not found, with the
+// NotFound handler of the group, if set, or the router one.
+func (g *Group) Handler(ctx *fasthttp.RequestCtx) {
+	path, ok := g.router.requestPath(ctx)
+	if !ok || hasPathPrefix(path, g.prefix) {
+		// The invalid requests are still replied by the router
+		g.router.Handler(ctx)
+		return
+	}
+
+	if g.router.PanicHandler != nil || g.router.RecoverPanics {
+		defer g.router.recv(ctx)
+	}
+
+	g.router.notFound(ctx, g.prefix)
+	g.router.miss(ctx, MissNotFound)
+}
+
+// NotFound sets the handler which is called when no matching route is found
+// for a path under the group prefix, instead of the router NotFound handler.
+// The handler of the most specific group of the path is used.
+// It's wrapped with the group middleware added so far, so they also run
+// for the not found requests (e.g. to set CORS headers or to log them).
+func (g *Group) NotFound(handler fasthttp.RequestHandler) {
+	if handler == nil {
+		panic("handler must not be nil")
+	}
+
+	g.router.setGroupNotFound(g.prefix, g.applyMiddleware(handler))
 }
 
 // GET is a shortcut for group.Handle(fasthttp.MethodGet, path, handler)
 func (g *Group) GET(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
-
-	g.router.GET(g.prefix+path, handler)
+	g.Handle(fasthttp.MethodGet, path, handler)
 }
 
 // HEAD is a shortcut for group.Handle(fasthttp.MethodHead, path, handler)
 func (g *Group) HEAD(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
-
-	g.router.HEAD(g.prefix+path, handler)
+	g.Handle(fasthttp.MethodHead, path, handler)
 }
 
 // POST is a shortcut for group.Handle(fasthttp.MethodPost, path, handler)
 func (g *Group) POST(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
-
-	g.router.POST(g.prefix+path, handler)
+	g.Handle(fasthttp.MethodPost, path, handler)
 }
 
 // PUT is a shortcut for group.Handle(fasthttp.MethodPut, path, handler)
 func (g *Group) PUT(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
-
-	g.router.PUT(g.prefix+path, handler)
+	g.Handle(fasthttp.MethodPut, path, handler)
 }
 
 // PATCH is a shortcut for group.Handle(fasthttp.MethodPatch, path, handler)
 func (g *Group) PATCH(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
-
-	g.router.PATCH(g.prefix+path, handler)
+	g.Handle(fasthttp.MethodPatch, path, handler)
 }
 
 // DELETE is a shortcut for group.Handle(fasthttp.MethodDelete, path, handler)
 func (g *Group) DELETE(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
-
-	g.router.DELETE(g.prefix+path, handler)
+	g.Handle(fasthttp.MethodDelete, path, handler)
 }
 
 // OPTIONS is a shortcut for group.Handle(fasthttp.MethodOptions, path, handler)
 func (g *Group) CONNECT(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
-
-	g.router.CONNECT(g.prefix+path, handler)
+	g.Handle(fasthttp.MethodConnect, path, handler)
 }
 
 // OPTIONS is a shortcut for group.Handle(fasthttp.MethodOptions, path, handler)
 func (g *Group) OPTIONS(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
-
-	g.router.OPTIONS(g.prefix+path, handler)
+	g.Handle(fasthttp.MethodOptions, path, handler)
 }
 
 // OPTIONS is a shortcut for group.Handle(fasthttp.MethodOptions, path, handler)
 func (g *Group) TRACE(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
+	g.Handle(fasthttp.MethodTrace, path, handler)
+}
 
-	g.router.TRACE(g.prefix+path, handler)
+// All registers the handler with the given path for every standard method,
+// apart from OPTIONS.
+//
+// See Router.All for more details.
+func (g *Group) All(path string, handler fasthttp.RequestHandler) {
+	for _, method := range wildAllowedMethods {
+		g.Handle(method, path, handler)
+	}
 }
 
 // ANY is a shortcut for group.Handle(router.MethodWild, path, handler)
 //
 // WARNING: Use only for routes where the request method is not important
 func (g *Group) ANY(path string, handler fasthttp.RequestHandler) {
-	validatePath(path)
+	g.Handle(MethodWild, path, handler)
+}
+
+// GETErr is a shortcut for group.HandleErr(fasthttp.MethodGet, path, handler)
+func (g *Group) GETErr(path string, handler ErrRequestHandler) {
+	g.HandleErr(fasthttp.MethodGet, path, handler)
+}
 
-	g.router.ANY(g.prefix+path, handler)
+// POSTErr is a shortcut for group.HandleErr(fasthttp.MethodPost, path, handler)
+func (g *Group) POSTErr(path string, handler ErrRequestHandler) {
+	g.HandleErr(fasthttp.MethodPost, path, handler)
+}
+
+// PUTErr is a shortcut for group.HandleErr(fasthttp.MethodPut, path, handler)
+func (g *Group) PUTErr(path string, handler ErrRequestHandler) {
+	g.HandleErr(fasthttp.MethodPut, path, handler)
+}
+
+// PATCHErr is a shortcut for group.HandleErr(fasthttp.MethodPatch, path, handler)
+func (g *Group) PATCHErr(path string, handler ErrRequestHandler) {
+	g.HandleErr(fasthttp.MethodPatch, path, handler)
+}
+
+// DELETEErr is a shortcut for group.HandleErr(fasthttp.MethodDelete, path, handler)
+func (g *Group) DELETEErr(path string, handler ErrRequestHandler) {
+	g.HandleErr(fasthttp.MethodDelete, path, handler)
 }
 
 // ServeFiles serves files from the given file system root path.
@@ -102,7 +270,45 @@ func (g *Group) ANY(path string, handler fasthttp.RequestHandler) {
 func (g *Group) ServeFiles(path string, rootPath string) {
 	validatePath(path)
 
-	g.router.ServeFiles(g.prefix+path, rootPath)
+	g.ServeFilesCustom(path, newFilesFS(rootPath))
+}
+
+// Static serves files from the given file system root path under the given
+// url prefix. It's a shortcut for group.ServeFiles(urlPrefix+"/{filepath:*}", rootPath)
+// The url prefix must not contain wildcards.
+// Use:
+//
+//	group.Static("/static", "./public")
+func (g *Group) Static(urlPrefix string, rootPath string) {
+	g.ServeFiles(staticPath(urlPrefix), rootPath)
+}
+
+// MountHandler mounts the given handler at the given path prefix for all
+// request methods. The prefix is stripped from the request path before
+// invoking the handler, so it could do its own sub-routing.
+// For example if the group prefix is "/admin" and the prefix is "/debug",
+// the request "/admin/debug/pprof/heap" is handled with the path "/pprof/heap".
+// The prefix must not contain wildcards.
+// Use:
+//
+//	group.MountHandler("/debug", pprofHandler)
+func (g *Group) MountHandler(prefix string, handler fasthttp.RequestHandler) {
+	g.ANY(mountPath(prefix), newMountHandler(handler))
+}
+
+// Delegate delegates the requests under the given path prefix to the
+// handler of another application, including the prefix itself.
+//
+// See Router.Delegate for more details.
+func (g *Group) Delegate(prefix string, handler fasthttp.RequestHandler) {
+	path := mountPath(prefix)
+	handler = newMountHandler(handler)
+
+	g.ANY(path, handler)
+
+	if bare := path[:len(path)-len(mountSuffix)]; bare != "" {
+		g.ANY(bare, handler)
+	}
 }
 
 // ServeFS serves files from the given file system.
@@ -117,7 +323,37 @@ func (g *Group) ServeFiles(path string, rootPath string) {
 func (g *Group) ServeFS(path string, filesystem fs.FS) {
 	validatePath(path)
 
-	g.router.ServeFS(g.prefix+path, filesystem)
+	g.ServeFilesCustom(path, newFilesystemFS(filesystem))
+}
+
+// ServeSPA serves the files of a single-page app from the given file system
+// root path, answering the missing files without extension with the index file.
+//
+// See Router.ServeSPA for more details.
+func (g *Group) ServeSPA(path, rootPath, indexFile string) {
+	validatePath(path)
+
+	g.GET(path, newSPAHandler(g.prefix+path, newFilesFS(rootPath), indexFile))
+}
+
+// ServeFilesCompressed serves files from the given file system root path,
+// serving their pre-compressed siblings for the accepted encodings.
+//
+// See Router.ServeFilesCompressed for more details.
+func (g *Group) ServeFilesCompressed(path, rootPath string, encodings []string) {
+	validatePath(path)
+
+	g.GET(path, newCompressedFilesHandler(g.prefix+path, rootPath, newFilesFS(rootPath), encodings))
+}
+
+// ServeFilesCached serves files from the given file system root path,
+// handling the conditional requests for them with ETag and Cache-Control.
+//
+// See Router.ServeFilesCached for more details.
+func (g *Group) ServeFilesCached(path, rootPath string, ttl time.Duration) {
+	validatePath(path)
+
+	g.GET(path, newCachedFilesHandler(g.prefix+path, newFilesFS(rootPath), ttl))
 }
 
 // ServeFilesCustom serves files from the given file system settings.
@@ -133,7 +369,7 @@ func (g *Group) ServeFS(path string, filesystem fs.FS) {
 func (g *Group) ServeFilesCustom(path string, fs *fasthttp.FS) {
 	validatePath(path)
 
-	g.router.ServeFilesCustom(g.prefix+path, fs)
+	g.GET(path, newFilesHandler(g.prefix+path, fs))
 }
 
 // Handle registers a new request handler with the given path and method.
@@ -147,5 +383,112 @@ func (g *Group) ServeFilesCustom(path string, fs *fasthttp.FS) {
 func (g *Group) Handle(method, path string, handler fasthttp.RequestHandler) {
 	validatePath(path)
 
-	g.router.Handle(method, g.prefix+path, handler)
+	path = g.fullPath(path)
+
+	g.router.handle(method, path, nil, routeHandler{handler: g.wrapHandler(path, handler), group: g})
+}
+
+// HandleErr registers a new error-returning request handler with the given
+// path and method. The errors returned by the handler are passed to the
+// group ErrorHandler, so they don't need to be handled in every handler.
+func (g *Group) HandleErr(method, path string, handler ErrRequestHandler) {
+	g.Handle(method, path, g.errHandler(handler))
+}
+
+// Routes registers the given routes in the group at once.
+// The full paths of all routes are built with a single allocation,
+// which reduces the startup time of apps with lots of routes.
+func (g *Group) Routes(routes []Route) {
+	size := 0
+	for _, route := range routes {
+		validatePath(route.Path)
+
+		size += len(g.prefix) + len(route.Path)
+	}
+
+	if cap(g.paths)-len(g.paths) < size {
+		g.paths = make([]byte, 0, max(size, 2*cap(g.paths), groupPathsBufferSize))
+	}
+
+	g.router.bulk(func() {
+		for _, route := range routes {
+			path := g.fullPath(route.Path)
+
+			g.router.handle(route.Method, path, nil, routeHandler{handler: g.wrapHandler(path, route.Handler), group: g})
+		}
+	})
+}
+
+// HandleWhen registers a new request handler with the given path and method,
+// which only matches the requests for which the given predicate returns true.
+//
+// See Router.HandleWhen for more details.
+func (g *Group) HandleWhen(method, path string, handler fasthttp.RequestHandler, predicate radix.Predicate) {
+	validatePath(path)
+
+	if predicate == nil {
+		panic("predicate must not be nil")
+	}
+
+	path = g.fullPath(path)
+
+	g.router.handle(method, path, nil, routeHandler{
+		handler:   g.wrapHandler(path, handler),
+		predicate: predicate,
+		group:     g,
+	})
+}
+
+// Route returns a builder to configure a new route with the given path and
+// method, which is registered once its configuration is done.
+//
+// See Router.Route for more details.
+func (g *Group) Route(method, path string, handler fasthttp.RequestHandler) *RouteBuilder {
+	validatePath(path)
+
+	return &RouteBuilder{
+		group:   g,
+		method:  method,
+		path:    path,
+		handler: handler,
+	}
+}
+
+// HandleNegotiated registers a new route with the given path and method,
+// which dispatches each request to the handler of the media type which
+// best matches its Accept header.
+//
+// See Router.HandleNegotiated for more details.
+func (g *Group) HandleNegotiated(method, path string, handlers []MediaTypeHandler) {
+	g.Handle(method, path, newNegotiatedHandler(handlers))
+}
+
+// HandlePriority registers a new request handler with the given path and method,
+// with the given priority to match the requests.
+//
+// See Router.HandlePriority for more details.
+func (g *Group) HandlePriority(method, path string, handler fasthttp.RequestHandler, priority int) {
+	validatePath(path)
+
+	path = g.fullPath(path)
+
+	g.router.handle(method, path, nil, routeHandler{
+		handler:  g.wrapHandler(path, handler),
+		priority: priority,
+		group:    g,
+	})
+}
+
+// HandleTimeout registers a new request handler with the given path and method,
+// limiting its execution to the given timeout.
+//
+// See Router.HandleTimeout for more details.
+func (g *Group) HandleTimeout(method, path string, handler fasthttp.RequestHandler, timeout time.Duration) {
+	validatePath(path)
+
+	if handler == nil {
+		panic("handler must not be nil")
+	}
+
+	g.Handle(method, path, newTimeoutHandler(handler, timeout))
 }
@@ -2,9 +2,13 @@ package router
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/valyala/fasthttp"
 )
@@ -12,6 +16,7 @@ import (
 type routerGrouper interface {
 	Group(string) *Group
 	ServeFiles(path string, rootPath string)
+	Static(urlPrefix string, rootPath string)
 	ServeFilesCustom(path string, fs *fasthttp.FS)
 }
 
@@ -48,6 +53,10 @@ func assertGroup(t *testing.T, gs ...routerGrouper) {
 			t.Error("an error was expected when a path does not begin with slash")
 		}
 
+		if err := catchPanic(func() { g.Static("/static/{filepath:*}", "./") }); err == nil {
+			t.Error("an error was expected when a url prefix contains wildcards")
+		}
+
 		if err := catchPanic(func() {
 			g.ServeFilesCustom("", &fasthttp.FS{Root: "./"})
 		}); err == nil {
@@ -64,8 +73,9 @@ func TestGroup(t *testing.T) {
 	r4 := r1.Group("/moo")
 	r5 := r4.Group("/foo")
 	r6 := r5.Group("/foo")
+	r7 := r1.Scope()
 
-	assertGroup(t, r1, r2, r3, r4, r5, r6)
+	assertGroup(t, r1, r2, r3, r4, r5, r6, r7)
 
 	hit := false
 
@@ -95,6 +105,7 @@ func TestGroup(t *testing.T) {
 	})
 	r6.ServeFiles("/static/{filepath:*}", "./")
 	r6.ServeFS("/static/fs/{filepath:*}", fsTestFilesystem)
+	r6.Static("/assets/static", "./")
 	r6.ServeFilesCustom("/custom/static/{filepath:*}", &fasthttp.FS{Root: "./"})
 
 	uris := []string{
@@ -113,6 +124,8 @@ func TestGroup(t *testing.T) {
 		"GET /moo/foo/foo/static/router.go HTTP/1.1\r\n\r\n",
 		// testing multiple sub-router group - r6 (grouped from r5) to serve fs
 		"GET /moo/foo/foo/static/fs/LICENSE HTTP/1.1\r\n\r\n",
+		// testing multiple sub-router group - r6 (grouped from r5) to serve static files
+		"GET /moo/foo/foo/assets/static/router.go HTTP/1.1\r\n\r\n",
 		// testing multiple sub-router group - r6 (grouped from r5) to serve files with custom settings
 		"GET /moo/foo/foo/custom/static/router.go HTTP/1.1\r\n\r\n",
 	}
@@ -148,6 +161,642 @@ func TestGroup(t *testing.T) {
 	})
 }
 
+func TestGroupScope(t *testing.T) {
+	var calls []string
+
+	middleware := func(name string) Middleware {
+		return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+			return func(ctx *fasthttp.RequestCtx) {
+				calls = append(calls, name)
+				next(ctx)
+			}
+		}
+	}
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		calls = append(calls, "handler")
+	}
+
+	r := New()
+	r.GET("/public", handler)
+
+	s := r.Scope(middleware("auth"), middleware("log"))
+	s.GET("/me", handler)
+	s.POST("/logout", handler)
+	s.Group("/v1").GET("/users", handler)
+	s.Group("/").GET("/settings", handler)
+	s.ServeFiles("/static/{filepath:*}", "./")
+
+	tests := []struct {
+		method string
+		path   string
+		want   []string
+	}{
+		{fasthttp.MethodGet, "/public", []string{"handler"}},
+		{fasthttp.MethodGet, "/me", []string{"auth", "log", "handler"}},
+		{fasthttp.MethodPost, "/logout", []string{"auth", "log", "handler"}},
+		{fasthttp.MethodGet, "/v1/users", []string{"auth", "log", "handler"}},
+		{fasthttp.MethodGet, "/settings", []string{"auth", "log", "handler"}},
+		{fasthttp.MethodGet, "/static/group.go", []string{"auth", "log"}},
+	}
+
+	for _, test := range tests {
+		calls = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != fasthttp.StatusOK {
+			t.Errorf("%s %s - Response status code == %d, want %d", test.method, test.path, status, fasthttp.StatusOK)
+		}
+
+		if !reflect.DeepEqual(calls, test.want) {
+			t.Errorf("%s %s - calls == %v, want %v", test.method, test.path, calls, test.want)
+		}
+	}
+
+	if err := catchPanic(func() { s.GET("/nil", nil) }); err == nil {
+		t.Error("an error was expected with a nil handler")
+	}
+}
+
+func TestGroupAddAndPrependMiddleware(t *testing.T) {
+	middleware := func(name string) Middleware {
+		return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+			return func(ctx *fasthttp.RequestCtx) {
+				ctx.Response.Header.Add("X-Order", name)
+				next(ctx)
+			}
+		}
+	}
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Add("X-Order", "handler")
+	}
+
+	r := New()
+
+	g := r.Group("/api")
+	g.GET("/none", handler)
+
+	g.AddMiddleware(middleware("auth"))
+	g.AddMiddleware(middleware("log"))
+	g.GET("/append", handler)
+
+	g.PrependMiddleware(middleware("recover"), middleware("request-id"))
+	g.GET("/prepend", handler)
+
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/api/none", []string{"handler"}},
+		{"/api/append", []string{"auth", "log", "handler"}},
+		{"/api/prepend", []string{"recover", "request-id", "auth", "log", "handler"}},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		var got []string
+		ctx.Response.Header.VisitAll(func(key, value []byte) {
+			if string(key) == "X-Order" {
+				got = append(got, string(value))
+			}
+		})
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s - X-Order headers == %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestGroupAddNamedMiddleware(t *testing.T) {
+	middleware := func(name string) Middleware {
+		return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+			return func(ctx *fasthttp.RequestCtx) {
+				ctx.Response.Header.Add("X-Order", name)
+				next(ctx)
+			}
+		}
+	}
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Add("X-Order", "handler")
+	}
+
+	r := New()
+	r.MiddlewareWrapper = func(name string, next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.Response.Header.Add("X-Order", "before "+name)
+			next(ctx)
+			ctx.Response.Header.Add("X-Order", "after "+name)
+		}
+	}
+
+	g := r.Group("/api")
+	g.AddNamedMiddleware("auth", middleware("auth"))
+	g.AddMiddleware(middleware("log"))
+	g.AddNamedMiddleware("cache", middleware("cache"))
+	g.GET("/users", handler)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/api/users")
+	r.Handler(ctx)
+
+	var got []string
+	ctx.Response.Header.VisitAll(func(key, value []byte) {
+		if string(key) == "X-Order" {
+			got = append(got, string(value))
+		}
+	})
+
+	want := []string{"before auth", "auth", "log", "before cache", "cache", "handler", "after cache", "after auth"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("X-Order headers == %v, want %v", got, want)
+	}
+
+	if recv := catchPanic(func() { g.AddNamedMiddleware("", middleware("x")) }); recv == nil {
+		t.Error("Expected a panic with an empty middleware name")
+	}
+
+	if recv := catchPanic(func() { g.AddNamedMiddleware("x", nil) }); recv == nil {
+		t.Error("Expected a panic with a nil middleware")
+	}
+}
+
+func TestGroupRegistrationConflict(t *testing.T) {
+	handler := func(_ *fasthttp.RequestCtx) {}
+
+	tests := []struct {
+		register func(r *Router)
+		want     string
+	}{
+		{
+			register: func(r *Router) {
+				r.GET("/foo", handler)
+				r.Scope().GET("/foo", handler)
+			},
+			want: "a handler is already registered for path '/foo' by the router, registering it again by the scope",
+		},
+		{
+			register: func(r *Router) {
+				r.Group("/api").GET("/foo", handler)
+				r.GET("/api/foo", handler)
+			},
+			want: "a handler is already registered for path '/api/foo' by the group '/api', registering it again by the router",
+		},
+		{
+			register: func(r *Router) {
+				r.Group("/api").Group("/v1").HandleWhen(fasthttp.MethodGet, "/foo", handler, func(_ *fasthttp.RequestCtx) bool { return true })
+				r.Group("/api").HandlePriority(fasthttp.MethodGet, "/v1/foo", handler, 1)
+			},
+			want: "a handler is already registered for path '/api/v1/foo' by the group '/api/v1', registering it again by the group '/api'",
+		},
+		{
+			register: func(r *Router) {
+				r.Group("/api").Routes([]Route{{Method: fasthttp.MethodPost, Path: "/foo", Handler: handler}})
+				r.Route(fasthttp.MethodPost, "/api/foo", handler).Done()
+			},
+			want: "a handler is already registered for path '/api/foo' by the group '/api', registering it again by the scope",
+		},
+	}
+
+	for _, test := range tests {
+		recv := catchPanic(func() {
+			test.register(New())
+		})
+
+		if fmt.Sprint(recv) != test.want {
+			t.Errorf("Expected panic %q, got %v", test.want, recv)
+		}
+	}
+}
+
+func TestGroupParamPrefix(t *testing.T) {
+	handler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(fmt.Sprintf("%v %v %v", ctx.UserValue("id"), ctx.UserValue("post"), ctx.UserValue("tab")))
+	}
+
+	r := New()
+
+	posts := r.Group("/users/{id}")
+	posts.GET("/posts", handler)
+	posts.GET("/posts/{post}", handler)
+
+	likes := r.Group("/users/{id}")
+	likes.GET("/likes", handler)
+	likes.GET("/", handler)
+
+	comments := posts.Group("/posts/{post}")
+	comments.GET("/comments", handler)
+
+	settings := r.Group("/settings/{id:[0-9]+}/{tab?}")
+	settings.GET("/edit", handler)
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/users/1/posts", fasthttp.StatusOK, "1 <nil> <nil>"},
+		{"/users/1/posts/2", fasthttp.StatusOK, "1 2 <nil>"},
+		{"/users/1/likes", fasthttp.StatusOK, "1 <nil> <nil>"},
+		{"/users/1/", fasthttp.StatusOK, "1 <nil> <nil>"},
+		{"/users/1/posts/2/comments", fasthttp.StatusOK, "1 2 <nil>"},
+		{"/users/1/comments", fasthttp.StatusNotFound, ""},
+		{"/settings/7/edit", fasthttp.StatusOK, "7 <nil> <nil>"},
+		{"/settings/7/profile/edit", fasthttp.StatusOK, "7 <nil> profile"},
+		{"/settings/7", fasthttp.StatusNotFound, ""},
+		{"/settings/7/profile", fasthttp.StatusNotFound, ""},
+		{"/settings/x/profile/edit", fasthttp.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if ctx.Response.StatusCode() != test.code {
+			t.Errorf("%s - status code == %d, want %d", test.path, ctx.Response.StatusCode(), test.code)
+		} else if test.code == fasthttp.StatusOK && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s - body == %q, want %q", test.path, ctx.Response.Body(), test.body)
+		}
+	}
+
+	recv := catchPanic(func() {
+		likes.GET("/posts", handler)
+	})
+
+	want := "a handler is already registered for path '/users/{id}/posts' by the group '/users/{id}', registering it again by the group '/users/{id}'"
+	if fmt.Sprint(recv) != want {
+		t.Errorf("Expected panic %q, got %v", want, recv)
+	}
+
+	recv = catchPanic(func() {
+		r.Group("/users/{id}").GET("/posts/{postID}", handler)
+	})
+
+	if recv == nil {
+		t.Error("Expected a panic registering a conflicting param name under the group prefix")
+	}
+}
+
+func TestGroupSaveMatchedRoutePath(t *testing.T) {
+	var matchedPath interface{}
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		matchedPath = ctx.UserValue(MatchedRoutePathParam)
+	}
+
+	r := New()
+	r.GET("/public/{name}", handler)
+
+	g := r.Group("/v1")
+	g.SaveMatchedRoutePath = true
+	g.GET("/users/{name}", handler)
+	g.Group("/admin").GET("/users/{name}", handler)
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"/public/gopher", nil},
+		{"/v1/users/gopher", "/v1/users/{name}"},
+		{"/v1/admin/users/gopher", "/v1/admin/users/{name}"},
+	}
+
+	for _, test := range tests {
+		matchedPath = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if matchedPath != test.want {
+			t.Errorf("Path '%s' - matched route path == %v, want %v", test.path, matchedPath, test.want)
+		}
+	}
+
+	r.SaveMatchedRoutePath = true
+	g.GET("/items/{id}", handler)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/v1/items/1")
+	r.Handler(ctx)
+
+	if want := "/v1/items/{id}"; matchedPath != want {
+		t.Errorf("Matched route path == %v, want %v", matchedPath, want)
+	}
+}
+
+func TestGroupSaveMatchedGroupPrefix(t *testing.T) {
+	var matchedPrefix interface{}
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		matchedPrefix = ctx.UserValue(MatchedGroupPrefixParam)
+	}
+
+	r := New()
+	r.GET("/public/{name}", handler)
+	r.Group("/v0").GET("/users/{name}", handler)
+
+	g := r.Group("/v1")
+	g.SaveMatchedGroupPrefix = true
+	g.GET("/users/{name}", handler)
+	g.Group("/admin").GET("/users/{name}", handler)
+
+	tests := []struct {
+		path string
+		want interface{}
+	}{
+		{"/public/gopher", nil},
+		{"/v0/users/gopher", nil},
+		{"/v1/users/gopher", "/v1"},
+		{"/v1/admin/users/gopher", "/v1/admin"},
+	}
+
+	for _, test := range tests {
+		matchedPrefix = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if matchedPrefix != test.want {
+			t.Errorf("Path '%s' - matched group prefix == %v, want %v", test.path, matchedPrefix, test.want)
+		}
+	}
+
+	r.SaveMatchedGroupPrefix = true
+	r.GET("/items/{id}", handler)
+	r.Scope().GET("/scoped/{id}", handler)
+	r.Group("/v2").GET("/items/{id}", handler)
+
+	tests = []struct {
+		path string
+		want interface{}
+	}{
+		{"/items/1", nil},
+		{"/scoped/1", nil},
+		{"/v2/items/1", "/v2"},
+	}
+
+	for _, test := range tests {
+		matchedPrefix = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if matchedPrefix != test.want {
+			t.Errorf("Path '%s' - matched group prefix == %v, want %v", test.path, matchedPrefix, test.want)
+		}
+	}
+}
+
+func TestGroupHandleErr(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	handler := func(ctx *fasthttp.RequestCtx) error {
+		if ctx.QueryArgs().Has("fail") {
+			return errFailed
+		}
+
+		ctx.SetStatusCode(fasthttp.StatusOK)
+
+		return nil
+	}
+
+	var handledErr error
+
+	r := New()
+	r.Group("/default").GETErr("/items", handler)
+
+	g := r.Group("/v1")
+	g.ErrorHandler = func(ctx *fasthttp.RequestCtx, err error) {
+		handledErr = err
+		ctx.SetStatusCode(fasthttp.StatusBadGateway)
+	}
+	g.GETErr("/items", handler)
+	g.POSTErr("/items", handler)
+	g.PUTErr("/items", handler)
+	g.PATCHErr("/items", handler)
+	g.DELETEErr("/items", handler)
+	g.Group("/admin").HandleErr(fasthttp.MethodGet, "/items", handler)
+
+	tests := []struct {
+		method  string
+		uri     string
+		status  int
+		handled bool
+	}{
+		{fasthttp.MethodGet, "/default/items", fasthttp.StatusOK, false},
+		{fasthttp.MethodGet, "/default/items?fail", fasthttp.StatusInternalServerError, false},
+		{fasthttp.MethodGet, "/v1/items", fasthttp.StatusOK, false},
+		{fasthttp.MethodGet, "/v1/items?fail", fasthttp.StatusBadGateway, true},
+		{fasthttp.MethodPost, "/v1/items?fail", fasthttp.StatusBadGateway, true},
+		{fasthttp.MethodPut, "/v1/items?fail", fasthttp.StatusBadGateway, true},
+		{fasthttp.MethodPatch, "/v1/items?fail", fasthttp.StatusBadGateway, true},
+		{fasthttp.MethodDelete, "/v1/items?fail", fasthttp.StatusBadGateway, true},
+		{fasthttp.MethodGet, "/v1/admin/items?fail", fasthttp.StatusBadGateway, true},
+	}
+
+	for _, test := range tests {
+		handledErr = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.uri)
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s %s - status code == %d, want %d", test.method, test.uri, status, test.status)
+		}
+
+		if handled := handledErr == errFailed; handled != test.handled {
+			t.Errorf("%s %s - error handled == %v, want %v", test.method, test.uri, handled, test.handled)
+		}
+	}
+}
+
+func TestGroupNotFound(t *testing.T) {
+	var calls []string
+
+	middleware := func(name string) Middleware {
+		return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+			return func(ctx *fasthttp.RequestCtx) {
+				calls = append(calls, name)
+				next(ctx)
+			}
+		}
+	}
+	notFound := func(name string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			calls = append(calls, name)
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+		}
+	}
+
+	r := New()
+	r.NotFound = notFound("router")
+	r.GET("/api/users", func(_ *fasthttp.RequestCtx) {})
+
+	api := r.Group("/api")
+	api.AddMiddleware(middleware("cors"))
+	api.NotFound(notFound("api"))
+
+	admin := api.Group("/admin")
+	admin.AddMiddleware(middleware("auth"))
+	admin.NotFound(notFound("admin"))
+
+	user := r.Group("/users/{id}")
+	user.GET("/posts", func(_ *fasthttp.RequestCtx) {})
+	user.NotFound(notFound("user"))
+
+	tests := []struct {
+		path  string
+		calls []string
+	}{
+		{"/api", []string{"cors", "api"}},
+		{"/api/unknown", []string{"cors", "api"}},
+		{"/api/admin/unknown", []string{"cors", "auth", "admin"}},
+		{"/apix", []string{"router"}},
+		{"/unknown", []string{"router"}},
+		{"/users/5", []string{"user"}},
+		{"/users/5/unknown", []string{"user"}},
+		{"/users", []string{"router"}},
+	}
+
+	for _, test := range tests {
+		calls = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("Path '%s' - calls == %v, want %v", test.path, calls, test.calls)
+		}
+
+		if status := ctx.Response.StatusCode(); status != fasthttp.StatusNotFound {
+			t.Errorf("Path '%s' - status code == %d, want %d", test.path, status, fasthttp.StatusNotFound)
+		}
+	}
+
+	if err := catchPanic(func() { api.NotFound(nil) }); err == nil {
+		t.Error("Expected a panic with a nil handler")
+	}
+}
+
+func TestGroupMountHandler(t *testing.T) {
+	var path, query string
+
+	mounted := func(ctx *fasthttp.RequestCtx) {
+		path = string(ctx.Path())
+		query = string(ctx.QueryArgs().Peek("debug"))
+	}
+
+	r := New()
+	r.MountHandler("/metrics", mounted)
+
+	g := r.Group("/admin")
+	g.MountHandler("/debug", mounted)
+
+	if err := catchPanic(func() { g.MountHandler("/debug/{name}", mounted) }); err == nil {
+		t.Error("an error was expected when a prefix contains wildcards")
+	}
+
+	if err := catchPanic(func() { g.MountHandler("/nil", nil) }); err == nil {
+		t.Error("an error was expected with a nil handler")
+	}
+
+	tests := []struct {
+		method string
+		uri    string
+		path   string
+	}{
+		{fasthttp.MethodGet, "/metrics/", "/"},
+		{fasthttp.MethodGet, "/metrics/requests", "/requests"},
+		{fasthttp.MethodPost, "/admin/debug/pprof/heap?debug=1", "/pprof/heap"},
+		{fasthttp.MethodDelete, "/admin/debug/pprof/", "/pprof/"},
+	}
+
+	for _, test := range tests {
+		path, query = "", ""
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.uri)
+		r.Handler(ctx)
+
+		if path != test.path {
+			t.Errorf("%s %s - path == %q, want %q", test.method, test.uri, path, test.path)
+		}
+
+		if strings.Contains(test.uri, "?") && query != "1" {
+			t.Errorf("%s %s - query arg == %q, want %q", test.method, test.uri, query, "1")
+		}
+	}
+}
+
+func TestRouterDelegate(t *testing.T) {
+	var path, query string
+
+	app := func(ctx *fasthttp.RequestCtx) {
+		path = string(ctx.Path())
+		query = string(ctx.QueryArgs().Peek("q"))
+	}
+
+	r := New()
+	r.Delegate("/admin", app)
+	r.Group("/v1").Delegate("/legacy/", app)
+
+	tests := []struct {
+		method string
+		uri    string
+		path   string
+	}{
+		{fasthttp.MethodGet, "/admin", "/"},
+		{fasthttp.MethodGet, "/admin/", "/"},
+		{fasthttp.MethodPost, "/admin/users/42?q=1", "/users/42"},
+		{fasthttp.MethodGet, "/admin/a%20b", "/a b"},
+		{fasthttp.MethodPut, "/v1/legacy", "/"},
+		{fasthttp.MethodGet, "/v1/legacy/x/y", "/x/y"},
+	}
+
+	for _, test := range tests {
+		path, query = "", ""
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.uri)
+		r.Handler(ctx)
+
+		restored := string(ctx.Request.URI().PathOriginal())
+
+		if path != test.path {
+			t.Errorf("%s %s - delegate path == %q, want %q", test.method, test.uri, path, test.path)
+		}
+
+		if strings.Contains(test.uri, "?") && query != "1" {
+			t.Errorf("%s %s - query arg == %q, want %q", test.method, test.uri, query, "1")
+		}
+
+		if want, _, _ := strings.Cut(test.uri, "?"); restored != want {
+			t.Errorf("%s %s - restored path == %q, want %q", test.method, test.uri, restored, want)
+		}
+	}
+
+	if err := catchPanic(func() { r.Delegate("/nil", nil) }); err == nil {
+		t.Error("an error was expected with a nil handler")
+	}
+}
+
 func TestGroup_shortcutsAndHandle(t *testing.T) {
 	r := New()
 	g := r.Group("/v1")
@@ -203,4 +852,230 @@ func TestGroup_shortcutsAndHandle(t *testing.T) {
 			t.Errorf("Bad shorcurt")
 		}
 	}
+
+	g2.HandleTimeout(fasthttp.MethodGet, "/timeout", func(_ *fasthttp.RequestCtx) {}, time.Second)
+
+	if err := catchPanic(func() {
+		g2.HandleTimeout(fasthttp.MethodGet, "timeout", func(_ *fasthttp.RequestCtx) {}, time.Second)
+	}); err == nil {
+		t.Error("an error was expected when a path does not begin with slash")
+	}
+
+	if h, _ := r.Lookup(fasthttp.MethodGet, "/v1/foo/timeout", nil); h == nil {
+		t.Errorf("Bad shorcurt")
+	}
+}
+
+func TestGroupRoutes(t *testing.T) {
+	r := New()
+	g := r.Group("/v1").Group("/users")
+
+	hit := ""
+	g.Routes([]Route{
+		{fasthttp.MethodGet, "/", func(_ *fasthttp.RequestCtx) { hit = "list" }},
+		{fasthttp.MethodGet, "/{id}", func(_ *fasthttp.RequestCtx) { hit = "get" }},
+		{fasthttp.MethodPost, "/{id}/edit", func(_ *fasthttp.RequestCtx) { hit = "edit" }},
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		hit    string
+	}{
+		{fasthttp.MethodGet, "/v1/users/", "list"},
+		{fasthttp.MethodGet, "/v1/users/1", "get"},
+		{fasthttp.MethodPost, "/v1/users/1/edit", "edit"},
+	}
+
+	for _, test := range tests {
+		hit = ""
+
+		h, _ := r.Lookup(test.method, test.path, nil)
+		if h == nil {
+			t.Fatalf("Route %s %s not found", test.method, test.path)
+		}
+
+		h(nil)
+
+		if hit != test.hit {
+			t.Errorf("Route %s %s called handler %q, want %q", test.method, test.path, hit, test.hit)
+		}
+	}
+
+	if err := catchPanic(func() {
+		g.Routes([]Route{{fasthttp.MethodGet, "invalid", func(_ *fasthttp.RequestCtx) {}}})
+	}); err == nil {
+		t.Error("an error was expected when a path does not begin with slash")
+	}
+}
+
+func TestGroupFullPath(t *testing.T) {
+	r := New()
+	g := r.Group("/api/v1")
+
+	paths := make([]string, 0, 100)
+
+	for i := 0; i < 100; i++ {
+		path := "/resources-" + strconv.Itoa(i) + "/" + strings.Repeat("x", i)
+		paths = append(paths, path)
+
+		g.GET(path, func(_ *fasthttp.RequestCtx) {})
+	}
+
+	for _, path := range paths {
+		if h, _ := r.Lookup(fasthttp.MethodGet, "/api/v1"+path, nil); h == nil {
+			t.Errorf("Route GET /api/v1%s not found", path)
+		}
+	}
+
+	if got := r.List()[fasthttp.MethodGet]; len(got) != len(paths) || got[0] != "/api/v1"+paths[0] {
+		t.Errorf("Unexpected registered paths after the buffer growth: %v", got[:1])
+	}
+}
+func TestGroupHandler(t *testing.T) {
+	handler := func(body string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(body)
+		}
+	}
+
+	r := New()
+	r.GET("/", handler("root"))
+	r.GET("/apis", handler("apis"))
+	r.GET("/health", handler("health"))
+
+	api := r.Group("/api")
+	api.GET("/users", handler("users"))
+	api.Group("/v1").GET("/items", handler("items"))
+	r.GET("/api/status", handler("status"))
+
+	admin := r.Group("/admin")
+	admin.GET("/", handler("admin"))
+	admin.NotFound(handler("admin not found"))
+
+	user := r.Group("/users/{id:[0-9]+}")
+	user.GET("/posts", handler("posts"))
+	r.GET("/users/{id:[0-9]+}", handler("user"))
+
+	tests := []struct {
+		group *Group
+		path  string
+		code  int
+		body  string
+	}{
+		{api, "/api/users", fasthttp.StatusOK, "users"},
+		{api, "/api/v1/items", fasthttp.StatusOK, "items"},
+		{api, "/api/status", fasthttp.StatusOK, "status"},
+		{api, "/api//users", fasthttp.StatusMovedPermanently, ""},
+		{api, "/api/missing", fasthttp.StatusNotFound, "Not Found"},
+		{api, "/", fasthttp.StatusNotFound, "Not Found"},
+		{api, "/apis", fasthttp.StatusNotFound, "Not Found"},
+		{api, "/health", fasthttp.StatusNotFound, "Not Found"},
+		{admin, "/admin/", fasthttp.StatusOK, "admin"},
+		{admin, "/admin", fasthttp.StatusMovedPermanently, ""},
+		{admin, "/api/users", fasthttp.StatusOK, "admin not found"},
+		{user, "/users/5/posts", fasthttp.StatusOK, "posts"},
+		{user, "/users/5", fasthttp.StatusOK, "user"},
+		{user, "/users/5/missing", fasthttp.StatusNotFound, "Not Found"},
+		{user, "/users", fasthttp.StatusNotFound, "Not Found"},
+		{user, "/api/users", fasthttp.StatusNotFound, "Not Found"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		test.group.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s%s - status code == %d, want %d", test.group.prefix, test.path, status, test.code)
+		}
+
+		if body := string(ctx.Response.Body()); test.body != "" && body != test.body {
+			t.Errorf("%s%s - body == %q, want %q", test.group.prefix, test.path, body, test.body)
+		}
+	}
+}
+
+func TestGroupRoutesDeferSort(t *testing.T) {
+	handler := func(_ *fasthttp.RequestCtx) {}
+
+	r := New()
+	r.GET("/a/{name}", handler)
+
+	r.Group("/a").Routes([]Route{
+		{fasthttp.MethodGet, "/b", handler},
+		{fasthttp.MethodGet, "/b/{id}/c", handler},
+		{fasthttp.MethodGet, "/c", handler},
+	})
+
+	// The invalid routes panic in the middle of the bulk registration
+	_ = catchPanic(func() {
+		r.Group("/x").Routes([]Route{
+			{fasthttp.MethodGet, "/y", handler},
+			{fasthttp.MethodGet, "/y", handler},
+		})
+	})
+
+	r.GET("/a/b/{id}/d", handler)
+
+	if r.deferSort || r.trees[r.methodIndexOf(fasthttp.MethodGet)].DeferSort {
+		t.Fatal("the deferred sort was not disabled after the bulk registration")
+	}
+
+	want := New()
+	for _, path := range []string{"/a/{name}", "/a/b", "/a/b/{id}/c", "/a/c", "/x/y", "/a/b/{id}/d"} {
+		want.GET(path, handler)
+	}
+
+	got := r.trees[r.methodIndexOf(fasthttp.MethodGet)].String()
+	if wantTree := want.trees[want.methodIndexOf(fasthttp.MethodGet)].String(); got != wantTree {
+		t.Errorf("Tree == %s, want %s", got, wantTree)
+	}
+}
+
+func benchmarkGroupRoutes(b *testing.B, register func(g *Group, routes []Route)) {
+	handler := func(_ *fasthttp.RequestCtx) {}
+
+	resources := []string{"users", "posts", "comments", "tags", "files", "teams", "orders", "payments"}
+
+	routes := []Route{
+		{fasthttp.MethodGet, "/", handler},
+		{fasthttp.MethodPost, "/", handler},
+		{fasthttp.MethodGet, "/{id}", handler},
+		{fasthttp.MethodPut, "/{id}", handler},
+		{fasthttp.MethodDelete, "/{id}", handler},
+		{fasthttp.MethodGet, "/{id}/history", handler},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r := New()
+		api := r.Group("/api")
+
+		for _, version := range []string{"/v1", "/v2", "/v3"} {
+			v := api.Group(version)
+
+			for _, resource := range resources {
+				register(v.Group("/"+resource).Group("/admin"), routes)
+			}
+		}
+	}
+}
+
+func BenchmarkGroupRoutes(b *testing.B) {
+	b.Run("Handle", func(b *testing.B) {
+		benchmarkGroupRoutes(b, func(g *Group, routes []Route) {
+			for _, route := range routes {
+				g.Handle(route.Method, route.Path, route.Handler)
+			}
+		})
+	})
+
+	b.Run("Routes", func(b *testing.B) {
+		benchmarkGroupRoutes(b, func(g *Group, routes []Route) {
+			g.Routes(routes)
+		})
+	})
 }
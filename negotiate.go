@@ -0,0 +1,150 @@
+package router
+
+import (
+	"strconv"
+	"strings"
+
+	gstrconv "github.com/savsgio/gotils/strconv"
+	"github.com/valyala/fasthttp"
+)
+
+// mediaTypeOffer is a media type served by a negotiated route
+type mediaTypeOffer struct {
+	typ     string
+	subtype string
+	handler fasthttp.RequestHandler
+}
+
+// newNegotiatedHandler returns a handler which dispatches the requests
+// to the handler of the media type which best matches their Accept header.
+// If none matches, the request is dispatched to the first handler.
+func newNegotiatedHandler(handlers []MediaTypeHandler) fasthttp.RequestHandler {
+	if len(handlers) == 0 {
+		panic("negotiated handlers must not be empty")
+	}
+
+	offers := make([]mediaTypeOffer, len(handlers))
+
+	for i, h := range handlers {
+		if h.Handler == nil {
+			panic("handler must not be nil")
+		}
+
+		typ, subtype, ok := splitMediaType(h.MediaType)
+		if !ok || typ == "*" || subtype == "*" {
+			panic("invalid media type '" + h.MediaType + "'")
+		}
+
+		offers[i] = mediaTypeOffer{
+			typ:     strings.ToLower(typ),
+			subtype: strings.ToLower(subtype),
+			handler: h.Handler,
+		}
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccept)
+
+		i := negotiate(gstrconv.B2S(ctx.Request.Header.Peek(fasthttp.HeaderAccept)), offers)
+		offers[i].handler(ctx)
+	}
+}
+
+// negotiate returns the index of the offer with the highest quality
+// for the given Accept header, preferring the first offers on equal quality.
+// It returns 0 if the header is empty or none of the offers is acceptable.
+func negotiate(accept string, offers []mediaTypeOffer) int {
+	best, bestQuality := 0, 0.0
+
+	if strings.TrimSpace(accept) == "" {
+		return best
+	}
+
+	for i, offer := range offers {
+		if q := acceptQuality(accept, offer); q > bestQuality {
+			best, bestQuality = i, q
+		}
+	}
+
+	return best
+}
+
+// acceptQuality returns the quality value of the most specific media range
+// of the Accept header which matches the offer, or 0 if none matches
+func acceptQuality(accept string, offer mediaTypeOffer) float64 {
+	quality, specificity := 0.0, -1
+
+	for len(accept) > 0 {
+		var mediaRange string
+
+		if i := strings.IndexByte(accept, ','); i > -1 {
+			mediaRange, accept = accept[:i], accept[i+1:]
+		} else {
+			mediaRange, accept = accept, ""
+		}
+
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+
+		typ, subtype, ok := splitMediaType(mediaType)
+		if !ok {
+			continue
+		}
+
+		s := 0
+
+		switch {
+		case typ == "*" && subtype == "*":
+		case !strings.EqualFold(typ, offer.typ):
+			continue
+		case subtype == "*":
+			s = 1
+		case !strings.EqualFold(subtype, offer.subtype):
+			continue
+		default:
+			s = 2
+		}
+
+		if s > specificity {
+			quality, specificity = mediaRangeQuality(params), s
+		}
+	}
+
+	return quality
+}
+
+// mediaRangeQuality returns the value of the q param of a media range,
+// which is 1 if it's missing or invalid
+func mediaRangeQuality(params string) float64 {
+	for len(params) > 0 {
+		var param string
+
+		param, params, _ = strings.Cut(params, ";")
+
+		key, value, _ := strings.Cut(param, "=")
+		if !strings.EqualFold(strings.TrimSpace(key), "q") {
+			continue
+		}
+
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 1
+		}
+
+		return q
+	}
+
+	return 1
+}
+
+// splitMediaType splits the media type into its type and subtype,
+// ignoring its params and surrounding spaces
+func splitMediaType(mediaType string) (string, string, bool) {
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+
+	typ, subtype, ok := strings.Cut(strings.TrimSpace(mediaType), "/")
+	if !ok || typ == "" || subtype == "" {
+		return "", "", false
+	}
+
+	return typ, subtype, true
+}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestRouterHandleNegotiated(t *testing.T) {
+	newHandler := func(body string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(body)
+		}
+	}
+
+	r := New()
+	r.HandleNegotiated(fasthttp.MethodGet, "/report", []MediaTypeHandler{
+		{MediaType: "application/json", Handler: newHandler("json")},
+		{MediaType: "text/html; charset=utf-8", Handler: newHandler("html")},
+		{MediaType: "text/plain", Handler: newHandler("plain")},
+	})
+	r.Group("/v1").HandleNegotiated(fasthttp.MethodGet, "/report", []MediaTypeHandler{
+		{MediaType: "text/csv", Handler: newHandler("csv")},
+	})
+
+	tests := []struct {
+		path   string
+		accept string
+		want   string
+	}{
+		{"/report", "", "json"},
+		{"/report", "application/json", "json"},
+		{"/report", "text/html", "html"},
+		{"/report", "Text/HTML", "html"},
+		{"/report", "text/*", "html"},
+		{"/report", "*/*", "json"},
+		{"/report", "text/html;q=0.5, text/plain", "plain"},
+		{"/report", "text/*;q=0.9, text/plain;q=0.1", "html"},
+		{"/report", "application/json;q=0, */*;q=0.1", "html"},
+		{"/report", "text/html;level=1;q=0.8, application/json;q=0.7", "html"},
+		{"/report", "image/png", "json"},
+		{"/report", "invalid, text/plain", "plain"},
+		{"/v1/report", "text/html", "csv"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		ctx.Request.Header.Set(fasthttp.HeaderAccept, test.accept)
+		r.Handler(ctx)
+
+		if body := string(ctx.Response.Body()); body != test.want {
+			t.Errorf("Path '%s' Accept '%s' - handler == %s, want %s", test.path, test.accept, body, test.want)
+		}
+
+		if vary := string(ctx.Response.Header.Peek(fasthttp.HeaderVary)); vary != fasthttp.HeaderAccept {
+			t.Errorf("Path '%s' Accept '%s' - Vary == %s, want %s", test.path, test.accept, vary, fasthttp.HeaderAccept)
+		}
+	}
+
+	handler := newHandler("")
+
+	panics := []struct {
+		handlers []MediaTypeHandler
+		want     string
+	}{
+		{nil, "negotiated handlers must not be empty"},
+		{[]MediaTypeHandler{{MediaType: "text/html"}}, "handler must not be nil"},
+		{[]MediaTypeHandler{{MediaType: "html", Handler: handler}}, "invalid media type 'html'"},
+		{[]MediaTypeHandler{{MediaType: "text/*", Handler: handler}}, "invalid media type 'text/*'"},
+	}
+
+	for _, test := range panics {
+		recv := catchPanic(func() {
+			r.HandleNegotiated(fasthttp.MethodGet, "/panic", test.handlers)
+		})
+
+		if fmt.Sprint(recv) != test.want {
+			t.Errorf("Expected panic %q, got %v", test.want, recv)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fasthttp/router/radix"
+	"github.com/valyala/fasthttp"
+)
+
+const paramTag = "route"
+
+// ErrParamNotFound is the error of the typed param getters, like ParamInt,
+// when the request has no path param with the given name
+var ErrParamNotFound = errors.New("param not found")
+
+// ParamError is returned by the typed param getters, like ParamInt,
+// when a path param is not found or could not be parsed
+type ParamError struct {
+	// Param is the name of the path param
+	Param string
+
+	// Value is the value of the path param, or nil if it's not found
+	Value interface{}
+
+	// Err is ErrParamNotFound or the parsing error
+	Err error
+}
+
+func (err *ParamError) Error() string {
+	if err.Value == nil {
+		return fmt.Sprintf("could not get param '%s': %v", err.Param, err.Err)
+	}
+
+	return fmt.Sprintf("could not parse param '%s' with value '%v': %v", err.Param, err.Value, err.Err)
+}
+
+func (err *ParamError) Unwrap() error {
+	return err.Err
+}
+
+// BindParamError is returned by BindParams when a path param
+// could not be converted to the type of its struct field
+type BindParamError struct {
+	// Param is the name of the path param
+	Param string
+
+	// Value is the value of the path param
+	Value interface{}
+
+	// Field is the name of the struct field
+	Field string
+
+	// Err is the conversion error
+	Err error
+}
+
+func (err *BindParamError) Error() string {
+	return fmt.Sprintf("could not bind param '%s' with value '%v' into field '%s': %v", err.Param, err.Value, err.Field, err.Err)
+}
+
+func (err *BindParamError) Unwrap() error {
+	return err.Err
+}
+
+// BindParams populates the fields of the struct pointed by dst with the
+// path params of the request, using the `route:"<name>"` tag of each field
+// as the param name.
+//
+// The string, bool, int and uint fields are converted from the param value.
+// The values of other types, like the ones returned by a ParamDecoder,
+// are only assigned to fields of an assignable type.
+// Fields without tag and params not found in the request are skipped.
+//
+// It panics if dst is not a pointer to a struct.
+func BindParams(ctx *fasthttp.RequestCtx, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		panic("dst must be a non-nil pointer to a struct")
+	}
+
+	v = v.Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := field.Tag.Get(paramTag)
+		if name == "" || name == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		value := paramValue(ctx, name)
+		if value == nil {
+			continue
+		}
+
+		if err := setParamField(v.Field(i), value); err != nil {
+			return &BindParamError{Param: name, Value: value, Field: field.Name, Err: err}
+		}
+	}
+
+	return nil
+}
+
+// setParamField sets the param value into the given field,
+// converting it if it's a string
+func setParamField(field reflect.Value, value interface{}) error {
+	rv := reflect.ValueOf(value)
+	if rv.Type().AssignableTo(field.Type()) {
+		field.Set(rv)
+
+		return nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("type %s is not assignable to %s", rv.Type(), field.Type())
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
+
+// requestDataKey is the user value key of the data saved by the router
+// for the request. Since it's not a string, it never collides with the keys
+// of the user values set by a middleware, and it's skipped by
+// ctx.VisitUserValues.
+type requestDataKey struct{}
+
+// requestData is the data saved by the router for the request,
+// under the single user value requestDataKey.
+type requestData struct {
+	// params are the captured path params of the matched route,
+	// in the same order they appear in the route path
+	params radix.Params
+
+	// values are the values of params, decoded by a ParamDecoder if any
+	values []interface{}
+
+	meta RequestMeta
+}
+
+var requestDataPool = sync.Pool{
+	New: func() interface{} {
+		return new(requestData)
+	},
+}
+
+// Close releases the data once the request is done,
+// since fasthttp closes the user values when resetting them.
+func (d *requestData) Close() error {
+	clear(d.params)
+	clear(d.values)
+
+	d.params = d.params[:0]
+	d.values = d.values[:0]
+	d.meta = RequestMeta{}
+
+	requestDataPool.Put(d)
+
+	return nil
+}
+
+// index returns the index of the param with the given key, or -1
+func (d *requestData) index(key string) int {
+	for i := range d.params {
+		if d.params[i].Key == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// getRequestData returns the data saved by the router for the request, if any
+func getRequestData(ctx *fasthttp.RequestCtx) *requestData {
+	d, _ := ctx.UserValue(requestDataKey{}).(*requestData)
+
+	return d
+}
+
+// acquireRequestData returns the data saved by the router for the request,
+// saving a new one if there is none yet
+func acquireRequestData(ctx *fasthttp.RequestCtx) *requestData {
+	if d := getRequestData(ctx); d != nil {
+		return d
+	}
+
+	d := requestDataPool.Get().(*requestData)
+	ctx.SetUserValue(requestDataKey{}, d)
+
+	return d
+}
+
+// getParams returns the handler of the path from the tree like
+// Tree.GetWithParamKeys, capturing the values of the params of the matched
+// route straight into the data saved for the request, which is only saved
+// if the route has params.
+func getParams(tree *radix.Tree, path string, ctx *fasthttp.RequestCtx, steps *[]string) (fasthttp.RequestHandler, bool) {
+	if ctx == nil {
+		handler, _, _, tsr := tree.GetWithParamKeys(path, nil, nil, steps)
+
+		return handler, tsr
+	}
+
+	d := getRequestData(ctx)
+	saved := d != nil
+
+	if !saved {
+		d = requestDataPool.Get().(*requestData)
+	}
+
+	// On a miss, nothing is captured, so the saved params are kept
+	handler, keys, values, tsr := tree.GetWithParamKeys(path, ctx, d.values[:0], steps)
+	if handler == nil {
+		if !saved {
+			requestDataPool.Put(d)
+		}
+
+		return nil, tsr
+	}
+
+	d.setParams(keys, values)
+
+	if !saved {
+		if len(d.params) == 0 {
+			requestDataPool.Put(d)
+		} else {
+			ctx.SetUserValue(requestDataKey{}, d)
+		}
+	}
+
+	return handler, tsr
+}
+
+// setParams saves the values captured by the lookup, aligned with the
+// param keys of the matched route, as its path params
+func (d *requestData) setParams(keys []string, values []interface{}) {
+	d.params = d.params[:0]
+	d.values = values[:0]
+
+	for i, key := range keys {
+		if key == mountPathParam {
+			continue
+		}
+
+		var s string
+
+		switch value := values[i].(type) {
+		case string:
+			s = value
+		case []string:
+			s = strings.Join(value, "/")
+		}
+
+		d.params = append(d.params, radix.Param{Key: key, Value: s})
+		d.values = append(d.values, values[i])
+	}
+
+	// Releases the values skipped or captured by a previous lookup
+	clear(values[len(d.values):cap(values)])
+}
+
+// VisitParams calls fn for each path param of the matched route,
+// in the same order they appear in the route path, with its value
+// decoded by a ParamDecoder if any.
+// The user values set by a middleware are skipped, even if their key
+// is the name of a param, since the params are read from the data
+// saved by the router for the request.
+func VisitParams(ctx *fasthttp.RequestCtx, fn func(key string, value interface{})) {
+	d := getRequestData(ctx)
+	if d == nil {
+		return
+	}
+
+	for i := range d.params {
+		fn(d.params[i].Key, d.values[i])
+	}
+}
+
+// Params returns the path params of the matched route, in the same order
+// they appear in the route path, from the data saved by the router for the
+// request, so a user value set by a middleware with the same key as a param
+// doesn't change them.
+// The values decoded by a ParamDecoder are returned as captured,
+// use VisitParams to get the decoded ones, and the segments of a wildcard
+// like '{path:**}' are joined by '/'.
+func Params(ctx *fasthttp.RequestCtx) radix.Params {
+	d := getRequestData(ctx)
+	if d == nil || len(d.params) == 0 {
+		return nil
+	}
+
+	// The data is reused by the next requests
+	ps := make(radix.Params, len(d.params))
+	copy(ps, d.params)
+
+	return ps
+}
+
+// Meta returns the data saved by the router for the request,
+// apart from the path params.
+func Meta(ctx *fasthttp.RequestCtx) RequestMeta {
+	if d := getRequestData(ctx); d != nil {
+		return d.meta
+	}
+
+	return RequestMeta{}
+}
+
+// unescapeParams decodes the percent-encoded chars of the path params
+// of the matched route, also updating their ctx.UserValue
+func unescapeParams(ctx *fasthttp.RequestCtx) error {
+	d := getRequestData(ctx)
+	if d == nil {
+		return nil
+	}
+
+	for i := range d.params {
+		value := d.params[i].Value
+		if strings.IndexByte(value, '%') == -1 {
+			continue
+		}
+
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return err
+		}
+
+		d.params[i].Value = unescaped
+		d.values[i] = unescaped
+		ctx.SetUserValue(d.params[i].Key, unescaped)
+	}
+
+	return nil
+}
+
+// paramValue returns the value of the path param with the given name,
+// decoded by a ParamDecoder if any, from the data saved by the router for the
+// request, or nil if it's not found
+func paramValue(ctx *fasthttp.RequestCtx, name string) interface{} {
+	d := getRequestData(ctx)
+	if d == nil {
+		return nil
+	}
+
+	if i := d.index(name); i > -1 {
+		return d.values[i]
+	}
+
+	return nil
+}
+
+// Param returns the value of the path param with the given name,
+// and whether it's found as a string, so the values decoded by
+// a ParamDecoder are not returned.
+// Like Params, a user value set by a middleware with the same key
+// as a param doesn't change it.
+func Param(ctx *fasthttp.RequestCtx, name string) (string, bool) {
+	value, ok := paramValue(ctx, name).(string)
+
+	return value, ok
+}
+
+// SetParam sets the value of the path param with the given name.
+// The params are saved as ctx.UserValue once the route is matched, and the
+// ParamDecoders are run, before calling its middleware, so a middleware
+// could normalize a param value (e.g. lowercasing a slug) for the handler.
+// The value is also updated in the params returned by Params, VisitParams
+// and the param getters, or added to them if the param is not found.
+func SetParam(ctx *fasthttp.RequestCtx, name, value string) {
+	var v interface{} = value
+
+	ctx.SetUserValue(name, v)
+
+	d := acquireRequestData(ctx)
+	if i := d.index(name); i > -1 {
+		d.params[i].Value = value
+		d.values[i] = v
+	} else {
+		d.params = append(d.params, radix.Param{Key: name, Value: value})
+		d.values = append(d.values, v)
+	}
+}
+
+// ParamInt returns the value of the path param with the given name as int.
+// The error is a *ParamError, which wraps ErrParamNotFound if the param
+// is not found, or the strconv error if it could not be parsed.
+func ParamInt(ctx *fasthttp.RequestCtx, name string) (int, error) {
+	value, err := paramString(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &ParamError{Param: name, Value: value, Err: err}
+	}
+
+	return n, nil
+}
+
+// ParamUint returns the value of the path param with the given name as uint.
+// The error is a *ParamError, like ParamInt.
+func ParamUint(ctx *fasthttp.RequestCtx, name string) (uint, error) {
+	value, err := paramString(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return 0, &ParamError{Param: name, Value: value, Err: err}
+	}
+
+	return uint(n), nil
+}
+
+// ParamBool returns the value of the path param with the given name as bool,
+// accepting the values of strconv.ParseBool.
+// The error is a *ParamError, like ParamInt.
+func ParamBool(ctx *fasthttp.RequestCtx, name string) (bool, error) {
+	value, err := paramString(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, &ParamError{Param: name, Value: value, Err: err}
+	}
+
+	return b, nil
+}
+
+// paramString returns the string value of the path param to be parsed
+func paramString(ctx *fasthttp.RequestCtx, name string) (string, error) {
+	value := paramValue(ctx, name)
+
+	switch v := value.(type) {
+	case nil:
+		return "", &ParamError{Param: name, Err: ErrParamNotFound}
+	case string:
+		return v, nil
+	default:
+		return "", &ParamError{Param: name, Value: value, Err: fmt.Errorf("type %T is not a string", value)}
+	}
+}
@@ -0,0 +1,387 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fasthttp/router/radix"
+	"github.com/valyala/fasthttp"
+)
+
+func TestBindParams(t *testing.T) {
+	type params struct {
+		ID       int64    `route:"id"`
+		Name     string   `route:"name"`
+		Active   bool     `route:"active"`
+		Page     uint8    `route:"page"`
+		Segments []string `route:"path"`
+		Ignored  string
+		Missing  string `route:"missing"`
+	}
+
+	r := New()
+
+	var got params
+	var bindErr error
+
+	r.GET("/users/{id}/{name}/{active}/{page}/{path:**}", func(ctx *fasthttp.RequestCtx) {
+		bindErr = BindParams(ctx, &got)
+	})
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/users/42/gopher/true/3/a/b")
+	r.Handler(ctx)
+
+	if bindErr != nil {
+		t.Fatalf("Unexpected error: %v", bindErr)
+	}
+
+	want := params{ID: 42, Name: "gopher", Active: true, Page: 3, Segments: []string{"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BindParams() == %+v, want %+v", got, want)
+	}
+}
+
+func TestBindParamsDecoded(t *testing.T) {
+	type params struct {
+		ID int `route:"id"`
+	}
+
+	r := New()
+	r.ParamDecoder("id", func(value string) (interface{}, error) {
+		return strconv.Atoi(value)
+	})
+
+	var got params
+	var bindErr error
+
+	r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {
+		bindErr = BindParams(ctx, &got)
+	})
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/users/7")
+	r.Handler(ctx)
+
+	if bindErr != nil {
+		t.Fatalf("Unexpected error: %v", bindErr)
+	}
+
+	if got.ID != 7 {
+		t.Errorf("ID == %d, want %d", got.ID, 7)
+	}
+}
+
+func TestBindParamsError(t *testing.T) {
+	tests := []struct {
+		value string
+		dst   interface{}
+		field string
+	}{
+		{"abc", &struct {
+			ID int `route:"id"`
+		}{}, "ID"},
+		{"300", &struct {
+			ID uint8 `route:"id"`
+		}{}, "ID"},
+		{"yes!", &struct {
+			ID bool `route:"id"`
+		}{}, "ID"},
+		{"1.5", &struct {
+			ID float64 `route:"id"`
+		}{}, "ID"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		SetParam(ctx, "id", test.value)
+
+		err := BindParams(ctx, test.dst)
+
+		var bindErr *BindParamError
+		if !errors.As(err, &bindErr) {
+			t.Fatalf("Value '%s' - Expected a *BindParamError, got %v", test.value, err)
+		}
+
+		if bindErr.Param != "id" || bindErr.Field != test.field || bindErr.Value != test.value {
+			t.Errorf("Value '%s' - Unexpected error details: %+v", test.value, bindErr)
+		}
+	}
+
+	for _, dst := range []interface{}{nil, struct{}{}, new(string)} {
+		if err := catchPanic(func() { _ = BindParams(new(fasthttp.RequestCtx), dst) }); err == nil {
+			t.Errorf("Expected panic with dst %T", dst)
+		}
+	}
+}
+
+func TestVisitParams(t *testing.T) {
+	type param struct {
+		key   string
+		value interface{}
+	}
+
+	r := New()
+	r.SaveMatchedRoutePath = true
+
+	var got []param
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		got = nil
+
+		ctx.SetUserValue("custom", "value")
+		ctx.SetUserValue("id", "mw")
+
+		VisitParams(ctx, func(key string, value interface{}) {
+			got = append(got, param{key, value})
+		})
+	}
+
+	r.GET("/{version}/users/{id}/{post?}", handler)
+	r.GET("/{version}/files/{name}_{ext}/{filepath:*}", handler)
+	r.GET("/{version}/assets/{path:**}", handler)
+	r.GET("/static", handler)
+
+	tests := []struct {
+		path string
+		want []param
+	}{
+		{"/v1/users/42/7", []param{{"version", "v1"}, {"id", "42"}, {"post", "7"}}},
+		{"/v1/users/42", []param{{"version", "v1"}, {"id", "42"}}},
+		{"/v2/files/doc_pdf/a/b", []param{{"version", "v2"}, {"name", "doc"}, {"ext", "pdf"}, {"filepath", "a/b"}}},
+		{"/v2/assets/css/app.css", []param{{"version", "v2"}, {"path", []string{"css", "app.css"}}}},
+		{"/static", nil},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s - VisitParams() == %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestParamsAndMeta(t *testing.T) {
+	r := New()
+	r.SaveMatchedRoutePath = true
+	r.TrustForwardedHost = true
+	r.ParamDecoder("n", func(value string) (interface{}, error) { return strconv.Atoi(value) })
+
+	var (
+		ps      radix.Params
+		decoded interface{}
+		meta    RequestMeta
+	)
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		// The user values set by a middleware don't change the params
+		ctx.SetUserValue("custom", "value")
+		ctx.SetUserValue("id", "mw")
+		ctx.SetUserValue(MatchedRoutePathParam, "mw")
+
+		ps = Params(ctx)
+		meta = Meta(ctx)
+
+		decoded = nil
+		VisitParams(ctx, func(key string, value interface{}) {
+			if key == "n" {
+				decoded = value
+			}
+		})
+	}
+
+	g := r.Group("/api")
+	g.SaveMatchedGroupPrefix = true
+	g.GET("/{version}/users/{id}/{n}", handler)
+	r.GET("/static", handler)
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/api/v1/users/42/7")
+	ctx.Request.Header.Set(fasthttp.HeaderXForwardedHost, "example.com")
+	r.Handler(ctx)
+
+	if want := (radix.Params{{Key: "version", Value: "v1"}, {Key: "id", Value: "42"}, {Key: "n", Value: "7"}}); !reflect.DeepEqual(ps, want) {
+		t.Errorf("Params() == %v, want %v", ps, want)
+	}
+
+	if decoded != 7 {
+		t.Errorf("VisitParams() decoded value == %v, want %v", decoded, 7)
+	}
+
+	want := RequestMeta{
+		MatchedRoutePath:   "/api/{version}/users/{id}/{n}",
+		MatchedGroupPrefix: "/api",
+		RequestHost:        "example.com",
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("Meta() == %+v, want %+v", meta, want)
+	}
+
+	ctx = new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/static")
+	r.Handler(ctx)
+
+	if ps != nil {
+		t.Errorf("Params() == %v, want nil", ps)
+	}
+
+	ctx = new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetRequestURI("/static")
+	r.MethodNotAllowed = handler
+	r.Handler(ctx)
+
+	if want := []string{fasthttp.MethodGet, fasthttp.MethodOptions}; !reflect.DeepEqual(meta.AllowedMethods, want) {
+		t.Errorf("Meta().AllowedMethods == %v, want %v", meta.AllowedMethods, want)
+	}
+}
+
+func BenchmarkParams(b *testing.B) {
+	r := New()
+	r.GET("/{version}/users/{id}", func(_ *fasthttp.RequestCtx) {})
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/v1/users/42")
+	r.Handler(ctx)
+
+	b.Run("Handler", func(b *testing.B) {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("/v1/users/42")
+
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			r.Handler(ctx)
+			ctx.ResetUserValues()
+		}
+	})
+
+	b.Run("Params", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Params(ctx)
+		}
+	})
+
+	b.Run("UserValue", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ctx.UserValue("version")
+			ctx.UserValue("id")
+		}
+	})
+
+	b.Run("Meta", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Meta(ctx)
+		}
+	})
+}
+
+func TestParamGetters(t *testing.T) {
+	r := New()
+	r.ParamDecoder("decoded", func(value string) (interface{}, error) {
+		return strconv.Atoi(value)
+	})
+	r.GET("/{id}/{neg}/{active}/{name}/{decoded}", func(ctx *fasthttp.RequestCtx) {
+		// Not a param, since it's not captured by the router
+		ctx.SetUserValue("missing", "1")
+	})
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/42/-7/true/gopher/42")
+	r.Handler(ctx)
+
+	if value, ok := Param(ctx, "name"); !ok || value != "gopher" {
+		t.Errorf("Param(name) == %q, %v, want %q, true", value, ok, "gopher")
+	}
+
+	for _, name := range []string{"missing", "decoded"} {
+		if value, ok := Param(ctx, name); ok {
+			t.Errorf("Param(%s) == %q, true, want false", name, value)
+		}
+	}
+
+	if n, err := ParamInt(ctx, "neg"); err != nil || n != -7 {
+		t.Errorf("ParamInt(neg) == %d, %v, want %d", n, err, -7)
+	}
+
+	if n, err := ParamUint(ctx, "id"); err != nil || n != 42 {
+		t.Errorf("ParamUint(id) == %d, %v, want %d", n, err, 42)
+	}
+
+	if b, err := ParamBool(ctx, "active"); err != nil || !b {
+		t.Errorf("ParamBool(active) == %v, %v, want true", b, err)
+	}
+
+	tests := []struct {
+		name     string
+		get      func(ctx *fasthttp.RequestCtx, name string) error
+		notFound bool
+	}{
+		{"missing", func(ctx *fasthttp.RequestCtx, name string) error { _, err := ParamInt(ctx, name); return err }, true},
+		{"missing", func(ctx *fasthttp.RequestCtx, name string) error { _, err := ParamUint(ctx, name); return err }, true},
+		{"missing", func(ctx *fasthttp.RequestCtx, name string) error { _, err := ParamBool(ctx, name); return err }, true},
+		{"name", func(ctx *fasthttp.RequestCtx, name string) error { _, err := ParamInt(ctx, name); return err }, false},
+		{"neg", func(ctx *fasthttp.RequestCtx, name string) error { _, err := ParamUint(ctx, name); return err }, false},
+		{"id", func(ctx *fasthttp.RequestCtx, name string) error { _, err := ParamBool(ctx, name); return err }, false},
+		{"decoded", func(ctx *fasthttp.RequestCtx, name string) error { _, err := ParamInt(ctx, name); return err }, false},
+	}
+
+	for _, test := range tests {
+		err := test.get(ctx, test.name)
+
+		var paramErr *ParamError
+		if !errors.As(err, &paramErr) {
+			t.Fatalf("Param '%s' - Expected a *ParamError, got %v", test.name, err)
+		}
+
+		if paramErr.Param != test.name {
+			t.Errorf("Param '%s' - Unexpected error param: %+v", test.name, paramErr)
+		}
+
+		if errors.Is(err, ErrParamNotFound) != test.notFound {
+			t.Errorf("Param '%s' - errors.Is(%v, ErrParamNotFound) != %v", test.name, err, test.notFound)
+		}
+	}
+
+	var numErr *strconv.NumError
+	if _, err := ParamInt(ctx, "name"); !errors.As(err, &numErr) {
+		t.Errorf("Expected a wrapped *strconv.NumError, got %v", err)
+	}
+}
+
+func TestSetParamMiddleware(t *testing.T) {
+	r := New()
+
+	g := r.Group("/posts")
+	g.AddMiddleware(func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			if slug, ok := Param(ctx, "slug"); ok {
+				SetParam(ctx, "slug", strings.ToLower(slug))
+			}
+
+			next(ctx)
+		}
+	})
+
+	var got []string
+	g.GET("/{slug}", func(ctx *fasthttp.RequestCtx) {
+		VisitParams(ctx, func(key string, value interface{}) {
+			got = append(got, fmt.Sprintf("%s=%v", key, value))
+		})
+	})
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/posts/Hello-World")
+	r.Handler(ctx)
+
+	if want := []string{"slug=hello-world"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Params == %v, want %v", got, want)
+	}
+}
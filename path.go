@@ -1,9 +1,13 @@
 package router
 
 import (
+	"fmt"
+	"slices"
 	"strings"
 
+	"github.com/fasthttp/router/radix"
 	gstrings "github.com/savsgio/gotils/strings"
+	"github.com/valyala/fasthttp"
 )
 
 // cleanPath removes the '.' if it is the last character of the route
@@ -11,74 +15,253 @@ func cleanPath(path string) string {
 	return strings.TrimSuffix(path, ".")
 }
 
+// collapseSlashes replaces the repeated slashes of the path with a single one.
+// It only allocates a new string if the path has repeated slashes.
+func collapseSlashes(path string) string {
+	i := strings.Index(path, "//")
+	if i == -1 {
+		return path
+	}
+
+	buf := make([]byte, i, len(path)-1)
+	copy(buf, path[:i])
+
+	for ; i < len(path); i++ {
+		if path[i] == '/' && len(buf) > 0 && buf[len(buf)-1] == '/' {
+			continue
+		}
+
+		buf = append(buf, path[i])
+	}
+
+	return string(buf)
+}
+
 // getOptionalPaths returns all possible paths when the original path
-// has optional arguments
+// has optional arguments. The optional params at the end of the path could
+// only be omitted along with the ones after them (e.g. '/a/{b?}/{c?}' expands
+// to '/a', '/a/{b}' and '/a/{b}/{c}'), while an optional param followed by
+// a required segment is omitted with its own segment only (e.g.
+// '/users/{id?}/posts' expands to '/users/posts' and '/users/{id}/posts').
 func getOptionalPaths(path string) []string {
 	paths := make([]string, 0)
 
-	start := 0
-walk:
-	for {
-		if start >= len(path) {
-			return paths
+	segments, optional := optionalSegments(path)
+
+	last := -1
+	for i := range segments {
+		if !optional[i] {
+			last = i
+		}
+	}
+
+	if !slices.Contains(optional, true) {
+		return paths
+	}
+
+	// Expand the optional params followed by a required segment
+	prefixes := []string{""}
+
+	for i := 0; i <= last; i++ {
+		n := len(prefixes)
+
+		for j := 0; j < n; j++ {
+			if optional[i] {
+				prefixes = append(prefixes, prefixes[j]+"/"+segments[i])
+			} else {
+				prefixes[j] += "/" + segments[i]
+			}
+		}
+	}
+
+	// Expand the optional params at the end of the path
+	for _, prefix := range prefixes {
+		p := prefix
+
+		for i := last + 1; i <= len(segments); i++ {
+			if i > last+1 {
+				p += "/" + segments[i-1]
+			}
+
+			if p == "" {
+				p = "/"
+			}
+
+			if !gstrings.Include(paths, p) {
+				paths = append(paths, p)
+			}
+
+			if p == "/" {
+				p = ""
+			}
+		}
+	}
+
+	return paths
+}
+
+// optionalSegments splits the path into its segments, without the leading
+// slash, removing the '?' of their optional params, and reports which of
+// them have an optional param
+func optionalSegments(path string) ([]string, []bool) {
+	var segments []string
+	var optional []bool
+
+	segment := make([]byte, 0, len(path))
+	isOptional := false
+	depth := 0
+	hasRegex := false
+
+	for i := 1; i <= len(path); i++ {
+		if i == len(path) || (path[i] == '/' && depth == 0) {
+			segments = append(segments, string(segment))
+			optional = append(optional, isOptional)
+
+			segment = segment[:0]
+			isOptional = false
+
+			continue
 		}
 
-		c := path[start]
-		start++
+		c := path[i]
+
+		switch {
+		case c == '{':
+			if depth == 0 {
+				hasRegex = false
+			}
+
+			depth++
+		case c == '}':
+			depth--
+		case c == ':' && depth == 1:
+			hasRegex = true
+		case c == '?' && depth == 1 && !hasRegex:
+			// The '?' after the ':' belongs to the regex
+			isOptional = true
 
-		if c != '{' {
 			continue
 		}
 
-		newPath := ""
-		hasRegex := false
-		questionMarkIndex := -1
+		segment = append(segment, c)
+	}
+
+	return segments, optional
+}
+
+// stripParamDefaults removes the default values of the optional params
+// (e.g. '{page?=1}' or '{page?=1:[0-9]+}') from the path,
+// returning them apart, or nil if there are none
+func stripParamDefaults(path string) (string, []paramDefault) {
+	if !strings.Contains(path, "?=") {
+		return path, nil
+	}
+
+	var defaults []paramDefault
+
+	buf := make([]byte, 0, len(path))
+	depth := 0
+
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == '?' && depth == 1 && strings.HasPrefix(path[i:], "?="):
+			// The name is between the '{' and the '?', otherwise it's a regex
+			start := strings.LastIndexByte(path[:i], '{') + 1
+			if strings.IndexByte(path[start:i], ':') != -1 {
+				break
+			}
+
+			end := i + 2 + strings.IndexAny(path[i+2:], ":}")
+
+			value := path[i+2 : end]
+			if value == "" || strings.ContainsAny(value, "/{") {
+				panic("invalid default value of param '" + path[start:i] + "' in path '" + path + "'")
+			}
+
+			defaults = append(defaults, paramDefault{key: path[start:i], value: value})
+			buf = append(buf, '?')
+			i = end - 1
 
-		brackets := 0
+			continue
+		}
 
-		for end, c := range []byte(path[start:]) {
-			switch c {
-			case '{':
-				brackets++
+		buf = append(buf, c)
+	}
 
-			case '}':
-				if brackets > 0 {
-					brackets--
-					continue
-				} else if questionMarkIndex == -1 {
-					continue walk
-				}
+	return string(buf), defaults
+}
 
-				end++
-				newPath += path[questionMarkIndex+1 : start+end]
+// withParamDefaults wraps the handler of the given optional path to set the
+// default values of the params which are absent from it
+func withParamDefaults(path string, handler fasthttp.RequestHandler, defaults []paramDefault) fasthttp.RequestHandler {
+	if len(defaults) == 0 {
+		return handler
+	}
 
-				path = path[:questionMarkIndex] + path[questionMarkIndex+1:] // remove '?'
-				paths = append(paths, newPath)
-				start += end - 1
+	keys := radix.PathParamKeys(path)
 
-				continue walk
+	var absent []paramDefault
 
-			case ':':
-				hasRegex = true
+	for _, d := range defaults {
+		if !gstrings.Include(keys, d.key) {
+			absent = append(absent, d)
+		}
+	}
 
-			case '?':
-				if hasRegex {
-					continue
-				}
+	if len(absent) == 0 {
+		return handler
+	}
 
-				questionMarkIndex = start + end
-				newPath += path[:questionMarkIndex]
+	return func(ctx *fasthttp.RequestCtx) {
+		for _, d := range absent {
+			ctx.SetUserValue(d.key, d.value)
+		}
 
-				if len(path[:start-2]) == 0 {
-					// include the root slash because the param is in the first segment
-					paths = append(paths, "/")
+		handler(ctx)
+	}
+}
 
-				} else if !gstrings.Include(paths, path[:start-2]) {
-					// include the path without the wildcard
-					// -2 due to remove the '/' and '{'
-					paths = append(paths, path[:start-2])
-				}
+// ValidatePattern checks if the given route path could be registered,
+// returning a descriptive error otherwise, like a path not beginning with
+// '/', unbalanced braces, params without name, invalid regexes, wildcards
+// not at the end or params not separated by at least 1 char.
+// The path is checked with its optional paths in a throwaway tree,
+// so no router is needed, which is useful for codegen and linters.
+// The conflicts with other routes are not checked.
+func ValidatePattern(path string) (err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			if rcvErr, ok := rcv.(error); ok {
+				err = rcvErr
+			} else {
+				err = fmt.Errorf("%v", rcv)
 			}
 		}
+	}()
+
+	validatePath(path)
+
+	if !radix.BalancedBraces(path) {
+		panic("unbalanced braces in path '" + path + "'")
 	}
+
+	path, _ = stripParamDefaults(path)
+
+	paths := getOptionalPaths(path)
+	if len(paths) == 0 {
+		paths = append(paths, path)
+	}
+
+	tree := radix.New()
+	for _, p := range paths {
+		tree.Add(p, func(_ *fasthttp.RequestCtx) {})
+	}
+
+	return nil
 }
@@ -1,8 +1,10 @@
 package router
 
 import (
+	"fmt"
 	"reflect"
 	"runtime"
+	gostrings "strings"
 	"testing"
 
 	"github.com/savsgio/gotils/strings"
@@ -86,6 +88,26 @@ func Test_cleanPath(t *testing.T) {
 	}
 }
 
+func Test_collapseSlashes(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "/"},
+		{"//", "/"},
+		{"/users/42", "/users/42"},
+		{"/users//42", "/users/42"},
+		{"/a///b", "/a/b"},
+		{"//a//b//", "/a/b/"},
+	}
+
+	for _, test := range tests {
+		if got := collapseSlashes(test.path); got != test.want {
+			t.Errorf("collapseSlashes(%q) == %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
 func TestGetOptionalPath(t *testing.T) {
 	handler := func(ctx *fasthttp.RequestCtx) {
 		ctx.SetStatusCode(fasthttp.StatusOK)
@@ -96,14 +118,18 @@ func TestGetOptionalPath(t *testing.T) {
 		tsr     bool
 		handler fasthttp.RequestHandler
 	}{
-		{"/show/{name}", false, handler},
-		{"/show/{name}/", true, nil},
-		{"/show/{name}/{surname}", false, handler},
-		{"/show/{name}/{surname}/", true, nil},
-		{"/show/{name}/{surname}/at", false, handler},
-		{"/show/{name}/{surname}/at/", true, nil},
-		{"/show/{name}/{surname}/at/{address}", false, handler},
-		{"/show/{name}/{surname}/at/{address}/", true, nil},
+		// The optional params followed by a required segment are omitted
+		// with their own segment only
+		{"/show/{name}", false, nil},
+		{"/show/{name}/{surname}", false, nil},
+		{"/show/{name}/{surname}/at", false, nil},
+		{"/show/{name}/at/{id}", false, handler},
+		{"/show/{name}/at/{id}/", true, nil},
+		{"/show/{name}/at/{id}/{phone:.*}", false, handler},
+		{"/show/{name}/{surname}/at/{id}", false, handler},
+		{"/show/{name}/{surname}/at/{id}/{phone:.*}", false, handler},
+		{"/show/{name}/at/{address}/{id}", false, handler},
+		{"/show/{name}/at/{address}/{id}/{phone:.*}", false, handler},
 		{"/show/{name}/{surname}/at/{address}/{id}", false, handler},
 		{"/show/{name}/{surname}/at/{address}/{id}/", true, nil},
 		{"/show/{name}/{surname}/at/{address}/{id}/{phone:.*}", false, handler},
@@ -137,6 +163,15 @@ func TestGetOptionalPath(t *testing.T) {
 		{"/{filepath:^(?!api).*}", nil},
 		{"/static/{filepath?:^(?!api).*}", []string{"/static", "/static/{filepath:^(?!api).*}"}},
 		{"/show/{name?}", []string{"/show", "/show/{name}"}},
+		{"/users/{id?}/posts", []string{"/users/posts", "/users/{id}/posts"}},
+		{"/users/{id?:[0-9]+}/posts", []string{"/users/posts", "/users/{id:[0-9]+}/posts"}},
+		{"/a/{b?}/{c?}", []string{"/a", "/a/{b}", "/a/{b}/{c}"}},
+		{"/{a?}/x/{b?}", []string{"/x", "/x/{b}", "/{a}/x", "/{a}/x/{b}"}},
+		{"/users/{id?:[0-9]+}/{name?:[a-z]{2,3}}", []string{"/users", "/users/{id:[0-9]+}", "/users/{id:[0-9]+}/{name:[a-z]{2,3}}"}},
+		{"/colors/{name?:colou?r}", []string{"/colors", "/colors/{name:colou?r}"}},
+		// The '?' after the ':' belongs to the regex, so the param isn't optional
+		{"/users/{id:[0-9]+?}", nil},
+		{"/users/{id:[0-9]?}/posts", nil},
 	}
 
 	for _, test := range tests {
@@ -153,3 +188,160 @@ func TestGetOptionalPath(t *testing.T) {
 		}
 	}
 }
+
+func TestRouterOptionalRegexParams(t *testing.T) {
+	r := New()
+	r.GET("/users/{id?:[0-9]+}/posts", func(_ *fasthttp.RequestCtx) {})
+
+	tests := []struct {
+		path  string
+		found bool
+		id    interface{}
+	}{
+		{"/users/posts", true, nil},
+		{"/users/12/posts", true, "12"},
+		{"/users", false, nil},
+		{"/users/12", false, nil},
+		{"/users/ab/posts", false, nil},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+
+		if h, _ := r.Lookup(fasthttp.MethodGet, test.path, ctx); (h != nil) != test.found {
+			t.Errorf("Path '%s' - found == %v, want %v", test.path, h != nil, test.found)
+		}
+
+		if id := ctx.UserValue("id"); id != test.id {
+			t.Errorf("Path '%s' - id == %v, want %v", test.path, id, test.id)
+		}
+	}
+}
+
+func Test_stripParamDefaults(t *testing.T) {
+	tests := []struct {
+		path     string
+		want     string
+		defaults []paramDefault
+	}{
+		{"/list/{page?}", "/list/{page?}", nil},
+		{"/list/{page?=1}", "/list/{page?}", []paramDefault{{"page", "1"}}},
+		{"/list/{page?=1:[0-9]{1,3}}", "/list/{page?:[0-9]{1,3}}", []paramDefault{{"page", "1"}}},
+		{"/{lang?=en}/list/{page?=1}", "/{lang?}/list/{page?}", []paramDefault{{"lang", "en"}, {"page", "1"}}},
+		{"/a/{x:ab?=c}", "/a/{x:ab?=c}", nil},
+	}
+
+	for _, test := range tests {
+		got, defaults := stripParamDefaults(test.path)
+		if got != test.want || !reflect.DeepEqual(defaults, test.defaults) {
+			t.Errorf("stripParamDefaults(%q) == %q, %v, want %q, %v", test.path, got, defaults, test.want, test.defaults)
+		}
+	}
+
+	for _, path := range []string{"/list/{page?=}", "/list/{page?=}/x", "/list/{page?=a{b}"} {
+		if recv := catchPanic(func() { stripParamDefaults(path) }); recv == nil {
+			t.Errorf("Path '%s' - Expected a panic", path)
+		}
+	}
+}
+
+func TestRouterParamDefaults(t *testing.T) {
+	r := New()
+	r.GET("/list/{page?=1:[0-9]+}", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(fmt.Sprint(ctx.UserValue("page")))
+	})
+	r.GET("/docs/{lang?=en}/{section?=intro}", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(fmt.Sprint(ctx.UserValue("lang"), " ", ctx.UserValue("section")))
+	})
+
+	v2 := r.CloneGroup(r.Scope(), "/v2", nil)
+	v2.GET("/other", func(_ *fasthttp.RequestCtx) {})
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/list", fasthttp.StatusOK, "1"},
+		{"/list/3", fasthttp.StatusOK, "3"},
+		{"/list/x", fasthttp.StatusNotFound, ""},
+		{"/docs", fasthttp.StatusOK, "en intro"},
+		{"/docs/es", fasthttp.StatusOK, "es intro"},
+		{"/docs/es/setup", fasthttp.StatusOK, "es setup"},
+		{"/v2/list", fasthttp.StatusOK, "1"},
+		{"/v2/docs/fr", fasthttp.StatusOK, "fr intro"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if ctx.Response.StatusCode() != test.code {
+			t.Errorf("%s - status code == %d, want %d", test.path, ctx.Response.StatusCode(), test.code)
+		} else if test.code == fasthttp.StatusOK && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s - body == %q, want %q", test.path, ctx.Response.Body(), test.body)
+		}
+	}
+
+	want := []RouteInfo{
+		{Method: fasthttp.MethodGet, Path: "/list/{page?:[0-9]+}", Paths: []string{"/list", "/list/{page:[0-9]+}"}},
+	}
+
+	if routes := r.Export(); !reflect.DeepEqual(routes[:1], want) {
+		t.Errorf("Export() == %+v, want %+v", routes[:1], want)
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	valid := []string{
+		"/",
+		"/users",
+		"/users/",
+		"/users/{id}",
+		"/users/{id}/posts/{post}",
+		"/users/{id:[0-9]+}",
+		"/users/{id:[0-9]{1,3}}",
+		"/users/{id?}",
+		"/users/{id?:[0-9]+}/posts",
+		"/list/{page?=1}",
+		"/list/{page?=1:[0-9]+}",
+		"/files/{filepath:*}",
+		"/files/{filepath:**}",
+		"/files/{dir}/{filepath:*}",
+		"/{name}.{ext}",
+		"/{a}-{b}-{c}",
+	}
+
+	for _, path := range valid {
+		if err := ValidatePattern(path); err != nil {
+			t.Errorf("ValidatePattern(%q) == %v, want nil", path, err)
+		}
+	}
+
+	invalid := []struct {
+		path string
+		err  string
+	}{
+		{"", "path must begin with '/'"},
+		{"users", "path must begin with '/'"},
+		{"/users/{id", "unbalanced braces"},
+		{"/users/id}", "unbalanced braces"},
+		{"/users/{id:[0-9]{1,3}", "unbalanced braces"},
+		{"/users/{}", "non-empty name"},
+		{"/users/{:[0-9]+}", "non-empty name"},
+		{"/users/{id:[0-9}", "error parsing regexp"},
+		{"/files/{filepath:*}/x", "wildcard routes are only allowed at the end of the path"},
+		{"/files{filepath:*}", "no / before wildcard"},
+		{"/{a}{b}", "the wildcards must be separated by at least 1 char"},
+		{"/list/{page?=}", "invalid default value of param 'page'"},
+		{"/list/{page?=a/b}", "invalid default value of param 'page'"},
+	}
+
+	for _, test := range invalid {
+		err := ValidatePattern(test.path)
+		if err == nil || !gostrings.Contains(err.Error(), test.err) {
+			t.Errorf("ValidatePattern(%q) == %v, want an error containing %q", test.path, err, test.err)
+		}
+	}
+}
@@ -6,3 +6,7 @@ const (
 	param
 	wildcard
 )
+
+// stackBufSize is the size of the buffer in which Tree.Serve captures
+// the params for a ParamHandler, which grows if the route has more params
+const stackBufSize = 8
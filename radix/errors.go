@@ -25,3 +25,35 @@ func (err radixError) Error() string {
 func newRadixError(msg string, params ...interface{}) radixError {
 	return radixError{msg, params}
 }
+
+// ConflictError is the error raised when a new path conflicts with
+// an existing wild path or wildcard
+type ConflictError struct {
+	// Segment is the conflicting segment of the new path
+	Segment string
+
+	// NewPath is the full path which is being registered
+	NewPath string
+
+	// Wildcard is the existing wild path or wildcard
+	Wildcard string
+
+	// ExistingPrefix is the full prefix of the existing wild path or wildcard
+	ExistingPrefix string
+
+	msg string
+}
+
+func (err *ConflictError) Error() string {
+	return fmt.Sprintf(err.msg, err.Segment, err.NewPath, err.Wildcard, err.ExistingPrefix)
+}
+
+func newConflictError(msg, segment, newPath, wildcard, existingPrefix string) *ConflictError {
+	return &ConflictError{
+		Segment:        segment,
+		NewPath:        newPath,
+		Wildcard:       wildcard,
+		ExistingPrefix: existingPrefix,
+		msg:            msg,
+	}
+}
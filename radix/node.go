@@ -1,7 +1,10 @@
 package radix
 
 import (
+	"maps"
+	"math"
 	"sort"
+	"strconv"
 	"strings"
 
 	gstrings "github.com/savsgio/gotils/strings"
@@ -9,6 +12,117 @@ import (
 	"github.com/valyala/fasthttp"
 )
 
+// match checks if the handler is registered and its predicate,
+// if any, matches the request.
+// Without request ctx, the predicate is not evaluated.
+func (h *nodeHandler) match(ctx *fasthttp.RequestCtx) bool {
+	return h != nil && (h.predicate == nil || ctx == nil || h.predicate(ctx))
+}
+
+// fixable checks if a path could be fixed to the route of the handler
+// by FindCaseInsensitivePath
+func (h *nodeHandler) fixable() bool {
+	return h != nil && !h.noFixedPath
+}
+
+// saveParams saves the values of the given param keys for the request.
+// Without values, the whole path segment is the value of the only key.
+// For a ParamHandler, or without request, the values are appended to ps
+// in reverse order, since the params are captured from the end of the path,
+// otherwise they are saved as ctx.UserValue, and also appended to vs
+// in reverse order if not nil.
+func (h *nodeHandler) saveParams(ctx *fasthttp.RequestCtx, ps *Params, vs *[]interface{}, keys, values []string, segment string) {
+	if ps != nil && (h.paramHandler != nil || ctx == nil) {
+		if values == nil {
+			*ps = append(*ps, Param{Key: keys[0], Value: segment})
+			return
+		}
+
+		for i := len(keys) - 1; i >= 0; i-- {
+			*ps = append(*ps, Param{Key: keys[i], Value: values[i]})
+		}
+
+		return
+	}
+
+	if values == nil {
+		saveUserValue(ctx, vs, keys[0], gstrings.Copy(segment))
+		return
+	}
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		saveUserValue(ctx, vs, keys[i], values[i])
+	}
+}
+
+// saveWildcard saves the value of the wildcard for the request,
+// like saveParams. In ps, the value is always the raw path.
+func (h *nodeHandler) saveWildcard(ctx *fasthttp.RequestCtx, ps *Params, vs *[]interface{}, w *nodeWildcard, path string) {
+	if ps != nil && (h.paramHandler != nil || ctx == nil) {
+		*ps = append(*ps, Param{Key: w.paramKey, Value: path})
+		return
+	}
+
+	saveUserValue(ctx, vs, w.paramKey, w.value(path))
+}
+
+// saveUserValue saves the value as ctx.UserValue, also appending it to vs
+// if not nil, so the value is only boxed once
+func saveUserValue(ctx *fasthttp.RequestCtx, vs *[]interface{}, key string, value interface{}) {
+	ctx.SetUserValue(key, value)
+
+	if vs != nil {
+		*vs = append(*vs, value)
+	}
+}
+
+// paramMatchers returns the matchers of the handler for the given
+// param keys, aligned with them, or nil if there are no matchers
+func (h *nodeHandler) paramMatchers(keys []string) []Matcher {
+	if h == nil || len(h.matchers) == 0 {
+		return nil
+	}
+
+	var matchers []Matcher
+
+	for i, key := range keys {
+		if m := h.matchers[key]; m != nil {
+			if matchers == nil {
+				matchers = make([]Matcher, len(keys))
+			}
+
+			matchers[i] = m
+		}
+	}
+
+	return matchers
+}
+
+// getPriority returns the priority of the handler,
+// or the lowest one if it's not registered
+func (h *nodeHandler) getPriority() int {
+	if h == nil {
+		return math.MinInt
+	}
+
+	return h.priority
+}
+
+// matrixKey returns the matrix param key of the route segment at the given
+// index of the request path, which is the last one for the segments
+// captured by a trailing wildcard or spanning param
+func (h *nodeHandler) matrixKey(index int) string {
+	if len(h.matrixKeys) == 0 {
+		return ""
+	}
+
+	if index >= len(h.matrixKeys) {
+		index = len(h.matrixKeys) - 1
+	}
+
+	return h.matrixKeys[index]
+}
+
 func newNode(path string) *node {
 	return &node{
 		nType: static,
@@ -16,28 +130,54 @@ func newNode(path string) *node {
 	}
 }
 
-// conflict raises a panic with some details
+// value returns the user value of the wildcard for the given path.
+// With segments, the path is split by '/' into a []string,
+// skipping the empty segments.
+func (n *nodeWildcard) value(path string) interface{} {
+	path = gstrings.Copy(path)
+
+	if !n.segments {
+		return path
+	}
+
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+}
+
+// conflict returns a conflict error with some details
 func (n *nodeWildcard) conflict(path, fullPath string) error {
 	prefix := fullPath[:strings.LastIndex(fullPath, path)] + n.path
 
-	return newRadixError(errWildcardConflict, path, fullPath, n.path, prefix)
+	return newConflictError(errWildcardConflict, path, fullPath, n.path, prefix)
 }
 
-// wildPathConflict raises a panic with some details
+// contains checks if the value is a number in the range
+func (r *paramRange) contains(value string) bool {
+	if r.float {
+		v, err := strconv.ParseFloat(value, 64)
+
+		return err == nil && v >= r.minFloat && v <= r.maxFloat
+	}
+
+	v, err := strconv.ParseInt(value, 10, 64)
+
+	return err == nil && v >= r.minInt && v <= r.maxInt
+}
+
+// wildPathConflict returns a conflict error with some details
 func (n *node) wildPathConflict(path, fullPath string) error {
 	pathSeg := strings.SplitN(path, "/", 2)[0]
 	prefix := fullPath[:strings.LastIndex(fullPath, path)] + n.path
 
-	return newRadixError(errWildPathConflict, pathSeg, fullPath, n.path, prefix)
+	return newConflictError(errWildPathConflict, pathSeg, fullPath, n.path, prefix)
 }
 
 // clone clones the current node in a new pointer
-func (n node) clone() *node {
+func (n *node) clone() *node {
 	cloneNode := new(node)
 	cloneNode.nType = n.nType
 	cloneNode.path = n.path
 	cloneNode.tsr = n.tsr
-	cloneNode.handler = n.handler
+	cloneNode.handler.Store(n.handler.Load())
 
 	if len(n.children) > 0 {
 		cloneNode.children = make([]*node, len(n.children))
@@ -51,8 +191,9 @@ func (n node) clone() *node {
 		cloneNode.wildcard = &nodeWildcard{
 			path:     n.wildcard.path,
 			paramKey: n.wildcard.paramKey,
-			handler:  n.wildcard.handler,
+			segments: n.wildcard.segments,
 		}
+		cloneNode.wildcard.handler.Store(n.wildcard.handler.Load())
 	}
 
 	if len(n.paramKeys) > 0 {
@@ -61,6 +202,11 @@ func (n node) clone() *node {
 	}
 
 	cloneNode.paramRegex = n.paramRegex
+	cloneNode.paramRanges = n.paramRanges
+	cloneNode.paramMatchers = n.paramMatchers
+	cloneNode.paramEnum = n.paramEnum
+	cloneNode.paramSpans = n.paramSpans
+	cloneNode.priority = n.priority
 
 	return cloneNode
 }
@@ -71,14 +217,81 @@ func (n *node) split(i int) {
 	cloneChild.path = cloneChild.path[i:]
 	cloneChild.paramKeys = nil
 	cloneChild.paramRegex = nil
+	cloneChild.paramRanges = nil
+	cloneChild.paramMatchers = nil
+	cloneChild.paramEnum = nil
+	cloneChild.paramSpans = false
 
 	n.path = n.path[:i]
-	n.handler = nil
+	n.handler.Store(nil)
 	n.tsr = false
 	n.wildcard = nil
 	n.children = append(n.children[:0], cloneChild)
 }
 
+func (n *node) findEndIndex(path string) int {
+	if n.paramRanges != nil {
+		// The values are needed to check their ranges
+		end, _ := n.findEndIndexAndValues(path)
+
+		return end
+	}
+
+	index := n.paramRegex.FindStringIndex(path)
+	if len(index) == 0 || index[0] != 0 {
+		return -1
+	}
+
+	return index[1]
+}
+
+// matchValues checks the param values with the matchers of the node,
+// returning the values replaced by the matched ones.
+// Without values, the whole path segment is the value of the only key.
+func (n *node) matchValues(segment string, values []string) ([]string, bool) {
+	if values == nil {
+		values = []string{segment}
+	}
+
+	for i, m := range n.paramMatchers {
+		if m == nil || i >= len(values) {
+			continue
+		}
+
+		value, ok := m.Match(values[i])
+		if !ok {
+			return nil, false
+		}
+
+		values[i] = gstrings.Copy(value)
+	}
+
+	return values, true
+}
+
+// matchEnum checks if the param value is one of the enum values of the node
+func (n *node) matchEnum(value string) bool {
+	_, ok := n.paramEnum[value]
+
+	return ok
+}
+
+// matchSegment checks if the param values of the segment
+// match the matchers of the node
+func (n *node) matchSegment(segment string) bool {
+	var values []string
+
+	if n.paramRegex != nil {
+		if _, values = n.findEndIndexAndValues(segment); values == nil {
+			return false
+		}
+	}
+
+	_, ok := n.matchValues(segment, values)
+
+	return ok
+}
+
 func (n *node) findEndIndexAndValues(path string) (int, []string) {
 	index := n.paramRegex.FindStringSubmatchIndex(path)
 	if len(index) == 0 || index[0] != 0 {
@@ -101,15 +314,31 @@ func (n *node) findEndIndexAndValues(path string) (int, []string) {
 		i++
 	}
 
+	for i, r := range n.paramRanges {
+		if r != nil && i < len(values) && !r.contains(values[i]) {
+			return -1, nil
+		}
+	}
+
 	return end, values
 }
 
-func (n *node) setHandler(handler fasthttp.RequestHandler, fullPath string) (*node, error) {
-	if n.handler != nil || n.tsr {
+// setHandler sets the handler of the node and, unless noTSR, the TSR
+// (trailing slash redirect) of its path with a trailing slash.
+// A node which only recommends a TSR takes the handler, since the path with
+// and without the trailing slash are registered as distinct routes then.
+func (n *node) setHandler(handler *nodeHandler, fullPath string, noTSR bool) (*node, error) {
+	if n.handler.Load() != nil {
 		return n, newRadixError(errSetHandler, fullPath)
 	}
 
-	n.handler = handler
+	n.handler.Store(handler)
+	n.tsr = false
+
+	if noTSR {
+		return n, nil
+	}
+
 	foundTSR := false
 
 	// Set TSR in method
@@ -120,7 +349,8 @@ func (n *node) setHandler(handler fasthttp.RequestHandler, fullPath string) (*no
 			continue
 		}
 
-		child.tsr = true
+		// The path with the trailing slash could be a distinct route
+		child.tsr = child.handler.Load() == nil
 		foundTSR = true
 
 		break
@@ -140,11 +370,11 @@ func (n *node) setHandler(handler fasthttp.RequestHandler, fullPath string) (*no
 	return n, nil
 }
 
-func (n *node) insert(path, fullPath string, handler fasthttp.RequestHandler) (*node, error) {
+func (n *node) insert(path, fullPath string, handler *nodeHandler, noTSR bool, maxRegexSize int) (*node, error) {
 	end := segmentEndIndex(path, true)
 	child := newNode(path)
 
-	wp := findWildPath(path, fullPath)
+	wp := findWildPath(path, fullPath, maxRegexSize)
 	if wp != nil {
 		j := end
 		if wp.start > 0 {
@@ -156,7 +386,7 @@ func (n *node) insert(path, fullPath string, handler fasthttp.RequestHandler) (*
 		if wp.start > 0 {
 			n.children = append(n.children, child)
 
-			return child.insert(path[j:], fullPath, handler)
+			return child.insert(path[j:], fullPath, handler, noTSR, maxRegexSize)
 		}
 
 		switch wp.pType {
@@ -166,6 +396,17 @@ func (n *node) insert(path, fullPath string, handler fasthttp.RequestHandler) (*
 			child.nType = wp.pType
 			child.paramKeys = wp.keys
 			child.paramRegex = wp.regex
+			child.paramSpans = wp.spans && len(path) == wp.end
+
+			for _, r := range wp.ranges {
+				if r != nil {
+					child.paramRanges = wp.ranges
+					break
+				}
+			}
+
+			child.paramMatchers = handler.paramMatchers(wp.keys)
+			child.paramEnum = wp.enum
 		case wildcard:
 			if len(path) == end && n.path[len(n.path)-1] != '/' {
 				return nil, newRadixError(errWildcardSlash, fullPath)
@@ -175,7 +416,7 @@ func (n *node) insert(path, fullPath string, handler fasthttp.RequestHandler) (*
 
 			if n.path != "/" && n.path[len(n.path)-1] == '/' {
 				n.split(len(n.path) - 1)
-				n.tsr = true
+				n.tsr = !noTSR
 
 				n = n.children[0]
 			}
@@ -191,8 +432,9 @@ func (n *node) insert(path, fullPath string, handler fasthttp.RequestHandler) (*
 			n.wildcard = &nodeWildcard{
 				path:     wp.path,
 				paramKey: wp.keys[0],
-				handler:  handler,
+				segments: wp.segments,
 			}
+			n.wildcard.handler.Store(handler)
 
 			return n, nil
 		}
@@ -202,13 +444,25 @@ func (n *node) insert(path, fullPath string, handler fasthttp.RequestHandler) (*
 		if len(path) > 0 {
 			n.children = append(n.children, child)
 
-			return child.insert(path, fullPath, handler)
+			return child.insert(path, fullPath, handler, noTSR, maxRegexSize)
 		}
 	}
 
-	child.handler = handler
+	child.handler.Store(handler)
 	n.children = append(n.children, child)
 
+	if noTSR {
+		if child.nType == param && strings.HasSuffix(child.path, "/") {
+			// The param is only matched until the end of its segment,
+			// so the trailing slash must be its child anyway
+			child.split(len(child.path) - 1)
+
+			return child.children[0], nil
+		}
+
+		return child, nil
+	}
+
 	if child.path == "/" {
 		// Add TSR when split a edge and the remain path to insert is "/"
 		n.tsr = true
@@ -224,10 +478,11 @@ func (n *node) insert(path, fullPath string, handler fasthttp.RequestHandler) (*
 	return child, nil
 }
 
-// add adds the handler to node for the given path
-func (n *node) add(path, fullPath string, handler fasthttp.RequestHandler) (*node, error) {
+// add adds the handler to node for the given path.
+// If noTSR, no TSR (trailing slash redirect) is recorded for the path.
+func (n *node) add(path, fullPath string, handler *nodeHandler, strict, noTSR bool, maxRegexSize int) (*node, error) {
 	if len(path) == 0 {
-		return n.setHandler(handler, fullPath)
+		return n.setHandler(handler, fullPath, noTSR)
 	}
 
 	for _, child := range n.children {
@@ -243,13 +498,20 @@ func (n *node) add(path, fullPath string, handler fasthttp.RequestHandler) (*nod
 			}
 
 			if len(path) > i {
-				return child.add(path[i:], fullPath, handler)
+				return child.add(path[i:], fullPath, handler, strict, noTSR, maxRegexSize)
 			}
 		case param:
-			wp := findWildPath(path, fullPath)
+			wp := findWildPath(path, fullPath, maxRegexSize)
 
 			isParam := wp.start == 0 && wp.pType == param
-			hasHandler := child.handler != nil || handler == nil
+			hasHandler := child.handler.Load() != nil || handler == nil
+			matchers := handler.paramMatchers(wp.keys)
+
+			if isParam && (child.path == wp.path || child.path == wp.path+"/") &&
+				!equalMatchers(child.paramMatchers, matchers) {
+				// The same param could not be matched differently
+				return nil, child.wildPathConflict(path, fullPath)
+			}
 
 			if len(path) == wp.end && isParam && hasHandler {
 				// The current segment is a param and it's duplicated
@@ -257,60 +519,124 @@ func (n *node) add(path, fullPath string, handler fasthttp.RequestHandler) (*nod
 					return child, newRadixError(errSetHandler, fullPath)
 				}
 
-				return nil, child.wildPathConflict(path, fullPath)
+				// A regex or matcher constrained param could live with an
+				// unconstrained one, since the constrained one is tried first.
+				// The same param with a trailing slash is a distinct route,
+				// which takes the place of its TSR.
+				childConstrained := child.paramRegex != nil || child.paramEnum != nil || child.paramMatchers != nil
+				slashed := path == child.path+"/"
+
+				if !slashed && childConstrained == (wp.regex != nil || wp.enum != nil || matchers != nil) {
+					return nil, child.wildPathConflict(path, fullPath)
+				}
+			}
+
+			if len(path) == wp.end && isParam && handler != nil && wp.spans && child.path == wp.path {
+				// The route ends with the param, so it could span the rest of the path
+				child.paramSpans = true
 			}
 
 			if len(path) > i {
 				if child.path == wp.path {
-					return child.add(path[i:], fullPath, handler)
+					return child.add(path[i:], fullPath, handler, strict, noTSR, maxRegexSize)
+				}
+
+				if wp.pType == param && !equalStrings(child.paramKeys, wp.keys) {
+					// Sibling params with different names followed by the same path
+					// are ambiguous, unless they are distinguished by their regex,
+					// range, enum or matchers.
+					// In strict mode, they must be named equally anyway.
+					ambiguous := equalRegex(child.paramRegex, wp.regex) &&
+						equalRanges(child.paramRanges, wp.ranges) &&
+						maps.Equal(child.paramEnum, wp.enum) &&
+						equalMatchers(child.paramMatchers, matchers) &&
+						child.hasRoute(path[len(wp.path):])
+
+					if strict || ambiguous {
+						return nil, child.wildPathConflict(path, fullPath)
+					}
 				}
 
-				return n.insert(path, fullPath, handler)
+				// Look for the param in the other children,
+				// otherwise it's inserted as a new child
+				continue
 			}
 		}
 
-		if path == "/" {
+		if path == "/" && !noTSR && n.handler.Load() == nil {
 			n.tsr = true
 		}
 
-		return child.setHandler(handler, fullPath)
+		return child.setHandler(handler, fullPath, noTSR)
+	}
+
+	return n.insert(path, fullPath, handler, noTSR, maxRegexSize)
+}
+
+// hasRoute checks if a route is registered with the given path
+// under the node, comparing the path with the node paths literally
+func (n *node) hasRoute(path string) bool {
+	if path == "" {
+		return n.handler.Load() != nil
+	} else if n.wildcard != nil && n.wildcard.path == path {
+		return true
+	}
+
+	for _, child := range n.children {
+		if strings.HasPrefix(path, child.path) && child.hasRoute(path[len(child.path):]) {
+			return true
+		}
 	}
 
-	return n.insert(path, fullPath, handler)
+	return false
 }
 
-func (n *node) getFromChild(path string, ctx *fasthttp.RequestCtx) (fasthttp.RequestHandler, bool) {
+func (n *node) getFromChild(path string, ctx *fasthttp.RequestCtx, ps *Params, vs *[]interface{}, steps *[]string, fold bool) (*nodeHandler, bool) {
 	for _, child := range n.children {
+		traceStep(steps, child.nType, child.path)
+
 		switch child.nType {
 		case static:
 
 			// Checks if the first byte is equal
 			// It's faster than compare strings
-			if path[0] != child.path[0] {
+			if path[0] != child.path[0] && (!fold || lowerASCII(path[0]) != child.path[0]) {
 				continue
 			}
 
 			if len(path) > len(child.path) {
-				if path[:len(child.path)] != child.path {
+				if !equalStatic(path[:len(child.path)], child.path, fold) {
 					continue
 				}
 
-				h, tsr := child.getFromChild(path[len(child.path):], ctx)
+				h, tsr := child.getFromChild(path[len(child.path):], ctx, ps, vs, steps, fold)
 				if h != nil || tsr {
 					return h, tsr
 				}
-			} else if path == child.path {
+			} else if equalStatic(path, child.path, fold) {
+				h := child.handler.Load()
+
 				switch {
-				case child.tsr:
+				case child.tsr && (child.wildcard == nil || !child.wildcard.handler.Load().match(ctx)):
+					// The wildcard, with an empty value, takes precedence
+					// over the TSR of a shorter route (e.g. '/{dir}/{path:*}')
 					return nil, true
-				case child.handler != nil:
-					return child.handler, false
+				case h.match(ctx):
+					return h, false
 				case child.wildcard != nil:
-					if ctx != nil {
-						ctx.SetUserValue(child.wildcard.paramKey, "")
+					if wh := child.wildcard.handler.Load(); wh.match(ctx) {
+						if ctx != nil || ps != nil {
+							wh.saveWildcard(ctx, ps, vs, child.wildcard, "")
+						}
+
+						return wh, false
 					}
 
-					return child.wildcard.handler, false
+					// The route predicates don't match, so try another child
+					continue
+				case h != nil:
+					// The route predicates don't match, so try another child
+					continue
 				}
 
 				return nil, false
@@ -318,43 +644,18 @@ func (n *node) getFromChild(path string, ctx *fasthttp.RequestCtx) (fasthttp.Req
 
 		case param:
 			end := segmentEndIndex(path, false)
-			values := []string{gstrings.Copy(path[:end])}
 
-			if child.paramRegex != nil {
-				end, values = child.findEndIndexAndValues(path[:end])
-				if end == -1 {
-					continue
+			h, tsr := child.getFromParam(path, end, ctx, ps, vs, steps, fold)
+			if h == nil && !tsr && child.paramSpans {
+				// The regex could match the rest of the path,
+				// once the routes which go on are not matched
+				if spanEnd := spanEndIndex(path); spanEnd > end {
+					h, tsr = child.getFromParam(path, spanEnd, ctx, ps, vs, steps, fold)
 				}
 			}
 
-			if len(path) > end {
-				h, tsr := child.getFromChild(path[end:], ctx)
-				if tsr {
-					return nil, tsr
-				} else if h != nil {
-					if ctx != nil {
-						for i, key := range child.paramKeys {
-							ctx.SetUserValue(key, values[i])
-						}
-					}
-
-					return h, false
-				}
-
-			} else if len(path) == end {
-				switch {
-				case child.tsr:
-					return nil, true
-				case child.handler == nil:
-					// try another child
-					continue
-				case ctx != nil:
-					for i, key := range child.paramKeys {
-						ctx.SetUserValue(key, values[i])
-					}
-				}
-
-				return child.handler, false
+			if h != nil || tsr {
+				return h, tsr
 			}
 
 		default:
@@ -363,11 +664,77 @@ func (n *node) getFromChild(path string, ctx *fasthttp.RequestCtx) (fasthttp.Req
 	}
 
 	if n.wildcard != nil {
-		if ctx != nil {
-			ctx.SetUserValue(n.wildcard.paramKey, gstrings.Copy(path))
+		traceStep(steps, wildcard, n.wildcard.path)
+
+		if h := n.wildcard.handler.Load(); h.match(ctx) {
+			if ctx != nil || ps != nil {
+				h.saveWildcard(ctx, ps, vs, n.wildcard, path)
+			}
+
+			return h, false
 		}
+	}
 
-		return n.wildcard.handler, false
+	return nil, false
+}
+
+// getFromParam returns the handler of the path from the param node,
+// matching its param until the given end of the path, like getFromChild
+func (n *node) getFromParam(path string, end int, ctx *fasthttp.RequestCtx, ps *Params, vs *[]interface{}, steps *[]string, fold bool) (*nodeHandler, bool) {
+	// The values are only needed to be saved in the request ctx.
+	// Without regex, the value is the whole path segment.
+	var values []string
+
+	if n.paramRegex != nil {
+		if ctx != nil || ps != nil || n.paramMatchers != nil {
+			end, values = n.findEndIndexAndValues(path[:end])
+		} else {
+			end = n.findEndIndex(path[:end])
+		}
+
+		if end == -1 {
+			return nil, false
+		}
+	}
+
+	if n.paramEnum != nil && !n.matchEnum(path[:end]) {
+		return nil, false
+	}
+
+	if n.paramMatchers != nil {
+		var ok bool
+
+		if values, ok = n.matchValues(path[:end], values); !ok {
+			return nil, false
+		}
+	}
+
+	if len(path) > end {
+		h, tsr := n.getFromChild(path[end:], ctx, ps, vs, steps, fold)
+		if tsr {
+			return nil, tsr
+		} else if h != nil {
+			if ctx != nil || ps != nil {
+				h.saveParams(ctx, ps, vs, n.paramKeys, values, path[:end])
+			}
+
+			return h, false
+		}
+
+	} else if len(path) == end {
+		h := n.handler.Load()
+
+		switch {
+		case n.tsr:
+			return nil, true
+		case !h.match(ctx):
+			// The route predicates don't match
+			return nil, false
+		case ctx != nil || ps != nil:
+			h.saveParams(ctx, ps, vs, n.paramKeys, values, path[:end])
+		}
+
+		return h, false
 	}
 
 	return nil, false
@@ -402,7 +769,7 @@ func (n *node) find(path string, buf *bytebufferpool.ByteBuffer) (bool, bool) {
 			return true, true
 		}
 
-		if n.handler != nil {
+		if n.handler.Load().fixable() {
 			return true, false
 		} else {
 			bufferRemoveString(buf, n.path)
@@ -424,34 +791,119 @@ func (n *node) findFromChild(path string, buf *bytebufferpool.ByteBuffer) (bool,
 		case param:
 			end := segmentEndIndex(path, false)
 
-			if child.paramRegex != nil {
-				end, _ = child.findEndIndexAndValues(path[:end])
-				if end == -1 {
-					continue
+			found, tsr := child.findFromParam(path, end, buf)
+			if !found && child.paramSpans {
+				if spanEnd := spanEndIndex(path); spanEnd > end {
+					found, tsr = child.findFromParam(path, spanEnd, buf)
 				}
 			}
 
-			buf.WriteString(path[:end])
+			if found {
+				return found, tsr
+			}
 
-			if len(path) > end {
-				found, tsr := child.findFromChild(path[end:], buf)
-				if found {
-					return found, tsr
-				}
+		default:
+			panic("invalid node type")
+		}
+	}
 
-			} else if len(path) == end {
-				if child.tsr {
-					buf.WriteByte('/')
+	if n.wildcard != nil && n.wildcard.handler.Load().fixable() {
+		buf.WriteString(path)
 
-					return true, true
-				}
+		return true, false
+	}
+
+	return false, false
+}
+
+// findFromParam finds the path from the param node, matching its param
+// until the given end of the path, like findFromChild
+func (n *node) findFromParam(path string, end int, buf *bytebufferpool.ByteBuffer) (bool, bool) {
+	if n.paramRegex != nil {
+		end = n.findEndIndex(path[:end])
+		if end == -1 {
+			return false, false
+		}
+	}
+
+	if n.paramEnum != nil && !n.matchEnum(path[:end]) {
+		return false, false
+	}
+
+	if n.paramMatchers != nil && !n.matchSegment(path[:end]) {
+		return false, false
+	}
+
+	buf.WriteString(path[:end])
+
+	if len(path) > end {
+		found, tsr := n.findFromChild(path[end:], buf)
+		if found {
+			return found, tsr
+		}
+
+	} else if len(path) == end {
+		if n.tsr {
+			buf.WriteByte('/')
+
+			return true, true
+		}
+
+		if n.handler.Load().fixable() {
+			return true, false
+		}
+	}
+
+	bufferRemoveString(buf, path[:end])
+
+	return false, false
+}
+
+// visit calls fn with the handlers of the routes which end at the node,
+// also the wildcard one with an empty value
+func (n *node) visit(fn func(*nodeHandler)) {
+	if h := n.handler.Load(); h != nil {
+		fn(h)
+	}
+
+	if n.wildcard != nil {
+		if h := n.wildcard.handler.Load(); h != nil {
+			fn(h)
+		}
+	}
+}
+
+// visitFromChild calls fn with the handler of each route which matches
+// the path under the node. Unlike getFromChild, it doesn't stop at the
+// first matched route, so the routes shadowed by another one are visited too.
+func (n *node) visitFromChild(path string, fold bool, fn func(*nodeHandler)) {
+	for _, child := range n.children {
+		switch child.nType {
+		case static:
+			if path[0] != child.path[0] && (!fold || lowerASCII(path[0]) != child.path[0]) {
+				continue
+			}
 
-				if child.handler != nil {
-					return true, false
+			if len(path) > len(child.path) {
+				if equalStatic(path[:len(child.path)], child.path, fold) {
+					child.visitFromChild(path[len(child.path):], fold, fn)
 				}
+			} else if equalStatic(path, child.path, fold) {
+				child.visit(fn)
 			}
 
-			bufferRemoveString(buf, path[:end])
+		case param:
+			end := segmentEndIndex(path, false)
+			child.visitFromParam(path, end, fold, fn)
+
+			// Only the routes which end with the param could span the rest
+			// of the path, without its trailing slash like getFromChild
+			if child.paramSpans && len(path) > end && spanEndIndex(path) == len(path) {
+				if h := child.handler.Load(); h != nil && child.findEndIndex(path) == len(path) &&
+					(child.paramMatchers == nil || child.matchSegment(path)) {
+					fn(h)
+				}
+			}
 
 		default:
 			panic("invalid node type")
@@ -459,21 +911,153 @@ func (n *node) findFromChild(path string, buf *bytebufferpool.ByteBuffer) (bool,
 	}
 
 	if n.wildcard != nil {
-		buf.WriteString(path)
+		if h := n.wildcard.handler.Load(); h != nil {
+			fn(h)
+		}
+	}
+}
 
-		return true, false
+// visitFromParam calls fn with the handler of each route which matches
+// the path from the param node, matching its param until the given end
+// of the path, like visitFromChild
+func (n *node) visitFromParam(path string, end int, fold bool, fn func(*nodeHandler)) {
+	if n.paramRegex != nil {
+		end = n.findEndIndex(path[:end])
+		if end == -1 {
+			return
+		}
 	}
 
-	return false, false
+	if n.paramEnum != nil && !n.matchEnum(path[:end]) {
+		return
+	}
+
+	if n.paramMatchers != nil && !n.matchSegment(path[:end]) {
+		return
+	}
+
+	if len(path) > end {
+		n.visitFromChild(path[end:], fold, fn)
+	} else if h := n.handler.Load(); h != nil {
+		fn(h)
+	}
+}
+
+// traceStep records the node compared during a traced lookup
+func traceStep(steps *[]string, nType nodeType, path string) {
+	if steps != nil {
+		*steps = append(*steps, nType.String()+" '"+path+"'")
+	}
+}
+
+// String returns the name of the node type
+func (t nodeType) String() string {
+	switch t {
+	case root:
+		return "root"
+	case static:
+		return "static"
+	case param:
+		return "param"
+	case wildcard:
+		return "wildcard"
+	default:
+		return "unknown"
+	}
+}
+
+// dump writes the node and their children into the buffer,
+// one line per node indented by its depth
+func (n *node) dump(buf *bytebufferpool.ByteBuffer, depth int) {
+	buf.WriteString(strings.Repeat("  ", depth))
+	buf.WriteString(n.path)
+	buf.WriteString(" [")
+	buf.WriteString(n.nType.String())
+
+	if len(n.paramKeys) > 0 {
+		buf.WriteString(" keys=")
+		buf.WriteString(strings.Join(n.paramKeys, ","))
+	}
+
+	if n.paramRegex != nil {
+		buf.WriteString(" regex=")
+		buf.WriteString(n.paramRegex.String())
+	}
+
+	if n.paramEnum != nil {
+		values := make([]string, 0, len(n.paramEnum))
+		for value := range n.paramEnum {
+			values = append(values, value)
+		}
+
+		sort.Strings(values)
+
+		buf.WriteString(" enum=")
+		buf.WriteString(strings.Join(values, ","))
+	}
+
+	if n.paramMatchers != nil {
+		buf.WriteString(" matcher")
+	}
+
+	n.handler.Load().dump(buf)
+
+	if n.tsr {
+		buf.WriteString(" tsr")
+	}
+
+	buf.WriteString("]\n")
+
+	for _, child := range n.children {
+		child.dump(buf, depth+1)
+	}
+
+	if n.wildcard != nil {
+		buf.WriteString(strings.Repeat("  ", depth+1))
+		buf.WriteString(n.wildcard.path)
+		buf.WriteString(" [")
+		buf.WriteString(wildcard.String())
+		buf.WriteString(" keys=")
+		buf.WriteString(n.wildcard.paramKey)
+
+		if n.wildcard.segments {
+			buf.WriteString(" segments")
+		}
+
+		n.wildcard.handler.Load().dump(buf)
+		buf.WriteString("]\n")
+	}
 }
 
-// sort sorts the current node and their children
+// dump writes the handler flags into the buffer
+func (h *nodeHandler) dump(buf *bytebufferpool.ByteBuffer) {
+	if h == nil {
+		return
+	}
+
+	buf.WriteString(" handler")
+
+	if h.predicate != nil {
+		buf.WriteString(" predicate")
+	}
+}
+
+// sort sorts the current node and their children, computing the priority
+// of the node as the highest priority of its routes
 func (n *node) sort() {
+	n.priority = n.handler.Load().getPriority()
+
+	if n.wildcard != nil {
+		n.priority = max(n.priority, n.wildcard.handler.Load().getPriority())
+	}
+
 	for _, child := range n.children {
 		child.sort()
+
+		n.priority = max(n.priority, child.priority)
 	}
 
-	sort.Sort(n)
+	sort.Stable(n)
 }
 
 // Len returns the total number of children the node has
@@ -494,5 +1078,23 @@ func (n *node) Less(i, j int) bool {
 		return false
 	}
 
+	// The regex-constrained params must be tried before the unconstrained ones,
+	// as well as the enum ones
+	iRegex := n.children[i].paramRegex != nil || n.children[i].paramEnum != nil
+	jRegex := n.children[j].paramRegex != nil || n.children[j].paramEnum != nil
+
+	if iRegex != jRegex {
+		return iRegex
+	}
+
+	// And so the matcher-constrained ones
+	if iMatcher, jMatcher := n.children[i].paramMatchers != nil, n.children[j].paramMatchers != nil; iMatcher != jMatcher {
+		return iMatcher
+	}
+
+	if n.children[i].priority != n.children[j].priority {
+		return n.children[i].priority > n.children[j].priority
+	}
+
 	return len(n.children[i].children) > len(n.children[j].children)
 }
@@ -237,6 +237,99 @@ func TestTreeChildConflict(t *testing.T) {
 	testRoutes(t, routes)
 }
 
+func TestTreeRegexParamPriority(t *testing.T) {
+	orders := [][]string{
+		{"/api/{id:[0-9]+}", "/api/{name}", "/api/{name}/posts"},
+		{"/api/{name}/posts", "/api/{name}", "/api/{id:[0-9]+}"},
+	}
+
+	for _, routes := range orders {
+		tree := New()
+
+		for _, route := range routes {
+			tree.Add(route, fakeHandler(route))
+		}
+
+		checkRequests(t, tree, testRequests{
+			{"/api/42", false, "/api/{id:[0-9]+}", map[string]interface{}{"id": "42"}},
+			{"/api/gopher", false, "/api/{name}", map[string]interface{}{"name": "gopher"}},
+			{"/api/gopher/posts", false, "/api/{name}/posts", map[string]interface{}{"name": "gopher"}},
+			{"/api/42/posts", false, "/api/{name}/posts", map[string]interface{}{"name": "42"}},
+		})
+	}
+
+	testRoutes(t, []testRoute{
+		{"/api/{id:[0-9]+}", false},
+		{"/api/{name}", false},
+		{"/api/{user}", true},
+		{"/api/{key:[a-z]+}", true},
+	})
+}
+
+func TestTreeAmbiguousParams(t *testing.T) {
+	routes := []testRoute{
+		{"/users/{name}/jobs", false},
+		{"/users/{status}/proc", false},
+		{"/users/{id}/jobs", true},
+		{"/users/{id:[0-9]+}/jobs", false},
+		{"/users/{key:[0-9]+}/jobs", true},
+		{"/users/{name}/{job}", false},
+		{"/users/{other}/{job}", true},
+		{"/files/{dir}/{filepath:*}", false},
+		{"/files/{other}/{filepath:*}", true},
+		{"/files/{other}/index", false},
+	}
+
+	testRoutes(t, routes)
+
+	tree := New()
+	tree.Add("/users/{name}/jobs", fakeHandler("/users/{name}/jobs"))
+
+	err := tree.TryAdd("/users/{id}/jobs", fakeHandler("/users/{id}/jobs"))
+	if _, ok := err.(*ConflictError); !ok {
+		t.Errorf("Expected a conflict error, got %v", err)
+	}
+}
+
+func TestTreeStrictWildcardNames(t *testing.T) {
+	tests := []struct {
+		routes   []string
+		conflict bool
+	}{
+		{[]string{"/a/{x}", "/a/{y}/b"}, true},
+		{[]string{"/a/{y}/b", "/a/{x}"}, true},
+		{[]string{"/a/{x}/c", "/a/{y}/b"}, true},
+		{[]string{"/a/{id:[0-9]+}", "/a/{name}"}, true},
+		{[]string{"/a/{x}-{y}", "/a/{x}-{z}/b"}, true},
+		{[]string{"/a/{x}", "/a/{x}/b"}, false},
+		{[]string{"/a/{x:[0-9]+}", "/a/{x}"}, false},
+		{[]string{"/a/{x}/c", "/a/{x}/b/{y}", "/b/{y}"}, false},
+		{[]string{"/a/{x}", "/a/{filepath:*}"}, false},
+	}
+
+	for _, test := range tests {
+		for _, strict := range []bool{true, false} {
+			tree := New()
+			tree.StrictWildcardNames = strict
+
+			var err interface{}
+			for _, route := range test.routes {
+				if err = catchPanic(func() { tree.Add(route, fakeHandler(route)) }); err != nil {
+					break
+				}
+			}
+
+			if wantConflict := strict && test.conflict; wantConflict {
+				if _, ok := err.(*ConflictError); !ok {
+					t.Errorf("Routes %v (strict: %v) - Expected a conflict error, got %v", test.routes, strict, err)
+				}
+			} else if err != nil {
+				t.Errorf("Routes %v (strict: %v) - Unexpected panic: %v", test.routes, strict, err)
+			}
+		}
+	}
+}
+
 func TestTreeDuplicatePath(t *testing.T) {
 	tree := New()
 
@@ -440,6 +533,25 @@ func TestTreeRootTrailingSlashRedirect(t *testing.T) {
 	} else if tsr {
 		t.Errorf("expected no TSR recommendation")
 	}
+
+	tree = New()
+	tree.Add("/", fakeHandler("/"))
+
+	handler, tsr = tree.Get("//", nil)
+	if handler != nil {
+		t.Fatalf("non-nil handler")
+	} else if !tsr {
+		t.Errorf("expected TSR recommendation")
+	}
+
+	tree.Add("//", fakeHandler("//"))
+
+	handler, tsr = tree.Get("//", nil)
+	if handler == nil {
+		t.Fatalf("nil handler")
+	} else if tsr {
+		t.Errorf("expected no TSR recommendation")
+	}
 }
 
 func TestTreeFindCaseInsensitivePath(t *testing.T) {
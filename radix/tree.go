@@ -2,8 +2,12 @@ package radix
 
 import (
 	"errors"
+	"fmt"
+	"slices"
 	"strings"
 
+	"github.com/savsgio/gotils/strconv"
+	gstrings "github.com/savsgio/gotils/strings"
 	"github.com/valyala/bytebufferpool"
 	"github.com/valyala/fasthttp"
 )
@@ -21,10 +25,151 @@ func New() *Tree {
 //
 // WARNING: Not concurrency-safe!
 func (t *Tree) Add(path string, handler fasthttp.RequestHandler) {
+	t.AddWhen(path, handler, nil)
+}
+
+// AddWhen adds a node with the given handle to the path, which only matches
+// when the given predicate returns true for the request.
+// If the predicate doesn't match, the lookup continues as if the route were
+// not registered, so other routes could match the request.
+// A nil predicate always matches.
+//
+// WARNING: Not concurrency-safe!
+func (t *Tree) AddWhen(path string, handler fasthttp.RequestHandler, predicate Predicate) {
+	t.AddWithPriority(path, handler, predicate, 0)
+}
+
+// AddWithPriority adds a node with the given handle to the path like AddWhen,
+// with the given priority to match the requests.
+// The children of a node with the same type are tried by the highest priority
+// of their routes first, so a route could take precedence over another one
+// differing in a param at the same position. The default priority is 0.
+//
+// WARNING: Not concurrency-safe!
+func (t *Tree) AddWithPriority(path string, handler fasthttp.RequestHandler, predicate Predicate, priority int) {
+	if handler == nil {
+		panic("nil handler")
+	}
+
+	nHandler := &nodeHandler{
+		handler:   handler,
+		predicate: predicate,
+		priority:  priority,
+	}
+
+	t.add(path, nHandler)
+}
+
+// AddExact adds a node with the given handle to the path like AddWithPriority,
+// which is only matched by its exact path. No TSR (trailing slash redirect)
+// is recommended for it, and FindCaseInsensitivePath doesn't fix any path
+// to it, so the requests which differ in case or in the trailing slash
+// are not found.
+//
+// WARNING: Not concurrency-safe!
+func (t *Tree) AddExact(path string, handler fasthttp.RequestHandler, predicate Predicate, priority int) {
+	if handler == nil {
+		panic("nil handler")
+	}
+
+	nHandler := &nodeHandler{
+		handler:     handler,
+		predicate:   predicate,
+		priority:    priority,
+		exact:       true,
+		noFixedPath: true,
+	}
+
+	t.add(path, nHandler)
+}
+
+// AddWithoutFixedPath adds a node with the given handle to the path like
+// AddWithPriority, but FindCaseInsensitivePath doesn't fix any path to it,
+// so the requests which differ in case are not found.
+// Unlike AddExact, the TSR (trailing slash redirect) is still recommended.
+//
+// WARNING: Not concurrency-safe!
+func (t *Tree) AddWithoutFixedPath(path string, handler fasthttp.RequestHandler, predicate Predicate, priority int) {
+	if handler == nil {
+		panic("nil handler")
+	}
+
+	nHandler := &nodeHandler{
+		handler:     handler,
+		predicate:   predicate,
+		priority:    priority,
+		noFixedPath: true,
+	}
+
+	t.add(path, nHandler)
+}
+
+// AddWithMatchers adds a node with the given handle to the path like
+// AddWithPriority, whose params are matched by the given matchers by key,
+// in addition to their regex if any. The routes with the same param at the
+// same position of the tree must have the same matchers.
+//
+// WARNING: Not concurrency-safe!
+func (t *Tree) AddWithMatchers(path string, handler fasthttp.RequestHandler, predicate Predicate, priority int, matchers map[string]Matcher) {
+	if handler == nil {
+		panic("nil handler")
+	}
+
+	keys := getParamKeys(path)
+
+	for key, m := range matchers {
+		if m == nil {
+			panicf("nil matcher for param '%s' in path '%s'", key, path)
+		} else if !gstrings.Include(keys, key) || isWildcardKey(path, key) {
+			panicf("matcher param '%s' not found in path '%s'", key, path)
+		}
+	}
+
+	nHandler := &nodeHandler{
+		handler:   handler,
+		predicate: predicate,
+		priority:  priority,
+		matchers:  matchers,
+	}
+
+	t.add(path, nHandler)
+}
+
+// AddParamHandler adds a node with the given params-aware handle to the path.
+// When the route is served by Tree.Serve, its params are passed to the handle
+// directly, instead of being saved as ctx.UserValue.
+// When it's returned by Tree.Get, the handle receives the params saved
+// as ctx.UserValue, so it could be used as a regular handle too.
+//
+// WARNING: Not concurrency-safe!
+func (t *Tree) AddParamHandler(path string, handler ParamHandler) {
+	if handler == nil {
+		panic("nil handler")
+	}
+
+	nHandler := &nodeHandler{
+		paramHandler: handler,
+	}
+
+	keys := getParamKeys(path)
+	nHandler.handler = func(ctx *fasthttp.RequestCtx) {
+		handler(ctx, userValueParams(ctx, keys))
+	}
+
+	t.add(path, nHandler)
+}
+
+func (t *Tree) add(path string, nHandler *nodeHandler) {
 	if !strings.HasPrefix(path, "/") {
 		panicf("path must begin with '/' in path '%s'", path)
-	} else if handler == nil {
-		panic("nil handler")
+	}
+
+	if !balancedBraces(path) {
+		panicf("unbalanced braces in path '%s'", path)
+	}
+
+	if t.Lowercase {
+		path = LowercaseStatic(path)
 	}
 
 	fullPath := path
@@ -38,17 +183,27 @@ func (t *Tree) Add(path string, handler fasthttp.RequestHandler) {
 		path = path[i:]
 	}
 
-	n, err := t.root.add(path, fullPath, handler)
+	nHandler.path = fullPath
+
+	if keys := getParamKeys(fullPath); len(keys) > 0 {
+		nHandler.paramKeys = keys
+	}
+
+	if t.MatrixParams {
+		nHandler.matrixKeys = matrixSegmentKeys(fullPath)
+	}
+
+	n, err := t.root.add(path, fullPath, nHandler, t.StrictWildcardNames, t.DisableTSR || nHandler.exact, t.MaxRegexProgramSize)
 	if err != nil {
 		var radixErr radixError
 
 		if errors.As(err, &radixErr) && t.Mutable && !n.tsr {
 			switch radixErr.msg {
 			case errSetHandler:
-				n.handler = handler
+				n.handler.Store(nHandler)
 				return
 			case errSetWildcardHandler:
-				n.wildcard.handler = handler
+				n.wildcard.handler.Store(nHandler)
 				return
 			}
 		}
@@ -61,49 +216,344 @@ func (t *Tree) Add(path string, handler fasthttp.RequestHandler) {
 		t.root.nType = root
 	}
 
-	// Reorder the nodes
+	if !t.DeferSort {
+		// Reorder the nodes
+		t.root.sort()
+	}
+}
+
+// Finalize reorders the nodes to match the requests, which is needed once
+// the routes are added if Tree.DeferSort is enabled. The order is the same
+// as if the nodes were reordered after adding each route.
+//
+// WARNING: Not concurrency-safe!
+func (t *Tree) Finalize() {
 	t.root.sort()
 }
 
+// TryAdd adds a node with the given handle to the path like Add, but returning
+// an error instead of raising a panic when the path can't be registered.
+// Conflicts with existing wild paths or wildcards are returned as *ConflictError.
+//
+// The tree could be in an inconsistent state after an error,
+// so it should be discarded.
+//
+// WARNING: Not concurrency-safe!
+func (t *Tree) TryAdd(path string, handler fasthttp.RequestHandler) (err error) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			if rcvErr, ok := rcv.(error); ok {
+				err = rcvErr
+			} else {
+				err = fmt.Errorf("%v", rcv)
+			}
+		}
+	}()
+
+	t.Add(path, handler)
+
+	return nil
+}
+
+// Clone returns an independent copy of the tree with the same options,
+// so routes could be added to the copy without affecting the tree.
+// The handlers are shared by both trees.
+//
+// WARNING: Not concurrency-safe!
+func (t *Tree) Clone() *Tree {
+	clone := *t
+	clone.root = t.root.clone()
+
+	return &clone
+}
+
+// String returns a human-readable representation of the tree for debugging.
+// Each node is written in a line, indented by its depth, with its type,
+// param keys, regex pattern and flags, in the same order they are matched.
+func (t *Tree) String() string {
+	buf := bytebufferpool.Get()
+	t.root.dump(buf, 0)
+
+	s := buf.String()
+	bytebufferpool.Put(buf)
+
+	return s
+}
+
 // Get returns the handle registered with the given path (key). The values of
 // param/wildcard are saved as ctx.UserValue.
 // If no handle can be found, a TSR (trailing slash redirect) recommendation is
 // made if a handle exists with an extra (without the) trailing slash for the
 // given path.
 func (t *Tree) Get(path string, ctx *fasthttp.RequestCtx) (fasthttp.RequestHandler, bool) {
+	handler, tsr := t.lookup(path, ctx, nil, nil, nil)
+	if handler == nil {
+		return nil, tsr
+	}
+
+	return handler.handler, false
+}
+
+// GetWithTrace returns the handler registered with the given path like
+// Tree.Get, along with the steps of the lookup, which are the nodes compared
+// in order (e.g. "static '/users/'" or "param '{id}'").
+// It's intended to debug which route matches a path, since recording
+// the steps allocates on each lookup.
+func (t *Tree) GetWithTrace(path string, ctx *fasthttp.RequestCtx) (fasthttp.RequestHandler, bool, []string) {
+	var steps []string
+
+	handler, tsr := t.lookup(path, ctx, nil, nil, &steps)
+	if handler == nil {
+		return nil, tsr, steps
+	}
+
+	return handler.handler, false, steps
+}
+
+// GetWithParamKeys returns the handler registered with the given path like
+// Tree.Get, along with the param keys of the matched route, in the same order
+// they appear in the route path. The values saved as ctx.UserValue are also
+// appended to values, aligned with the keys, so the params could be read
+// without looking up the user values. So values could be a reused buffer
+// (e.g. values[:0]). The compared nodes are recorded in steps if not nil,
+// like Tree.GetWithTrace.
+func (t *Tree) GetWithParamKeys(path string, ctx *fasthttp.RequestCtx, values []interface{}, steps *[]string) (fasthttp.RequestHandler, []string, []interface{}, bool) {
+	start := len(values)
+
+	handler, tsr := t.lookup(path, ctx, nil, &values, steps)
+	if handler == nil {
+		return nil, nil, values[:start], tsr
+	}
+
+	// Captured from the end of the path, like the params of GetParams
+	slices.Reverse(values[start:])
+
+	return handler.handler, handler.paramKeys, values, false
+}
+
+// VisitRoutes calls fn with the path of each route which matches the given
+// path, as it was added to the tree, in a single traversal of the tree.
+// Unlike Tree.Get, the traversal doesn't stop at the first matched route,
+// so the routes shadowed by another one are visited too, neither the route
+// predicates are evaluated nor the params are saved.
+func (t *Tree) VisitRoutes(path string, fn func(route string)) {
+	if t.MatrixParams {
+		path, _ = stripMatrixParams(path)
+	}
+
+	visit := func(h *nodeHandler) {
+		fn(h.path)
+	}
+
 	if len(path) > len(t.root.path) {
-		if path[:len(t.root.path)] != t.root.path {
+		if equalStatic(path[:len(t.root.path)], t.root.path, t.Lowercase) {
+			t.root.visitFromChild(path[len(t.root.path):], t.Lowercase, visit)
+		}
+	} else if equalStatic(path, t.root.path, t.Lowercase) {
+		t.root.visit(visit)
+	}
+}
+
+// Serve calls the handle registered with the given path (key), like calling
+// the handle returned by Tree.Get. For the routes added with AddParamHandler,
+// the values of param/wildcard are passed to the handle in a fixed-size buffer,
+// instead of being saved as ctx.UserValue.
+// It returns if a handle has been called and, otherwise, the TSR (trailing
+// slash redirect) recommendation like Tree.Get.
+func (t *Tree) Serve(path string, ctx *fasthttp.RequestCtx) (bool, bool) {
+	var buf [stackBufSize]Param
+
+	ps := Params(buf[:0])
+
+	handler, tsr := t.lookup(path, ctx, &ps, nil, nil)
+
+	switch {
+	case handler == nil:
+		// Nothing to call
+	case handler.paramHandler != nil:
+		reverseParams(ps)
+		handler.paramHandler(ctx, ps)
+	default:
+		handler.handler(ctx)
+	}
+
+	return handler != nil, tsr
+}
+
+// GetParams returns the handler registered with the given path like Tree.Get,
+// but without request, appending the values of its param/wildcard to ps,
+// in the same order they appear in the route path, instead of saving them
+// as ctx.UserValue. So ps could be a reused buffer (e.g. ps[:0]).
+// The values reference the given path, and the value of a wildcard is always
+// the raw path, also with segments (e.g. '{path:**}').
+// Since there is no request, the route predicates are not evaluated.
+func (t *Tree) GetParams(path string, ps Params) (fasthttp.RequestHandler, Params, bool) {
+	start := len(ps)
+
+	handler, tsr := t.lookup(path, nil, &ps, nil, nil)
+	if handler == nil {
+		return nil, ps[:start], tsr
+	}
+
+	reverseParams(ps[start:])
+
+	return handler.handler, ps, false
+}
+
+// reverseParams reverses the captured params in place,
+// since they are captured from the end of the path
+func reverseParams(ps Params) {
+	for i, j := 0, len(ps)-1; i < j; i, j = i+1, j-1 {
+		ps[i], ps[j] = ps[j], ps[i]
+	}
+}
+
+// lookup returns the handler registered with the given path, saving the
+// values of param/wildcard in ps for a ParamHandler if not nil, otherwise
+// as ctx.UserValue, also appended to vs if not nil. The compared nodes are
+// recorded in steps if not nil.
+func (t *Tree) lookup(path string, ctx *fasthttp.RequestCtx, ps *Params, vs *[]interface{}, steps *[]string) (*nodeHandler, bool) {
+	var matrix []matrixParam
+
+	if t.MatrixParams {
+		path, matrix = stripMatrixParams(path)
+	}
+
+	handler, tsr := t.get(path, ctx, ps, vs, steps)
+	if handler == nil {
+		return nil, tsr
+	}
+
+	if ctx != nil {
+		for _, param := range matrix {
+			ctx.SetUserValue(MatrixParamKey(handler.matrixKey(param.segment), param.key), gstrings.Copy(param.value))
+		}
+	}
+
+	return handler, false
+}
+
+// MatrixParamKey returns the user value key of the matrix param of the
+// given route segment, which is its param name if it's a single param
+// (e.g. 'id' for '/users/{id}'), when Tree.MatrixParams is enabled.
+func MatrixParamKey(segment, key string) string {
+	return segment + ";" + key
+}
+
+func (t *Tree) get(path string, ctx *fasthttp.RequestCtx, ps *Params, vs *[]interface{}, steps *[]string) (*nodeHandler, bool) {
+	traceStep(steps, root, t.root.path)
+
+	if len(path) > len(t.root.path) {
+		if !equalStatic(path[:len(t.root.path)], t.root.path, t.Lowercase) {
 			return nil, false
 		}
 
 		path = path[len(t.root.path):]
 
-		return t.root.getFromChild(path, ctx)
+		handler, tsr := t.root.getFromChild(path, ctx, ps, vs, steps, t.Lowercase)
+		if handler == nil && !tsr && !t.DisableTSR && path == "/" && t.root.path == "/" {
+			if h := t.root.handler.Load(); h.match(ctx) && !h.exact {
+				// The root path with a trailing slash (e.g. "//")
+				return nil, true
+			}
+		}
 
-	} else if path == t.root.path {
-		switch {
-		case t.root.tsr:
+		return handler, tsr
+
+	} else if equalStatic(path, t.root.path, t.Lowercase) {
+		if t.root.tsr {
 			return nil, true
-		case t.root.handler != nil:
-			return t.root.handler, false
-		case t.root.wildcard != nil:
-			if ctx != nil {
-				ctx.SetUserValue(t.root.wildcard.paramKey, "")
-			}
+		}
 
-			return t.root.wildcard.handler, false
+		if h := t.root.handler.Load(); h.match(ctx) {
+			return h, false
+		}
+
+		if t.root.wildcard != nil {
+			traceStep(steps, wildcard, t.root.wildcard.path)
+
+			if h := t.root.wildcard.handler.Load(); h.match(ctx) {
+				if ctx != nil || ps != nil {
+					h.saveWildcard(ctx, ps, vs, t.root.wildcard, "")
+				}
+
+				return h, false
+			}
 		}
 	}
 
 	return nil, false
 }
 
+// PathParamKeys returns the param keys of the given route path,
+// in the same order they appear in the path.
+func PathParamKeys(path string) []string {
+	return getParamKeys(path)
+}
+
+// BalancedBraces checks if the braces of the given route path are balanced,
+// so each '{' is closed by a '}', taking into account the nested ones
+// of the param regexes (e.g. '{name:[a-z]{5}}').
+func BalancedBraces(path string) bool {
+	return balancedBraces(path)
+}
+
+// LowercaseStatic returns the given route path with its static parts
+// lowercased (ASCII only), keeping the params as they are
+// (e.g. '/Users/{Name}' is '/users/{Name}').
+func LowercaseStatic(path string) string {
+	var b []byte
+	depth := 0
+
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case depth == 0 && 'A' <= c && c <= 'Z':
+			if b == nil {
+				b = []byte(path)
+			}
+
+			b[i] = c + ('a' - 'A')
+		}
+	}
+
+	if b == nil {
+		return path
+	}
+
+	return string(b)
+}
+
+// ByName returns the value of the first param with the given key,
+// or an empty string if there is no such param.
+func (ps Params) ByName(key string) string {
+	for i := range ps {
+		if ps[i].Key == key {
+			return ps[i].Value
+		}
+	}
+
+	return ""
+}
+
 // FindCaseInsensitivePath makes a case-insensitive lookup of the given path
 // and tries to find a handler.
 // It can optionally also fix trailing slashes.
 // It returns the case-corrected path and a bool indicating whether the lookup
 // was successful.
 func (t *Tree) FindCaseInsensitivePath(path string, fixTrailingSlash bool, buf *bytebufferpool.ByteBuffer) bool {
+	if handler, _ := t.get(path, nil, nil, nil, nil); handler.fixable() {
+		// The path is already correct, so there is nothing to fix
+		buf.WriteString(path)
+
+		return true
+	}
+
 	found, tsr := t.root.find(path, buf)
 
 	if !found || (tsr && !fixTrailingSlash) {
@@ -112,5 +562,15 @@ func (t *Tree) FindCaseInsensitivePath(path string, fixTrailingSlash bool, buf *
 		return false
 	}
 
+	if tsr {
+		// The TSR nodes don't know the handler of their route,
+		// so check it could be fixed to
+		if h, _ := t.get(strconv.B2S(buf.B), nil, nil, nil, nil); !h.fixable() {
+			buf.Reset()
+
+			return false
+		}
+	}
+
 	return true
 }
@@ -1,8 +1,11 @@
 package radix
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/savsgio/gotils/bytes"
@@ -231,6 +234,7 @@ func Test_AddWithParam(t *testing.T) {
 	tree.Add("/prefix{name:[a-z]+}suffix/data", handler)
 	tree.Add("/prefix{name:[a-z]+}/data", handler)
 	tree.Add("/api/{file}.json", handler)
+	tree.Add("/items/{id}-{color}-{size}", handler)
 
 	testHandlerAndParams(t, tree, "/api/prefixV1_atreugo_sufix/files", handler, false, map[string]interface{}{
 		"version": "V1", "name": "atreugo",
@@ -247,6 +251,12 @@ func Test_AddWithParam(t *testing.T) {
 	testHandlerAndParams(t, tree, "/api/name.json", handler, false, map[string]interface{}{
 		"file": "name",
 	})
+	testHandlerAndParams(t, tree, "/items/42-red-large", handler, false, map[string]interface{}{
+		"id": "42", "color": "red", "size": "large",
+	})
+	testHandlerAndParams(t, tree, "/items/42-red-extra-large", handler, false, map[string]interface{}{
+		"id": "42", "color": "red", "size": "extra-large",
+	})
 
 	// Not found
 	testHandlerAndParams(t, tree, "/api/prefixV1_1111_sufix/fake", nil, false, nil)
@@ -268,6 +278,139 @@ func Test_TreeRootWildcard(t *testing.T) {
 	})
 }
 
+func Test_TreeSegmentsWildcard(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.Add("/tree/{path:**}", handler)
+	tree.Add("/files/{filepath:*}", handler)
+
+	testHandlerAndParams(t, tree, "/tree/", handler, false, map[string]interface{}{
+		"path": []string{},
+	})
+	testHandlerAndParams(t, tree, "/tree/a", handler, false, map[string]interface{}{
+		"path": []string{"a"},
+	})
+	testHandlerAndParams(t, tree, "/tree/a/b/c", handler, false, map[string]interface{}{
+		"path": []string{"a", "b", "c"},
+	})
+	testHandlerAndParams(t, tree, "/tree/a//b/", handler, false, map[string]interface{}{
+		"path": []string{"a", "b"},
+	})
+	testHandlerAndParams(t, tree, "/files/a/b/c", handler, false, map[string]interface{}{
+		"filepath": "a/b/c",
+	})
+
+	err := catchPanic(func() {
+		tree.Add("/tree/{other:*}", handler)
+	})
+
+	if _, ok := err.(*ConflictError); !ok {
+		t.Errorf("Expected a conflict error, got %v", err)
+	}
+}
+
+func Test_TreeString(t *testing.T) {
+	handler := generateHandler()
+	predicate := func(_ *fasthttp.RequestCtx) bool { return true }
+
+	tree := New()
+
+	for _, path := range []string{"/", "/api/{id:[0-9]+}", "/api/{name}/posts/", "/api/users", "/files/{filepath:*}"} {
+		tree.Add(path, handler)
+	}
+
+	tree.AddWhen("/when", handler, predicate)
+
+	want := `/ [root handler]
+  api/ [static]
+    users [static handler]
+      / [static tsr]
+    {id:[0-9]+} [param keys=id regex=([0-9]+) handler]
+      / [static tsr]
+    {name} [param keys=name]
+      /posts [static tsr]
+        / [static handler]
+  files [static tsr]
+    / [static]
+      {filepath:*} [wildcard keys=filepath handler]
+  when [static handler predicate]
+    / [static tsr]
+`
+
+	if got := tree.String(); got != want {
+		t.Errorf("Tree.String() ==\n%s\nwant\n%s", got, want)
+	}
+
+	if got := New().String(); got != " [root]\n" {
+		t.Errorf("Tree.String() == %q, want %q", got, " [root]\n")
+	}
+}
+
+func Test_TreeMatrixParams(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.Add("/users/{id}/profile", handler)
+
+	testHandlerAndParams(t, tree, "/users;active/42;v=1;lang=en/profile", nil, false, nil)
+
+	tree = New()
+	tree.MatrixParams = true
+	tree.Add("/users/{id}/profile", handler)
+	tree.Add("/users/{id}/{name}-{ext}", handler)
+	tree.Add("/files/{filepath:*}", handler)
+
+	testHandlerAndParams(t, tree, "/users/42/profile", handler, false, map[string]interface{}{
+		"id": "42",
+	})
+	testHandlerAndParams(t, tree, "/users;active/42;v=1;lang=en/profile;full", handler, false, map[string]interface{}{
+		"id":                              "42",
+		MatrixParamKey("users", "active"): "",
+		MatrixParamKey("id", "v"):         "1",
+		MatrixParamKey("id", "lang"):      "en",
+		MatrixParamKey("profile", "full"): "",
+	})
+	testHandlerAndParams(t, tree, "/users/7;v=2/a-txt;x=1", handler, false, map[string]interface{}{
+		"id":                                "7",
+		"name":                              "a",
+		"ext":                               "txt",
+		MatrixParamKey("id", "v"):           "2",
+		MatrixParamKey("{name}-{ext}", "x"): "1",
+	})
+	testHandlerAndParams(t, tree, "/files/a;x=1/b;y=2", handler, false, map[string]interface{}{
+		"filepath":                      "a/b",
+		MatrixParamKey("filepath", "x"): "1",
+		MatrixParamKey("filepath", "y"): "2",
+	})
+	testHandlerAndParams(t, tree, "/users;v=1/42/profile/", nil, true, nil)
+}
+
+func Test_stripMatrixParams(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		params []matrixParam
+	}{
+		{"/users/42", "/users/42", nil},
+		{"/users;id=42/profile", "/users/profile", []matrixParam{{0, "id", "42"}}},
+		{"/a;x;y=2/b;;z=", "/a/b", []matrixParam{{0, "x", ""}, {0, "y", "2"}, {1, "z", ""}}},
+		{"/;x=1", "/", []matrixParam{{0, "x", "1"}}},
+	}
+
+	for _, test := range tests {
+		path, params := stripMatrixParams(test.path)
+
+		if path != test.want {
+			t.Errorf("stripMatrixParams(%q) path == %q, want %q", test.path, path, test.want)
+		}
+
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("stripMatrixParams(%q) params == %v, want %v", test.path, params, test.params)
+		}
+	}
+}
+
 func Test_TreeNilHandler(t *testing.T) {
 	const panicMsg = "nil handler"
 
@@ -322,77 +465,1421 @@ func Test_TreeMutable(t *testing.T) {
 	}
 }
 
-func Benchmark_Get(b *testing.B) {
-	handler := func(ctx *fasthttp.RequestCtx) {}
+func Test_TreeMutableConcurrent(t *testing.T) {
+	routes := []string{"/", "/api/{version}", "/files/{filepath:*}", "/users/{id:[0-9]+}/posts"}
+	requests := []string{"/", "/api/v1", "/files/a/b", "/users/1/posts"}
 
 	tree := New()
+	tree.Mutable = true
 
-	// for i := 0; i < 3000; i++ {
-	// 	tree.Add(
-	// 		fmt.Sprintf("/%s", bytes.Rand(make([]byte, 15))), handler,
-	// 	)
-	// }
+	for _, route := range routes {
+		tree.Add(route, generateHandler())
+	}
 
-	tree.Add("/", handler)
-	tree.Add("/plaintext", handler)
-	tree.Add("/json", handler)
-	tree.Add("/fortune", handler)
-	tree.Add("/fortune-quick", handler)
-	tree.Add("/db", handler)
-	tree.Add("/queries", handler)
-	tree.Add("/update", handler)
+	var wg sync.WaitGroup
 
-	ctx := new(fasthttp.RequestCtx)
+	wg.Add(2)
 
-	b.ResetTimer()
+	go func() {
+		defer wg.Done()
 
-	for i := 0; i < b.N; i++ {
-		tree.Get("/update", ctx)
+		for i := 0; i < 1000; i++ {
+			for _, route := range routes {
+				tree.Add(route, generateHandler())
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 1000; i++ {
+			for _, path := range requests {
+				if handler, _ := tree.Get(path, new(fasthttp.RequestCtx)); handler == nil {
+					t.Errorf("Path '%s' - Expected a handler", path)
+				}
+			}
+		}
+	}()
+
+	wg.Wait()
+}
+
+func Test_TreeAddWhen(t *testing.T) {
+	var handled string
+
+	handler := func(name string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			handled = name
+		}
+	}
+
+	match := false
+	predicate := func(ctx *fasthttp.RequestCtx) bool {
+		return match
+	}
+
+	tree := New()
+	tree.AddWhen("/", handler("root"), predicate)
+	tree.AddWhen("/users/new", handler("new"), predicate)
+	tree.Add("/users/{id}", handler("id"))
+	tree.AddWhen("/items/{id}", handler("item"), predicate)
+	tree.AddWhen("/files/{filepath:*}", handler("files"), predicate)
+
+	tests := []struct {
+		path  string
+		match bool
+		want  string
+	}{
+		{"/", true, "root"},
+		{"/", false, ""},
+		{"/users/new", true, "new"},
+		{"/users/new", false, "id"},
+		{"/items/1", true, "item"},
+		{"/items/1", false, ""},
+		{"/files/a/b", true, "files"},
+		{"/files/a/b", false, ""},
+	}
+
+	for _, test := range tests {
+		match = test.match
+		handled = ""
+
+		h, _ := tree.Get(test.path, new(fasthttp.RequestCtx))
+		if h != nil {
+			h(nil)
+		}
+
+		if handled != test.want {
+			t.Errorf("Path '%s' (match: %v) - handled by %q, want %q", test.path, test.match, handled, test.want)
+		}
+
+		// Without ctx, the predicate is not evaluated
+		if h, _ := tree.Get(test.path, nil); h == nil {
+			t.Errorf("Path '%s' (match: %v) - handler not found without request ctx", test.path, test.match)
+		}
 	}
 }
 
-func Benchmark_GetWithRegex(b *testing.B) {
-	handler := func(ctx *fasthttp.RequestCtx) {}
+func Test_TreeAddWithPriority(t *testing.T) {
+	var matched string
+
+	newHandler := func(name string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			matched = name
+		}
+	}
+
+	tests := []struct {
+		idPriority, namePriority int
+		want                     string
+	}{
+		{0, 0, "id"},
+		{0, 1, "name"},
+		{1, 0, "id"},
+		{-1, 0, "name"},
+	}
+
+	for _, test := range tests {
+		tree := New()
+		tree.AddWithPriority("/items/{id:[0-9]+}/x", newHandler("id"), nil, test.idPriority)
+		tree.AddWithPriority("/items/{name:[a-z0-9]+}/x", newHandler("name"), nil, test.namePriority)
+
+		matched = ""
+
+		handler, _ := tree.Get("/items/42/x", nil)
+		if handler == nil {
+			t.Fatalf("Priorities (%d, %d) - Expected a handler", test.idPriority, test.namePriority)
+		}
+
+		handler(nil)
+
+		if matched != test.want {
+			t.Errorf("Priorities (%d, %d) - matched route == %s, want %s",
+				test.idPriority, test.namePriority, matched, test.want)
+		}
+	}
+}
+
+func Test_TreeNumericParams(t *testing.T) {
+	handler := generateHandler()
+	fallback := generateHandler()
 
 	tree := New()
-	ctx := new(fasthttp.RequestCtx)
+	tree.Add("/users/{id:int(1,100)}", handler)
+	tree.Add("/users/{name}", fallback)
+	tree.Add("/prices/{price:float(0,9.99)}/{qty:int}", handler)
+	tree.Add("/temps/{temp:float}", handler)
+	tree.Add("/u/{a:int(1,10)}/x", handler)
+	tree.Add("/u/{b:int(11,20)}/x", fallback)
 
-	tree.Add("/api/{version:v[0-9]}/data", handler)
+	tests := []struct {
+		path    string
+		handler fasthttp.RequestHandler
+		params  map[string]interface{}
+	}{
+		{"/users/1", handler, map[string]interface{}{"id": "1"}},
+		{"/users/100", handler, map[string]interface{}{"id": "100"}},
+		{"/users/0", fallback, map[string]interface{}{"name": "0"}},
+		{"/users/101", fallback, map[string]interface{}{"name": "101"}},
+		{"/users/-5", fallback, map[string]interface{}{"name": "-5"}},
+		{"/users/abc", fallback, map[string]interface{}{"name": "abc"}},
+		{"/prices/9.99/3", handler, map[string]interface{}{"price": "9.99", "qty": "3"}},
+		{"/prices/5/-3", handler, map[string]interface{}{"price": "5", "qty": "-3"}},
+		{"/prices/10.5/3", nil, nil},
+		{"/prices/1.5/x", nil, nil},
+		{"/prices/1.5/99999999999999999999", nil, nil},
+		{"/temps/-12.5", handler, map[string]interface{}{"temp": "-12.5"}},
+		{"/temps/warm", nil, nil},
+		{"/u/5/x", handler, map[string]interface{}{"a": "5"}},
+		{"/u/15/x", fallback, map[string]interface{}{"b": "15"}},
+		{"/u/25/x", nil, nil},
+	}
 
-	b.ResetTimer()
+	for _, test := range tests {
+		testHandlerAndParams(t, tree, test.path, test.handler, false, test.params)
+	}
 
-	for i := 0; i < b.N; i++ {
-		tree.Get("/api/v1/data", ctx)
+	buf := bytebufferpool.Get()
+	if found := tree.FindCaseInsensitivePath("/USERS/50", false, buf); !found {
+		t.Error("Expected a case-insensitive match for '/USERS/50'")
+	}
+
+	buf.Reset()
+	tree = New()
+	tree.Add("/users/{id:int(1,100)}", handler)
+
+	if found := tree.FindCaseInsensitivePath("/USERS/500", false, buf); found {
+		t.Errorf("Unexpected case-insensitive match for '/USERS/500': %s", buf)
+	}
+
+	bytebufferpool.Put(buf)
+
+	tree = New()
+	tree.Add("/u/{a:int(1,10)}/x", handler)
+
+	if err := catchPanic(func() { tree.Add("/u/{c:int(1,10)}/x", handler) }); err == nil {
+		t.Error("Expected a conflict with the same range of another param name")
+	}
+
+	invalid := []string{
+		"/a/{id:int(1)}",
+		"/a/{id:int(a,b)}",
+		"/a/{id:int(10,1)}",
+		"/a/{id:int(1,10}",
+		"/a/{id:float(1.5,x)}",
+	}
+
+	for _, path := range invalid {
+		err := catchPanic(func() {
+			New().Add(path, handler)
+		})
+
+		if err == nil || !strings.HasPrefix(fmt.Sprint(err), "invalid range") {
+			t.Errorf("Path '%s' - Expected an invalid range panic, got %v", path, err)
+		}
 	}
 }
 
-func Benchmark_GetWithParams(b *testing.B) {
-	handler := func(ctx *fasthttp.RequestCtx) {}
+func Test_TreeEnumParams(t *testing.T) {
+	handler := generateHandler()
+	fallback := generateHandler()
 
 	tree := New()
-	ctx := new(fasthttp.RequestCtx)
+	tree.Add("/colors/{color:enum(red, green, blue)}", handler)
+	tree.Add("/colors/{name}", fallback)
+	tree.Add("/sizes/{size:enum(s,m,l)}/items", handler)
+	tree.Add("/icons/{name:enum(a.b,c)}.{ext:enum(png,svg)}", handler)
 
-	tree.Add("/api/{version}/data", handler)
+	tests := []struct {
+		path    string
+		handler fasthttp.RequestHandler
+		params  map[string]interface{}
+	}{
+		{"/colors/red", handler, map[string]interface{}{"color": "red"}},
+		{"/colors/blue", handler, map[string]interface{}{"color": "blue"}},
+		{"/colors/yellow", fallback, map[string]interface{}{"name": "yellow"}},
+		{"/colors/redd", fallback, map[string]interface{}{"name": "redd"}},
+		{"/colors/RED", fallback, map[string]interface{}{"name": "RED"}},
+		{"/sizes/m/items", handler, map[string]interface{}{"size": "m"}},
+		{"/sizes/xl/items", nil, nil},
+		{"/icons/a.b.svg", handler, map[string]interface{}{"name": "a.b", "ext": "svg"}},
+		{"/icons/c.png", handler, map[string]interface{}{"name": "c", "ext": "png"}},
+		{"/icons/axb.png", nil, nil},
+		{"/icons/c.gif", nil, nil},
+	}
 
-	b.ResetTimer()
+	for _, test := range tests {
+		testHandlerAndParams(t, tree, test.path, test.handler, false, test.params)
+	}
 
-	for i := 0; i < b.N; i++ {
-		tree.Get("/api/v1/data", ctx)
+	if dump := tree.String(); !strings.Contains(dump, "enum=blue,green,red") {
+		t.Errorf("Expected the enum values in the dump:\n%s", dump)
+	}
+
+	buf := bytebufferpool.Get()
+	if found := tree.FindCaseInsensitivePath("/SIZES/l/ITEMS", false, buf); !found || buf.String() != "/sizes/l/items" {
+		t.Errorf("Expected a case-insensitive match for '/SIZES/l/ITEMS', got %q", buf)
+	}
+
+	buf.Reset()
+
+	if found := tree.FindCaseInsensitivePath("/SIZES/xl/ITEMS", false, buf); found {
+		t.Errorf("Unexpected case-insensitive match for '/SIZES/xl/ITEMS': %s", buf)
+	}
+
+	bytebufferpool.Put(buf)
+
+	if err := catchPanic(func() { tree.Add("/colors/{color:enum(cyan,magenta)}", handler) }); err == nil {
+		t.Error("Expected a conflict with the other enum of the param")
+	}
+
+	invalid := []string{
+		"/a/{x:enum()}",
+		"/a/{x:enum(a,,b)}",
+		"/a/{x:enum(a,b}",
+	}
+
+	for _, path := range invalid {
+		err := catchPanic(func() {
+			New().Add(path, handler)
+		})
+
+		if err == nil || !strings.HasPrefix(fmt.Sprint(err), "invalid enum") {
+			t.Errorf("Path '%s' - Expected an invalid enum panic, got %v", path, err)
+		}
 	}
 }
 
-func Benchmark_FindCaseInsensitivePath(b *testing.B) {
-	handler := func(ctx *fasthttp.RequestCtx) {}
+func Test_TreeMaxRegexProgramSize(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.MaxRegexProgramSize = 100
+
+	valid := []string{
+		"/users/{id:[0-9]+}",
+		"/repeat/{x:(a+)+}",
+		"/files/{name:[a-z]+}.{ext:png|jpg}",
+		"/colors/{color:enum(red,green,blue)}",
+		"/plain/{name}",
+	}
+
+	for _, path := range valid {
+		if err := tree.TryAdd(path, handler); err != nil {
+			t.Errorf("Path '%s' - Unexpected error: %v", path, err)
+		}
+	}
+
+	invalid := []string{
+		"/a/{x:(?:[a-z]{1,10}){1,100}}",
+		"/b/{id:[0-9]+}/{code:[A-Z]{200}}",
+		"/c/{name}.{ext:[a-z]{200}}",
+	}
+
+	for _, path := range invalid {
+		err := tree.TryAdd(path, handler)
+		if err == nil || !strings.Contains(err.Error(), "is too complex") {
+			t.Errorf("Path '%s' - Expected a too complex regex error, got %v", path, err)
+		}
+	}
+
+	testHandlerAndParams(t, tree, "/repeat/aaa", handler, false, map[string]interface{}{"x": "aaa"})
+	testHandlerAndParams(t, tree, "/b/1/ABC", nil, false, nil)
+
+	tree = New()
+	if err := tree.TryAdd("/a/{x:(?:[a-z]{1,10}){1,100}}", handler); err != nil {
+		t.Errorf("Unexpected error without max regex program size: %v", err)
+	}
+
+	for _, maxSize := range []int{0, 100} {
+		tree = New()
+		tree.MaxRegexProgramSize = maxSize
+
+		err := tree.TryAdd("/d/{x:[a-}", handler)
+		if err == nil || !strings.Contains(err.Error(), "invalid regex '([a-)' in path '/d/{x:[a-}'") {
+			t.Errorf("Max %d - Expected an invalid regex error, got %v", maxSize, err)
+		}
+	}
+}
+func Test_TreeUnbalancedBraces(t *testing.T) {
+	handler := generateHandler()
+
+	invalid := []string{
+		"/a/{id/b",
+		"/a/{id}}",
+		"/a/id}/b",
+		"/a/{id:[0-9]{3}/b",
+		"/a/{{id}",
+		"/a/{id}/{",
+	}
+
+	for _, path := range invalid {
+		err := catchPanic(func() {
+			New().Add(path, handler)
+		})
+
+		want := "unbalanced braces in path '" + path + "'"
+		if fmt.Sprint(err) != want {
+			t.Errorf("Path '%s' - Expected panic '%s', got %v", path, want, err)
+		}
+
+		if BalancedBraces(path) {
+			t.Errorf("Path '%s' - Expected unbalanced braces", path)
+		}
+	}
+
+	for _, path := range []string{"/a/{id}", "/a/{name:[a-z]{5}}/{id?}", "/a/b"} {
+		if !BalancedBraces(path) {
+			t.Errorf("Path '%s' - Expected balanced braces", path)
+		}
+	}
+}
+
+func Test_TreeSpanningRegexParams(t *testing.T) {
+	handler := generateHandler()
+	meta := generateHandler()
 
 	tree := New()
+	tree.Add("/files/{path:.*}", handler)
+	tree.Add("/docs/{path:.+}", handler)
+	tree.Add("/docs/{path:.+}/meta", meta)
+	tree.Add("/ids/{id:[0-9]+}", handler)
+
+	tests := []struct {
+		path    string
+		handler fasthttp.RequestHandler
+		tsr     bool
+		params  map[string]interface{}
+	}{
+		{"/files/a", handler, false, map[string]interface{}{"path": "a"}},
+		{"/files/a/b/c", handler, false, map[string]interface{}{"path": "a/b/c"}},
+		{"/files/a/b/c/", nil, true, nil},
+		{"/docs/a", handler, false, map[string]interface{}{"path": "a"}},
+		{"/docs/a/meta", meta, false, map[string]interface{}{"path": "a"}},
+		{"/docs/a/b", handler, false, map[string]interface{}{"path": "a/b"}},
+		{"/docs/a/b/meta", handler, false, map[string]interface{}{"path": "a/b/meta"}},
+		{"/ids/12", handler, false, map[string]interface{}{"id": "12"}},
+		{"/ids/12/34", nil, false, nil},
+	}
+
+	for _, test := range tests {
+		testHandlerAndParams(t, tree, test.path, test.handler, test.tsr, test.params)
+	}
+
+	// The spanning of a route doesn't depend on the other routes,
+	// neither on the order they are added
+	for _, routes := range [][]string{{"/docs/{path:.+}"}, {"/docs/{path:.+}/meta", "/docs/{path:.+}"}} {
+		tree := New()
+		for _, route := range routes {
+			tree.Add(route, handler)
+		}
+
+		testHandlerAndParams(t, tree, "/docs/a/b", handler, false, map[string]interface{}{"path": "a/b"})
+		testHandlerAndParams(t, tree, "/docs/a/b/", nil, true, nil)
+	}
+
 	buf := bytebufferpool.Get()
+	if found := tree.FindCaseInsensitivePath("/FILES/a/b/c", false, buf); !found || buf.String() != "/files/a/b/c" {
+		t.Errorf("Expected a case-insensitive match for '/FILES/a/b/c', got %v '%s'", found, buf)
+	}
 
-	tree.Add("/endpoint", handler)
+	bytebufferpool.Put(buf)
+}
 
-	b.ResetTimer()
+func Test_TreeFindCaseInsensitivePathExact(t *testing.T) {
+	handler := generateHandler()
 
-	for i := 0; i < b.N; i++ {
-		tree.FindCaseInsensitivePath("/ENdpOiNT", false, buf)
-		buf.Reset()
+	tree := New()
+	for _, route := range []string{"/", "/endpoint", "/Users/{id}/posts/", "/files/{filepath:*}", "/ids/{id:[0-9]+}"} {
+		tree.Add(route, handler)
+	}
+
+	paths := []string{
+		"/", "/endpoint", "/ENDPOINT", "/Users/1/posts/", "/users/1/posts/",
+		"/Users/1/posts", "/files/a/B", "/ids/12", "/ids/ab", "/missing",
+	}
+
+	buf := bytebufferpool.Get()
+	want := bytebufferpool.Get()
+
+	for _, path := range paths {
+		for _, fixTrailingSlash := range []bool{false, true} {
+			buf.Reset()
+			want.Reset()
+
+			found := tree.FindCaseInsensitivePath(path, fixTrailingSlash, buf)
+
+			wantFound, tsr := tree.root.find(path, want)
+			if !wantFound || (tsr && !fixTrailingSlash) {
+				wantFound = false
+				want.Reset()
+			}
+
+			if found != wantFound || buf.String() != want.String() {
+				t.Errorf("Path '%s' - FindCaseInsensitivePath == %v '%s', want %v '%s'", path, found, buf, wantFound, want)
+			}
+		}
+	}
+
+	bytebufferpool.Put(buf)
+	bytebufferpool.Put(want)
+}
+
+func Test_TreeGetWithTrace(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.Add("/users/{id}", handler)
+	tree.Add("/users/{id}/posts", handler)
+	tree.Add("/files/{filepath:*}", handler)
+
+	tests := []struct {
+		path    string
+		handler fasthttp.RequestHandler
+		steps   []string
+	}{
+		{"/users/1/posts", handler, []string{"root '/'", "static 'users/'", "param '{id}'", "static '/'", "static 'posts'"}},
+		{"/files/a/b", handler, []string{"root '/'", "static 'users/'", "static 'files'", "static '/'", "wildcard '{filepath:*}'"}},
+		{"/missing", nil, []string{"root '/'", "static 'users/'", "static 'files'"}},
+	}
+
+	for _, test := range tests {
+		h, _, steps := tree.GetWithTrace(test.path, new(fasthttp.RequestCtx))
+
+		if reflect.ValueOf(h).Pointer() != reflect.ValueOf(test.handler).Pointer() {
+			t.Errorf("Path '%s' - handler == %p, want %p", test.path, h, test.handler)
+		}
+
+		if !reflect.DeepEqual(steps, test.steps) {
+			t.Errorf("Path '%s' - steps == %q, want %q", test.path, steps, test.steps)
+		}
+	}
+}
+
+func Test_TreeGetWithParamKeys(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.Add("/users/{id}/posts/{post}", handler)
+	tree.Add("/users/{id}/posts", handler)
+	tree.Add("/{version}/files/{name}_{ext}/{filepath:*}", handler)
+	tree.Add("/static", handler)
+
+	tests := []struct {
+		path   string
+		keys   []string
+		values []interface{}
+	}{
+		{"/users/1/posts/2", []string{"id", "post"}, []interface{}{"1", "2"}},
+		{"/users/1/posts", []string{"id"}, []interface{}{"1"}},
+		{"/v1/files/doc_pdf/a/b", []string{"version", "name", "ext", "filepath"}, []interface{}{"v1", "doc", "pdf", "a/b"}},
+		{"/static", nil, nil},
+		{"/missing", nil, nil},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+
+		_, keys, values, _ := tree.GetWithParamKeys(test.path, ctx, nil, nil)
+		if !reflect.DeepEqual(keys, test.keys) {
+			t.Errorf("Path '%s' - keys == %v, want %v", test.path, keys, test.keys)
+		}
+
+		if !reflect.DeepEqual(values, test.values) {
+			t.Errorf("Path '%s' - values == %v, want %v", test.path, values, test.values)
+		}
+
+		for i, key := range keys {
+			if ctx.UserValue(key) != values[i] {
+				t.Errorf("Path '%s' - user value '%s' == %v, want %v", test.path, key, ctx.UserValue(key), values[i])
+			}
+		}
+
+		// Only the params are saved as user values
+		n := 0
+		ctx.VisitUserValues(func(_ []byte, _ interface{}) { n++ })
+
+		if n != len(test.keys) {
+			t.Errorf("Path '%s' - user values == %d, want %d", test.path, n, len(test.keys))
+		}
+	}
+}
+
+func Test_TreeVisitRoutes(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.Add("/users/new", handler)
+	tree.Add("/users/{0}", handler)
+	tree.Add("/users/{0:[0-9]+}", handler)
+	tree.Add("/docs/{0:.+}", handler)
+	tree.Add("/docs/{0:.+}/meta", handler)
+	tree.Add("/files/{0:*}", handler)
+	tree.Add("/files/", handler)
+	tree.Add("/", handler)
+
+	tests := []struct {
+		path   string
+		routes []string
+	}{
+		{"/", []string{"/"}},
+		{"/users/new", []string{"/users/new", "/users/{0}"}},
+		{"/users/gopher", []string{"/users/{0}"}},
+		{"/users/1", []string{"/users/{0:[0-9]+}", "/users/{0}"}},
+		{"/users/1/", nil},
+		{"/docs/a", []string{"/docs/{0:.+}"}},
+		{"/docs/a/meta", []string{"/docs/{0:.+}/meta", "/docs/{0:.+}"}},
+		{"/docs/a/b", []string{"/docs/{0:.+}"}},
+		{"/files/", []string{"/files/", "/files/{0:*}"}},
+		{"/files/a/b", []string{"/files/{0:*}"}},
+		{"/missing", nil},
+	}
+
+	for _, test := range tests {
+		var routes []string
+
+		tree.VisitRoutes(test.path, func(route string) {
+			routes = append(routes, route)
+		})
+
+		if !reflect.DeepEqual(routes, test.routes) {
+			t.Errorf("Path '%s' - routes == %v, want %v", test.path, routes, test.routes)
+		}
+	}
+}
+
+func Test_TreeLowercase(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.Lowercase = true
+	tree.Add("/Users/{Name}/Posts", handler)
+	tree.Add("/files/{FilePath:*}", handler)
+	tree.Add("/ids/{id:[A-Z]+}", handler)
+
+	if s := tree.String(); strings.Contains(s, "Users") || !strings.Contains(s, "{Name}") {
+		t.Errorf("Unexpected tree:\n%s", s)
+	}
+
+	tests := []struct {
+		path    string
+		handler fasthttp.RequestHandler
+		tsr     bool
+		params  map[string]interface{}
+	}{
+		{"/users/Bob/posts", handler, false, map[string]interface{}{"Name": "Bob"}},
+		{"/USERS/Bob/POSTS", handler, false, map[string]interface{}{"Name": "Bob"}},
+		{"/USERS/Bob/POSTS/", nil, true, nil},
+		{"/Files/A/B.TXT", handler, false, map[string]interface{}{"FilePath": "A/B.TXT"}},
+		{"/IDS/ABC", handler, false, map[string]interface{}{"id": "ABC"}},
+		{"/ids/abc", nil, false, nil},
+		{"/usersx/Bob/posts", nil, false, nil},
+	}
+
+	for _, test := range tests {
+		testHandlerAndParams(t, tree, test.path, test.handler, test.tsr, test.params)
+	}
+
+	err := catchPanic(func() {
+		tree.Add("/users/{Name}/posts", handler)
+	})
+
+	if err == nil {
+		t.Error("Expected a panic registering the same route with another case")
+	}
+
+	for path, want := range map[string]string{
+		"/Users/{Name}":      "/users/{Name}",
+		"/a/{id:[A-Z]{2}}/B": "/a/{id:[A-Z]{2}}/b",
+		"/users":             "/users",
+	} {
+		if got := LowercaseStatic(path); got != want {
+			t.Errorf("LowercaseStatic(%s) == %s, want %s", path, got, want)
+		}
+	}
+}
+
+func Test_TreeParamAndWildcard(t *testing.T) {
+	handler := generateHandler()
+	index := generateHandler()
+	dir := generateHandler()
+
+	tree := New()
+	tree.Add("/files/{dir}/{filepath:*}", handler)
+	tree.Add("/files/index", index)
+
+	tests := []struct {
+		path    string
+		handler fasthttp.RequestHandler
+		tsr     bool
+		params  map[string]interface{}
+	}{
+		{"/files/js/inc/app.js", handler, false, map[string]interface{}{"dir": "js", "filepath": "inc/app.js"}},
+		{"/files/js/app.js", handler, false, map[string]interface{}{"dir": "js", "filepath": "app.js"}},
+		{"/files/js/", handler, false, map[string]interface{}{"dir": "js", "filepath": ""}},
+		{"/files/index", index, false, nil},
+		{"/files/index/app.js", handler, false, map[string]interface{}{"dir": "index", "filepath": "app.js"}},
+		{"/files/js", nil, false, nil},
+	}
+
+	for _, test := range tests {
+		testHandlerAndParams(t, tree, test.path, test.handler, test.tsr, test.params)
+	}
+
+	// The segment param also has its own route
+	tree.Add("/files/{dir}", dir)
+
+	tests = []struct {
+		path    string
+		handler fasthttp.RequestHandler
+		tsr     bool
+		params  map[string]interface{}
+	}{
+		{"/files/js/inc/app.js", handler, false, map[string]interface{}{"dir": "js", "filepath": "inc/app.js"}},
+		{"/files/js/", handler, false, map[string]interface{}{"dir": "js", "filepath": ""}},
+		{"/files/js", dir, false, map[string]interface{}{"dir": "js"}},
+		{"/files/index", index, false, nil},
+	}
+
+	for _, test := range tests {
+		testHandlerAndParams(t, tree, test.path, test.handler, test.tsr, test.params)
+	}
+
+	// A wildcard and a segment param under the same prefix, in both orders
+	for _, routes := range [][]string{{"/a/{x:*}", "/a/{y}/b"}, {"/a/{y}/b", "/a/{x:*}"}} {
+		tree := New()
+		tree.Add(routes[0], handler)
+		tree.Add(routes[1], index)
+
+		wildHandler, paramHandler := handler, index
+		if routes[0] != "/a/{x:*}" {
+			wildHandler, paramHandler = index, handler
+		}
+
+		testHandlerAndParams(t, tree, "/a/1/b", paramHandler, false, map[string]interface{}{"y": "1"})
+		testHandlerAndParams(t, tree, "/a/1/c", wildHandler, false, map[string]interface{}{"x": "1/c"})
+		testHandlerAndParams(t, tree, "/a/1", wildHandler, false, map[string]interface{}{"x": "1"})
+		testHandlerAndParams(t, tree, "/a/1/b/", nil, true, nil)
+	}
+}
+
+func Test_TreeDisableTSR(t *testing.T) {
+	handler := generateHandler()
+
+	routes := []string{"/", "/a", "/b/", "/c/{id}", "/c/{id}/d/", "/files/{filepath:*}", "/e/f", "/g/{id}/"}
+
+	tree := New()
+	tree.DisableTSR = true
+
+	for _, route := range routes {
+		tree.Add(route, handler)
+	}
+
+	if s := tree.String(); strings.Contains(s, "tsr") {
+		t.Errorf("Unexpected TSR nodes in tree:\n%s", s)
+	}
+
+	testHandlerAndParams(t, tree, "/", handler, false, nil)
+	testHandlerAndParams(t, tree, "/a", handler, false, nil)
+	testHandlerAndParams(t, tree, "/b/", handler, false, nil)
+	testHandlerAndParams(t, tree, "/c/1", handler, false, map[string]interface{}{"id": "1"})
+	testHandlerAndParams(t, tree, "/c/1/d/", handler, false, map[string]interface{}{"id": "1"})
+	testHandlerAndParams(t, tree, "/files/a", handler, false, map[string]interface{}{"filepath": "a"})
+	testHandlerAndParams(t, tree, "/g/1/", handler, false, map[string]interface{}{"id": "1"})
+
+	for _, path := range []string{"//", "/a/", "/b", "/c/1/", "/c/1/d", "/files", "/e/f/", "/g/1"} {
+		testHandlerAndParams(t, tree, path, nil, false, nil)
+	}
+}
+
+func Test_TreeClone(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.Mutable = true
+	tree.Add("/users/{id}", handler)
+	tree.Add("/files/{filepath:*}", handler)
+
+	want := tree.String()
+
+	clone := tree.Clone()
+	if !clone.Mutable {
+		t.Error("Expected the clone to be mutable")
+	}
+
+	if got := clone.String(); got != want {
+		t.Errorf("Clone tree ==\n%s\nwant\n%s", got, want)
+	}
+
+	clone.Add("/use", handler)
+	clone.Add("/users/{id}/posts", handler)
+	clone.Add("/files/{filepath:*}", fakeHandler("/files/{filepath:*}"))
+
+	if got := tree.String(); got != want {
+		t.Errorf("Tree changed by its clone ==\n%s\nwant\n%s", got, want)
+	}
+
+	testHandlerAndParams(t, tree, "/use", nil, false, nil)
+	testHandlerAndParams(t, tree, "/users/1/posts", nil, false, nil)
+	testHandlerAndParams(t, tree, "/files/a", handler, false, map[string]interface{}{"filepath": "a"})
+	testHandlerAndParams(t, clone, "/use", handler, false, nil)
+	testHandlerAndParams(t, clone, "/users/1/posts", handler, false, map[string]interface{}{"id": "1"})
+}
+
+func Test_TreeTryAdd(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	if err := tree.TryAdd("/con{tact}", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := tree.TryAdd("/who/are/{you:*}", handler); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want *ConflictError
+	}{
+		{
+			path: "/con{something}",
+			want: &ConflictError{
+				Segment:        "{something}",
+				NewPath:        "/con{something}",
+				Wildcard:       "{tact}",
+				ExistingPrefix: "/con{tact}",
+				msg:            errWildPathConflict,
+			},
+		},
+		{
+			path: "/who/are/{me:*}",
+			want: &ConflictError{
+				Segment:        "{me:*}",
+				NewPath:        "/who/are/{me:*}",
+				Wildcard:       "{you:*}",
+				ExistingPrefix: "/who/are/{you:*}",
+				msg:            errWildcardConflict,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		err := tree.TryAdd(test.path, handler)
+
+		var conflictErr *ConflictError
+		if !errors.As(err, &conflictErr) {
+			t.Fatalf("Path '%s' - Expected *ConflictError, got %T: %v", test.path, err, err)
+		}
+
+		if !reflect.DeepEqual(conflictErr, test.want) {
+			t.Errorf("Path '%s' - ConflictError == %#v, want %#v", test.path, conflictErr, test.want)
+		}
+	}
+
+	err := tree.TryAdd("/con{tact}", handler)
+	if want := "a handler is already registered for path '/con{tact}'"; err == nil || err.Error() != want {
+		t.Errorf("Unexpected error: %v, want %s", err, want)
+	}
+
+	err = tree.TryAdd("invalid", handler)
+	if want := "path must begin with '/' in path 'invalid'"; err == nil || err.Error() != want {
+		t.Errorf("Unexpected error: %v, want %s", err, want)
+	}
+}
+
+func Test_TreeAddParamHandler(t *testing.T) {
+	var got Params
+
+	paramHandler := func(ctx *fasthttp.RequestCtx, ps Params) {
+		got = append(Params(nil), ps...)
+	}
+
+	tree := New()
+	tree.AddParamHandler("/users/{id}/posts/{slug:[a-z]+}-{n:[0-9]+}", paramHandler)
+	tree.AddParamHandler("/files/{dir}/{filepath:*}", paramHandler)
+	tree.AddParamHandler("/static", paramHandler)
+	tree.Add("/users/{id}", generateHandler())
+
+	tests := []struct {
+		path string
+		want Params
+	}{
+		{"/users/42/posts/hello-7", Params{{"id", "42"}, {"slug", "hello"}, {"n", "7"}}},
+		{"/files/docs/a/b.txt", Params{{"dir", "docs"}, {"filepath", "a/b.txt"}}},
+		{"/static", nil},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		got = nil
+
+		found, tsr := tree.Serve(test.path, ctx)
+		if !found || tsr {
+			t.Fatalf("Path '%s' - Serve() == %v, %v, want true, false", test.path, found, tsr)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Path '%s' - Params == %v, want %v", test.path, got, test.want)
+		}
+
+		for _, p := range test.want {
+			if v := ctx.UserValue(p.Key); v != nil {
+				t.Errorf("Path '%s' - Unexpected user value '%s' == %v", test.path, p.Key, v)
+			}
+		}
+
+		// The handle also works when it's returned by Get
+		ctx = new(fasthttp.RequestCtx)
+		got = nil
+
+		handler, _ := tree.Get(test.path, ctx)
+		handler(ctx)
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Path '%s' - Get() params == %v, want %v", test.path, got, test.want)
+		}
+	}
+
+	if got := (Params{{"id", "42"}}).ByName("id"); got != "42" {
+		t.Errorf("ByName() == %s, want %s", got, "42")
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+
+	// The regular handles are served with the params as user values
+	if found, _ := tree.Serve("/users/42", ctx); !found {
+		t.Error("Expected a handle for '/users/42'")
+	} else if v := ctx.UserValue("id"); v != "42" {
+		t.Errorf("User value 'id' == %v, want %s", v, "42")
+	}
+
+	if found, tsr := tree.Serve("/static/", ctx); found || !tsr {
+		t.Errorf("Serve() == %v, %v, want false, true", found, tsr)
+	}
+
+	err := catchPanic(func() {
+		tree.AddParamHandler("/nil", nil)
+	})
+
+	if err == nil || fmt.Sprint(err) != "nil handler" {
+		t.Errorf("Expected 'nil handler' panic, got %v", err)
+	}
+}
+
+func Benchmark_Get(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+
+	tree := New()
+
+	// for i := 0; i < 3000; i++ {
+	// 	tree.Add(
+	// 		fmt.Sprintf("/%s", bytes.Rand(make([]byte, 15))), handler,
+	// 	)
+	// }
+
+	tree.Add("/", handler)
+	tree.Add("/plaintext", handler)
+	tree.Add("/json", handler)
+	tree.Add("/fortune", handler)
+	tree.Add("/fortune-quick", handler)
+	tree.Add("/db", handler)
+	tree.Add("/queries", handler)
+	tree.Add("/update", handler)
+
+	ctx := new(fasthttp.RequestCtx)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Get("/update", ctx)
+	}
+}
+
+func Benchmark_GetWithRegex(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+
+	tree := New()
+	ctx := new(fasthttp.RequestCtx)
+
+	tree.Add("/api/{version:v[0-9]}/data", handler)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Get("/api/v1/data", ctx)
+	}
+}
+
+func Benchmark_GetWithEnum(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+
+	tree := New()
+	ctx := new(fasthttp.RequestCtx)
+
+	tree.Add("/colors/{color:enum(red,green,blue,cyan,magenta,yellow)}/data", handler)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Get("/colors/yellow/data", ctx)
+	}
+}
+
+func Benchmark_GetWithRegexAlternation(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+
+	tree := New()
+	ctx := new(fasthttp.RequestCtx)
+
+	tree.Add("/colors/{color:red|green|blue|cyan|magenta|yellow}/data", handler)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Get("/colors/yellow/data", ctx)
+	}
+}
+
+func Benchmark_GetWithParams(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+
+	tree := New()
+	ctx := new(fasthttp.RequestCtx)
+
+	tree.Add("/api/{version}/data", handler)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Get("/api/v1/data", ctx)
+	}
+}
+
+func Benchmark_ServeWithParams(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx, ps Params) {}
+
+	tree := New()
+	ctx := new(fasthttp.RequestCtx)
+
+	tree.AddParamHandler("/api/{version}/data", handler)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.Serve("/api/v1/data", ctx)
+	}
+}
+
+func Benchmark_FindCaseInsensitivePath(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+
+	tree := New()
+	buf := bytebufferpool.Get()
+
+	tree.Add("/endpoint", handler)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.FindCaseInsensitivePath("/ENdpOiNT", false, buf)
+		buf.Reset()
+	}
+}
+
+func Benchmark_FindCaseInsensitivePathWithParams(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+
+	tree := New()
+	buf := bytebufferpool.Get()
+
+	tree.Add("/endpoint", handler)
+	tree.Add("/users/{id}/posts/{post}", handler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.FindCaseInsensitivePath("/USERS/1/Posts/2", false, buf)
+		buf.Reset()
+	}
+}
+
+func Benchmark_FindCaseInsensitivePathExact(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+
+	tree := New()
+	buf := bytebufferpool.Get()
+
+	tree.Add("/endpoint", handler)
+	tree.Add("/users/{id}/posts/{post}", handler)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		tree.FindCaseInsensitivePath("/users/1/posts/2", false, buf)
+		buf.Reset()
+	}
+}
+
+func Test_TreeAddExact(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.AddExact("/webhook", handler, nil, 0)
+	tree.AddExact("/hooks/{id}/", handler, nil, 0)
+	tree.AddExact("/raw/{path:*}", handler, nil, 0)
+	tree.Add("/users", handler)
+
+	tests := []struct {
+		path    string
+		handler fasthttp.RequestHandler
+		tsr     bool
+		params  map[string]interface{}
+	}{
+		{"/webhook", handler, false, nil},
+		{"/webhook/", nil, false, nil},
+		{"/hooks/1/", handler, false, map[string]interface{}{"id": "1"}},
+		{"/hooks/1", nil, false, nil},
+		{"/raw/a/b", handler, false, map[string]interface{}{"path": "a/b"}},
+		{"/users/", nil, true, nil},
+	}
+
+	for _, test := range tests {
+		testHandlerAndParams(t, tree, test.path, test.handler, test.tsr, test.params)
+	}
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	for _, path := range []string{"/WEBHOOK", "/webhook", "/Webhook/", "/HOOKS/1/", "/hooks/1", "/RAW/a"} {
+		if found := tree.FindCaseInsensitivePath(path, true, buf); found {
+			t.Errorf("FindCaseInsensitivePath(%s) == %s, true, want false", path, buf)
+		}
+
+		buf.Reset()
+	}
+
+	if found := tree.FindCaseInsensitivePath("/USERS", true, buf); !found || buf.String() != "/users" {
+		t.Errorf("FindCaseInsensitivePath(/USERS) == %s, %v, want /users, true", buf, found)
+	}
+
+	if err := catchPanic(func() { tree.AddExact("/nil", nil, nil, 0) }); err == nil {
+		t.Error("Expected a panic with a nil handler")
+	}
+}
+
+func Test_TreeWildcardValue(t *testing.T) {
+	handler := generateHandler()
+
+	// The wildcard value is the rest of the path after the slash which
+	// precedes the wildcard in the route, either at the root or nested,
+	// and with a single route or more
+	tests := []struct {
+		routes []string
+		path   string
+		value  interface{}
+	}{
+		{[]string{"/{filepath:*}"}, "/", ""},
+		{[]string{"/{filepath:*}"}, "/a/b", "a/b"},
+		{[]string{"/{filepath:*}", "/static"}, "/", ""},
+		{[]string{"/{filepath:*}", "/static"}, "/a/b", "a/b"},
+		{[]string{"/src/{filepath:*}"}, "/src/", ""},
+		{[]string{"/src/{filepath:*}"}, "/src/a/b", "a/b"},
+		{[]string{"/src/{filepath:*}", "/src/data"}, "/src/", ""},
+		{[]string{"/src/{filepath:*}", "/src/data"}, "/src/a/b", "a/b"},
+		{[]string{"/src/{dir}/{filepath:*}"}, "/src/x/", ""},
+		{[]string{"/src/{dir}/{filepath:*}"}, "/src/x/a/b", "a/b"},
+		// The rest of the path is kept as is, so a repeated slash
+		// is the leading slash of the value
+		{[]string{"/src/{filepath:*}"}, "/src//a", "/a"},
+		{[]string{"/{filepath:*}"}, "//a", "/a"},
+	}
+
+	for _, test := range tests {
+		tree := New()
+		for _, route := range test.routes {
+			tree.Add(route, handler)
+		}
+
+		ctx := new(fasthttp.RequestCtx)
+
+		if h, _ := tree.Get(test.path, ctx); h == nil {
+			t.Errorf("Routes %v - path '%s' not found", test.routes, test.path)
+		} else if value := ctx.UserValue("filepath"); value != test.value {
+			t.Errorf("Routes %v - path '%s' filepath == %q, want %q", test.routes, test.path, value, test.value)
+		}
+	}
+}
+
+func Test_TreeGetParams(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.Add("/users/{id}/posts/{post}", handler)
+	tree.Add("/files/{dir}/{filepath:**}", handler)
+	tree.AddWhen("/private/{id}", handler, func(_ *fasthttp.RequestCtx) bool { return false })
+
+	tests := []struct {
+		path   string
+		found  bool
+		tsr    bool
+		params Params
+	}{
+		{"/users/1/posts/hello", true, false, Params{{"id", "1"}, {"post", "hello"}}},
+		{"/files/docs/a/b", true, false, Params{{"dir", "docs"}, {"filepath", "a/b"}}},
+		{"/private/1", true, false, Params{{"id", "1"}}},
+		{"/users/1/posts/hello/", false, true, Params{}},
+		{"/users/1", false, false, Params{}},
+	}
+
+	buf := make(Params, 0, 4)
+
+	for _, test := range tests {
+		h, params, tsr := tree.GetParams(test.path, buf[:0])
+
+		if (h != nil) != test.found || tsr != test.tsr {
+			t.Errorf("Path '%s' - found, tsr == %v, %v, want %v, %v", test.path, h != nil, tsr, test.found, test.tsr)
+		}
+
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("Path '%s' - params == %v, want %v", test.path, params, test.params)
+		}
+	}
+
+	// The params are appended to the given ones
+	_, params, _ := tree.GetParams("/users/1/posts/hello", Params{{"a", "b"}})
+	if want := (Params{{"a", "b"}, {"id", "1"}, {"post", "hello"}}); !reflect.DeepEqual(params, want) {
+		t.Errorf("Params == %v, want %v", params, want)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		tree.GetParams("/users/1/posts/hello", buf[:0])
+	})
+
+	if allocs != 0 {
+		t.Errorf("GetParams allocs == %v, want 0", allocs)
+	}
+}
+
+func Test_TreeAddWithoutFixedPath(t *testing.T) {
+	handler := generateHandler()
+
+	tree := New()
+	tree.AddWithoutFixedPath("/secret", handler, nil, 0)
+	tree.AddWithoutFixedPath("/hidden/{id}/", handler, nil, 0)
+	tree.Add("/public", handler)
+
+	testHandlerAndParams(t, tree, "/secret", handler, false, nil)
+	testHandlerAndParams(t, tree, "/secret/", nil, true, nil)
+	testHandlerAndParams(t, tree, "/hidden/1", nil, true, nil)
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	for _, path := range []string{"/SECRET", "/Secret/", "/HIDDEN/1/", "/Hidden/1"} {
+		if found := tree.FindCaseInsensitivePath(path, true, buf); found {
+			t.Errorf("FindCaseInsensitivePath(%s) == %s, true, want false", path, buf)
+		}
+
+		buf.Reset()
+	}
+
+	for path, want := range map[string]string{"/PUBLIC": "/public", "/Public/": "/public"} {
+		if found := tree.FindCaseInsensitivePath(path, true, buf); !found || buf.String() != want {
+			t.Errorf("FindCaseInsensitivePath(%s) == %s, %v, want %s, true", path, buf, found, want)
+		}
+
+		buf.Reset()
+	}
+}
+
+func deferSortRoutes(n int) []string {
+	routes := make([]string, 0, n)
+
+	for i := 0; len(routes) < n; i++ {
+		routes = append(routes,
+			fmt.Sprintf("/api/v%d/users/{id}/posts/%d", i%5, i),
+			fmt.Sprintf("/static/%d/{filepath:*}", i),
+			fmt.Sprintf("/r%d/{name}/items/{item:[0-9]+}", i),
+			fmt.Sprintf("/r%d/x", i),
+		)
+	}
+
+	return routes[:n]
+}
+
+func Test_TreeDeferSort(t *testing.T) {
+	handler := generateHandler()
+	routes := deferSortRoutes(200)
+
+	tree := New()
+	deferred := New()
+	deferred.DeferSort = true
+
+	for _, route := range routes {
+		tree.Add(route, handler)
+		deferred.Add(route, handler)
+	}
+
+	deferred.Finalize()
+
+	if got, want := deferred.String(), tree.String(); got != want {
+		t.Errorf("Finalize tree == %s, want %s", got, want)
+	}
+
+	for _, path := range []string{"/api/v2/users/1/posts/7", "/static/3/a/b.css", "/r6/bob/items/42", "/r10/x", "/r10/x/", "/r10/y"} {
+		wantH, wantTSR := tree.Get(path, nil)
+		gotH, gotTSR := deferred.Get(path, nil)
+
+		if (gotH == nil) != (wantH == nil) || gotTSR != wantTSR {
+			t.Errorf("Get(%s) == %v, %v, want %v, %v", path, gotH != nil, gotTSR, wantH != nil, wantTSR)
+		}
+	}
+}
+
+func Benchmark_AddDeferSort(b *testing.B) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+	routes := deferSortRoutes(2000)
+
+	for _, deferSort := range []bool{false, true} {
+		b.Run(fmt.Sprintf("DeferSort=%v", deferSort), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				tree := New()
+				tree.DeferSort = deferSort
+
+				for _, route := range routes {
+					tree.Add(route, handler)
+				}
+
+				tree.Finalize()
+			}
+		})
+	}
+}
+
+// checksumMatcher matches the ids whose last digit is the sum
+// of the other digits modulo 10
+type checksumMatcher struct{}
+
+func (checksumMatcher) Match(segment string) (string, bool) {
+	if len(segment) < 2 {
+		return "", false
+	}
+
+	sum := 0
+	for i := 0; i < len(segment); i++ {
+		if segment[i] < '0' || segment[i] > '9' {
+			return "", false
+		} else if i < len(segment)-1 {
+			sum += int(segment[i] - '0')
+		}
+	}
+
+	return segment[:len(segment)-1], sum%10 == int(segment[len(segment)-1]-'0')
+}
+
+type lowerMatcher struct{}
+
+func (lowerMatcher) Match(segment string) (string, bool) {
+	return strings.ToLower(segment), true
+}
+
+func Test_TreeAddWithMatchers(t *testing.T) {
+	handler := generateHandler()
+	slugHandler := generateHandler()
+	editHandler := generateHandler()
+
+	checksum := map[string]Matcher{"id": checksumMatcher{}}
+
+	tree := New()
+	tree.AddWithMatchers("/x/{id}", handler, nil, 0, checksum)
+	tree.AddWithMatchers("/x/{id}/edit", editHandler, nil, 0, checksum)
+	tree.Add("/x/{slug}", slugHandler)
+	tree.AddWithMatchers("/r/{id:[0-9]+}.json", handler, nil, 0, checksum)
+	tree.AddWithMatchers("/u/{name}/{path:*}", handler, nil, 0, map[string]Matcher{"name": lowerMatcher{}})
+
+	testHandlerAndParams(t, tree, "/x/123", handler, false, map[string]interface{}{"id": "12"})
+	testHandlerAndParams(t, tree, "/x/124", slugHandler, false, map[string]interface{}{"slug": "124"})
+	testHandlerAndParams(t, tree, "/x/123/edit", editHandler, false, map[string]interface{}{"id": "12"})
+	testHandlerAndParams(t, tree, "/x/124/edit", nil, false, nil)
+	testHandlerAndParams(t, tree, "/r/4150.json", handler, false, map[string]interface{}{"id": "415"})
+	testHandlerAndParams(t, tree, "/r/4157.json", nil, false, nil)
+	testHandlerAndParams(t, tree, "/u/BOB/a/b", handler, false, map[string]interface{}{"name": "bob", "path": "a/b"})
+
+	h, ps, _ := tree.GetParams("/x/55/edit", nil)
+	if want := (Params{{Key: "id", Value: "5"}}); h == nil || !reflect.DeepEqual(ps, want) {
+		t.Errorf("GetParams(/x/55/edit) == %v, want %v", ps, want)
+	}
+
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	if found := tree.FindCaseInsensitivePath("/X/123/EDIT", true, buf); !found || buf.String() != "/x/123/edit" {
+		t.Errorf("FindCaseInsensitivePath(/X/123/EDIT) == %s, %v, want /x/123/edit, true", buf, found)
+	}
+
+	buf.Reset()
+
+	if found := tree.FindCaseInsensitivePath("/X/124/EDIT", true, buf); found {
+		t.Errorf("FindCaseInsensitivePath(/X/124/EDIT) == %s, true, want false", buf)
+	}
+
+	for path, matchers := range map[string]map[string]Matcher{
+		"/x/{id}/other":  nil,
+		"/x/{id}/lower":  {"id": lowerMatcher{}},
+		"/y/{id}":        {"name": checksumMatcher{}},
+		"/y/{path:*}":    {"path": checksumMatcher{}},
+		"/y/{id}/{name}": {"id": nil},
+	} {
+		err := catchPanic(func() {
+			tree.AddWithMatchers(path, handler, nil, 0, matchers)
+		})
+
+		if err == nil {
+			t.Errorf("Expected panic adding path '%s' with matchers %v", path, matchers)
+		}
+	}
+}
+
+func Test_TreeTrailingSlashRoutes(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		handler := generateHandler()
+		slashHandler := generateHandler()
+
+		routes := [][2]interface{}{
+			{"/x", handler}, {"/x/", slashHandler},
+			{"/a/b/c", handler}, {"/a/b/c/", slashHandler},
+			{"/u/{id}", handler}, {"/u/{id}/", slashHandler},
+		}
+
+		tree := New()
+		for i := range routes {
+			route := routes[i]
+			if reverse {
+				route = routes[len(routes)-1-i]
+			}
+
+			tree.Add(route[0].(string), route[1].(fasthttp.RequestHandler))
+		}
+
+		tree.Add("/a/b/c/d", handler)
+		tree.Add("/a/b", handler)
+
+		testHandlerAndParams(t, tree, "/x", handler, false, nil)
+		testHandlerAndParams(t, tree, "/x/", slashHandler, false, nil)
+		testHandlerAndParams(t, tree, "/a/b/c", handler, false, nil)
+		testHandlerAndParams(t, tree, "/a/b/c/", slashHandler, false, nil)
+		testHandlerAndParams(t, tree, "/a/b/", nil, true, nil)
+		testHandlerAndParams(t, tree, "/u/1", handler, false, map[string]interface{}{"id": "1"})
+		testHandlerAndParams(t, tree, "/u/1/", slashHandler, false, map[string]interface{}{"id": "1"})
+
+		for _, path := range []string{"/x/", "/u/{id}/"} {
+			if err := catchPanic(func() { tree.Add(path, handler) }); err == nil {
+				t.Errorf("Expected panic re-adding path '%s'", path)
+			}
+		}
 	}
 }
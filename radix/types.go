@@ -2,16 +2,82 @@ package radix
 
 import (
 	"regexp"
+	"sync/atomic"
 
 	"github.com/valyala/fasthttp"
 )
 
 type nodeType uint8
 
+// Predicate checks if a route matches the request
+type Predicate func(ctx *fasthttp.RequestCtx) bool
+
+// Matcher matches the value of a path param, like a regex but with custom
+// logic (e.g. to validate a checksummed id). It returns the value to save
+// for the param, which could be normalized, and if the segment matches.
+// Otherwise the route is not matched, as if the regex didn't match.
+type Matcher interface {
+	Match(segment string) (value string, ok bool)
+}
+
+// Param is a path param of the matched route
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params are the path params of the matched route,
+// in the same order they appear in the route path
+type Params []Param
+
+// ParamHandler is a request handler which receives the path params of the
+// matched route, instead of reading them from the ctx user values.
+//
+// The params are only valid until the handler returns, so they must be
+// copied to be retained.
+type ParamHandler func(ctx *fasthttp.RequestCtx, ps Params)
+
+type nodeHandler struct {
+	handler   fasthttp.RequestHandler
+	predicate Predicate
+
+	// The path of the route, as it was added to the tree
+	path string
+
+	// If not nil, the params are passed to it by Tree.Serve
+	// instead of being saved as ctx.UserValue
+	paramHandler ParamHandler
+
+	priority int
+
+	// If true, the route is only matched by its exact path, so it's
+	// excluded from the TSR and the case-insensitive fixes
+	exact bool
+
+	// If true, the route is excluded from the case-insensitive fixes
+	noFixedPath bool
+
+	// The matchers of the route params by key,
+	// which are set in the param nodes when adding the route
+	matchers map[string]Matcher
+
+	// The param keys of the route,
+	// in the same order they appear in its path
+	paramKeys []string
+
+	// The matrix param key of each segment of the route,
+	// if the tree is added with Tree.MatrixParams
+	matrixKeys []string
+}
+
 type nodeWildcard struct {
 	path     string
 	paramKey string
-	handler  fasthttp.RequestHandler
+	segments bool
+
+	// The handler is stored atomically, so it could be replaced
+	// safely while serving requests when the tree is mutable
+	handler atomic.Pointer[nodeHandler]
 }
 
 type node struct {
@@ -19,13 +85,42 @@ type node struct {
 
 	path         string
 	tsr          bool
-	handler      fasthttp.RequestHandler
+	handler      atomic.Pointer[nodeHandler]
 	hasWildChild bool
 	children     []*node
 	wildcard     *nodeWildcard
 
 	paramKeys  []string
 	paramRegex *regexp.Regexp
+
+	// The ranges of the numeric params, aligned with the param keys,
+	// or nil if there are no numeric params
+	paramRanges []*paramRange
+
+	// The matchers of the params, aligned with the param keys,
+	// or nil if there are no matchers
+	paramMatchers []Matcher
+
+	// The allowed values of the param, registered with the enum shorthand
+	// (e.g. '{color:enum(red,green)}'), or nil if it's not an enum.
+	// It's only set for a param alone in its segment, without regex.
+	paramEnum map[string]struct{}
+
+	// If the param regex could match a slash and a route ends with the
+	// param, so it's matched against the rest of the path when the routes
+	// which go on are not matched. It's set when adding the route.
+	paramSpans bool
+
+	// The highest priority of the routes under the node,
+	// or the lowest one if there are no routes under it
+	priority int
+}
+
+// matrixParam is a matrix param of a path segment
+type matrixParam struct {
+	segment int
+	key     string
+	value   string
 }
 
 type wildPath struct {
@@ -35,8 +130,28 @@ type wildPath struct {
 	end   int
 	pType nodeType
 
+	segments bool
+
 	pattern string
 	regex   *regexp.Regexp
+
+	// The ranges of the numeric params, aligned with the keys
+	ranges []*paramRange
+
+	// The allowed values of the enum param, if it's alone in its segment
+	enum map[string]struct{}
+
+	// If the regex of the param could match a slash
+	spans bool
+}
+
+// paramRange is the range of the values of an int/float param,
+// registered with the shorthands (e.g. '{id:int(1,100)}')
+type paramRange struct {
+	float bool
+
+	minInt, maxInt     int64
+	minFloat, maxFloat float64
 }
 
 // Tree is a routes storage
@@ -45,4 +160,40 @@ type Tree struct {
 
 	// If enabled, the node handler could be updated
 	Mutable bool
+
+	// If enabled, the params at the same position of the tree must have the
+	// same names, even when they are followed by different paths or are
+	// constrained by different regexes, e.g. '/a/{x}' and '/a/{y}/b' conflict.
+	StrictWildcardNames bool
+
+	// If enabled, the matrix params of each path segment (e.g. '/users;id=42')
+	// are removed from the path before matching it, and saved as
+	// ctx.UserValue with the key '<segment>;<key>', where the segment is
+	// the one of the matched route at the same position: its param name if
+	// it's a single param (e.g. 'id;v' for '/users/{id}'), or its pattern text
+	// otherwise (e.g. 'users;id'). The segments captured by a wildcard use
+	// its param name. It must be set before adding any route.
+	MatrixParams bool
+
+	// If enabled, the TSR (trailing slash redirect) recommendations are not
+	// recorded when adding the routes, so their nodes are not created and
+	// Get never recommends a TSR. It must be set before adding any route.
+	DisableTSR bool
+
+	// If enabled, the static parts of the routes are lowercased when adding
+	// them, and matched case-insensitively (ASCII only), so '/USERS/Bob'
+	// matches '/Users/{name}' with the name 'Bob'. The param values
+	// keep their case. It must be set before adding any route.
+	Lowercase bool
+
+	// If enabled, the nodes are not reordered after adding each route,
+	// which speeds up the bulk registration of lots of routes.
+	// Tree.Finalize must be called once the routes are added,
+	// before looking up any path.
+	DeferSort bool
+
+	// If greater than zero, adding a route panics if the regex of any of its
+	// params compiles to a program with more instructions, to reject the
+	// pathological patterns (e.g. '{x:(a+)+}' or huge repetitions).
+	MaxRegexProgramSize int
 }
@@ -2,11 +2,16 @@ package radix
 
 import (
 	"fmt"
+	"math"
+	"reflect"
 	"regexp"
+	"regexp/syntax"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
 )
 
 func panicf(s string, args ...interface{}) {
@@ -69,9 +74,256 @@ func segmentEndIndex(path string, includeTSR bool) int {
 	return end
 }
 
+// spanEndIndex returns the end index of a param that spans the rest
+// of the path, leaving out the trailing slash to keep the TSR
+func spanEndIndex(path string) int {
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		return len(path) - 1
+	}
+
+	return len(path)
+}
+
+// lowerASCII returns the lowercase of the ASCII char
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+
+	return c
+}
+
+// equalStatic checks if the path is equal to the static path of a node,
+// which is already lowercased when fold is enabled
+func equalStatic(path, static string, fold bool) bool {
+	if path == static {
+		return true
+	} else if !fold || len(path) != len(static) {
+		return false
+	}
+
+	for i := 0; i < len(path); i++ {
+		if lowerASCII(path[i]) != static[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// balancedBraces checks if each '{' of the path is closed by a '}'
+func balancedBraces(path string) bool {
+	depth := 0
+
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return false
+			}
+
+			depth--
+		}
+	}
+
+	return depth == 0
+}
+
+// stripMatrixParams removes the matrix params (e.g. ';key=value') from each
+// segment of the given path, returning them apart
+func stripMatrixParams(path string) (string, []matrixParam) {
+	if strings.IndexByte(path, ';') == -1 {
+		return path, nil
+	}
+
+	var params []matrixParam
+
+	stripped := make([]byte, 0, len(path))
+
+	for index := 0; len(path) > 0; index++ {
+		end := 1 + segmentEndIndex(path[1:], false)
+		segment := path[:end]
+
+		if i := strings.IndexByte(segment, ';'); i > -1 {
+			for _, param := range strings.Split(segment[i+1:], ";") {
+				if param == "" {
+					continue
+				}
+
+				key, value, _ := strings.Cut(param, "=")
+				params = append(params, matrixParam{segment: index, key: key, value: value})
+			}
+
+			segment = segment[:i]
+		}
+
+		stripped = append(stripped, segment...)
+		path = path[end:]
+	}
+
+	return string(stripped), params
+}
+
+// matrixSegmentKeys returns the matrix param key of each segment of the
+// route path, which is the param name of a segment with a single param,
+// or the segment pattern text otherwise
+func matrixSegmentKeys(path string) []string {
+	var keys []string
+
+	depth := 0
+	start := 1
+
+	for i := 1; i <= len(path); i++ {
+		if i < len(path) {
+			switch path[i] {
+			case '{':
+				depth++
+				continue
+			case '}':
+				depth--
+				continue
+			case '/':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+
+		segment := path[start:i]
+		if params := getParamKeys(segment); len(params) == 1 && segment[0] == '{' && segment[len(segment)-1] == '}' {
+			segment = params[0]
+		}
+
+		keys = append(keys, segment)
+		start = i + 1
+	}
+
+	return keys
+}
+
+// equalStrings checks if both slices have the same strings in the same order
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalRegex checks if both regexes are nil or have the same pattern
+func equalRegex(a, b *regexp.Regexp) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.String() == b.String()
+}
+
+// equalRanges checks if the numeric param ranges have the same bounds.
+// A missing range is the same as a nil one, which has no bounds.
+func equalRanges(a, b []*paramRange) bool {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var ra, rb *paramRange
+
+		if i < len(a) {
+			ra = a[i]
+		}
+
+		if i < len(b) {
+			rb = b[i]
+		}
+
+		if ra == nil || rb == nil {
+			if ra != rb {
+				return false
+			}
+		} else if *ra != *rb {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equalMatchers checks if the param matchers are the same ones.
+// The matchers of an uncomparable type are never equal.
+func equalMatchers(a, b []Matcher) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] == nil || b[i] == nil {
+			if a[i] != b[i] {
+				return false
+			}
+
+			continue
+		}
+
+		if !reflect.TypeOf(a[i]).Comparable() || !reflect.TypeOf(b[i]).Comparable() || a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isWildcardKey checks if the key is the one of a wildcard of the path
+func isWildcardKey(path, key string) bool {
+	return strings.Contains(path, "{"+key+":*}") || strings.Contains(path, "{"+key+":**}")
+}
+
+// getParamKeys returns the keys of the params of the path,
+// in the same order they appear in it
+func getParamKeys(path string) []string {
+	var keys []string
+
+	for start := 0; start < len(path); start++ {
+		if path[start] != '{' {
+			continue
+		}
+
+		brackets := 0
+		end := start + 1
+
+		for ; end < len(path); end++ {
+			if path[end] == '{' {
+				brackets++
+			} else if path[end] == '}' {
+				if brackets == 0 {
+					break
+				}
+
+				brackets--
+			}
+		}
+
+		key := path[start+1 : end]
+		if i := strings.IndexByte(key, ':'); i > -1 {
+			key = key[:i]
+		}
+
+		keys = append(keys, key)
+		start = end
+	}
+
+	return keys
+}
+
 // findWildPath search for a wild path segment and check the name for invalid characters.
 // Returns -1 as index, if no param/wildcard was found.
-func findWildPath(path string, fullPath string) *wildPath {
+func findWildPath(path, fullPath string, maxRegexSize int) *wildPath {
 	// Find start
 	for start, c := range []byte(path) {
 		// A wildcard starts with ':' (param) or '*' (wildcard)
@@ -93,11 +345,12 @@ func findWildPath(path string, fullPath string) *wildPath {
 
 				end := start + end + 2
 				wp := &wildPath{
-					path:  path[start:end],
-					keys:  []string{path[start+1 : end-1]},
-					start: start,
-					end:   end,
-					pType: param,
+					path:   path[start:end],
+					keys:   []string{path[start+1 : end-1]},
+					start:  start,
+					end:    end,
+					pType:  param,
+					ranges: []*paramRange{nil},
 				}
 
 				if len(path) > end && path[end] == '{' {
@@ -109,12 +362,23 @@ func findWildPath(path string, fullPath string) *wildPath {
 					wp.keys = []string{sn[0]}
 					pattern := sn[1]
 
-					if pattern == "*" {
+					if pattern == "*" || pattern == "**" {
 						wp.pattern = pattern
 						wp.pType = wildcard
+						wp.segments = pattern == "**"
+					} else if numPattern, r := numericParamPattern(pattern, fullPath); r != nil {
+						wp.pattern = "(" + numPattern + ")"
+						wp.regex = compileParamRegex(wp.pattern, fullPath, maxRegexSize)
+						wp.ranges[0] = r
+					} else if enumPattern, enum := enumParamPattern(pattern, fullPath); enum != nil {
+						// Matched by the set of values, unless the regex is
+						// needed to split the segment with other params
+						wp.pattern = "(" + enumPattern + ")"
+						wp.enum = enum
 					} else {
 						wp.pattern = "(" + pattern + ")"
-						wp.regex = regexp.MustCompile(wp.pattern)
+						wp.regex = compileParamRegex(wp.pattern, fullPath, maxRegexSize)
+						wp.spans = regexMatchesSlash(pattern)
 					}
 				} else if path[len(path)-1] != '/' {
 					wp.pattern = "(.*)"
@@ -134,8 +398,18 @@ func findWildPath(path string, fullPath string) *wildPath {
 				}
 
 				if len(path) > 0 {
+					// The param is followed by more chars in the segment
+					wp.spans = false
+					wp.enum = nil
+
+					if wp.pattern == "(.*)" {
+						// The param is followed by more chars in the segment,
+						// so it must not be greedy to avoid capturing them
+						wp.pattern = "(.*?)"
+					}
+
 					// Rebuild the wildpath with the prefix
-					wp2 := findWildPath(path, fullPath)
+					wp2 := findWildPath(path, fullPath, maxRegexSize)
 					if wp2 != nil {
 						prefix := path[:wp2.start]
 
@@ -143,13 +417,14 @@ func findWildPath(path string, fullPath string) *wildPath {
 						wp.path += prefix + wp2.path
 						wp.pattern += prefix + wp2.pattern
 						wp.keys = append(wp.keys, wp2.keys...)
+						wp.ranges = append(wp.ranges, wp2.ranges...)
 					} else {
 						wp.path += path
 						wp.pattern += path
 						wp.end += len(path)
 					}
 
-					wp.regex = regexp.MustCompile(wp.pattern)
+					wp.regex = compileParamRegex(wp.pattern, fullPath, maxRegexSize)
 				}
 
 				return wp
@@ -169,3 +444,185 @@ func findWildPath(path string, fullPath string) *wildPath {
 
 	return nil
 }
+
+// compileParamRegex compiles the regex of a param of the path, which panics
+// if it's invalid, or if its program has more instructions than maxSize
+// when it's greater than zero
+func compileParamRegex(pattern, fullPath string, maxSize int) *regexp.Regexp {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		panicf("invalid regex '%s' in path '%s': %v", pattern, fullPath, err)
+	}
+
+	if maxSize > 0 {
+		size, err := regexProgramSize(pattern)
+		if err != nil {
+			panicf("invalid regex '%s' in path '%s': %v", pattern, fullPath, err)
+		}
+
+		if size > maxSize {
+			panicf("regex '%s' is too complex (%d program instructions, max %d) in path '%s'", pattern, size, maxSize, fullPath)
+		}
+	}
+
+	return re
+}
+
+// regexProgramSize returns the number of instructions
+// of the compiled program of the regex pattern
+func regexProgramSize(pattern string) (int, error) {
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return 0, err
+	}
+
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return 0, err
+	}
+
+	return len(prog.Inst), nil
+}
+
+// regexMatchesSlash checks if the regex pattern could match a slash
+func regexMatchesSlash(pattern string) bool {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return false
+	}
+
+	return syntaxMatchesSlash(re)
+}
+
+func syntaxMatchesSlash(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if r == '/' {
+				return true
+			}
+		}
+	case syntax.OpCharClass:
+		for i := 0; i < len(re.Rune); i += 2 {
+			if re.Rune[i] <= '/' && '/' <= re.Rune[i+1] {
+				return true
+			}
+		}
+	}
+
+	for _, sub := range re.Sub {
+		if syntaxMatchesSlash(sub) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// numericParamPattern returns the regex pattern and the range of the values
+// of the int/float shorthands of a param pattern, e.g. 'int', 'float' or
+// 'int(1,100)'. The range is nil if the pattern is not a shorthand.
+func numericParamPattern(pattern, fullPath string) (string, *paramRange) {
+	name, args, hasArgs := strings.Cut(pattern, "(")
+
+	r := &paramRange{
+		minInt:   math.MinInt64,
+		maxInt:   math.MaxInt64,
+		minFloat: math.Inf(-1),
+		maxFloat: math.Inf(1),
+	}
+
+	var numPattern string
+
+	switch name {
+	case "int":
+		numPattern = "-?[0-9]+"
+	case "float":
+		numPattern = `-?[0-9]+(?:\.[0-9]+)?`
+		r.float = true
+	default:
+		return "", nil
+	}
+
+	if !hasArgs {
+		return numPattern, r
+	}
+
+	minValue, maxValue, ok := strings.Cut(strings.TrimSuffix(args, ")"), ",")
+	if !ok || !strings.HasSuffix(args, ")") {
+		panicf("invalid range '%s' in path '%s'", pattern, fullPath)
+	}
+
+	var minErr, maxErr error
+
+	if r.float {
+		r.minFloat, minErr = strconv.ParseFloat(strings.TrimSpace(minValue), 64)
+		r.maxFloat, maxErr = strconv.ParseFloat(strings.TrimSpace(maxValue), 64)
+		ok = r.minFloat <= r.maxFloat
+	} else {
+		r.minInt, minErr = strconv.ParseInt(strings.TrimSpace(minValue), 10, 64)
+		r.maxInt, maxErr = strconv.ParseInt(strings.TrimSpace(maxValue), 10, 64)
+		ok = r.minInt <= r.maxInt
+	}
+
+	if minErr != nil || maxErr != nil || !ok {
+		panicf("invalid range '%s' in path '%s'", pattern, fullPath)
+	}
+
+	return numPattern, r
+}
+
+// enumParamPattern returns the regex pattern and the set of the values of
+// the enum shorthand of a param pattern, e.g. 'enum(red,green,blue)'.
+// The set is nil if the pattern is not an enum.
+func enumParamPattern(pattern, fullPath string) (string, map[string]struct{}) {
+	args, ok := strings.CutPrefix(pattern, "enum(")
+	if !ok {
+		return "", nil
+	}
+
+	args, ok = strings.CutSuffix(args, ")")
+	if !ok {
+		panicf("invalid enum '%s' in path '%s'", pattern, fullPath)
+	}
+
+	values := strings.Split(args, ",")
+	enum := make(map[string]struct{}, len(values))
+
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+		if values[i] == "" || strings.IndexByte(values[i], '/') > -1 {
+			panicf("invalid enum '%s' in path '%s'", pattern, fullPath)
+		}
+
+		enum[values[i]] = struct{}{}
+		values[i] = regexp.QuoteMeta(values[i])
+	}
+
+	return strings.Join(values, "|"), enum
+}
+
+// userValueParams returns the params with the given keys saved as ctx.UserValue.
+// The wildcard values split in segments are joined again by '/'.
+func userValueParams(ctx *fasthttp.RequestCtx, keys []string) Params {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ps := make(Params, len(keys))
+
+	for i, key := range keys {
+		ps[i].Key = key
+
+		switch value := ctx.UserValue(key).(type) {
+		case string:
+			ps[i].Value = value
+		case []string:
+			ps[i].Value = strings.Join(value, "/")
+		}
+	}
+
+	return ps
+}
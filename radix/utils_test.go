@@ -33,7 +33,7 @@ func Test_findWildPath(t *testing.T) {
 				start: 5,
 				end:   22,
 				pType: param,
-				regex: regexp.MustCompile("(.*)_(.*)"),
+				regex: regexp.MustCompile("(.*?)_(.*)"),
 			},
 		},
 		{
@@ -58,6 +58,17 @@ func Test_findWildPath(t *testing.T) {
 				regex: regexp.MustCompile("([a-z]{1}:[0-9]{1})"),
 			},
 		},
+		{
+			path: "/api/{param1}-{param2}-{param3}/data",
+			want: wildPath{
+				path:  "{param1}-{param2}-{param3}",
+				keys:  []string{"param1", "param2", "param3"},
+				start: 5,
+				end:   31,
+				pType: param,
+				regex: regexp.MustCompile("(.*?)-(.*?)-(.*)"),
+			},
+		},
 		{
 			path: "/api/{param1:[a-z]{3}}_{param2}/data",
 			want: wildPath{
@@ -77,7 +88,7 @@ func Test_findWildPath(t *testing.T) {
 				start: 11,
 				end:   43,
 				pType: param,
-				regex: regexp.MustCompile("([a-z]{3})_(.*)suffix"),
+				regex: regexp.MustCompile("([a-z]{3})_(.*?)suffix"),
 			},
 		},
 	}
@@ -85,7 +96,7 @@ func Test_findWildPath(t *testing.T) {
 	for _, test := range tests {
 		fullPath := test.path
 
-		result := findWildPath(test.path, fullPath)
+		result := findWildPath(test.path, fullPath, 0)
 
 		if result.path != test.want.path {
 			t.Errorf("wildPath.path == %s, want %s", result.path, test.want.path)
@@ -176,7 +187,7 @@ func Test_findWildPathConflict(t *testing.T) {
 		fullPath := test.path
 
 		err := catchPanic(func() {
-			findWildPath(test.path, fullPath)
+			findWildPath(test.path, fullPath, 0)
 		})
 
 		if test.wantErr != (err != nil) {
@@ -188,3 +199,41 @@ func Test_findWildPathConflict(t *testing.T) {
 		}
 	}
 }
+
+func Test_getParamKeys(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/", nil},
+		{"/users/{id}", []string{"id"}},
+		{"/users/{id}/posts/{post:[0-9]+}", []string{"id", "post"}},
+		{"/items/{id}-{color}-{size:[a-z]{1,3}}", []string{"id", "color", "size"}},
+		{"/files/{filepath:*}", []string{"filepath"}},
+	}
+
+	for _, test := range tests {
+		if got := getParamKeys(test.path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("getParamKeys(%q) == %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func Test_matrixSegmentKeys(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"/", []string{""}},
+		{"/users/{id}", []string{"users", "id"}},
+		{"/users/{id:[0-9]+}/", []string{"users", "id", ""}},
+		{"/items/{id}-{color}/{size:[a-z/]{1,3}}", []string{"items", "{id}-{color}", "size"}},
+		{"/files/{filepath:*}", []string{"files", "filepath"}},
+	}
+
+	for _, test := range tests {
+		if got := matrixSegmentKeys(test.path); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("matrixSegmentKeys(%q) == %v, want %v", test.path, got, test.want)
+		}
+	}
+}
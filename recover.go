@@ -0,0 +1,33 @@
+package router
+
+import "github.com/valyala/fasthttp"
+
+// Recover returns a middleware which recovers the panics of the wrapped
+// handler, logging them with their stack trace and replying with
+// 500 Internal Server Error. If logger is nil, the ctx logger is used.
+//
+// Unlike Router.PanicHandler, which recovers the panics of all the routes,
+// it could be added to a group, so each group has its own recovery policy.
+// Since the panic is recovered inside the group middleware chain, the
+// outer middleware run as usual after it.
+// Use:
+//
+//	api := router.Group("/api")
+//	api.AddMiddleware(router.Recover(nil))
+func Recover(logger fasthttp.Logger) Middleware {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			defer func() {
+				if rcv := recover(); rcv != nil {
+					if logger == nil {
+						defaultPanicHandler(ctx, rcv)
+					} else {
+						replyPanic(ctx, logger, rcv)
+					}
+				}
+			}()
+
+			next(ctx)
+		}
+	}
+}
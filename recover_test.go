@@ -0,0 +1,86 @@
+package router
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestRecover(t *testing.T) {
+	outer := func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			defer ctx.Response.Header.Set("X-Deferred", "outer")
+
+			next(ctx)
+			ctx.Response.Header.Set("X-After", "outer")
+		}
+	}
+
+	logger := new(testLogger)
+
+	r := New()
+
+	api := r.Group("/api")
+	api.AddMiddleware(outer, Recover(logger))
+	api.GET("/panic", func(_ *fasthttp.RequestCtx) {
+		panic("oops!")
+	})
+	api.GET("/ok", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("ok")
+	})
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/api/panic")
+	r.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusInternalServerError {
+		t.Errorf("Unexpected status code %d, want %d", status, fasthttp.StatusInternalServerError)
+	}
+
+	for _, header := range []string{"X-Deferred", "X-After"} {
+		if value := string(ctx.Response.Header.Peek(header)); value != "outer" {
+			t.Errorf("Header %s == %q, want %q", header, value, "outer")
+		}
+	}
+
+	if len(logger.logs) != 1 || !strings.Contains(logger.logs[0], "panic recovered: oops!") || !strings.Contains(logger.logs[0], "goroutine") {
+		t.Errorf("Unexpected logs: %v", logger.logs)
+	}
+
+	ctx = new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/api/ok")
+	r.Handler(ctx)
+
+	if status, body := ctx.Response.StatusCode(), string(ctx.Response.Body()); status != fasthttp.StatusOK || body != "ok" {
+		t.Errorf("Unexpected response %d %q", status, body)
+	}
+
+	if len(logger.logs) != 1 {
+		t.Errorf("Unexpected logs: %v", logger.logs)
+	}
+
+	// Without logger, the ctx logger is used
+	admin := r.Group("/admin")
+	admin.AddMiddleware(Recover(nil))
+	admin.GET("/panic", func(_ *fasthttp.RequestCtx) {
+		panic("oops!")
+	})
+
+	req := new(fasthttp.Request)
+	req.SetRequestURI("/admin/panic")
+
+	ctxLogger := new(testLogger)
+
+	ctx = new(fasthttp.RequestCtx)
+	ctx.Init(req, nil, ctxLogger)
+	r.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusInternalServerError {
+		t.Errorf("Unexpected status code %d, want %d", status, fasthttp.StatusInternalServerError)
+	}
+
+	if len(ctxLogger.logs) != 1 || !strings.Contains(ctxLogger.logs[0], "panic recovered: oops!") {
+		t.Errorf("Unexpected ctx logs: %v", ctxLogger.logs)
+	}
+}
@@ -0,0 +1,296 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fasthttp/router/radix"
+)
+
+// Name sets the name of the route, to look it up with Router.NamedRoute.
+// The name must be unique in the router.
+func (b *RouteBuilder) Name(name string) *RouteBuilder {
+	b.checkNotRegistered()
+	b.name = name
+
+	return b
+}
+
+// Timeout limits the execution of the route handler to the given timeout,
+// like Router.HandleTimeout.
+func (b *RouteBuilder) Timeout(timeout time.Duration) *RouteBuilder {
+	b.checkNotRegistered()
+	b.timeout = timeout
+
+	return b
+}
+
+// Middleware appends the given middleware to the route, which run inside
+// the middleware of its group, so the first added one is the outermost.
+func (b *RouteBuilder) Middleware(middleware ...Middleware) *RouteBuilder {
+	b.checkNotRegistered()
+	b.middleware = append(b.middleware, middleware...)
+
+	return b
+}
+
+// Exact makes the route only match its exact path, disabling the
+// auto-correction for it: the requests which differ in case or in the
+// trailing slash are not redirected to it, but not found.
+// The path is still cleaned if Router.CleanPath is enabled, and matched
+// case-insensitively if Router.LowercaseRoutes is enabled.
+func (b *RouteBuilder) Exact() *RouteBuilder {
+	b.checkNotRegistered()
+	b.exact = true
+
+	return b
+}
+
+// NoFixedPathRedirect excludes the route from Router.RedirectFixedPath,
+// so the requests which differ in case, or need to be cleaned, are not
+// redirected to it, but not found (e.g. to avoid leaking its canonical path).
+// Unlike Exact, the trailing slash redirection still applies.
+func (b *RouteBuilder) NoFixedPathRedirect() *RouteBuilder {
+	b.checkNotRegistered()
+	b.noFixedPath = true
+
+	return b
+}
+
+// Secure makes the route only match the secure requests, which are made
+// over HTTPS (see Router.IsSecure). The insecure requests are replied with
+// 403 Forbidden, or redirected to HTTPS if Router.RedirectInsecure is enabled,
+// before running the route middleware and handler.
+//
+// Behind a proxy which terminates TLS, enable Router.TrustForwardedProto
+// to check the scheme forwarded in the X-Forwarded-Proto header.
+func (b *RouteBuilder) Secure() *RouteBuilder {
+	b.checkNotRegistered()
+	b.secure = true
+
+	return b
+}
+
+// MaxBodySize limits the request body of the route to the given size in bytes,
+// replying with 413 Request Entity Too Large before running the route
+// middleware and handler if it's exceeded.
+//
+// The body is read by fasthttp before routing the request, so the
+// fasthttp.Server.MaxRequestBodySize is still the upper limit of all routes,
+// which must be greater than the size of any route.
+func (b *RouteBuilder) MaxBodySize(size int) *RouteBuilder {
+	b.checkNotRegistered()
+
+	if size <= 0 {
+		panic("max body size must be greater than 0")
+	}
+
+	b.maxBodySize = size
+
+	return b
+}
+
+// ParamMatcher matches the value of the given param with the matcher,
+// in addition to its regex if any, so the route is only matched if the
+// matcher accepts the value, otherwise the request could be handled by
+// another route. The value returned by the matcher is the param value.
+//
+// The routes with the same param at the same position must be registered
+// with the same matcher, of a comparable type. It can't be combined with
+// Exact or NoFixedPathRedirect.
+func (b *RouteBuilder) ParamMatcher(name string, matcher radix.Matcher) *RouteBuilder {
+	b.checkNotRegistered()
+
+	if matcher == nil {
+		panic("matcher must not be nil")
+	} else if !hasParamKey(b.group.prefix+b.path, name) {
+		panic("param '" + name + "' not found in path '" + b.group.prefix + b.path + "'")
+	}
+
+	if b.matchers == nil {
+		b.matchers = make(map[string]radix.Matcher)
+	}
+
+	b.matchers[name] = matcher
+
+	return b
+}
+
+// AutoOptions replies automatically to the OPTIONS requests of the route
+// path with a CORS preflight reply: the "Allow" and
+// "Access-Control-Allow-Methods" headers are set with the allowed methods
+// of the path, and the other CORS headers according to the config, if the
+// request origin is allowed. It replaces the HandleOPTIONS and GlobalOPTIONS
+// behavior for the path, even if HandleOPTIONS is disabled.
+//
+// The config applies to the whole path, so the last one registered by the
+// routes of the path is used. A custom OPTIONS handler of the path takes
+// priority over it.
+func (b *RouteBuilder) AutoOptions(config CORSConfig) *RouteBuilder {
+	b.checkNotRegistered()
+	b.autoOptions = &config
+
+	return b
+}
+
+// When sets the predicate of the route, like Router.HandleWhen.
+func (b *RouteBuilder) When(predicate radix.Predicate) *RouteBuilder {
+	b.checkNotRegistered()
+	b.predicate = predicate
+
+	return b
+}
+
+// Priority sets the priority of the route, like Router.HandlePriority.
+func (b *RouteBuilder) Priority(priority int) *RouteBuilder {
+	b.checkNotRegistered()
+	b.priority = priority
+
+	return b
+}
+
+// Done registers the route with its configuration.
+// The route could not be configured anymore afterwards.
+func (b *RouteBuilder) Done() {
+	b.checkNotRegistered()
+
+	if b.handler == nil {
+		panic("handler must not be nil")
+	} else if len(b.matchers) > 0 && (b.exact || b.noFixedPath) {
+		panic("param matchers can't be combined with an exact or no fixed path redirect route in path '" + b.group.prefix + b.path + "'")
+	}
+
+	r := b.group.router
+	path := b.group.fullPath(b.path)
+
+	if _, ok := r.routeNames[b.name]; ok && b.name != "" {
+		panic("route name '" + b.name + "' is already registered")
+	}
+
+	handler := newTimeoutHandler(b.handler, b.timeout)
+
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		handler = b.middleware[i](handler)
+	}
+
+	if b.maxBodySize > 0 {
+		handler = newMaxBodySizeHandler(handler, b.maxBodySize)
+	}
+
+	if b.secure {
+		handler = r.secureHandler(handler)
+	}
+
+	r.handle(b.method, path, nil, routeHandler{
+		handler:     b.group.wrapHandler(path, handler),
+		predicate:   b.predicate,
+		priority:    b.priority,
+		exact:       b.exact,
+		noFixedPath: b.noFixedPath,
+		matchers:    b.matchers,
+		autoOptions: b.autoOptions,
+		group:       b.group,
+	})
+
+	if b.name != "" {
+		paths := getOptionalPaths(path)
+		if len(paths) == 0 {
+			paths = append(paths, path)
+		}
+
+		r.routeNames[b.name] = RouteInfo{Method: b.method, Path: path, Paths: paths}
+	}
+
+	b.registered = true
+}
+
+// checkNotRegistered panics if the route is already registered
+func (b *RouteBuilder) checkNotRegistered() {
+	if b.registered {
+		panic("route is already registered in path '" + b.group.prefix + b.path + "'")
+	}
+}
+
+// Register registers the given route specs in the group at once.
+//
+// See Router.Register for more details.
+func (g *Group) Register(specs []RouteSpec) {
+	names := make(map[string]struct{}, len(specs))
+
+	for i, spec := range specs {
+		if msg := g.routeSpecError(spec, names); msg != "" {
+			panic(fmt.Sprintf("invalid route spec %d: %s", i, msg))
+		}
+
+		if spec.Name != "" {
+			names[spec.Name] = struct{}{}
+		}
+	}
+
+	g.checkRouteSpecConflicts(specs)
+
+	g.router.bulk(func() {
+		for _, spec := range specs {
+			g.Route(spec.Method, spec.Path, spec.Handler).
+				Name(spec.Name).
+				Middleware(spec.Middleware...).
+				Done()
+		}
+	})
+}
+
+// routeSpecError returns why the route spec can't be registered in the group,
+// or an empty string if it's valid. The names are the ones of the previous specs.
+func (g *Group) routeSpecError(spec RouteSpec, names map[string]struct{}) string {
+	path := g.prefix + spec.Path
+
+	switch {
+	case len(spec.Method) == 0:
+		return "method must not be empty"
+	case !isValidMethodSet(spec.Method):
+		return "method must be an uppercase token in method '" + spec.Method + "'"
+	case spec.Handler == nil:
+		return "handler must not be nil"
+	case !strings.HasPrefix(spec.Path, "/"):
+		return "path must begin with '/' in path '" + spec.Path + "'"
+	case !radix.BalancedBraces(path):
+		return "unbalanced braces in path '" + path + "'"
+	}
+
+	for _, mw := range spec.Middleware {
+		if mw == nil {
+			return "middleware must not be nil"
+		}
+	}
+
+	if spec.Name != "" {
+		_, registered := g.router.routeNames[spec.Name]
+		_, repeated := names[spec.Name]
+
+		if registered || repeated {
+			return "route name '" + spec.Name + "' is already registered"
+		}
+	}
+
+	return ""
+}
+
+// checkRouteSpecConflicts panics if any of the route specs conflicts with
+// a registered route or with a previous spec, registering them in a clone
+// of the router first, so none of them is registered on a conflict
+func (g *Group) checkRouteSpecConflicts(specs []RouteSpec) {
+	clone := g.router.Clone()
+
+	for i, spec := range specs {
+		func() {
+			defer func() {
+				if rcv := recover(); rcv != nil {
+					panic(fmt.Sprintf("invalid route spec %d: %v", i, rcv))
+				}
+			}()
+
+			clone.handle(spec.Method, g.prefix+spec.Path, nil, routeHandler{handler: spec.Handler, group: g})
+		}()
+	}
+}
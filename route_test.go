@@ -0,0 +1,659 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestRouterRoute(t *testing.T) {
+	var calls []string
+
+	middleware := func(name string) Middleware {
+		return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+			return func(ctx *fasthttp.RequestCtx) {
+				calls = append(calls, name)
+				next(ctx)
+			}
+		}
+	}
+	handler := func(body string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			calls = append(calls, body)
+			ctx.SetBodyString(body)
+		}
+	}
+
+	r := New()
+
+	g := r.Group("/v1")
+	g.AddMiddleware(middleware("group"))
+
+	g.Route(fasthttp.MethodGet, "/users/{id}", handler("user")).
+		Name("user").
+		Middleware(middleware("first"), middleware("second")).
+		Done()
+
+	r.Route(fasthttp.MethodGet, "/items/{id:[0-9]+}/x", handler("id")).Done()
+	r.Route(fasthttp.MethodGet, "/items/{name:[a-z0-9]+}/x", handler("name")).Priority(1).Done()
+	r.Route(fasthttp.MethodGet, "/beta", handler("beta")).
+		When(func(ctx *fasthttp.RequestCtx) bool { return ctx.QueryArgs().Has("beta") }).
+		Done()
+
+	tests := []struct {
+		uri   string
+		calls []string
+	}{
+		{"/v1/users/1", []string{"group", "first", "second", "user"}},
+		{"/items/42/x", []string{"name"}},
+		{"/beta?beta", []string{"beta"}},
+		{"/beta", nil},
+	}
+
+	for _, test := range tests {
+		calls = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.uri)
+		r.Handler(ctx)
+
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("URI '%s' - calls == %v, want %v", test.uri, calls, test.calls)
+		}
+	}
+
+	route, ok := r.NamedRoute("user")
+	want := RouteInfo{Method: fasthttp.MethodGet, Path: "/v1/users/{id}", Paths: []string{"/v1/users/{id}"}}
+
+	if !ok || !reflect.DeepEqual(route, want) {
+		t.Errorf("NamedRoute() == %v, %v, want %v, true", route, ok, want)
+	}
+
+	if _, ok := r.NamedRoute("unknown"); ok {
+		t.Error("Unexpected named route 'unknown'")
+	}
+
+	builder := r.Route(fasthttp.MethodGet, "/done", handler("done"))
+	builder.Done()
+
+	panics := []struct {
+		fn   func()
+		want string
+	}{
+		{builder.Done, "route is already registered in path '/done'"},
+		{func() { builder.Name("done") }, "route is already registered in path '/done'"},
+		{func() { r.Route(fasthttp.MethodPost, "/users", handler("")).Name("user").Done() }, "route name 'user' is already registered"},
+		{func() { r.Route(fasthttp.MethodGet, "/nil", nil).Done() }, "handler must not be nil"},
+		{func() { r.Route(fasthttp.MethodGet, "invalid", handler("")) }, "path must begin with '/' in path 'invalid'"},
+	}
+
+	for _, test := range panics {
+		if recv := catchPanic(test.fn); fmt.Sprint(recv) != test.want {
+			t.Errorf("Expected panic %q, got %v", test.want, recv)
+		}
+	}
+}
+
+func TestRouterRouteTimeout(t *testing.T) {
+	r := New()
+	r.Route(fasthttp.MethodGet, "/slow", func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(200 * time.Millisecond)
+		ctx.SetBodyString("slow")
+	}).Timeout(10 * time.Millisecond).Done()
+
+	assertWithTestListener(t, "GET /slow HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
+		br := bufio.NewReader(&rw.w)
+		var resp fasthttp.Response
+		if err := resp.Read(br); err != nil {
+			t.Fatalf("Unexpected error when reading response: %s", err)
+		}
+
+		if status := resp.Header.StatusCode(); status != fasthttp.StatusServiceUnavailable {
+			t.Errorf("Status code == %d, want %d", status, fasthttp.StatusServiceUnavailable)
+		}
+
+		if body := string(resp.Body()); !strings.Contains(body, fasthttp.StatusMessage(fasthttp.StatusServiceUnavailable)) {
+			t.Errorf("Unexpected body %q", body)
+		}
+	})
+}
+
+func TestRouterRouteMaxBodySize(t *testing.T) {
+	r := New()
+
+	called := false
+	r.Route(fasthttp.MethodPost, "/json", func(ctx *fasthttp.RequestCtx) {
+		called = true
+		ctx.SetBodyString("ok")
+	}).Middleware(func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			called = true
+			next(ctx)
+		}
+	}).MaxBodySize(8).Done()
+
+	tests := []struct {
+		body   string
+		status int
+		called bool
+	}{
+		{"", fasthttp.StatusOK, true},
+		{"12345678", fasthttp.StatusOK, true},
+		{"123456789", fasthttp.StatusRequestEntityTooLarge, false},
+	}
+
+	for _, test := range tests {
+		called = false
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+		ctx.Request.SetRequestURI("/json")
+		ctx.Request.SetBodyString(test.body)
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("Body %q - status code == %d, want %d", test.body, status, test.status)
+		}
+
+		if called != test.called {
+			t.Errorf("Body %q - called == %v, want %v", test.body, called, test.called)
+		}
+	}
+
+	// The declared length is checked without reading the body
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetRequestURI("/json")
+	ctx.Request.Header.SetContentLength(1024)
+	r.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusRequestEntityTooLarge {
+		t.Errorf("Content-Length 1024 - status code == %d, want %d", status, fasthttp.StatusRequestEntityTooLarge)
+	}
+
+	// A streamed body of unknown length is read up to the max size,
+	// and the handler reads it as the request body
+	for _, test := range tests[1:] {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+		ctx.Request.SetRequestURI("/json")
+		ctx.Request.SetBodyStream(strings.NewReader(test.body), -1)
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("Streamed body %q - status code == %d, want %d", test.body, status, test.status)
+		}
+
+		if test.called && string(ctx.Request.Body()) != test.body {
+			t.Errorf("Streamed body %q - request body == %q", test.body, ctx.Request.Body())
+		}
+	}
+
+	if recv := catchPanic(func() { r.Route(fasthttp.MethodPost, "/zero", nil).MaxBodySize(0) }); fmt.Sprint(recv) != "max body size must be greater than 0" {
+		t.Errorf("Unexpected panic: %v", recv)
+	}
+}
+
+func TestRouterRouteNoFixedPathRedirect(t *testing.T) {
+	handler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("ok")
+	}
+
+	r := New()
+	r.Route(fasthttp.MethodGet, "/Secret/Path", handler).NoFixedPathRedirect().Done()
+	r.Route(fasthttp.MethodGet, "/hidden/", handler).NoFixedPathRedirect().Done()
+	r.GET("/public", handler)
+
+	tests := []struct {
+		uri      string
+		status   int
+		location string
+	}{
+		{"/Secret/Path", fasthttp.StatusOK, ""},
+		{"/secret/path", fasthttp.StatusNotFound, ""},
+		{"/SECRET/PATH/", fasthttp.StatusNotFound, ""},
+		{"/x/../Secret/Path", fasthttp.StatusNotFound, ""},
+		{"/Secret/Path/", fasthttp.StatusMovedPermanently, "/Secret/Path"},
+		{"/hidden", fasthttp.StatusMovedPermanently, "/hidden/"},
+		{"/HIDDEN", fasthttp.StatusNotFound, ""},
+		{"/PUBLIC", fasthttp.StatusMovedPermanently, "/public"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.uri)
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("URI '%s' - status code == %d, want %d", test.uri, status, test.status)
+		}
+
+		if location := string(ctx.Response.Header.Peek(fasthttp.HeaderLocation)); !strings.HasSuffix(location, test.location) {
+			t.Errorf("URI '%s' - location == %q, want %q", test.uri, location, test.location)
+		}
+	}
+}
+
+// evenMatcher matches the even numbers, trimming their leading zeros
+type evenMatcher struct{}
+
+func (evenMatcher) Match(segment string) (string, bool) {
+	n, err := strconv.Atoi(segment)
+	if err != nil || n%2 != 0 {
+		return "", false
+	}
+
+	return strconv.Itoa(n), true
+}
+
+func TestRouterRouteParamMatcher(t *testing.T) {
+	handler := func(name string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(fmt.Sprintf("%s:%v", name, ctx.UserValue("id")))
+		}
+	}
+
+	r := New()
+	r.Route(fasthttp.MethodGet, "/x/{id}", handler("even")).ParamMatcher("id", evenMatcher{}).Done()
+	r.GET("/x/{slug}", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(fmt.Sprintf("slug:%v", ctx.UserValue("slug")))
+	})
+	r.Group("/o").Route(fasthttp.MethodGet, "/{id?}", handler("optional")).ParamMatcher("id", evenMatcher{}).Done()
+
+	tests := []struct {
+		uri    string
+		status int
+		body   string
+	}{
+		{"/x/042", fasthttp.StatusOK, "even:42"},
+		{"/x/7", fasthttp.StatusOK, "slug:7"},
+		{"/o/8", fasthttp.StatusOK, "optional:8"},
+		{"/o", fasthttp.StatusOK, "optional:<nil>"},
+		{"/o/9", fasthttp.StatusNotFound, "Not Found"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.uri)
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("URI '%s' - status code == %d, want %d", test.uri, status, test.status)
+		}
+
+		if body := string(ctx.Response.Body()); body != test.body {
+			t.Errorf("URI '%s' - body == %q, want %q", test.uri, body, test.body)
+		}
+	}
+
+	for name, register := range map[string]func(){
+		"unknown param": func() { r.Route(fasthttp.MethodGet, "/a/{id}", handler("")).ParamMatcher("name", evenMatcher{}) },
+		"nil matcher":   func() { r.Route(fasthttp.MethodGet, "/a/{id}", handler("")).ParamMatcher("id", nil) },
+		"exact": func() {
+			r.Route(fasthttp.MethodGet, "/a/{id}", handler("")).ParamMatcher("id", evenMatcher{}).Exact().Done()
+		},
+		"other matcher": func() { r.GET("/x/{id}/edit", handler("")) },
+	} {
+		if err := catchPanic(register); err == nil {
+			t.Errorf("Expected panic with %s", name)
+		}
+	}
+}
+
+func TestRouterRouteExact(t *testing.T) {
+	handler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("ok")
+	}
+
+	r := New()
+	r.Route(fasthttp.MethodPost, "/webhook", handler).Exact().Done()
+	r.Route(fasthttp.MethodPost, "/hooks/{id}/", handler).Exact().Done()
+	r.POST("/users", handler)
+
+	tests := []struct {
+		uri    string
+		status int
+	}{
+		{"/webhook", fasthttp.StatusOK},
+		{"/webhook/", fasthttp.StatusNotFound},
+		{"/WEBHOOK", fasthttp.StatusNotFound},
+		{"/Webhook/", fasthttp.StatusNotFound},
+		{"/x/../webhook", fasthttp.StatusNotFound},
+		{"/hooks/1/", fasthttp.StatusOK},
+		{"/hooks/1", fasthttp.StatusNotFound},
+		{"/HOOKS/1/", fasthttp.StatusNotFound},
+		{"/users/", fasthttp.StatusPermanentRedirect},
+		{"/USERS", fasthttp.StatusPermanentRedirect},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+		ctx.Request.SetRequestURI(test.uri)
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("URI '%s' - status code == %d, want %d", test.uri, status, test.status)
+		}
+	}
+}
+
+func TestRouterRouteSecure(t *testing.T) {
+	r := New()
+	r.Route(fasthttp.MethodGet, "/secure", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("secure")
+	}).Secure().Done()
+	r.Route(fasthttp.MethodPost, "/secure", func(ctx *fasthttp.RequestCtx) {}).Secure().Done()
+
+	tests := []struct {
+		method   string
+		proto    string
+		trust    bool
+		redirect bool
+		status   int
+		location string
+	}{
+		{fasthttp.MethodGet, "", false, false, fasthttp.StatusForbidden, ""},
+		{fasthttp.MethodGet, "https", false, false, fasthttp.StatusForbidden, ""},
+		{fasthttp.MethodGet, "https", true, false, fasthttp.StatusOK, ""},
+		{fasthttp.MethodGet, "HTTPS, http", true, false, fasthttp.StatusOK, ""},
+		{fasthttp.MethodGet, "http, https", true, false, fasthttp.StatusForbidden, ""},
+		{fasthttp.MethodGet, "", false, true, fasthttp.StatusMovedPermanently, "https://example.com/secure?a=1"},
+		{fasthttp.MethodPost, "http", true, true, fasthttp.StatusPermanentRedirect, "https://example.com/secure?a=1"},
+	}
+
+	for _, test := range tests {
+		r.TrustForwardedProto = test.trust
+		r.RedirectInsecure = test.redirect
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI("http://example.com/secure?a=1")
+
+		if test.proto != "" {
+			ctx.Request.Header.Set(fasthttp.HeaderXForwardedProto, test.proto)
+		}
+
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s X-Forwarded-Proto %q - status code == %d, want %d", test.method, test.proto, status, test.status)
+		}
+
+		if location := string(ctx.Response.Header.Peek(fasthttp.HeaderLocation)); location != test.location {
+			t.Errorf("%s X-Forwarded-Proto %q - location == %q, want %q", test.method, test.proto, location, test.location)
+		}
+	}
+}
+
+func TestRouterRouteAutoOptions(t *testing.T) {
+	globalOPTIONS := 0
+
+	r := New()
+	r.GlobalOPTIONS = func(ctx *fasthttp.RequestCtx) {
+		globalOPTIONS++
+	}
+
+	cors := CORSConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+		AllowHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:       time.Minute,
+	}
+
+	r.Route(fasthttp.MethodGet, "/users/{id}", func(ctx *fasthttp.RequestCtx) {}).AutoOptions(cors).Done()
+	r.Route(fasthttp.MethodPut, "/users/{id}", func(ctx *fasthttp.RequestCtx) {}).Done()
+	r.Group("/public").Route(fasthttp.MethodGet, "/items/{page?}", func(ctx *fasthttp.RequestCtx) {}).
+		AutoOptions(CORSConfig{AllowCredentials: true}).
+		Done()
+	r.GET("/other", func(ctx *fasthttp.RequestCtx) {})
+
+	tests := []struct {
+		path          string
+		origin        string
+		status        int
+		allowOrigin   string
+		allowMethods  string
+		allowHeaders  string
+		credentials   string
+		maxAge        string
+		globalOPTIONS int
+	}{
+		{"/users/1", "https://app.example.com", fasthttp.StatusNoContent, "https://app.example.com", "GET, OPTIONS, PUT", "Content-Type, Authorization", "", "60", 0},
+		{"/users/1", "https://evil.example.com", fasthttp.StatusNoContent, "", "", "", "", "", 0},
+		{"/users/1", "", fasthttp.StatusNoContent, "", "", "", "", "", 0},
+		{"/public/items", "https://any.example.com", fasthttp.StatusNoContent, "https://any.example.com", "GET, OPTIONS", "", "true", "", 0},
+		{"/public/items/2", "https://any.example.com", fasthttp.StatusNoContent, "https://any.example.com", "GET, OPTIONS", "", "true", "", 0},
+		{"/other", "https://app.example.com", fasthttp.StatusOK, "", "", "", "", "", 1},
+	}
+
+	for _, test := range tests {
+		globalOPTIONS = 0
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(fasthttp.MethodOptions)
+		ctx.Request.SetRequestURI(test.path)
+
+		if test.origin != "" {
+			ctx.Request.Header.Set(fasthttp.HeaderOrigin, test.origin)
+		}
+
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s (%s) - status code == %d, want %d", test.path, test.origin, status, test.status)
+		}
+
+		if allow := string(ctx.Response.Header.Peek("Allow")); allow == "" {
+			t.Errorf("%s (%s) - Allow header not set", test.path, test.origin)
+		}
+
+		headers := map[string]string{
+			fasthttp.HeaderAccessControlAllowOrigin:      test.allowOrigin,
+			fasthttp.HeaderAccessControlAllowMethods:     test.allowMethods,
+			fasthttp.HeaderAccessControlAllowHeaders:     test.allowHeaders,
+			fasthttp.HeaderAccessControlAllowCredentials: test.credentials,
+			fasthttp.HeaderAccessControlMaxAge:           test.maxAge,
+		}
+
+		for header, want := range headers {
+			if value := string(ctx.Response.Header.Peek(header)); value != want {
+				t.Errorf("%s (%s) - %s == %q, want %q", test.path, test.origin, header, value, want)
+			}
+		}
+
+		if globalOPTIONS != test.globalOPTIONS {
+			t.Errorf("%s (%s) - GlobalOPTIONS calls == %d, want %d", test.path, test.origin, globalOPTIONS, test.globalOPTIONS)
+		}
+	}
+
+	r.HandleOPTIONS = false
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(fasthttp.MethodOptions)
+	ctx.Request.SetRequestURI("/users/1")
+	ctx.Request.Header.Set(fasthttp.HeaderOrigin, "https://app.example.com")
+
+	r.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusNoContent {
+		t.Errorf("status code == %d, want %d with HandleOPTIONS disabled", status, fasthttp.StatusNoContent)
+	}
+}
+
+func TestRouterRouteAutoOptionsParamNames(t *testing.T) {
+	handler := func(ctx *fasthttp.RequestCtx) {}
+	cors := CORSConfig{AllowOrigins: []string{"*"}}
+
+	r := New()
+
+	// The routes of other methods could name their params differently
+	r.Route(fasthttp.MethodGet, "/users/{id}", handler).AutoOptions(cors).Done()
+	r.Route(fasthttp.MethodPut, "/users/{name}", handler).AutoOptions(cors).Done()
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(fasthttp.MethodOptions)
+	ctx.Request.SetRequestURI("/users/1")
+	ctx.Request.Header.Set(fasthttp.HeaderOrigin, "https://app.example.com")
+
+	r.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusNoContent {
+		t.Errorf("status code == %d, want %d", status, fasthttp.StatusNoContent)
+	}
+
+	if methods := string(ctx.Response.Header.Peek(fasthttp.HeaderAccessControlAllowMethods)); methods != "GET, OPTIONS, PUT" {
+		t.Errorf("%s == %q, want %q", fasthttp.HeaderAccessControlAllowMethods, methods, "GET, OPTIONS, PUT")
+	}
+
+	// A conflicting reply is rejected before registering the route
+	r.Route(fasthttp.MethodGet, "/files/{filepath:*}", handler).AutoOptions(cors).Done()
+
+	recv := catchPanic(func() {
+		r.Route(fasthttp.MethodPost, "/files/{path:**}", handler).AutoOptions(cors).Done()
+	})
+	if recv == nil {
+		t.Error("Expected a panic registering a conflicting AutoOptions")
+	}
+
+	if h, _ := r.Lookup(fasthttp.MethodPost, "/files/a", nil); h != nil {
+		t.Error("The route with a conflicting AutoOptions must not be registered")
+	}
+}
+
+func TestRouterRegister(t *testing.T) {
+	var calls []string
+
+	middleware := func(name string) Middleware {
+		return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+			return func(ctx *fasthttp.RequestCtx) {
+				calls = append(calls, name)
+				next(ctx)
+			}
+		}
+	}
+	handler := func(body string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			calls = append(calls, body)
+		}
+	}
+
+	r := New()
+
+	r.Register([]RouteSpec{
+		{Method: fasthttp.MethodGet, Path: "/users", Handler: handler("list")},
+		{
+			Method:     fasthttp.MethodGet,
+			Path:       "/users/{id}",
+			Handler:    handler("user"),
+			Middleware: []Middleware{middleware("first"), middleware("second")},
+			Name:       "user",
+		},
+	})
+
+	g := r.Group("/v1")
+	g.AddMiddleware(middleware("group"))
+	g.Register([]RouteSpec{
+		{Method: fasthttp.MethodPost, Path: "/items", Handler: handler("item"), Middleware: []Middleware{middleware("route")}},
+	})
+
+	tests := []struct {
+		method string
+		uri    string
+		calls  []string
+	}{
+		{fasthttp.MethodGet, "/users", []string{"list"}},
+		{fasthttp.MethodGet, "/users/1", []string{"first", "second", "user"}},
+		{fasthttp.MethodPost, "/v1/items", []string{"group", "route", "item"}},
+	}
+
+	for _, test := range tests {
+		calls = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.uri)
+		r.Handler(ctx)
+
+		if !reflect.DeepEqual(calls, test.calls) {
+			t.Errorf("%s '%s' - calls == %v, want %v", test.method, test.uri, calls, test.calls)
+		}
+	}
+
+	if route, ok := r.NamedRoute("user"); !ok || route.Path != "/users/{id}" {
+		t.Errorf("NamedRoute() == %v, %v, want path '/users/{id}'", route, ok)
+	}
+
+	panics := []struct {
+		specs []RouteSpec
+		want  string
+	}{
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/a", Handler: handler("")}, {Path: "/b", Handler: handler("")}},
+			"invalid route spec 1: method must not be empty",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/a", Handler: handler("")}, {Method: fasthttp.MethodGet, Path: "/b"}},
+			"invalid route spec 1: handler must not be nil",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "invalid", Handler: handler("")}},
+			"invalid route spec 0: path must begin with '/' in path 'invalid'",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/{id", Handler: handler("")}},
+			"invalid route spec 0: unbalanced braces in path '/{id'",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/a", Handler: handler(""), Middleware: []Middleware{nil}}},
+			"invalid route spec 0: middleware must not be nil",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/a", Handler: handler(""), Name: "user"}},
+			"invalid route spec 0: route name 'user' is already registered",
+		},
+		{
+			[]RouteSpec{
+				{Method: fasthttp.MethodGet, Path: "/a", Handler: handler(""), Name: "a"},
+				{Method: fasthttp.MethodGet, Path: "/b", Handler: handler(""), Name: "a"},
+			},
+			"invalid route spec 1: route name 'a' is already registered",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/a", Handler: handler("")}, {Method: "get", Path: "/b", Handler: handler("")}},
+			"invalid route spec 1: method must be an uppercase token in method 'get'",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/a", Handler: handler("")}, {Method: "GET|", Path: "/b", Handler: handler("")}},
+			"invalid route spec 1: method must be an uppercase token in method 'GET|'",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/a", Handler: handler("")}, {Method: fasthttp.MethodGet, Path: "/users", Handler: handler("")}},
+			"invalid route spec 1: a handler is already registered for path '/users' by the scope, registering it again by the scope",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/a", Handler: handler("")}, {Method: fasthttp.MethodGet, Path: "/a", Handler: handler("")}},
+			"invalid route spec 1: a handler is already registered for path '/a' by the scope, registering it again by the scope",
+		},
+		{
+			[]RouteSpec{{Method: fasthttp.MethodGet, Path: "/a/{id}", Handler: handler("")}, {Method: fasthttp.MethodGet, Path: "/a/{name}", Handler: handler("")}},
+			"invalid route spec 1: '{name}' in new path '/a/{name}' conflicts with existing wild path '{id}' in existing prefix '/a/{id}'",
+		},
+	}
+
+	for _, test := range panics {
+		if recv := catchPanic(func() { r.Register(test.specs) }); fmt.Sprint(recv) != test.want {
+			t.Errorf("Expected panic %q, got %v", test.want, recv)
+		}
+	}
+
+	// The valid specs before the invalid one must not be registered
+	if r.Match(fasthttp.MethodGet, "/a") {
+		t.Error("Unexpected route '/a' registered by invalid specs")
+	}
+}
@@ -1,13 +1,19 @@
 package router
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/fasthttp/router/radix"
 	"github.com/savsgio/gotils/bytes"
 	"github.com/savsgio/gotils/strconv"
+	gstrings "github.com/savsgio/gotils/strings"
 	"github.com/valyala/bytebufferpool"
 	"github.com/valyala/fasthttp"
 )
@@ -15,12 +21,102 @@ import (
 // MethodWild wild HTTP method
 const MethodWild = "*"
 
+// The kinds of the requests which could not be dispatched to a route,
+// reported to Router.OnMiss
+const (
+	// MissNotFound is a request replied as not found
+	MissNotFound MissKind = iota
+
+	// MissMethodNotAllowed is a request replied with 405 Method Not Allowed,
+	// since the path is only registered for other methods
+	MissMethodNotAllowed
+
+	// MissRedirected is a request redirected to the fixed path
+	// or to the path with (without) the trailing slash
+	MissRedirected
+
+	// MissNotImplemented is a request with an unknown method replied
+	// with 501 Not Implemented, if Router.UnknownMethod501 is enabled
+	MissNotImplemented
+
+	// MissBadRequest is a request with an invalid path
+	MissBadRequest
+)
+
+// String returns the name of the miss kind (e.g. "not_found"),
+// to be used as a metric label
+func (k MissKind) String() string {
+	switch k {
+	case MissNotFound:
+		return "not_found"
+	case MissMethodNotAllowed:
+		return "method_not_allowed"
+	case MissRedirected:
+		return "redirected"
+	case MissNotImplemented:
+		return "not_implemented"
+	case MissBadRequest:
+		return "bad_request"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// groupPathsBufferSize is the initial size of the buffer
+	// of the full paths of the group routes
+	groupPathsBufferSize = 128
+
+	filepathSuffix = "/{filepath:*}"
+	mountPathParam = "__mountPath__"
+	mountSuffix    = "/{" + mountPathParam + ":*}"
+)
+
 var (
 	questionMark = byte('?')
 
+	// wildAllowedMethods are the standard methods allowed by a MethodWild route
+	wildAllowedMethods = []string{
+		fasthttp.MethodGet,
+		fasthttp.MethodHead,
+		fasthttp.MethodPost,
+		fasthttp.MethodPut,
+		fasthttp.MethodPatch,
+		fasthttp.MethodDelete,
+		fasthttp.MethodConnect,
+		fasthttp.MethodTrace,
+	}
+
+	// compressedFileSuffixes are the suffixes of the pre-compressed files
+	// by encoding, served by Router.ServeFilesCompressed
+	compressedFileSuffixes = map[string]string{
+		"br":   ".br",
+		"gzip": ".gz",
+		"zstd": ".zst",
+	}
+
 	// MatchedRoutePathParam is the param name under which the path of the matched
 	// route is stored, if Router.SaveMatchedRoutePath is set.
+	// The user value is kept for compatibility, but a middleware could
+	// override it, unlike RequestMeta.MatchedRoutePath returned by Meta.
 	MatchedRoutePathParam = fmt.Sprintf("__matchedRoutePath::%s__", bytes.Rand(make([]byte, 15)))
+
+	// MatchedGroupPrefixParam is the param name under which the path prefix
+	// of the group of the matched route is stored, if
+	// Router.SaveMatchedGroupPrefix or Group.SaveMatchedGroupPrefix is set.
+	// Like MatchedRoutePathParam, use RequestMeta.MatchedGroupPrefix instead.
+	MatchedGroupPrefixParam = fmt.Sprintf("__matchedGroupPrefix::%s__", bytes.Rand(make([]byte, 15)))
+
+	// RequestHostParam is the param name under which the host of the request,
+	// resolved by Router.RequestHost, is stored if Router.TrustForwardedHost is set.
+	// Like MatchedRoutePathParam, use RequestMeta.RequestHost instead.
+	RequestHostParam = fmt.Sprintf("__requestHost::%s__", bytes.Rand(make([]byte, 15)))
+
+	// AllowedMethodsParam is the param name under which the allowed methods
+	// of the path are stored as []string, before calling the
+	// Router.MethodNotAllowed handler.
+	// Like MatchedRoutePathParam, use RequestMeta.AllowedMethods instead.
+	AllowedMethodsParam = fmt.Sprintf("__allowedMethods::%s__", bytes.Rand(make([]byte, 15)))
 )
 
 // New returns a new router.
@@ -30,6 +126,10 @@ func New() *Router {
 		trees:                  make([]*radix.Tree, 10),
 		customMethodsIndex:     make(map[string]int),
 		registeredPaths:        make(map[string][]string),
+		routeHandlers:          make(map[string]map[string]routeHandler),
+		optionalPaths:          make(map[string]map[string]string),
+		paramDecoders:          make(map[string]ParamDecoderFunc),
+		routeNames:             make(map[string]RouteInfo),
 		RedirectTrailingSlash:  true,
 		RedirectFixedPath:      true,
 		HandleMethodNotAllowed: true,
@@ -37,7 +137,67 @@ func New() *Router {
 	}
 }
 
+// Clone returns an independent copy of the router with the same settings
+// and routes, so routes could be registered in the copy without affecting
+// the router (e.g. to reuse a base router in table-driven tests).
+// The handlers are shared by both routers.
+func (r *Router) Clone() *Router {
+	clone := *r
+
+	clone.trees = make([]*radix.Tree, len(r.trees))
+	for i, tree := range r.trees {
+		if tree != nil {
+			clone.trees[i] = tree.Clone()
+		}
+	}
+
+	clone.customMethodsIndex = maps.Clone(r.customMethodsIndex)
+	clone.paramDecoders = maps.Clone(r.paramDecoders)
+	clone.routeNames = maps.Clone(r.routeNames)
+	clone.groupNotFound = append([]groupHandler(nil), r.groupNotFound...)
+	if r.autoOptions != nil {
+		clone.autoOptions = r.autoOptions.Clone()
+	}
+	if r.methodsTree != nil {
+		clone.methodsTree = r.methodsTree.Clone()
+		clone.pathMethods = maps.Clone(r.pathMethods)
+	}
+	clone.RedirectTrailingSlashMethods = append([]string(nil), r.RedirectTrailingSlashMethods...)
+	clone.DisableTSRMethods = append([]string(nil), r.DisableTSRMethods...)
+
+	clone.registeredPaths = make(map[string][]string, len(r.registeredPaths))
+	for method, paths := range r.registeredPaths {
+		clone.registeredPaths[method] = append([]string(nil), paths...)
+	}
+
+	clone.routeHandlers = make(map[string]map[string]routeHandler, len(r.routeHandlers))
+	for method, handlers := range r.routeHandlers {
+		clone.routeHandlers[method] = maps.Clone(handlers)
+	}
+
+	clone.optionalPaths = make(map[string]map[string]string, len(r.optionalPaths))
+	for method, paths := range r.optionalPaths {
+		clone.optionalPaths[method] = maps.Clone(paths)
+	}
+
+	return &clone
+}
+
+// Scope returns a new group without path prefix, which applies the given
+// middleware to all its routes.
+// It's useful to share middleware between routes which don't have
+// a common path prefix.
+// Path auto-correction, including trailing slashes, is enabled by default.
+func (r *Router) Scope(middleware ...Middleware) *Group {
+	return &Group{
+		router:     r,
+		middleware: toNamedMiddleware(middleware),
+	}
+}
+
 // Group returns a new group.
+// The path could contain params (e.g. '/users/{id}'), which are captured
+// for all the routes of the group, like any other param of their paths.
 // Path auto-correction, including trailing slashes, is enabled by default.
 func (r *Router) Group(path string) *Group {
 	validatePath(path)
@@ -52,13 +212,82 @@ func (r *Router) Group(path string) *Group {
 	}
 }
 
+// setGroupNotFound sets the NotFound handler of the paths under the prefix,
+// keeping the most specific prefixes first
+func (r *Router) setGroupNotFound(prefix string, handler fasthttp.RequestHandler) {
+	for i := range r.groupNotFound {
+		if r.groupNotFound[i].prefix == prefix {
+			r.groupNotFound[i].handler = handler
+			return
+		}
+	}
+
+	r.groupNotFound = append(r.groupNotFound, groupHandler{prefix: prefix, handler: handler})
+
+	sort.SliceStable(r.groupNotFound, func(i, j int) bool {
+		return len(r.groupNotFound[i].prefix) > len(r.groupNotFound[j].prefix)
+	})
+}
+
+// groupNotFoundHandler returns the NotFound handler of the most specific
+// group of the path, or nil if there is none
+func (r *Router) groupNotFoundHandler(path string) fasthttp.RequestHandler {
+	for _, gh := range r.groupNotFound {
+		if hasPathPrefix(path, gh.prefix) {
+			return gh.handler
+		}
+	}
+
+	return nil
+}
+
 func (r *Router) saveMatchedRoutePath(path string, handler fasthttp.RequestHandler) fasthttp.RequestHandler {
 	return func(ctx *fasthttp.RequestCtx) {
 		ctx.SetUserValue(MatchedRoutePathParam, path)
+		acquireRequestData(ctx).meta.MatchedRoutePath = path
+		handler(ctx)
+	}
+}
+
+func saveMatchedGroupPrefix(prefix string, handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		ctx.SetUserValue(MatchedGroupPrefixParam, prefix)
+		acquireRequestData(ctx).meta.MatchedGroupPrefix = prefix
 		handler(ctx)
 	}
 }
 
+// secureHandler returns a handler which only calls the given one
+// for the secure requests, see Router.IsSecure
+func (r *Router) secureHandler(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if r.IsSecure(ctx) {
+			handler(ctx)
+			return
+		}
+
+		if !r.RedirectInsecure {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusForbidden), fasthttp.StatusForbidden)
+			return
+		}
+
+		// Moved Permanently, request with GET method
+		code := fasthttp.StatusMovedPermanently
+		if !ctx.IsGet() {
+			// Permanent Redirect, request with same method
+			code = fasthttp.StatusPermanentRedirect
+		}
+
+		uri := bytebufferpool.Get()
+		uri.WriteString("https://")
+		uri.WriteString(r.RequestHost(ctx))
+		uri.Write(ctx.URI().RequestURI())
+
+		ctx.RedirectBytes(uri.B, code)
+		bytebufferpool.Put(uri)
+	}
+}
+
 func (r *Router) methodIndexOf(method string) int {
 	switch method {
 	case fasthttp.MethodGet:
@@ -94,6 +323,10 @@ func (r *Router) methodIndexOf(method string) int {
 //
 // # It's disabled by default
 //
+// The handlers of the already registered routes are replaced atomically,
+// so they could be updated while serving requests. Registering new routes
+// is still not concurrency-safe.
+//
 // WARNING: Use with care. It could generate unexpected behaviours
 func (r *Router) Mutable(v bool) {
 	r.treeMutable = v
@@ -107,11 +340,117 @@ func (r *Router) Mutable(v bool) {
 	}
 }
 
+// ParamDecoder registers a decoder for the param with the given name.
+// The decoded value is saved as ctx.UserValue(name) before invoking the handler
+// of any route which captures the param.
+// If the decoder returns an error, the ParamDecodeError handler is called
+// instead of the route handler.
+//
+// Use:
+//
+//	router.ParamDecoder("token", func(value string) (interface{}, error) {
+//		return base64.RawURLEncoding.DecodeString(value)
+//	})
+func (r *Router) ParamDecoder(name string, fn ParamDecoderFunc) {
+	switch {
+	case len(name) == 0:
+		panic("param name must not be empty")
+	case fn == nil:
+		panic("param decoder must not be nil")
+	}
+
+	r.paramDecoders[name] = fn
+}
+
+// decodeParams decodes the captured params which have a registered decoder,
+// after unescaping them if DecodeParams is enabled.
+// It returns false if the request has been answered due to a decoding error.
+func (r *Router) decodeParams(ctx *fasthttp.RequestCtx) bool {
+	if r.DecodeParams {
+		if err := unescapeParams(ctx); err != nil {
+			r.paramDecodeError(ctx, err)
+			return false
+		}
+	}
+
+	d := getRequestData(ctx)
+	if d == nil || len(r.paramDecoders) == 0 {
+		return true
+	}
+
+	for i := range d.params {
+		fn, ok := r.paramDecoders[d.params[i].Key]
+		if !ok {
+			continue
+		}
+
+		decoded, err := fn(d.params[i].Value)
+		if err != nil {
+			r.paramDecodeError(ctx, err)
+			return false
+		}
+
+		d.values[i] = decoded
+		ctx.SetUserValue(d.params[i].Key, decoded)
+	}
+
+	return true
+}
+
+// paramDecodeError replies the request whose params could not be decoded
+func (r *Router) paramDecodeError(ctx *fasthttp.RequestCtx, err error) {
+	if r.ParamDecodeError != nil {
+		r.ParamDecodeError(ctx, err)
+	} else {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusBadRequest), fasthttp.StatusBadRequest)
+	}
+}
+
+// DumpTree returns a human-readable representation of the routes tree
+// of the given method for debugging, or an empty string if the method
+// has no routes.
+//
+// See radix.Tree.String for more details about the output.
+func (r *Router) DumpTree(method string) string {
+	methodIndex := r.methodIndexOf(method)
+	if methodIndex == -1 || r.trees[methodIndex] == nil {
+		return ""
+	}
+
+	return r.trees[methodIndex].String()
+}
+
 // List returns all registered routes grouped by method
 func (r *Router) List() map[string][]string {
 	return r.registeredPaths
 }
 
+// Len returns the number of registered routes across all methods.
+// Each route is counted once per method, by its original path, so
+// the expanded optional paths of a route are not counted separately.
+func (r *Router) Len() int {
+	n := 0
+	for _, handlers := range r.routeHandlers {
+		n += len(handlers)
+	}
+
+	return n
+}
+
+// Methods returns the sorted methods with at least one registered route
+func (r *Router) Methods() []string {
+	methods := make([]string, 0, len(r.routeHandlers))
+	for method, handlers := range r.routeHandlers {
+		if len(handlers) > 0 {
+			methods = append(methods, method)
+		}
+	}
+
+	sort.Strings(methods)
+
+	return methods
+}
+
 // GET is a shortcut for router.Handle(fasthttp.MethodGet, path, handler)
 func (r *Router) GET(path string, handler fasthttp.RequestHandler) {
 	r.Handle(fasthttp.MethodGet, path, handler)
@@ -157,6 +496,22 @@ func (r *Router) TRACE(path string, handler fasthttp.RequestHandler) {
 	r.Handle(fasthttp.MethodTrace, path, handler)
 }
 
+// All registers the handler with the given path for every standard method,
+// apart from OPTIONS, which is answered automatically (see HandleOPTIONS).
+//
+// Unlike ANY, which registers a single route in the wild method tree,
+// the route is registered in the tree of each method, at the cost of more
+// nodes. So the path is handled like any other route with several methods:
+// its methods are listed in the "Allow" header of the OPTIONS and 405
+// responses, and the unknown methods are not allowed. A route of the same
+// path and one of those methods conflicts with it, unless the router
+// is mutable.
+func (r *Router) All(path string, handler fasthttp.RequestHandler) {
+	for _, method := range wildAllowedMethods {
+		r.Handle(method, path, handler)
+	}
+}
+
 // ANY is a shortcut for router.Handle(router.MethodWild, path, handler)
 //
 // WARNING: Use only for routes where the request method is not important
@@ -174,12 +529,52 @@ func (r *Router) ANY(path string, handler fasthttp.RequestHandler) {
 //
 //	router.ServeFiles("/src/{filepath:*}", "./")
 func (r *Router) ServeFiles(path string, rootPath string) {
-	r.ServeFilesCustom(path, &fasthttp.FS{
-		Root:               rootPath,
-		IndexNames:         []string{"index.html"},
-		GenerateIndexPages: true,
-		AcceptByteRange:    true,
-	})
+	r.ServeFilesCustom(path, newFilesFS(rootPath))
+}
+
+// Static serves files from the given file system root path under the given
+// url prefix. It's a shortcut for router.ServeFiles(urlPrefix+"/{filepath:*}", rootPath)
+// The url prefix must not contain wildcards.
+// Use:
+//
+//	router.Static("/static", "./public")
+func (r *Router) Static(urlPrefix string, rootPath string) {
+	r.ServeFiles(staticPath(urlPrefix), rootPath)
+}
+
+// MountHandler mounts the given handler at the given path prefix for all
+// request methods. The prefix is stripped from the request path before
+// invoking the handler, so it could do its own sub-routing, and restored
+// once it returns, so the middleware see the original path.
+// For example if the prefix is "/debug", the request "/debug/pprof/heap"
+// is handled with the path "/pprof/heap".
+// The prefix must not contain wildcards.
+// Use:
+//
+//	router.MountHandler("/debug", pprofHandler)
+func (r *Router) MountHandler(prefix string, handler fasthttp.RequestHandler) {
+	r.ANY(mountPath(prefix), newMountHandler(handler))
+}
+
+// Delegate delegates the requests under the given path prefix, for all
+// request methods, to the handler of another application (e.g. a legacy
+// app), like MountHandler. The prefix itself is delegated too, so the
+// request "/admin" is handled with the path "/" instead of being
+// redirected to "/admin/".
+// The prefix is stripped from the request path for the duration of the
+// call and restored afterwards.
+// Use:
+//
+//	router.Delegate("/admin", adminApp.Handler)
+func (r *Router) Delegate(prefix string, handler fasthttp.RequestHandler) {
+	path := mountPath(prefix)
+	handler = newMountHandler(handler)
+
+	r.ANY(path, handler)
+
+	if bare := path[:len(path)-len(mountSuffix)]; bare != "" {
+		r.ANY(bare, handler)
+	}
 }
 
 // ServeFS serves files from the given file system.
@@ -192,15 +587,51 @@ func (r *Router) ServeFiles(path string, rootPath string) {
 //
 //	router.ServeFS("/src/{filepath:*}", myFilesystem)
 func (r *Router) ServeFS(path string, filesystem fs.FS) {
-	r.ServeFilesCustom(path, &fasthttp.FS{
-		FS:                 filesystem,
-		Root:               "",
-		AllowEmptyRoot:     true,
-		GenerateIndexPages: true,
-		AcceptByteRange:    true,
-		Compress:           true,
-		CompressBrotli:     true,
-	})
+	r.ServeFilesCustom(path, newFilesystemFS(filesystem))
+}
+
+// ServeSPA serves the files of a single-page app from the given file system
+// root path, like ServeFiles, but the requests for missing files without
+// extension are answered with the given index file, so the client routing
+// works when reloading a page. The missing assets, with a file extension,
+// are still answered with 404.
+// The path must end with "/{filepath:*}" and the index file is relative
+// to the root path.
+// Use:
+//
+//	router.ServeSPA("/app/{filepath:*}", "./dist", "index.html")
+func (r *Router) ServeSPA(path, rootPath, indexFile string) {
+	r.GET(path, newSPAHandler(path, newFilesFS(rootPath), indexFile))
+}
+
+// ServeFilesCompressed serves files from the given file system root path
+// like ServeFiles, but when the client accepts one of the given encodings,
+// the pre-compressed sibling of the requested file with its suffix
+// (e.g. "app.js.br" for "br" and "app.js.gz" for "gzip") is served instead,
+// if present, with the Content-Encoding header and the content type of the
+// requested file. The encodings are tried in the given order, so the
+// preferred one goes first. Otherwise the requested file is served as is.
+// The supported encodings are "br", "gzip" and "zstd".
+// Use:
+//
+//	router.ServeFilesCompressed("/assets/{filepath:*}", "./dist", []string{"br", "gzip"})
+func (r *Router) ServeFilesCompressed(path, rootPath string, encodings []string) {
+	r.GET(path, newCompressedFilesHandler(path, rootPath, newFilesFS(rootPath), encodings))
+}
+
+// ServeFilesCached serves files from the given file system root path like
+// ServeFiles, handling the conditional requests for them: the responses
+// have an ETag header, based on the size and modification time of the file,
+// and a Cache-Control header which allows caching them for the given ttl
+// (or "no-cache" if zero, so they are always revalidated).
+// The requests whose If-None-Match header matches the ETag, or whose
+// If-Modified-Since header is not older than the file, are replied with
+// 304 Not Modified without body. If-None-Match takes precedence.
+// Use:
+//
+//	router.ServeFilesCached("/static/{filepath:*}", "./public", time.Hour)
+func (r *Router) ServeFilesCached(path, rootPath string, ttl time.Duration) {
+	r.GET(path, newCachedFilesHandler(path, newFilesFS(rootPath), ttl))
 }
 
 // ServeFilesCustom serves files from the given file system settings.
@@ -214,21 +645,7 @@ func (r *Router) ServeFS(path string, filesystem fs.FS) {
 //
 //	router.ServeFilesCustom("/src/{filepath:*}", *customFS)
 func (r *Router) ServeFilesCustom(path string, fs *fasthttp.FS) {
-	const suffix = "/{filepath:*}"
-
-	if !strings.HasSuffix(path, suffix) {
-		panic("path must end with " + suffix + " in path '" + path + "'")
-	}
-
-	prefix := path[:len(path)-len(suffix)]
-	stripSlashes := strings.Count(prefix, "/")
-
-	if fs.PathRewrite == nil && stripSlashes > 0 {
-		fs.PathRewrite = fasthttp.NewPathSlashesStripper(stripSlashes)
-	}
-	fileHandler := fs.NewRequestHandler()
-
-	r.GET(path, fileHandler)
+	r.GET(path, newFilesHandler(path, fs))
 }
 
 // Handle registers a new request handler with the given path and method.
@@ -239,32 +656,247 @@ func (r *Router) ServeFilesCustom(path string, fs *fasthttp.FS) {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
+//
+// The method could be a set of methods separated by '|' (e.g. "GET|HEAD"),
+// registering the route for each one of them, like any other registration
+// function of the router and its groups.
 func (r *Router) Handle(method, path string, handler fasthttp.RequestHandler) {
+	r.handle(method, path, nil, routeHandler{handler: handler})
+}
+
+// HandleWhen registers a new request handler with the given path and method,
+// which only matches the requests for which the given predicate returns true.
+// Otherwise the router continues as if the route were not registered, so the
+// request could be handled by another route or the NotFound handler.
+//
+// The predicate is not evaluated to compute the allowed methods of a path.
+func (r *Router) HandleWhen(method, path string, handler fasthttp.RequestHandler, predicate radix.Predicate) {
+	if predicate == nil {
+		panic("predicate must not be nil")
+	}
+
+	r.handle(method, path, nil, routeHandler{handler: handler, predicate: predicate})
+}
+
+// Route returns a builder to configure a new route with the given path and
+// method, which is registered once its configuration is done.
+// See RouteBuilder for more details.
+func (r *Router) Route(method, path string, handler fasthttp.RequestHandler) *RouteBuilder {
+	return r.Scope().Route(method, path, handler)
+}
+
+// Register registers the given route specs at once, like configuring each
+// of them with Router.Route. It's intended for generated code, which could
+// declare all routes in a single table.
+//
+// All the specs are validated before registering any route, also checking
+// that they don't conflict with the registered routes or between them,
+// so it panics with the index of the first invalid spec without
+// registering the others.
+func (r *Router) Register(specs []RouteSpec) {
+	r.Scope().Register(specs)
+}
+
+// NamedRoute returns the route registered with the given name,
+// with RouteBuilder.Name.
+func (r *Router) NamedRoute(name string) (RouteInfo, bool) {
+	route, ok := r.routeNames[name]
+
+	return route, ok
+}
+
+// HandleNegotiated registers a new route with the given path and method,
+// which dispatches each request to the handler of the media type which
+// best matches its Accept header, according to the quality values.
+// On equal quality, the handlers given first are preferred. If none of
+// the media types is acceptable, the first handler is used as fallback.
+// The "Vary: Accept" header is added to all the responses.
+//
+//	router.HandleNegotiated(fasthttp.MethodGet, "/report", []router.MediaTypeHandler{
+//		{MediaType: "application/json", Handler: reportJSON},
+//		{MediaType: "text/html", Handler: reportHTML},
+//	})
+func (r *Router) HandleNegotiated(method, path string, handlers []MediaTypeHandler) {
+	r.Handle(method, path, newNegotiatedHandler(handlers))
+}
+
+// HandleParams registers a new request handler with the given path and method,
+// which receives the path params of the matched route, like the handlers added
+// to a radix.Tree with AddParamHandler. The params are the ones saved by the
+// router for the request, in the same order they appear in the route path,
+// so they are only valid until the handler returns.
+func (r *Router) HandleParams(method, path string, handler radix.ParamHandler) {
+	r.Handle(method, path, newParamHandler(handler))
+}
+
+// HandlePriority registers a new request handler with the given path and method,
+// with the given priority to match the requests.
+// When a request could be matched by several routes which differ in a param
+// at the same position (e.g. constrained by overlapping regexes), the route
+// with the highest priority is tried first. The default priority is 0.
+//
+// The priority doesn't change the order between static paths, params and
+// wildcards, since the static paths are always tried first.
+func (r *Router) HandlePriority(method, path string, handler fasthttp.RequestHandler, priority int) {
+	r.handle(method, path, nil, routeHandler{handler: handler, priority: priority})
+}
+
+// bulk registers the routes of fn deferring the reordering of the tree
+// nodes until all of them are added, which is faster with lots of routes
+func (r *Router) bulk(fn func()) {
+	if r.deferSort {
+		// Already in a bulk registration
+		fn()
+		return
+	}
+
+	r.deferSort = true
+
+	defer func() {
+		r.deferSort = false
+
+		for _, tree := range r.trees {
+			if tree != nil {
+				tree.DeferSort = false
+				tree.Finalize()
+			}
+		}
+
+		if r.methodsTree != nil {
+			r.methodsTree.DeferSort = false
+			r.methodsTree.Finalize()
+		}
+	}()
+
+	fn()
+}
+
+// handle registers the route handler with the given tree paths, which are
+// the expanded optional paths of the given path.
+// If paths is nil, they are derived from the path.
+// The predicate and the priority of the route handler are optional.
+func (r *Router) handle(method, path string, paths []string, rh routeHandler) {
+	if strings.IndexByte(method, '|') > -1 {
+		// A set of methods (e.g. 'GET|HEAD')
+		methods := strings.Split(method, "|")
+		if gstrings.Include(methods, "") {
+			panic("method must not be empty")
+		}
+
+		// Validate the whole set before registering any of its routes
+		for _, m := range methods {
+			if !isValidMethod(m) {
+				panic("method must be an uppercase token in method '" + m + "'")
+			}
+		}
+
+		for _, m := range methods {
+			r.handle(m, path, paths, rh)
+		}
+
+		return
+	}
+
+	handler := rh.handler
+
 	switch {
 	case len(method) == 0:
 		panic("method must not be empty")
+	case !isValidMethod(method):
+		panic("method must be an uppercase token in method '" + method + "'")
 	case handler == nil:
 		panic("handler must not be nil")
 	default:
 		validatePath(path)
 	}
 
-	r.registeredPaths[method] = append(r.registeredPaths[method], path)
+	if !radix.BalancedBraces(path) {
+		panic("unbalanced braces in path '" + path + "'")
+	}
+
+	if p, defaults := stripParamDefaults(path); defaults != nil {
+		path = p
+		rh.defaults = defaults
+	}
+
+	if r.LowercaseRoutes {
+		path = radix.LowercaseStatic(path)
+
+		if paths != nil {
+			lowercased := make([]string, len(paths))
+			for i := range paths {
+				lowercased[i] = radix.LowercaseStatic(paths[i])
+			}
+
+			paths = lowercased
+		}
+	}
+
+	if existing, ok := r.routeHandlers[method][path]; ok && !r.treeMutable {
+		panic("a handler is already registered for path '" + path + "' by the " +
+			existing.registrant() + ", registering it again by the " + rh.registrant())
+	}
+
+	if r.RejectDuplicateParams {
+		if key := duplicateParamKey(path); key != "" {
+			panic("duplicate param '" + key + "' in path '" + path + "'")
+		}
+	}
+
+	if paths == nil {
+		paths = getOptionalPaths(path)
+	}
+
+	if !r.treeMutable {
+		r.checkOptionalPathConflict(method, path, paths)
+	}
+
+	if rh.autoOptions != nil {
+		r.checkAutoOptionsConflict(path, paths)
+	}
+
+	if len(paths) > 0 {
+		if r.optionalPaths[method] == nil {
+			r.optionalPaths[method] = make(map[string]string)
+		}
+
+		for _, p := range paths {
+			r.optionalPaths[method][p] = path
+		}
+	}
+
+	if _, ok := r.routeHandlers[method][path]; !ok {
+		// A route re-registered on a mutable router is listed once
+		r.registeredPaths[method] = append(r.registeredPaths[method], path)
+	}
+
+	if r.routeHandlers[method] == nil {
+		r.routeHandlers[method] = make(map[string]routeHandler)
+	}
+
+	r.routeHandlers[method][path] = rh
 
 	methodIndex := r.methodIndexOf(method)
 	if methodIndex == -1 {
 		tree := radix.New()
 		tree.Mutable = r.treeMutable
+		tree.DisableTSR = gstrings.Include(r.DisableTSRMethods, method)
+		tree.Lowercase = r.LowercaseRoutes
+		tree.MatrixParams = r.MatrixParams
 
 		r.trees = append(r.trees, tree)
 		methodIndex = len(r.trees) - 1
 		r.customMethodsIndex[method] = methodIndex
+		r.globalAllowed = r.allowed("*", "")
 	}
 
 	tree := r.trees[methodIndex]
 	if tree == nil {
 		tree = radix.New()
 		tree.Mutable = r.treeMutable
+		tree.DisableTSR = gstrings.Include(r.DisableTSRMethods, method)
+		tree.Lowercase = r.LowercaseRoutes
+		tree.MatrixParams = r.MatrixParams
 
 		r.trees[methodIndex] = tree
 		r.globalAllowed = r.allowed("*", "")
@@ -274,47 +906,484 @@ func (r *Router) Handle(method, path string, handler fasthttp.RequestHandler) {
 		handler = r.saveMatchedRoutePath(path, handler)
 	}
 
-	optionalPaths := getOptionalPaths(path)
+	if g := rh.group; g != nil && g.prefix != "" && (r.SaveMatchedGroupPrefix || g.SaveMatchedGroupPrefix) {
+		handler = saveMatchedGroupPrefix(g.prefix, handler)
+	}
+
+	tree.DeferSort = r.deferSort
+	tree.MaxRegexProgramSize = r.MaxRegexProgramSize
+
+	add := tree.AddWithPriority
+	if rh.exact {
+		add = tree.AddExact
+	} else if rh.noFixedPath {
+		add = tree.AddWithoutFixedPath
+	} else if len(rh.matchers) > 0 {
+		add = func(p string, handler fasthttp.RequestHandler, predicate radix.Predicate, priority int) {
+			tree.AddWithMatchers(p, handler, predicate, priority, pathMatchers(p, rh.matchers))
+		}
+	}
 
 	// if not has optional paths, adds the original
-	if len(optionalPaths) == 0 {
-		tree.Add(path, handler)
+	if len(paths) == 0 {
+		add(path, handler, rh.predicate, rh.priority)
 	} else {
-		for _, p := range optionalPaths {
-			tree.Add(p, handler)
+		for _, p := range paths {
+			add(p, withParamDefaults(p, handler, rh.defaults), rh.predicate, rh.priority)
 		}
 	}
+
+	if rh.autoOptions != nil {
+		r.setAutoOptions(path, paths, *rh.autoOptions)
+	}
+
+	r.addPathMethod(method, path, paths, rh)
 }
 
-// Lookup allows the manual lookup of a method + path combo.
-// This is e.g. useful to build a framework around this router.
-// If the path was found, it returns the handler function.
-// Otherwise the second return value indicates whether a redirection to
-// the same path with an extra / without the trailing slash should be performed.
-func (r *Router) Lookup(method, path string, ctx *fasthttp.RequestCtx) (fasthttp.RequestHandler, bool) {
-	methodIndex := r.methodIndexOf(method)
-	if methodIndex == -1 {
-		return nil, false
+// addPathMethod adds the method to the paths of the route in pathMethods,
+// with positional param names like setAutoOptions, whose paths are added to
+// the methods tree to match them at once. The tree is dropped for good, so
+// the tree of each method is looked up instead, if a route has param
+// matchers, since the tree doesn't have them, or if the routes of all the
+// methods could not live in a single tree (e.g. '{path:*}' and '{path:**}'
+// at the same position).
+func (r *Router) addPathMethod(method, path string, paths []string, rh routeHandler) {
+	if r.noMethodsTree {
+		return
+	} else if len(rh.matchers) > 0 {
+		r.dropMethodsTree()
+		return
 	}
 
-	if tree := r.trees[methodIndex]; tree != nil {
-		handler, tsr := tree.Get(path, ctx)
-		if handler != nil || tsr {
-			return handler, tsr
-		}
+	if r.methodsTree == nil {
+		r.methodsTree = radix.New()
+		r.methodsTree.Lowercase = r.LowercaseRoutes
+		r.methodsTree.MatrixParams = r.MatrixParams
+		r.pathMethods = make(map[string][]string)
 	}
 
-	if tree := r.trees[r.methodIndexOf(MethodWild)]; tree != nil {
-		return tree.Get(path, ctx)
+	if len(paths) == 0 {
+		paths = []string{path}
 	}
 
-	return nil, false
-}
+	r.methodsTree.DeferSort = r.deferSort
 
-func (r *Router) recv(ctx *fasthttp.RequestCtx) {
-	if rcv := recover(); rcv != nil {
-		r.PanicHandler(ctx, rcv)
+	for _, p := range paths {
+		p = positionalParams(p)
+
+		methods, ok := r.pathMethods[p]
+		if !ok {
+			if err := r.methodsTree.TryAdd(p, func(*fasthttp.RequestCtx) {}); err != nil {
+				r.dropMethodsTree()
+				return
+			}
+		}
+
+		if !gstrings.Include(methods, method) {
+			// The previous slice could be shared with a cloned router
+			r.pathMethods[p] = append(methods[:len(methods):len(methods)], method)
+		}
+	}
+}
+
+// dropMethodsTree drops the methods tree for good,
+// see Router.addPathMethod
+func (r *Router) dropMethodsTree() {
+	r.methodsTree = nil
+	r.pathMethods = nil
+	r.noMethodsTree = true
+}
+
+// setAutoOptions registers the CORS preflight reply of the route path
+// with the given config, replacing the previous one of the path if any.
+// The paths are registered with positional param names, so the routes of
+// other methods which only differ by the param names share the reply.
+func (r *Router) setAutoOptions(path string, paths []string, config CORSConfig) {
+	if r.autoOptions == nil {
+		r.autoOptions = radix.New()
+		r.autoOptions.Mutable = true
+		r.autoOptions.Lowercase = r.LowercaseRoutes
+		r.autoOptions.MatrixParams = r.MatrixParams
+	}
+
+	handler := newPreflightHandler(config)
+
+	if len(paths) == 0 {
+		r.autoOptions.Add(positionalParams(path), handler)
+	} else {
+		for _, p := range paths {
+			r.autoOptions.Add(positionalParams(p), handler)
+		}
+	}
+}
+
+// checkAutoOptionsConflict panics if the CORS preflight reply of the route
+// path could not be registered, before the route is registered,
+// so the route is not registered without its reply
+func (r *Router) checkAutoOptionsConflict(path string, paths []string) {
+	if r.autoOptions == nil {
+		return
+	}
+
+	if len(paths) == 0 {
+		paths = []string{path}
+	}
+
+	tree := r.autoOptions.Clone()
+
+	for _, p := range paths {
+		if err := tree.TryAdd(positionalParams(p), func(*fasthttp.RequestCtx) {}); err != nil {
+			panic("the AutoOptions of path '" + path + "' conflicts with another route: " + err.Error())
+		}
+	}
+}
+
+// checkOptionalPathConflict panics with a descriptive error if the path,
+// or any of its optional paths, is already registered by another route,
+// since the tree would only report the duplicated expanded path.
+func (r *Router) checkOptionalPathConflict(method, path string, paths []string) {
+	if len(paths) == 0 {
+		if route, ok := r.optionalPaths[method][path]; ok {
+			panic("path '" + path + "' conflicts with the optional path of the existing route '" + route + "'")
+		}
+
+		return
+	}
+
+	for _, p := range paths {
+		route, ok := r.optionalPaths[method][p]
+		if !ok {
+			_, ok = r.routeHandlers[method][p]
+			route = p
+		}
+
+		if ok && route != path {
+			panic("optional path '" + p + "' of '" + path + "' conflicts with the existing route '" + route + "'")
+		}
+	}
+}
+
+// Export returns the registered routes sorted by method, with their
+// optional paths already expanded, so they could be stored and
+// imported later with ImportFrom.
+func (r *Router) Export() []RouteInfo {
+	methods := make([]string, 0, len(r.registeredPaths))
+	for method := range r.registeredPaths {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+
+	routes := make([]RouteInfo, 0)
+
+	for _, method := range methods {
+		for _, path := range r.registeredPaths[method] {
+			paths := getOptionalPaths(path)
+			if len(paths) == 0 {
+				paths = append(paths, path)
+			}
+
+			routes = append(routes, RouteInfo{
+				Method: method,
+				Path:   path,
+				Paths:  paths,
+			})
+		}
+	}
+
+	return routes
+}
+
+// Validate checks the registered routes for issues which don't prevent
+// them from being registered, but make them behave unexpectedly.
+// It reports the paths with the same param name more than once
+// (e.g. /a/{id}/b/{id}), since the last value overwrites the others
+// in the ctx.UserValue.
+// It's intended to be called once all the routes are registered.
+func (r *Router) Validate() error {
+	methods := make([]string, 0, len(r.registeredPaths))
+	for method := range r.registeredPaths {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+
+	var errs []error
+
+	for _, method := range methods {
+		checked := make(map[string]bool)
+
+		for _, path := range r.registeredPaths[method] {
+			if checked[path] {
+				continue
+			}
+
+			checked[path] = true
+
+			if key := duplicateParamKey(path); key != "" {
+				errs = append(errs, fmt.Errorf("%s %s: duplicate param '%s'", method, path, key))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// WouldConflict checks if registering a route with the given method and path
+// would panic, without registering it, returning the panic message if so
+// (e.g. a handler already registered for the path, or a conflict with
+// an existing wildcard), so routes could be skipped or renamed before
+// registering them (e.g. when loading plugins).
+//
+// The route is registered in a clone of the router, so it's intended to be
+// called when registering the routes, not while handling the requests.
+func (r *Router) WouldConflict(method, path string) (conflict bool, msg string) {
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			conflict = true
+			msg = fmt.Sprint(rcv)
+		}
+	}()
+
+	r.Clone().handle(method, path, nil, routeHandler{handler: func(*fasthttp.RequestCtx) {}})
+
+	return false, ""
+}
+
+// ImportFrom registers the given routes, usually exported with Export,
+// binding each one to the handler returned by lookupHandler for its method
+// and path.
+// The optional paths of the routes are not derived again, the exported ones
+// are used instead.
+func (r *Router) ImportFrom(routes []RouteInfo, lookupHandler func(method, path string) fasthttp.RequestHandler) {
+	for _, route := range routes {
+		r.handle(route.Method, route.Path, route.Paths, routeHandler{handler: lookupHandler(route.Method, route.Path)})
+	}
+}
+
+// CloneGroup registers again all the routes under the prefix of the src group
+// at the given prefix, which is useful to publish a new version of an API.
+// It returns the group of the new prefix, with the same middleware as src.
+//
+// The routes reuse the handler they were registered with, so they
+// are already wrapped with the middleware of their groups.
+// The overrides replace the handler of the routes by their path relative to
+// the src prefix. The key could be "<method> <path>" to only replace the
+// handler of a method, which takes priority over the key "<path>" replacing
+// it for all methods. The overrides are wrapped with the middleware of the
+// returned group.
+//
+//	v2 := router.CloneGroup(v1, "/v2", map[string]fasthttp.RequestHandler{
+//		"/users/{id}": getUserV2,
+//		"POST /users": createUserV2,
+//	})
+func (r *Router) CloneGroup(src *Group, prefix string, overrides map[string]fasthttp.RequestHandler) *Group {
+	validatePath(prefix)
+
+	g := r.Group(prefix)
+	if g.prefix == src.prefix {
+		panic("clone prefix must differ from the group prefix in path '" + prefix + "'")
+	}
+
+	g.middleware = append([]namedMiddleware(nil), src.middleware...)
+	g.SaveMatchedRoutePath = src.SaveMatchedRoutePath
+	g.SaveMatchedGroupPrefix = src.SaveMatchedGroupPrefix
+
+	methods := make([]string, 0, len(r.registeredPaths))
+	for method := range r.registeredPaths {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		cloned := make(map[string]bool)
+
+		for _, path := range r.registeredPaths[method] {
+			if !strings.HasPrefix(path, src.prefix+"/") || cloned[path] {
+				continue
+			}
+
+			cloned[path] = true
+			subPath := path[len(src.prefix):]
+
+			override := overrides[method+" "+subPath]
+			if override == nil {
+				override = overrides[subPath]
+			}
+
+			rh := r.routeHandlers[method][path]
+			rh.group = g
+			clonePath := g.prefix + subPath
+
+			if override != nil {
+				rh.handler = g.wrapHandler(clonePath, override)
+			}
+
+			r.handle(method, clonePath, nil, rh)
+		}
+	}
+
+	return g
+}
+
+// HandleTimeout registers a new request handler with the given path and method,
+// limiting its execution to the given timeout.
+//
+// If the handler doesn't return in time, the request is answered with
+// 'Service Unavailable' and HTTP status code 503.
+// Since fasthttp handlers can't be preempted, the handler is executed in its own
+// goroutine and keeps running after the timeout. All response modifications
+// after the timeout are ignored, so the handler should cooperatively bound its
+// own work (e.g. passing deadlines to its I/O calls).
+// Panics raised after the timeout are not passed to the PanicHandler.
+// Like fasthttp.TimeoutWithCodeHandler, the request is answered with
+// 'Too Many Requests' and HTTP status code 429 if the handlers running in
+// their own goroutine already reach the server concurrency.
+func (r *Router) HandleTimeout(method, path string, handler fasthttp.RequestHandler, timeout time.Duration) {
+	if handler == nil {
+		panic("handler must not be nil")
 	}
+
+	r.Handle(method, path, newTimeoutHandler(handler, timeout))
+}
+
+// Lookup allows the manual lookup of a method + path combo.
+// This is e.g. useful to build a framework around this router.
+// If the path was found, it returns the handler function.
+// Otherwise the second return value indicates whether a redirection to
+// the same path with an extra / without the trailing slash should be performed.
+func (r *Router) Lookup(method, path string, ctx *fasthttp.RequestCtx) (fasthttp.RequestHandler, bool) {
+	methodIndex := r.methodIndexOf(method)
+	if methodIndex == -1 {
+		return nil, false
+	}
+
+	if tree := r.trees[methodIndex]; tree != nil {
+		handler, tsr := getParams(tree, path, ctx, nil)
+		if handler != nil || tsr {
+			return handler, tsr
+		}
+	}
+
+	if tree := r.trees[r.methodIndexOf(MethodWild)]; tree != nil {
+		return getParams(tree, path, ctx, nil)
+	}
+
+	return nil, false
+}
+
+// LookupParams allows the manual lookup of a method + path combo like Lookup,
+// but without a request ctx, returning the params of the matched route as
+// key/value pairs, in the same order they appear in the route path,
+// instead of saving them as user values. So the number of params is known
+// to preallocate the storage of a framework built around this router.
+// The values reference the given path, and the value of a catch-all param
+// is always the raw path. The ParamDecoders and the route predicates
+// are not applied, since there is no request.
+func (r *Router) LookupParams(method, path string) (fasthttp.RequestHandler, radix.Params, bool) {
+	methodIndex := r.methodIndexOf(method)
+	if methodIndex == -1 {
+		return nil, nil, false
+	}
+
+	if tree := r.trees[methodIndex]; tree != nil {
+		handler, ps, tsr := tree.GetParams(path, nil)
+		if handler != nil || tsr {
+			return handler, ps, tsr
+		}
+	}
+
+	if tree := r.trees[r.methodIndexOf(MethodWild)]; tree != nil {
+		return tree.GetParams(path, nil)
+	}
+
+	return nil, nil, false
+}
+
+// Match checks if a route is registered for the given method + path combo,
+// like Lookup but without a request ctx, so it doesn't set the params as
+// user values and doesn't allocate, apart from the regexp matching of the
+// regex params. It's useful for read-only checks (e.g. rate limiting or
+// authorization) before handling the request.
+// Since there is no request, the route predicates are not evaluated.
+func (r *Router) Match(method, path string) bool {
+	handler, _ := r.Lookup(method, path, nil)
+
+	return handler != nil
+}
+
+// LookupWithRedirect allows the manual lookup of a method + path combo
+// like Lookup, but following the same steps as Handler.
+// If the path was found, it returns the handler function.
+// Otherwise the second return value is the corrected path to redirect to,
+// if a trailing slash redirection or a fixed path redirection applies,
+// according to the RedirectTrailingSlash and RedirectFixedPath options.
+func (r *Router) LookupWithRedirect(method, path string, ctx *fasthttp.RequestCtx) (fasthttp.RequestHandler, string) {
+	var trees [2]*radix.Tree
+
+	if methodIndex := r.methodIndexOf(method); methodIndex > -1 {
+		trees[0] = r.trees[methodIndex]
+	}
+
+	trees[1] = r.trees[r.methodIndexOf(MethodWild)]
+
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+
+		handler, tsr := getParams(tree, path, ctx, nil)
+		if handler != nil {
+			return handler, ""
+		} else if method == fasthttp.MethodConnect || path == "/" {
+			continue
+		}
+
+		fixURI := fasthttp.AcquireURI()
+		fixURI.SetPath(path)
+
+		uri := bytebufferpool.Get()
+		found := r.redirectURI(uri, tree, tsr, method, path, strconv.B2S(fixURI.Path()))
+		redirectTo := uri.String()
+
+		bytebufferpool.Put(uri)
+		fasthttp.ReleaseURI(fixURI)
+
+		if found {
+			return nil, redirectTo
+		}
+	}
+
+	return nil, ""
+}
+
+func (r *Router) recv(ctx *fasthttp.RequestCtx) {
+	if rcv := recover(); rcv != nil {
+		if r.PanicHandler != nil {
+			r.PanicHandler(ctx, rcv)
+		} else {
+			defaultPanicHandler(ctx, rcv)
+		}
+	}
+}
+
+// appendWildAllowed appends the methods which are allowed by a MethodWild route,
+// that is, the standard methods and the registered custom methods
+func (r *Router) appendWildAllowed(allowed []string, reqMethod string) []string {
+	for _, method := range wildAllowedMethods {
+		if method != reqMethod && !gstrings.Include(allowed, method) {
+			allowed = append(allowed, method)
+		}
+	}
+
+	for method := range r.customMethodsIndex {
+		if method != reqMethod && !gstrings.Include(allowed, method) {
+			allowed = append(allowed, method)
+		}
+	}
+
+	return allowed
 }
 
 func (r *Router) allowed(path, reqMethod string) (allow string) {
@@ -327,12 +1396,23 @@ func (r *Router) allowed(path, reqMethod string) (allow string) {
 				if method == fasthttp.MethodOptions {
 					continue
 				}
-				// Add request method to list of allowed methods
-				allowed = append(allowed, method)
+
+				allowed = r.appendAllowed(allowed, method, reqMethod)
 			}
 		} else {
 			return r.globalAllowed
 		}
+	} else if r.methodsTree != nil { // specific path, in a single lookup
+		r.methodsTree.VisitRoutes(path, func(route string) {
+			for _, method := range r.pathMethods[route] {
+				// Skip the requested method - we already tried this one
+				if method == reqMethod || method == fasthttp.MethodOptions {
+					continue
+				}
+
+				allowed = r.appendAllowed(allowed, method, reqMethod)
+			}
+		})
 	} else { // specific path
 		for method := range r.registeredPaths {
 			// Skip the requested method - we already tried this one
@@ -341,13 +1421,19 @@ func (r *Router) allowed(path, reqMethod string) (allow string) {
 			}
 
 			handle, _ := r.trees[r.methodIndexOf(method)].Get(path, nil)
-			if handle != nil {
-				// Add request method to list of allowed methods
-				allowed = append(allowed, method)
+			if handle == nil {
+				continue
 			}
+
+			allowed = r.appendAllowed(allowed, method, reqMethod)
 		}
 	}
 
+	if r.AdvertiseHEAD && reqMethod != fasthttp.MethodHead &&
+		gstrings.Include(allowed, fasthttp.MethodGet) && !gstrings.Include(allowed, fasthttp.MethodHead) {
+		allowed = append(allowed, fasthttp.MethodHead)
+	}
+
 	if len(allowed) > 0 {
 		// Add request method to list of allowed methods
 		allowed = append(allowed, fasthttp.MethodOptions)
@@ -367,17 +1453,42 @@ func (r *Router) allowed(path, reqMethod string) (allow string) {
 	return
 }
 
-func (r *Router) tryRedirect(ctx *fasthttp.RequestCtx, tree *radix.Tree, tsr bool, method, path string) bool {
-	// Moved Permanently, request with GET method
-	code := fasthttp.StatusMovedPermanently
-	if method != fasthttp.MethodGet {
-		// Permanent Redirect, request with same method
-		code = fasthttp.StatusPermanentRedirect
+// appendAllowed appends the given route method to the allowed methods,
+// or the methods allowed by a MethodWild route
+func (r *Router) appendAllowed(allowed []string, method, reqMethod string) []string {
+	if method == MethodWild {
+		return r.appendWildAllowed(allowed, reqMethod)
+	} else if !gstrings.Include(allowed, method) {
+		// Add request method to list of allowed methods
+		return append(allowed, method)
 	}
 
-	if tsr && r.RedirectTrailingSlash {
-		uri := bytebufferpool.Get()
+	return allowed
+}
+
+// redirectTrailingSlash checks if the trailing slash redirection
+// is enabled for the given method
+func (r *Router) redirectTrailingSlash(method string) bool {
+	if !r.RedirectTrailingSlash {
+		return false
+	}
+
+	return r.RedirectTrailingSlashMethods == nil || gstrings.Include(r.RedirectTrailingSlashMethods, method)
+}
 
+// redirectURI writes the redirect target of the given path into uri,
+// according to the RedirectTrailingSlash and RedirectFixedPath options.
+// The fixPath is the cleaned request path used to fix the case of the path.
+// It returns false if no redirection applies.
+func (r *Router) redirectURI(uri *bytebufferpool.ByteBuffer, tree *radix.Tree, tsr bool, method, path, fixPath string) bool {
+	return fixedURI(uri, tree, tsr, r.redirectTrailingSlash(method), r.RedirectFixedPath, path, fixPath)
+}
+
+// fixedURI writes the redirect target of the given path into uri, fixing
+// the trailing slash and the case of the path if enabled.
+// It returns false if no redirection applies.
+func fixedURI(uri *bytebufferpool.ByteBuffer, tree *radix.Tree, tsr, redirectTrailingSlash, redirectFixedPath bool, path, fixPath string) bool {
+	if tsr && redirectTrailingSlash {
 		if len(path) > 1 && path[len(path)-1] == '/' {
 			uri.SetString(path[:len(path)-1])
 		} else {
@@ -385,76 +1496,399 @@ func (r *Router) tryRedirect(ctx *fasthttp.RequestCtx, tree *radix.Tree, tsr boo
 			uri.WriteByte('/')
 		}
 
-		if queryBuf := ctx.URI().QueryString(); len(queryBuf) > 0 {
-			uri.WriteByte(questionMark)
-			uri.Write(queryBuf)
-		}
-
-		ctx.Redirect(uri.String(), code)
-		bytebufferpool.Put(uri)
-
 		return true
 	}
 
 	// Try to fix the request path
-	if r.RedirectFixedPath {
-		path2 := strconv.B2S(ctx.Request.URI().Path())
-
-		uri := bytebufferpool.Get()
+	if redirectFixedPath {
 		found := tree.FindCaseInsensitivePath(
-			cleanPath(path2),
-			r.RedirectTrailingSlash,
+			cleanPath(fixPath),
+			redirectTrailingSlash,
 			uri,
 		)
 
-		if found {
-			if queryBuf := ctx.URI().QueryString(); len(queryBuf) > 0 {
-				uri.WriteByte(questionMark)
-				uri.Write(queryBuf)
-			}
+		if found && isRedirectLoop(uri.B, path) {
+			// The fixed path is the request path itself (e.g. it only differs
+			// by an encoded char), so skip the redirection to avoid a loop
+			uri.Reset()
+
+			return false
+		}
+
+		return found
+	}
+
+	return false
+}
+
+func (r *Router) tryRedirect(ctx *fasthttp.RequestCtx, tree *radix.Tree, tsr bool, method, path string) bool {
+	return r.redirect(ctx, tree, tsr, r.redirectTrailingSlash(method), r.RedirectFixedPath, method, path)
+}
+
+// redirect redirects the request to the fixed path like tryRedirect,
+// fixing the trailing slash and the case of the path if enabled
+func (r *Router) redirect(ctx *fasthttp.RequestCtx, tree *radix.Tree, tsr, redirectTrailingSlash, redirectFixedPath bool, method, path string) bool {
+	if r.PathExtractor != nil {
+		// The fixed path could not be mapped back onto the request uri
+		return false
+	}
+
+	uri := bytebufferpool.Get()
+
+	if !fixedURI(uri, tree, tsr, redirectTrailingSlash, redirectFixedPath, path, strconv.B2S(ctx.Request.URI().Path())) {
+		bytebufferpool.Put(uri)
+
+		return false
+	}
+
+	redirectTo(ctx, uri, method)
+
+	return true
+}
+
+// redirectAnyMethod redirects the request to the path fixed with the routes
+// of any method, like redirect with RedirectFixedPath. The trees at the given
+// method indexes are skipped, since they were already tried.
+func (r *Router) redirectAnyMethod(ctx *fasthttp.RequestCtx, method, path string, skip ...int) bool {
+	if r.PathExtractor != nil {
+		// Like redirect
+		return false
+	}
+
+	uri := bytebufferpool.Get()
+
+	fixPath := cleanPath(strconv.B2S(ctx.Request.URI().Path()))
+
+	if !r.findCaseInsensitivePath(uri, fixPath, r.redirectTrailingSlash(method), skip...) || isRedirectLoop(uri.B, path) {
+		bytebufferpool.Put(uri)
+
+		return false
+	}
 
-			ctx.Redirect(uri.String(), code)
-			bytebufferpool.Put(uri)
+	redirectTo(ctx, uri, method)
 
+	return true
+}
+
+// redirectTo redirects the request to the given uri, keeping its query string,
+// and releases the uri buffer
+func redirectTo(ctx *fasthttp.RequestCtx, uri *bytebufferpool.ByteBuffer, method string) {
+	// Moved Permanently, request with GET method
+	code := fasthttp.StatusMovedPermanently
+	if method != fasthttp.MethodGet {
+		// Permanent Redirect, request with same method
+		code = fasthttp.StatusPermanentRedirect
+	}
+
+	if queryBuf := ctx.URI().QueryString(); len(queryBuf) > 0 {
+		uri.WriteByte(questionMark)
+		uri.Write(queryBuf)
+	}
+
+	// The location is copied into the response, so the buffer could be reused
+	ctx.RedirectBytes(uri.B, code)
+	bytebufferpool.Put(uri)
+}
+
+// FindCaseInsensitivePath looks up the given path case-insensitively in the
+// routes of all the methods, returning the first fixed path found, whatever
+// its method. If fixTrailingSlash, a missing or superfluous trailing slash
+// is fixed as well.
+// The trees are looked up in the order of the methods index, so the
+// standard methods are tried before the custom ones.
+func (r *Router) FindCaseInsensitivePath(path string, fixTrailingSlash bool) (string, bool) {
+	buf := bytebufferpool.Get()
+	defer bytebufferpool.Put(buf)
+
+	if !r.findCaseInsensitivePath(buf, path, fixTrailingSlash) {
+		return "", false
+	}
+
+	return buf.String(), true
+}
+
+// findCaseInsensitivePath writes into buf the first fixed path found like
+// FindCaseInsensitivePath, skipping the trees at the given method indexes
+func (r *Router) findCaseInsensitivePath(buf *bytebufferpool.ByteBuffer, path string, fixTrailingSlash bool, skip ...int) bool {
+	for i, tree := range r.trees {
+		if tree == nil || slices.Contains(skip, i) {
+			continue
+		}
+
+		buf.Reset()
+
+		if tree.FindCaseInsensitivePath(path, fixTrailingSlash, buf) {
 			return true
 		}
+	}
 
-		bytebufferpool.Put(uri)
+	buf.Reset()
+
+	return false
+}
+
+// RequestHost returns the host of the request, which is the first host
+// of the X-Forwarded-Host header if Router.TrustForwardedHost is enabled
+// and the header is present, otherwise the host of the request uri.
+func (r *Router) RequestHost(ctx *fasthttp.RequestCtx) string {
+	if r.TrustForwardedHost {
+		forwarded := strconv.B2S(ctx.Request.Header.Peek(fasthttp.HeaderXForwardedHost))
+
+		if i := strings.IndexByte(forwarded, ','); i > -1 {
+			forwarded = forwarded[:i]
+		}
+
+		if forwarded = strings.TrimSpace(forwarded); forwarded != "" {
+			return gstrings.Copy(forwarded)
+		}
+	}
+
+	return string(ctx.Host())
+}
+
+// IsSecure checks if the request is made over HTTPS, which is either
+// a TLS connection or, if Router.TrustForwardedProto is enabled, a request
+// forwarded with the https scheme in the first value of the
+// X-Forwarded-Proto header.
+func (r *Router) IsSecure(ctx *fasthttp.RequestCtx) bool {
+	if ctx.IsTLS() {
+		return true
+	} else if !r.TrustForwardedProto {
+		return false
+	}
+
+	proto := strconv.B2S(ctx.Request.Header.Peek(fasthttp.HeaderXForwardedProto))
+
+	if i := strings.IndexByte(proto, ','); i > -1 {
+		proto = proto[:i]
+	}
+
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// treeGet returns the handler of the path from the tree like Tree.Get,
+// passing the steps of the lookup to the MatchTracer if set, and saves
+// the params of the matched route for Params and VisitParams
+func (r *Router) treeGet(tree *radix.Tree, path string, ctx *fasthttp.RequestCtx) (fasthttp.RequestHandler, bool) {
+	var steps *[]string
+	if r.MatchTracer != nil {
+		steps = new([]string)
+	}
+
+	handler, tsr := getParams(tree, path, ctx, steps)
+
+	if r.MatchTracer != nil {
+		r.MatchTracer(path, *steps)
+	}
+
+	return handler, tsr
+}
+
+// setCustomOPTIONSAllow sets the "Allow" header before calling a custom
+// handler of an OPTIONS request, if Router.AutoAllowWithCustomOPTIONS is enabled
+func (r *Router) setCustomOPTIONSAllow(ctx *fasthttp.RequestCtx, method, path string) {
+	if !r.AutoAllowWithCustomOPTIONS || method != fasthttp.MethodOptions {
+		return
+	}
+
+	if allow := r.allowed(path, fasthttp.MethodOptions); allow != "" {
+		ctx.Response.Header.Set("Allow", allow)
+	}
+}
+
+// requestPath returns the path of the request to route,
+// or false if the request path is invalid
+func (r *Router) requestPath(ctx *fasthttp.RequestCtx) (string, bool) {
+	var path string
+	if r.PathExtractor != nil {
+		path = r.PathExtractor(ctx)
+	} else {
+		path = strconv.B2S(ctx.Request.URI().PathOriginal())
+	}
+
+	switch {
+	case len(path) == 0:
+		// The request uri has no path (e.g. "?key=val"), so route it as root
+		return "/", true
+	case !isValidRequestPath(path, r.MaxPathLength):
+		return "", false
+	case r.CleanPath:
+		return collapseSlashes(path), true
+	default:
+		return path, true
+	}
+}
+
+// TryRedirect redirects the request to the route which matches its path
+// with or without the trailing slash, or once its case is fixed and it's
+// cleaned, like the RedirectTrailingSlash and RedirectFixedPath options.
+// It returns if the request has been redirected.
+//
+// It's meant to be called by the NotFound handler, to opt into the
+// redirections when these options are disabled, so they are applied
+// regardless of them. The routes registered with RouteBuilder.Exact or
+// RouteBuilder.NoFixedPathRedirect are still excluded.
+func (r *Router) TryRedirect(ctx *fasthttp.RequestCtx) bool {
+	path, ok := r.requestPath(ctx)
+	method := strconv.B2S(ctx.Request.Header.Method())
+
+	if !ok || method == fasthttp.MethodConnect || path == "/" {
+		return false
+	}
+
+	var trees [3]*radix.Tree
+
+	if methodIndex := r.methodIndexOf(method); methodIndex > -1 {
+		trees[0] = r.trees[methodIndex]
+	}
+
+	if r.AutoHEAD && method == fasthttp.MethodHead {
+		trees[1] = r.trees[r.methodIndexOf(fasthttp.MethodGet)]
+	}
+
+	trees[2] = r.trees[r.methodIndexOf(MethodWild)]
+
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+
+		if handler, tsr := tree.Get(path, ctx); handler != nil {
+			// The path is found, so there is nothing to fix
+			return false
+		} else if r.redirect(ctx, tree, tsr, true, true, method, path) {
+			return true
+		}
 	}
 
 	return false
 }
 
+// serveGETAsHEAD serves the HEAD request with the GET handler of the path,
+// skipping the response body. It returns if the request has been served.
+func (r *Router) serveGETAsHEAD(ctx *fasthttp.RequestCtx, path string) bool {
+	tree := r.trees[r.methodIndexOf(fasthttp.MethodGet)]
+	if tree == nil {
+		return false
+	}
+
+	handler, tsr := r.treeGet(tree, path, ctx)
+	if handler == nil {
+		if path != "/" && r.tryRedirect(ctx, tree, tsr, fasthttp.MethodHead, path) {
+			r.miss(ctx, MissRedirected)
+			return true
+		}
+
+		return false
+	}
+
+	if (len(r.paramDecoders) == 0 && !r.DecodeParams) || r.decodeParams(ctx) {
+		handler(ctx)
+	}
+
+	// The Content-Length of the body is still sent
+	ctx.Response.SkipBody = true
+
+	return true
+}
+
 // Handler makes the router implement the http.Handler interface.
 func (r *Router) Handler(ctx *fasthttp.RequestCtx) {
-	if r.PanicHandler != nil {
+	if r.PanicHandler != nil || r.RecoverPanics {
 		defer r.recv(ctx)
 	}
 
-	path := strconv.B2S(ctx.Request.URI().PathOriginal())
+	if r.TrustForwardedHost {
+		host := r.RequestHost(ctx)
+
+		ctx.SetUserValue(RequestHostParam, host)
+		acquireRequestData(ctx).meta.RequestHost = host
+	}
+
+	path, ok := r.requestPath(ctx)
+	if !ok {
+		if r.BadRequestHandler != nil {
+			r.BadRequestHandler(ctx)
+		} else {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusBadRequest), fasthttp.StatusBadRequest)
+		}
+
+		r.miss(ctx, MissBadRequest)
+		return
+	}
+
 	method := strconv.B2S(ctx.Request.Header.Method())
 	methodIndex := r.methodIndexOf(method)
 
 	if methodIndex > -1 {
 		if tree := r.trees[methodIndex]; tree != nil {
-			if handler, tsr := tree.Get(path, ctx); handler != nil {
-				handler(ctx)
+			if handler, tsr := r.treeGet(tree, path, ctx); handler != nil {
+				r.setCustomOPTIONSAllow(ctx, method, path)
+
+				if (len(r.paramDecoders) == 0 && !r.DecodeParams) || r.decodeParams(ctx) {
+					handler(ctx)
+				}
 				return
 			} else if method != fasthttp.MethodConnect && path != "/" {
 				if ok := r.tryRedirect(ctx, tree, tsr, method, path); ok {
+					r.miss(ctx, MissRedirected)
 					return
 				}
 			}
 		}
 	}
 
+	if r.AutoHEAD && method == fasthttp.MethodHead && r.serveGETAsHEAD(ctx, path) {
+		return
+	}
+
 	// Try to search in the wild method tree
 	if tree := r.trees[r.methodIndexOf(MethodWild)]; tree != nil {
-		if handler, tsr := tree.Get(path, ctx); handler != nil {
-			handler(ctx)
+		if handler, tsr := r.treeGet(tree, path, ctx); handler != nil {
+			// The wild method routes also handle the OPTIONS requests
+			r.setCustomOPTIONSAllow(ctx, method, path)
+
+			if (len(r.paramDecoders) == 0 && !r.DecodeParams) || r.decodeParams(ctx) {
+				handler(ctx)
+			}
 			return
 		} else if method != fasthttp.MethodConnect && path != "/" {
 			if ok := r.tryRedirect(ctx, tree, tsr, method, path); ok {
+				r.miss(ctx, MissRedirected)
+				return
+			}
+		}
+	}
+
+	if r.RedirectFixedPath && r.RedirectFixedPathAnyMethod && method != fasthttp.MethodConnect && path != "/" {
+		// Try to fix the path with the routes of the other methods, since the
+		// trees of the request method and the wild method were already tried
+		if r.redirectAnyMethod(ctx, method, path, methodIndex, r.methodIndexOf(MethodWild)) {
+			r.miss(ctx, MissRedirected)
+			return
+		}
+	}
+
+	if r.UnknownMethod501 && methodIndex == -1 {
+		// Handle 501
+
+		if allow := r.allowed(path, method); allow != "" {
+			ctx.Response.Header.Set("Allow", allow)
+		}
+
+		ctx.SetStatusCode(fasthttp.StatusNotImplemented)
+		ctx.SetBodyString(fasthttp.StatusMessage(fasthttp.StatusNotImplemented))
+		r.miss(ctx, MissNotImplemented)
+		return
+	}
+
+	if method == fasthttp.MethodOptions && r.autoOptions != nil {
+		// Handle the OPTIONS requests of the routes with AutoOptions
+
+		if handler, _ := r.autoOptions.Get(path, nil); handler != nil {
+			if allow := r.allowed(path, fasthttp.MethodOptions); allow != "" {
+				ctx.Response.Header.Set("Allow", allow)
+				handler(ctx)
 				return
 			}
 		}
@@ -476,18 +1910,45 @@ func (r *Router) Handler(ctx *fasthttp.RequestCtx) {
 		if allow := r.allowed(path, method); allow != "" {
 			ctx.Response.Header.Set("Allow", allow)
 			if r.MethodNotAllowed != nil {
+				allowed := strings.Split(allow, ", ")
+
+				ctx.SetUserValue(AllowedMethodsParam, allowed)
+				acquireRequestData(ctx).meta.AllowedMethods = allowed
 				r.MethodNotAllowed(ctx)
 			} else {
-				ctx.SetStatusCode(fasthttp.StatusMethodNotAllowed)
-				ctx.SetBodyString(fasthttp.StatusMessage(fasthttp.StatusMethodNotAllowed))
+				replyBody(ctx, fasthttp.StatusMethodNotAllowed, r.MethodNotAllowedBody, r.MethodNotAllowedContentType)
 			}
+
+			r.miss(ctx, MissMethodNotAllowed)
 			return
 		}
 	}
 
-	// Handle 404
-	if r.NotFound != nil {
+	if r.Fallback != nil && r.Fallback(ctx) {
+		return
+	}
+
+	r.notFound(ctx, path)
+	r.miss(ctx, MissNotFound)
+}
+
+// miss reports the request which could not be dispatched to a route
+// to the OnMiss function, if set
+func (r *Router) miss(ctx *fasthttp.RequestCtx, kind MissKind) {
+	if r.OnMiss != nil {
+		r.OnMiss(ctx, kind)
+	}
+}
+
+// notFound handles the request as not found with the NotFound handler
+// of the most specific group of the path, or with the router one
+func (r *Router) notFound(ctx *fasthttp.RequestCtx, path string) {
+	if handler := r.groupNotFoundHandler(path); handler != nil {
+		handler(ctx)
+	} else if r.NotFound != nil {
 		r.NotFound(ctx)
+	} else if r.NotFoundBody != nil {
+		replyBody(ctx, fasthttp.StatusNotFound, r.NotFoundBody, r.NotFoundContentType)
 	} else {
 		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
 	}
@@ -4,18 +4,24 @@ import (
 	"bufio"
 	"bytes"
 	"embed"
+	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
+	"github.com/fasthttp/router/radix"
 	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
 )
 
 type readWriter struct {
@@ -113,6 +119,50 @@ func assertWithTestServer(t *testing.T, uri string, handler fasthttp.RequestHand
 	fn(rw)
 }
 
+// assertWithTestListener serves the request like assertWithTestServer, but
+// through a listener like a real server, which also bounds the handlers
+// running in their own goroutine (e.g. fasthttp.TimeoutHandler)
+func assertWithTestListener(t *testing.T, uri string, handler fasthttp.RequestHandler, fn assertFn) {
+	s := &fasthttp.Server{
+		Handler:          handler,
+		DisableKeepalive: true,
+	}
+
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+
+	go s.Serve(ln)
+
+	conn, err := ln.Dial()
+	if err != nil {
+		t.Fatalf("Unexpected error when dialing: %s", err)
+	}
+
+	rw := &readWriter{}
+	ch := make(chan error)
+
+	go func() {
+		if _, err := conn.Write([]byte(uri)); err != nil {
+			ch <- err
+			return
+		}
+
+		_, err := rw.w.ReadFrom(conn)
+		ch <- err
+	}()
+
+	select {
+	case err := <-ch:
+		if err != nil {
+			t.Fatalf("return error %s", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("timeout")
+	}
+
+	fn(rw)
+}
+
 func catchPanic(testFunc func()) (recv interface{}) {
 	defer func() {
 		recv = recover()
@@ -325,6 +375,189 @@ func TestRouterRegexUserValues(t *testing.T) {
 	}
 }
 
+func TestRouterParamDecoder(t *testing.T) {
+	router := New()
+	router.ParamDecoder("token", func(value string) (interface{}, error) {
+		return base64.RawURLEncoding.DecodeString(value)
+	})
+
+	var token interface{}
+	router.GET("/auth/{token}", func(ctx *fasthttp.RequestCtx) {
+		token = ctx.UserValue("token")
+	})
+	router.ANY("/any/{token}", func(ctx *fasthttp.RequestCtx) {
+		token = ctx.UserValue("token")
+	})
+
+	decodeInt := func(value string) (interface{}, error) {
+		return strconv.Atoi(value)
+	}
+
+	if err := catchPanic(func() { router.ParamDecoder("", decodeInt) }); err == nil {
+		t.Error("an error was expected with an empty param name")
+	}
+
+	if err := catchPanic(func() { router.ParamDecoder("id", nil) }); err == nil {
+		t.Error("an error was expected with a nil decoder")
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+
+	for _, path := range []string{"/auth/", "/any/"} {
+		token = nil
+
+		ctx.Request.SetRequestURI(path + base64.RawURLEncoding.EncodeToString([]byte("secret")))
+		router.Handler(ctx)
+
+		if v, ok := token.([]byte); !ok || string(v) != "secret" {
+			t.Errorf("Path '%s' - token == %v, want %q", path, token, "secret")
+		}
+
+		token = nil
+		ctx.Response.Reset()
+
+		ctx.Request.SetRequestURI(path + "@invalid@")
+		router.Handler(ctx)
+
+		if token != nil {
+			t.Errorf("Path '%s' - handler called with an invalid token", path)
+		}
+
+		if status := ctx.Response.StatusCode(); status != fasthttp.StatusBadRequest {
+			t.Errorf("Path '%s' - Response status code == %d, want %d", path, status, fasthttp.StatusBadRequest)
+		}
+
+		ctx.Response.Reset()
+	}
+
+	var decodeErr error
+	router.ParamDecodeError = func(ctx *fasthttp.RequestCtx, err error) {
+		decodeErr = err
+		ctx.SetStatusCode(fasthttp.StatusTeapot)
+	}
+
+	ctx.Request.SetRequestURI("/auth/@invalid@")
+	router.Handler(ctx)
+
+	if decodeErr == nil {
+		t.Error("custom param decode error handler not called")
+	}
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusTeapot {
+		t.Errorf("Response status code == %d, want %d", status, fasthttp.StatusTeapot)
+	}
+}
+
+func TestRouterDecodeParams(t *testing.T) {
+	var values []interface{}
+
+	router := New()
+	router.ParamDecoder("n", func(value string) (interface{}, error) {
+		return "decoded " + value, nil
+	})
+	router.GET("/names/{name}", func(ctx *fasthttp.RequestCtx) {
+		values = append(values, ctx.UserValue("name"))
+	})
+	router.GET("/names/{name}/{n}", func(ctx *fasthttp.RequestCtx) {
+		values = append(values, ctx.UserValue("name"), ctx.UserValue("n"))
+	})
+	router.GET("/files/{path:*}", func(ctx *fasthttp.RequestCtx) {
+		values = append(values, ctx.UserValue("path"))
+	})
+
+	tests := []struct {
+		decode bool
+		uri    string
+		code   int
+		want   []interface{}
+	}{
+		{false, "/names/hello%20world", fasthttp.StatusOK, []interface{}{"hello%20world"}},
+		{false, "/names/a%2Fb", fasthttp.StatusOK, []interface{}{"a%2Fb"}},
+		{true, "/names/hello%20world", fasthttp.StatusOK, []interface{}{"hello world"}},
+		{true, "/names/a%2Fb", fasthttp.StatusOK, []interface{}{"a/b"}},
+		{true, "/names/a+b%2B", fasthttp.StatusOK, []interface{}{"a+b+"}},
+		{true, "/names/a%2Fb/x%20y", fasthttp.StatusOK, []interface{}{"a/b", "decoded x y"}},
+		{true, "/files/dir%2Fa/b%20c.txt", fasthttp.StatusOK, []interface{}{"dir/a/b c.txt"}},
+		{true, "/names/%zz", fasthttp.StatusBadRequest, nil},
+	}
+
+	for _, test := range tests {
+		values = nil
+		router.DecodeParams = test.decode
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.uri)
+		router.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s (decode=%v) - Response status code == %d, want %d", test.uri, test.decode, status, test.code)
+		}
+
+		if !reflect.DeepEqual(values, test.want) {
+			t.Errorf("%s (decode=%v) - params == %q, want %q", test.uri, test.decode, values, test.want)
+		}
+	}
+}
+
+func TestRouterHandleWhen(t *testing.T) {
+	var handled string
+
+	handler := func(name string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			handled = name
+		}
+	}
+
+	beta := func(ctx *fasthttp.RequestCtx) bool {
+		return string(ctx.Request.Header.Peek("X-Beta")) == "1"
+	}
+
+	router := New()
+	router.HandleWhen(fasthttp.MethodGet, "/new", handler("new"), beta)
+	router.GET("/{name}", handler("name"))
+	router.HandleWhen(fasthttp.MethodGet, "/beta/{id}", handler("beta"), beta)
+	router.HandleWhen(fasthttp.MethodGet, "/static/{filepath:*}", handler("static"), beta)
+
+	if err := catchPanic(func() {
+		router.HandleWhen(fasthttp.MethodGet, "/nil", handler("nil"), nil)
+	}); err == nil {
+		t.Error("an error was expected with a nil predicate")
+	}
+
+	tests := []struct {
+		path string
+		beta bool
+		want string
+	}{
+		{"/new", true, "new"},
+		{"/new", false, "name"},
+		{"/beta/1", true, "beta"},
+		{"/beta/1", false, ""},
+		{"/static/app.js", true, "static"},
+		{"/static/app.js", false, ""},
+	}
+
+	for _, test := range tests {
+		handled = ""
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		if test.beta {
+			ctx.Request.Header.Set("X-Beta", "1")
+		}
+
+		router.Handler(ctx)
+
+		if handled != test.want {
+			t.Errorf("Path '%s' (beta: %v) - handled by %q, want %q", test.path, test.beta, handled, test.want)
+		}
+
+		if test.want == "" && ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+			t.Errorf("Path '%s' (beta: %v) - Response status code == %d, want %d", test.path, test.beta, ctx.Response.StatusCode(), fasthttp.StatusNotFound)
+		}
+	}
+}
+
 func TestRouterChaining(t *testing.T) {
 	router1 := New()
 	router2 := New()
@@ -372,6 +605,62 @@ func TestRouterChaining(t *testing.T) {
 	}
 }
 
+func TestRouterOptionalPathConflict(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	tests := []struct {
+		routes []string
+		err    string
+	}{
+		{
+			routes: []string{"/users", "/users/{id?}"},
+			err:    "optional path '/users' of '/users/{id?}' conflicts with the existing route '/users'",
+		},
+		{
+			routes: []string{"/users/{id?}", "/users"},
+			err:    "path '/users' conflicts with the optional path of the existing route '/users/{id?}'",
+		},
+		{
+			routes: []string{"/users/{id?}", "/users/{id}/{name?}"},
+			err:    "optional path '/users/{id}' of '/users/{id}/{name?}' conflicts with the existing route '/users/{id?}'",
+		},
+		{
+			routes: []string{"/users/{id?}", "/users/{id}/posts"},
+		},
+	}
+
+	for _, test := range tests {
+		router := New()
+
+		var err interface{}
+		for _, route := range test.routes {
+			err = catchPanic(func() {
+				router.GET(route, handlerFunc)
+			})
+		}
+
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("Routes %v - Unexpected panic: %v", test.routes, err)
+			}
+
+			continue
+		}
+
+		if fmt.Sprint(err) != test.err {
+			t.Errorf("Routes %v - Panic == %v, want %s", test.routes, err, test.err)
+		}
+	}
+
+	router := New()
+	router.Mutable(true)
+	router.GET("/users", handlerFunc)
+
+	if err := catchPanic(func() { router.GET("/users/{id?}", handlerFunc) }); err != nil {
+		t.Errorf("Unexpected panic with mutable routes: %v", err)
+	}
+}
+
 func TestRouterMutable(t *testing.T) {
 	handler1 := func(_ *fasthttp.RequestCtx) {}
 	handler2 := func(_ *fasthttp.RequestCtx) {}
@@ -519,537 +808,2961 @@ func TestRouterOPTIONS(t *testing.T) {
 	}
 }
 
-func TestRouterNotAllowed(t *testing.T) {
+func TestRouterAutoAllowWithCustomOPTIONS(t *testing.T) {
 	handlerFunc := func(_ *fasthttp.RequestCtx) {}
 
 	router := New()
+	router.GET("/path", handlerFunc)
 	router.POST("/path", handlerFunc)
+	router.OPTIONS("/path", func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Set("Access-Control-Allow-Origin", "*")
+		ctx.SetBodyString("custom")
+	})
 
 	ctx := new(fasthttp.RequestCtx)
 
-	var checkHandling = func(path, expectedAllowed string, expectedStatusCode int) {
-		ctx.Request.Header.SetMethod(fasthttp.MethodGet)
-		ctx.Request.SetRequestURI(path)
+	var checkHandling = func(expectedAllowed string) {
+		ctx.Response.Reset()
+		ctx.Request.Header.SetMethod(fasthttp.MethodOptions)
+		ctx.Request.SetRequestURI("/path")
 		router.Handler(ctx)
 
-		if !(ctx.Response.StatusCode() == expectedStatusCode) {
-			t.Errorf("NotAllowed handling failed:: Code=%d, Header=%v", ctx.Response.StatusCode(), ctx.Response.Header.String())
-		} else if allow := string(ctx.Response.Header.Peek("Allow")); allow != expectedAllowed {
-			t.Error("unexpected Allow header value: " + allow)
+		if allow := string(ctx.Response.Header.Peek("Allow")); allow != expectedAllowed {
+			t.Errorf("unexpected Allow header value: %q, want %q", allow, expectedAllowed)
+		}
+
+		if origin := string(ctx.Response.Header.Peek("Access-Control-Allow-Origin")); origin != "*" {
+			t.Errorf("unexpected Access-Control-Allow-Origin header value: %q, want %q", origin, "*")
+		}
+
+		if body := string(ctx.Response.Body()); body != "custom" {
+			t.Errorf("unexpected body: %q, want %q", body, "custom")
 		}
 	}
 
-	// test not allowed
-	checkHandling("/path", "OPTIONS, POST", fasthttp.StatusMethodNotAllowed)
+	checkHandling("")
 
-	// add another method
-	router.DELETE("/path", handlerFunc)
-	router.OPTIONS("/path", handlerFunc) // must be ignored
+	router.AutoAllowWithCustomOPTIONS = true
 
-	// test again
-	checkHandling("/path", "DELETE, OPTIONS, POST", fasthttp.StatusMethodNotAllowed)
+	checkHandling("GET, OPTIONS, POST")
+}
 
-	// test custom handler
-	responseText := "custom method"
-	router.MethodNotAllowed = func(ctx *fasthttp.RequestCtx) {
-		ctx.SetStatusCode(fasthttp.StatusTeapot)
-		ctx.Write([]byte(responseText))
-	}
+func TestRouterHandleMethodSet(t *testing.T) {
+	router := New()
+	router.Handle("GET|HEAD", "/safe", func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.SetBytesV("X-Method", ctx.Method())
+	})
+	router.Group("/v1").Handle("PUT|PATCH", "/item", func(_ *fasthttp.RequestCtx) {})
 
-	ctx.Response.Reset()
-	router.Handler(ctx)
+	for _, method := range []string{fasthttp.MethodGet, fasthttp.MethodHead} {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI("/safe")
+		router.Handler(ctx)
 
-	if got := string(ctx.Response.Body()); !(got == responseText) {
-		t.Errorf("unexpected response got %q want %q", got, responseText)
-	}
-	if ctx.Response.StatusCode() != fasthttp.StatusTeapot {
-		t.Errorf("unexpected response code %d want %d", ctx.Response.StatusCode(), fasthttp.StatusTeapot)
+		if got := string(ctx.Response.Header.Peek("X-Method")); got != method {
+			t.Errorf("%s /safe - X-Method == %q, want %q", method, got, method)
+		}
 	}
-	if allow := string(ctx.Response.Header.Peek("Allow")); allow != "DELETE, OPTIONS, POST" {
-		t.Error("unexpected Allow header value: " + allow)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		allow  string
+	}{
+		{fasthttp.MethodPost, "/safe", fasthttp.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+		{fasthttp.MethodOptions, "/safe", fasthttp.StatusOK, "GET, HEAD, OPTIONS"},
+		{fasthttp.MethodGet, "/v1/item", fasthttp.StatusMethodNotAllowed, "OPTIONS, PATCH, PUT"},
 	}
-}
 
-func testRouterNotFoundByMethod(t *testing.T, method string) {
-	handlerFunc := func(_ *fasthttp.RequestCtx) {}
-	host := "fast"
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		router.Handler(ctx)
 
-	router := New()
-	router.Handle(method, "/path", handlerFunc)
-	router.Handle(method, "/dir/", handlerFunc)
-	router.Handle(method, "/", handlerFunc)
-	router.Handle(method, "/{proc}/StaTus", handlerFunc)
-	router.Handle(method, "/USERS/{name}/enTRies/", handlerFunc)
-	router.Handle(method, "/static/{filepath:*}", handlerFunc)
+		if status := ctx.Response.StatusCode(); status != test.status {
+			t.Errorf("%s %s - status code == %d, want %d", test.method, test.path, status, test.status)
+		}
 
-	reqMethod := method
-	if method == MethodWild {
-		reqMethod = randomHTTPMethod()
+		if allow := string(ctx.Response.Header.Peek("Allow")); allow != test.allow {
+			t.Errorf("%s %s - Allow == %q, want %q", test.method, test.path, allow, test.allow)
+		}
 	}
 
-	// Moved Permanently, request with GET method
-	expectedCode := fasthttp.StatusMovedPermanently
-	switch {
-	case reqMethod == fasthttp.MethodConnect:
-		// CONNECT method does not allow redirects, so Not Found (404)
-		expectedCode = fasthttp.StatusNotFound
-	case reqMethod != fasthttp.MethodGet:
-		// Permanent Redirect, request with same method
-		expectedCode = fasthttp.StatusPermanentRedirect
+	if got := router.List()[fasthttp.MethodHead]; !reflect.DeepEqual(got, []string{"/safe"}) {
+		t.Errorf("List()[HEAD] == %v, want [/safe]", got)
 	}
 
-	type testRoute struct {
-		route    string
-		code     int
-		location string
+	if recv := catchPanic(func() { router.Handle("GET|", "/empty", func(_ *fasthttp.RequestCtx) {}) }); recv != "method must not be empty" {
+		t.Errorf("Unexpected panic: %v", recv)
 	}
 
-	testRoutes := []testRoute{
-		{"", fasthttp.StatusOK, ""},                              // TSR +/ (Not clean by router, this path is cleaned by fasthttp `ctx.Path()`)
-		{"/../path", expectedCode, buildLocation(host, "/path")}, // CleanPath (Not clean by router, this path is cleaned by fasthttp `ctx.Path()`)
-		{"/nope", fasthttp.StatusNotFound, ""},                   // NotFound
+	if router.Match(fasthttp.MethodGet, "/empty") {
+		t.Error("Unexpected route registered by an invalid set of methods")
 	}
 
-	if method != fasthttp.MethodConnect {
-		testRoutes = append(testRoutes, []testRoute{
-			{"/path/", expectedCode, buildLocation(host, "/path")},                                   // TSR -/
-			{"/dir", expectedCode, buildLocation(host, "/dir/")},                                     // TSR +/
-			{"/PATH", expectedCode, buildLocation(host, "/path")},                                    // Fixed Case
-			{"/DIR/", expectedCode, buildLocation(host, "/dir/")},                                    // Fixed Case
-			{"/PATH/", expectedCode, buildLocation(host, "/path")},                                   // Fixed Case -/
-			{"/DIR", expectedCode, buildLocation(host, "/dir/")},                                     // Fixed Case +/
-			{"/paTh/?name=foo", expectedCode, buildLocation(host, "/path?name=foo")},                 // Fixed Case With Query Params +/
-			{"/paTh?name=foo", expectedCode, buildLocation(host, "/path?name=foo")},                  // Fixed Case With Query Params +/
-			{"/sergio/status/", expectedCode, buildLocation(host, "/sergio/StaTus")},                 // Fixed Case With Params -/
-			{"/users/atreugo/eNtriEs", expectedCode, buildLocation(host, "/USERS/atreugo/enTRies/")}, // Fixed Case With Params +/
-			{"/STatiC/test.go", expectedCode, buildLocation(host, "/static/test.go")},                // Fixed Case Wildcard
-		}...)
+	if recv := catchPanic(func() { router.Handle("GET|post", "/lower", func(_ *fasthttp.RequestCtx) {}) }); recv != "method must be an uppercase token in method 'post'" {
+		t.Errorf("Unexpected panic: %v", recv)
 	}
 
-	for _, tr := range testRoutes {
-		ctx := new(fasthttp.RequestCtx)
-		ctx.Request.Header.SetMethod(reqMethod)
-		ctx.Request.SetRequestURI(tr.route)
-		ctx.Request.SetHost(host)
-
-		router.Handler(ctx)
-
-		statusCode := ctx.Response.StatusCode()
-		location := string(ctx.Response.Header.Peek("Location"))
+	if router.Match(fasthttp.MethodGet, "/lower") {
+		t.Error("Unexpected route registered by an invalid set of methods")
+	}
+}
 
-		if !(statusCode == tr.code && (statusCode == fasthttp.StatusNotFound || location == tr.location)) {
-			fn := t.Errorf
-			msg := "NotFound handling route '%s' failed: Method=%s, ReqMethod=%s, Code=%d, ExpectedCode=%d, Header=%v"
+func TestRouterInvalidMethod(t *testing.T) {
+	router := New()
 
-			if runtime.GOOS == "windows" && strings.HasPrefix(tr.route, "/../") {
-				// See: https://github.com/valyala/fasthttp/issues/1226
-				// Not fail, because it is a known issue.
-				fn = t.Logf
-				msg = "ERROR: " + msg
-			}
+	for _, method := range []string{"get", " GET", "GET ", "Post"} {
+		want := "method must be an uppercase token in method '" + method + "'"
 
-			fn(msg, tr.route, method, reqMethod, statusCode, tr.code, location)
+		if recv := catchPanic(func() { router.Handle(method, "/path", func(_ *fasthttp.RequestCtx) {}) }); recv != want {
+			t.Errorf("Handle(%q) panic == %v, want %q", method, recv, want)
 		}
 	}
 
-	ctx := new(fasthttp.RequestCtx)
-
-	// Test custom not found handler
-	var notFound bool
-	router.NotFound = func(ctx *fasthttp.RequestCtx) {
-		ctx.SetStatusCode(fasthttp.StatusNotFound)
-		notFound = true
+	if methods := router.Methods(); len(methods) != 0 {
+		t.Errorf("Methods() == %v, want none", methods)
 	}
+}
 
-	ctx.Request.Header.SetMethod(reqMethod)
-	ctx.Request.SetRequestURI("/nope")
+func TestRouterAll(t *testing.T) {
+	router := New()
+	router.All("/all", func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.SetBytesV("X-Method", ctx.Method())
+	})
+	router.Group("/v1").All("/all", func(_ *fasthttp.RequestCtx) {})
+
+	allMethods := "CONNECT, DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT, TRACE"
+
+	for _, path := range []string{"/all", "/v1/all"} {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(fasthttp.MethodOptions)
+		ctx.Request.SetRequestURI(path)
+		router.Handler(ctx)
+
+		if allow := string(ctx.Response.Header.Peek("Allow")); allow != allMethods {
+			t.Errorf("OPTIONS %s - Allow == %q, want %q", path, allow, allMethods)
+		}
+	}
+
+	for _, method := range wildAllowedMethods {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI("/all")
+		router.Handler(ctx)
+
+		if got := string(ctx.Response.Header.Peek("X-Method")); got != method {
+			t.Errorf("%s /all - X-Method == %q, want %q", method, got, method)
+		}
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod("CUSTOM")
+	ctx.Request.SetRequestURI("/all")
 	router.Handler(ctx)
 
-	if !(ctx.Response.StatusCode() == fasthttp.StatusNotFound && notFound == true) {
-		t.Errorf(
-			"Custom NotFound handling failed: Method=%s, ReqMethod=%s, Code=%d, Header=%v",
-			method, reqMethod, ctx.Response.StatusCode(), ctx.Response.Header.String(),
-		)
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusMethodNotAllowed {
+		t.Errorf("CUSTOM /all - status code == %d, want %d", status, fasthttp.StatusMethodNotAllowed)
 	}
 
-	ctx.Response.Reset()
-}
+	if allow := string(ctx.Response.Header.Peek("Allow")); allow != allMethods {
+		t.Errorf("CUSTOM /all - Allow == %q, want %q", allow, allMethods)
+	}
 
-func TestRouterNotFound(t *testing.T) {
-	for _, method := range httpMethods {
-		testRouterNotFoundByMethod(t, method)
+	if err := catchPanic(func() { router.GET("/all", func(_ *fasthttp.RequestCtx) {}) }); err == nil {
+		t.Error("Expected a panic registering a method of the same path")
 	}
+}
 
+func TestRouterOPTIONSWildOnly(t *testing.T) {
 	router := New()
-	handlerFunc := func(_ *fasthttp.RequestCtx) {}
-	host := "fast"
-	ctx := new(fasthttp.RequestCtx)
+	router.ANY("/x", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("any")
+	})
 
-	// Test other method than GET (want 308 instead of 301)
-	router.PATCH("/path", handlerFunc)
+	allMethods := "CONNECT, DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT, TRACE"
 
-	ctx.Request.Header.SetMethod(fasthttp.MethodPatch)
-	ctx.Request.SetRequestURI("/path/?key=val")
-	ctx.Request.SetHost(host)
-	router.Handler(ctx)
-	if !(ctx.Response.StatusCode() == fasthttp.StatusPermanentRedirect && string(ctx.Response.Header.Peek("Location")) == buildLocation(host, "/path?key=val")) {
-		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", ctx.Response.StatusCode(), ctx.Response.Header.String())
+	if allow := router.allowed("/x", fasthttp.MethodOptions); allow != allMethods {
+		t.Errorf("Allow == %q, want %q", allow, allMethods)
 	}
-	ctx.Response.Reset()
 
-	// Test special case where no node for the prefix "/" exists
-	router = New()
-	router.GET("/a", handlerFunc)
+	ctx := new(fasthttp.RequestCtx)
 
-	ctx.Request.Header.SetMethod(fasthttp.MethodPatch)
-	ctx.Request.SetRequestURI("/")
-	router.Handler(ctx)
-	if !(ctx.Response.StatusCode() == fasthttp.StatusNotFound) {
-		t.Errorf("NotFound handling route / failed: Code=%d", ctx.Response.StatusCode())
+	var checkHandling = func(expectedAllowed string) {
+		ctx.Response.Reset()
+		ctx.Request.Header.SetMethod(fasthttp.MethodOptions)
+		ctx.Request.SetRequestURI("/x")
+		router.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != fasthttp.StatusOK {
+			t.Errorf("unexpected status code: %d, want %d", status, fasthttp.StatusOK)
+		}
+
+		if body := string(ctx.Response.Body()); body != "any" {
+			t.Errorf("unexpected body: %q, want %q", body, "any")
+		}
+
+		if allow := string(ctx.Response.Header.Peek("Allow")); allow != expectedAllowed {
+			t.Errorf("unexpected Allow header value: %q, want %q", allow, expectedAllowed)
+		}
 	}
+
+	// The ANY handler serves the OPTIONS request itself
+	checkHandling("")
+
+	router.AutoAllowWithCustomOPTIONS = true
+
+	checkHandling(allMethods)
 }
 
-func TestRouterNotFound_MethodWild(t *testing.T) {
-	postFound, anyFound := false, false
+func TestRouterDumpTree(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
 
 	router := New()
-	router.ANY("/{path:*}", func(ctx *fasthttp.RequestCtx) { anyFound = true })
-	router.POST("/specific", func(ctx *fasthttp.RequestCtx) { postFound = true })
+	router.GET("/users/{id}", handlerFunc)
 
-	for i := 0; i < 100; i++ {
-		router.Handle(
-			randomHTTPMethod(),
-			fmt.Sprintf("/%d", rand.Int63()),
-			func(ctx *fasthttp.RequestCtx) {},
-		)
+	want := `/users/ [root]
+  {id} [param keys=id handler]
+    / [static tsr]
+`
+
+	if got := router.DumpTree(fasthttp.MethodGet); got != want {
+		t.Errorf("DumpTree(GET) ==\n%s\nwant\n%s", got, want)
 	}
 
-	ctx := new(fasthttp.RequestCtx)
-	var request = func(method, path string) {
-		ctx.Request.Header.SetMethod(method)
-		ctx.Request.SetRequestURI(path)
-		router.Handler(ctx)
+	for _, method := range []string{fasthttp.MethodPost, "CUSTOM"} {
+		if got := router.DumpTree(method); got != "" {
+			t.Errorf("DumpTree(%s) == %q, want an empty string", method, got)
+		}
 	}
+}
 
-	for _, method := range httpMethods {
-		request(method, "/specific")
+func TestRouterUnknownMethod501(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
 
-		if method == fasthttp.MethodPost {
-			if !postFound {
-				t.Errorf("Method '%s': not found", method)
+	router := New()
+	router.UnknownMethod501 = true
+	router.GET("/path", handlerFunc)
+	router.POST("/path", handlerFunc)
+	router.Handle("PURGE", "/cache", handlerFunc)
+	router.ANY("/any", handlerFunc)
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		allow  string
+	}{
+		{"FOOBAR", "/path", fasthttp.StatusNotImplemented, "GET, OPTIONS, POST"},
+		{"FOOBAR", "/doesnotexist", fasthttp.StatusNotImplemented, ""},
+		{"FOOBAR", "/any", fasthttp.StatusOK, ""},
+		{"PURGE", "/path", fasthttp.StatusMethodNotAllowed, "GET, OPTIONS, POST"},
+		{"PURGE", "/cache", fasthttp.StatusOK, ""},
+		{fasthttp.MethodPut, "/path", fasthttp.StatusMethodNotAllowed, "GET, OPTIONS, POST"},
+		{fasthttp.MethodGet, "/doesnotexist", fasthttp.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		request := test.method + " " + test.path + " HTTP/1.1\r\n\r\n"
+
+		assertWithTestServer(t, request, router.Handler, func(rw *readWriter) {
+			br := bufio.NewReader(&rw.w)
+			var resp fasthttp.Response
+			if err := resp.Read(br); err != nil {
+				t.Fatalf("Unexpected error when reading response: %s", err)
 			}
-		} else {
-			if !anyFound {
-				t.Errorf("Method 'ANY' not found with request method %s", method)
+
+			if status := resp.Header.StatusCode(); status != test.code {
+				t.Errorf("%s %s - Response status code == %d, want %d", test.method, test.path, status, test.code)
+			}
+
+			if allow := string(resp.Header.Peek("Allow")); allow != test.allow {
+				t.Errorf("%s %s - Allow header == %q, want %q", test.method, test.path, allow, test.allow)
 			}
+		})
+	}
+
+	router.UnknownMethod501 = false
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod("FOOBAR")
+	ctx.Request.SetRequestURI("/doesnotexist")
+	router.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusNotFound {
+		t.Errorf("Response status code == %d, want %d", status, fasthttp.StatusNotFound)
+	}
+}
+
+func TestRouterCloneGroup(t *testing.T) {
+	var calls []string
+
+	handler := func(name string) fasthttp.RequestHandler {
+		return func(_ *fasthttp.RequestCtx) {
+			calls = append(calls, name)
 		}
+	}
 
-		status := ctx.Response.StatusCode()
-		if status != fasthttp.StatusOK {
-			t.Errorf("Response status code == %d, want %d", status, fasthttp.StatusOK)
+	middleware := func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			calls = append(calls, "middleware")
+			next(ctx)
 		}
+	}
 
-		postFound, anyFound = false, false
-		ctx.Response.Reset()
+	r := New()
+	r.GET("/version", handler("version"))
+
+	v1 := r.Group("/v1")
+	v1.AddMiddleware(middleware)
+	v1.GET("/users", handler("list v1"))
+	v1.POST("/users", handler("create v1"))
+	v1.GET("/users/{id}", handler("get v1"))
+	v1.PUT("/users/{id}", handler("update v1"))
+
+	v2 := r.CloneGroup(v1, "/v2", map[string]fasthttp.RequestHandler{
+		"/users/{id}": handler("user v2"),
+		"POST /users": handler("create v2"),
+	})
+	v2.GET("/teams", handler("teams v2"))
+
+	tests := []struct {
+		method string
+		path   string
+		want   []string
+	}{
+		{fasthttp.MethodGet, "/v1/users", []string{"middleware", "list v1"}},
+		{fasthttp.MethodGet, "/v2/users", []string{"middleware", "list v1"}},
+		{fasthttp.MethodPost, "/v2/users", []string{"middleware", "create v2"}},
+		{fasthttp.MethodGet, "/v2/users/1", []string{"middleware", "user v2"}},
+		{fasthttp.MethodPut, "/v2/users/1", []string{"middleware", "user v2"}},
+		{fasthttp.MethodPut, "/v1/users/1", []string{"middleware", "update v1"}},
+		{fasthttp.MethodGet, "/v2/teams", []string{"middleware", "teams v2"}},
+		{fasthttp.MethodGet, "/v2/version", nil},
+	}
+
+	for _, test := range tests {
+		calls = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if !reflect.DeepEqual(calls, test.want) {
+			t.Errorf("%s %s - calls == %v, want %v", test.method, test.path, calls, test.want)
+		}
+	}
+
+	if err := catchPanic(func() { r.CloneGroup(v1, "/v1", nil) }); err == nil {
+		t.Error("an error was expected when cloning at the same prefix")
 	}
 }
 
-func TestRouterPanicHandler(t *testing.T) {
+func TestRouterAdvertiseHEAD(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
 	router := New()
-	panicHandled := false
+	router.GET("/path", handlerFunc)
+	router.POST("/post", handlerFunc)
 
-	router.PanicHandler = func(ctx *fasthttp.RequestCtx, p interface{}) {
-		panicHandled = true
+	ctx := new(fasthttp.RequestCtx)
+
+	var checkHandling = func(method, path, expectedAllowed string) {
+		ctx.Response.Reset()
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI(path)
+		router.Handler(ctx)
+
+		if allow := string(ctx.Response.Header.Peek("Allow")); allow != expectedAllowed {
+			t.Errorf("%s %s - unexpected Allow header value: %q, want %q", method, path, allow, expectedAllowed)
+		}
 	}
 
-	router.Handle(fasthttp.MethodPut, "/user/{name}", func(ctx *fasthttp.RequestCtx) {
-		panic("oops!")
+	checkHandling(fasthttp.MethodOptions, "/path", "GET, OPTIONS")
+
+	router.AdvertiseHEAD = true
+
+	checkHandling(fasthttp.MethodOptions, "/path", "GET, HEAD, OPTIONS")
+	checkHandling(fasthttp.MethodPost, "/path", "GET, HEAD, OPTIONS")
+	checkHandling(fasthttp.MethodHead, "/path", "GET, OPTIONS")
+	checkHandling(fasthttp.MethodOptions, "/post", "OPTIONS, POST")
+}
+
+func TestRouterAutoHEAD(t *testing.T) {
+	router := New()
+	router.GET("/path", func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Set("X-Handler", "get")
+		ctx.SetContentType("text/plain")
+		ctx.SetBodyString("hello")
+	})
+	router.GET("/head", func(ctx *fasthttp.RequestCtx) {})
+	router.HEAD("/head", func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Set("X-Handler", "head")
 	})
 
-	ctx := new(fasthttp.RequestCtx)
-	ctx.Request.Header.SetMethod(fasthttp.MethodPut)
-	ctx.Request.SetRequestURI("/user/gopher")
+	serve := func(method, uri string) *fasthttp.Response {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI(uri)
+		router.Handler(ctx)
 
-	defer func() {
-		if rcv := recover(); rcv != nil {
-			t.Fatal("handling panic failed")
+		resp := new(fasthttp.Response)
+		if err := resp.Read(bufio.NewReader(strings.NewReader(ctx.Response.String()))); err != nil && method != fasthttp.MethodHead {
+			t.Fatalf("%s %s - unexpected error reading the response: %v", method, uri, err)
 		}
-	}()
 
+		return resp
+	}
+
+	if status := serve(fasthttp.MethodHead, "/path").StatusCode(); status != fasthttp.StatusMethodNotAllowed {
+		t.Errorf("HEAD /path without AutoHEAD - status == %d, want %d", status, fasthttp.StatusMethodNotAllowed)
+	}
+
+	router.AutoHEAD = true
+
+	get := serve(fasthttp.MethodGet, "/path")
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(fasthttp.MethodHead)
+	ctx.Request.SetRequestURI("/path")
 	router.Handler(ctx)
 
-	if !panicHandled {
-		t.Fatal("simulating failed")
+	head := ctx.Response.String()
+	if want := get.Header.String(); head != want {
+		t.Errorf("HEAD /path - response == %q, want the GET headers %q", head, want)
+	}
+
+	if cl := get.Header.ContentLength(); cl != len("hello") {
+		t.Errorf("GET /path - Content-Length == %d, want %d", cl, len("hello"))
+	}
+
+	if handler := string(serve(fasthttp.MethodHead, "/head").Header.Peek("X-Handler")); handler != "head" {
+		t.Errorf("HEAD /head - X-Handler == %q, want %q", handler, "head")
+	}
+
+	resp := serve(fasthttp.MethodHead, "/path/")
+	if status, location := resp.StatusCode(), string(resp.Header.Peek("Location")); status != fasthttp.StatusPermanentRedirect || !strings.HasSuffix(location, "/path") {
+		t.Errorf("HEAD /path/ - redirect == %d %q, want %d to %q", status, location, fasthttp.StatusPermanentRedirect, "/path")
 	}
 }
 
-func testRouterLookupByMethod(t *testing.T, method string) {
-	reqMethod := method
-	if method == MethodWild {
-		reqMethod = randomHTTPMethod()
+func TestRouterAllowedMethodWild(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	router := New()
+	router.ANY("/any", handlerFunc)
+	router.POST("/any", handlerFunc)
+	router.POST("/path", handlerFunc)
+	router.Handle("CUSTOM", "/custom", handlerFunc)
+
+	allMethods := "CONNECT, CUSTOM, DELETE, GET, HEAD, OPTIONS, PATCH, POST, PUT, TRACE"
+
+	if allow := router.allowed("/any", fasthttp.MethodOptions); allow != allMethods {
+		t.Errorf("Allow == %q, want %q", allow, allMethods)
 	}
 
-	routed := false
-	wantHandle := func(_ *fasthttp.RequestCtx) {
-		routed = true
+	want := "CONNECT, CUSTOM, DELETE, HEAD, OPTIONS, PATCH, POST, PUT, TRACE"
+	if allow := router.allowed("/any", fasthttp.MethodGet); allow != want {
+		t.Errorf("Allow == %q, want %q", allow, want)
+	}
+
+	if allow := router.allowed("/path", fasthttp.MethodOptions); allow != "OPTIONS, POST" {
+		t.Errorf("Allow == %q, want %q", allow, "OPTIONS, POST")
 	}
-	wantParams := map[string]string{"name": "gopher"}
 
 	ctx := new(fasthttp.RequestCtx)
-	router := New()
+	ctx.Request.Header.SetMethod(fasthttp.MethodOptions)
+	ctx.Request.SetRequestURI("*")
+	router.Handler(ctx)
 
-	// try empty router first
-	handle, tsr := router.Lookup(reqMethod, "/nope", ctx)
-	if handle != nil {
-		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	if allow := string(ctx.Response.Header.Peek("Allow")); allow != allMethods {
+		t.Errorf("Allow == %q, want %q", allow, allMethods)
 	}
-	if tsr {
-		t.Error("Got wrong TSR recommendation!")
+}
+
+func TestRouterAllowedMethodsTree(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	r := New()
+	r.GET("/users/new", handlerFunc)
+	r.PUT("/users/{id}", handlerFunc)
+	r.DELETE("/users/{id:[0-9]+}", handlerFunc)
+	r.POST("/users/{name}/posts/{post?}", handlerFunc)
+	r.GET("/docs/{path:.+}", handlerFunc)
+	r.POST("/docs/{path:.+}/meta", handlerFunc)
+	r.ANY("/files/{filepath:*}", handlerFunc)
+	r.GET("/files/", handlerFunc)
+
+	if r.methodsTree == nil {
+		t.Fatal("Expected the methods tree")
 	}
 
-	// insert route and try again
-	router.Handle(method, "/user/{name}", wantHandle)
-	handle, _ = router.Lookup(reqMethod, "/user/gopher", ctx)
-	if handle == nil {
-		t.Fatal("Got no handle!")
-	} else {
-		handle(nil)
-		if !routed {
-			t.Fatal("Routing failed!")
+	// The allowed methods are the same as looking up the tree of each method
+	lookup := r.Clone()
+	lookup.dropMethodsTree()
+
+	paths := []string{
+		"/users/new", "/users/1", "/users/gopher", "/users/1/posts", "/users/1/posts/2",
+		"/docs/a", "/docs/a/meta", "/docs/a/b", "/files/", "/files/a/b", "/missing",
+	}
+
+	for _, path := range paths {
+		for _, method := range []string{"", fasthttp.MethodGet, fasthttp.MethodOptions} {
+			if got, want := r.allowed(path, method), lookup.allowed(path, method); got != want {
+				t.Errorf("%s %s - allowed == %q, want %q", method, path, got, want)
+			}
 		}
 	}
 
-	for expectedKey, expectedVal := range wantParams {
-		if ctx.UserValue(expectedKey) != expectedVal {
-			t.Errorf("The values %s = %s is not save in context", expectedKey, expectedVal)
+	// The routes which could not live in a single tree drop it
+	r.GET("/assets/{path:*}", handlerFunc)
+	r.POST("/assets/{path:**}", handlerFunc)
+
+	if r.methodsTree != nil {
+		t.Error("Expected the methods tree to be dropped")
+	}
+
+	if allow := r.allowed("/assets/a", ""); allow != "GET, OPTIONS, POST" {
+		t.Errorf("allowed == %q, want %q", allow, "GET, OPTIONS, POST")
+	}
+
+	// The tree doesn't have the param matchers, so a route with them drops it
+	r = New()
+	r.GET("/x/{id}", handlerFunc)
+	r.Route(fasthttp.MethodPut, "/x/{id}", handlerFunc).ParamMatcher("id", evenMatcher{}).Done()
+
+	if r.methodsTree != nil {
+		t.Error("Expected the methods tree to be dropped")
+	}
+
+	if allow := r.allowed("/x/1", ""); allow != "GET, OPTIONS" {
+		t.Errorf("allowed == %q, want %q", allow, "GET, OPTIONS")
+	}
+}
+
+func TestRouterNotAllowed(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	router := New()
+	router.POST("/path", handlerFunc)
+
+	ctx := new(fasthttp.RequestCtx)
+
+	var checkHandling = func(path, expectedAllowed string, expectedStatusCode int) {
+		ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+		ctx.Request.SetRequestURI(path)
+		router.Handler(ctx)
+
+		if !(ctx.Response.StatusCode() == expectedStatusCode) {
+			t.Errorf("NotAllowed handling failed:: Code=%d, Header=%v", ctx.Response.StatusCode(), ctx.Response.Header.String())
+		} else if allow := string(ctx.Response.Header.Peek("Allow")); allow != expectedAllowed {
+			t.Error("unexpected Allow header value: " + allow)
 		}
 	}
 
-	routed = false
+	// test not allowed
+	checkHandling("/path", "OPTIONS, POST", fasthttp.StatusMethodNotAllowed)
+
+	// add another method
+	router.DELETE("/path", handlerFunc)
+	router.OPTIONS("/path", handlerFunc) // must be ignored
+
+	// test again
+	checkHandling("/path", "DELETE, OPTIONS, POST", fasthttp.StatusMethodNotAllowed)
+
+	// test custom handler
+	responseText := "custom method"
+	router.MethodNotAllowed = func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusTeapot)
+		ctx.Write([]byte(responseText))
+	}
+
+	ctx.Response.Reset()
+	router.Handler(ctx)
+
+	if got := string(ctx.Response.Body()); !(got == responseText) {
+		t.Errorf("unexpected response got %q want %q", got, responseText)
+	}
+	if ctx.Response.StatusCode() != fasthttp.StatusTeapot {
+		t.Errorf("unexpected response code %d want %d", ctx.Response.StatusCode(), fasthttp.StatusTeapot)
+	}
+	if allow := string(ctx.Response.Header.Peek("Allow")); allow != "DELETE, OPTIONS, POST" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
+	// test the allowed methods user value
+	var allowed interface{}
+	router.MethodNotAllowed = func(ctx *fasthttp.RequestCtx) {
+		allowed = ctx.UserValue(AllowedMethodsParam)
+	}
+
+	ctx.Response.Reset()
+	router.Handler(ctx)
+
+	if want := []string{"DELETE", "OPTIONS", "POST"}; !reflect.DeepEqual(allowed, want) {
+		t.Errorf("unexpected allowed methods %v want %v", allowed, want)
+	}
+}
+
+func testRouterNotFoundByMethod(t *testing.T, method string) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+	host := "fast"
+
+	router := New()
+	router.Handle(method, "/path", handlerFunc)
+	router.Handle(method, "/dir/", handlerFunc)
+	router.Handle(method, "/", handlerFunc)
+	router.Handle(method, "/{proc}/StaTus", handlerFunc)
+	router.Handle(method, "/USERS/{name}/enTRies/", handlerFunc)
+	router.Handle(method, "/static/{filepath:*}", handlerFunc)
+
+	reqMethod := method
+	if method == MethodWild {
+		reqMethod = randomHTTPMethod()
+	}
+
+	// Moved Permanently, request with GET method
+	expectedCode := fasthttp.StatusMovedPermanently
+	switch {
+	case reqMethod == fasthttp.MethodConnect:
+		// CONNECT method does not allow redirects, so Not Found (404)
+		expectedCode = fasthttp.StatusNotFound
+	case reqMethod != fasthttp.MethodGet:
+		// Permanent Redirect, request with same method
+		expectedCode = fasthttp.StatusPermanentRedirect
+	}
+
+	type testRoute struct {
+		route    string
+		code     int
+		location string
+	}
+
+	testRoutes := []testRoute{
+		{"", fasthttp.StatusOK, ""},                              // TSR +/ (Not clean by router, this path is cleaned by fasthttp `ctx.Path()`)
+		{"/../path", expectedCode, buildLocation(host, "/path")}, // CleanPath (Not clean by router, this path is cleaned by fasthttp `ctx.Path()`)
+		{"/nope", fasthttp.StatusNotFound, ""},                   // NotFound
+	}
+
+	if method != fasthttp.MethodConnect {
+		testRoutes = append(testRoutes, []testRoute{
+			{"/path/", expectedCode, buildLocation(host, "/path")},                                   // TSR -/
+			{"/dir", expectedCode, buildLocation(host, "/dir/")},                                     // TSR +/
+			{"/PATH", expectedCode, buildLocation(host, "/path")},                                    // Fixed Case
+			{"/DIR/", expectedCode, buildLocation(host, "/dir/")},                                    // Fixed Case
+			{"/PATH/", expectedCode, buildLocation(host, "/path")},                                   // Fixed Case -/
+			{"/DIR", expectedCode, buildLocation(host, "/dir/")},                                     // Fixed Case +/
+			{"/paTh/?name=foo", expectedCode, buildLocation(host, "/path?name=foo")},                 // Fixed Case With Query Params +/
+			{"/paTh?name=foo", expectedCode, buildLocation(host, "/path?name=foo")},                  // Fixed Case With Query Params +/
+			{"/sergio/status/", expectedCode, buildLocation(host, "/sergio/StaTus")},                 // Fixed Case With Params -/
+			{"/users/atreugo/eNtriEs", expectedCode, buildLocation(host, "/USERS/atreugo/enTRies/")}, // Fixed Case With Params +/
+			{"/STatiC/test.go", expectedCode, buildLocation(host, "/static/test.go")},                // Fixed Case Wildcard
+		}...)
+	}
+
+	for _, tr := range testRoutes {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(reqMethod)
+		ctx.Request.SetRequestURI(tr.route)
+		ctx.Request.SetHost(host)
+
+		router.Handler(ctx)
+
+		statusCode := ctx.Response.StatusCode()
+		location := string(ctx.Response.Header.Peek("Location"))
+
+		if !(statusCode == tr.code && (statusCode == fasthttp.StatusNotFound || location == tr.location)) {
+			fn := t.Errorf
+			msg := "NotFound handling route '%s' failed: Method=%s, ReqMethod=%s, Code=%d, ExpectedCode=%d, Header=%v"
+
+			if runtime.GOOS == "windows" && strings.HasPrefix(tr.route, "/../") {
+				// See: https://github.com/valyala/fasthttp/issues/1226
+				// Not fail, because it is a known issue.
+				fn = t.Logf
+				msg = "ERROR: " + msg
+			}
+
+			fn(msg, tr.route, method, reqMethod, statusCode, tr.code, location)
+		}
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+
+	// Test custom not found handler
+	var notFound bool
+	router.NotFound = func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		notFound = true
+	}
+
+	ctx.Request.Header.SetMethod(reqMethod)
+	ctx.Request.SetRequestURI("/nope")
+	router.Handler(ctx)
+
+	if !(ctx.Response.StatusCode() == fasthttp.StatusNotFound && notFound == true) {
+		t.Errorf(
+			"Custom NotFound handling failed: Method=%s, ReqMethod=%s, Code=%d, Header=%v",
+			method, reqMethod, ctx.Response.StatusCode(), ctx.Response.Header.String(),
+		)
+	}
+
+	ctx.Response.Reset()
+}
+
+func TestRouterDefaultResponseBodies(t *testing.T) {
+	router := New()
+	router.GET("/items", func(_ *fasthttp.RequestCtx) {})
+	router.PUT("/items", func(_ *fasthttp.RequestCtx) {})
+	router.MethodNotAllowedBody = []byte(`{"error":"method not allowed"}`)
+	router.MethodNotAllowedContentType = "application/json"
+	router.NotFoundBody = []byte(`{"error":"not found"}`)
+	router.NotFoundContentType = "application/json"
+
+	tests := []struct {
+		method string
+		uri    string
+		code   int
+		body   string
+		allow  string
+	}{
+		{fasthttp.MethodPost, "/items", fasthttp.StatusMethodNotAllowed, `{"error":"method not allowed"}`, "GET, OPTIONS, PUT"},
+		{fasthttp.MethodGet, "/missing", fasthttp.StatusNotFound, `{"error":"not found"}`, ""},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.uri)
+		router.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s %s - status code == %d, want %d", test.method, test.uri, status, test.code)
+		}
+
+		if body := string(ctx.Response.Body()); body != test.body {
+			t.Errorf("%s %s - body == %q, want %q", test.method, test.uri, body, test.body)
+		}
+
+		if contentType := string(ctx.Response.Header.ContentType()); contentType != "application/json" {
+			t.Errorf("%s %s - content type == %q, want %q", test.method, test.uri, contentType, "application/json")
+		}
+
+		if allow := string(ctx.Response.Header.Peek("Allow")); allow != test.allow {
+			t.Errorf("%s %s - Allow header == %q, want %q", test.method, test.uri, allow, test.allow)
+		}
+	}
+
+	// The handlers take precedence
+	router.MethodNotAllowed = func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusTeapot)
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetRequestURI("/items")
+	router.Handler(ctx)
+
+	if status, body := ctx.Response.StatusCode(), ctx.Response.Body(); status != fasthttp.StatusTeapot || len(body) > 0 {
+		t.Errorf("MethodNotAllowed handler response == %d %q, want %d without body", status, body, fasthttp.StatusTeapot)
+	}
+}
+
+func TestRouterOnMiss(t *testing.T) {
+	var misses []string
+
+	r := New()
+	r.UnknownMethod501 = true
+	r.AutoHEAD = true
+	r.OnMiss = func(ctx *fasthttp.RequestCtx, kind MissKind) {
+		misses = append(misses, fmt.Sprintf("%s %s %s %d", kind, ctx.Method(), ctx.Path(), ctx.Response.StatusCode()))
+	}
+	r.NotFound = func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+	}
+	r.GET("/users", func(ctx *fasthttp.RequestCtx) {})
+	r.Group("/api").GET("/items", func(ctx *fasthttp.RequestCtx) {})
+
+	tests := []struct {
+		method string
+		path   string
+		miss   string
+	}{
+		{fasthttp.MethodGet, "/users", ""},
+		{fasthttp.MethodOptions, "/users", ""},
+		{fasthttp.MethodGet, "/missing", "not_found GET /missing 404"},
+		{fasthttp.MethodPost, "/users", "method_not_allowed POST /users 405"},
+		{fasthttp.MethodGet, "/users/", "redirected GET /users/ 301"},
+		{fasthttp.MethodHead, "/USERS", "redirected HEAD /USERS 308"},
+		{"PURGE", "/users", "not_implemented PURGE /users 501"},
+		{fasthttp.MethodGet, "/users%00", "bad_request GET /users\x00 400"},
+	}
+
+	for _, test := range tests {
+		misses = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+
+		r.Handler(ctx)
+
+		want := []string(nil)
+		if test.miss != "" {
+			want = []string{test.miss}
+		}
+
+		if !reflect.DeepEqual(misses, want) {
+			t.Errorf("%s %q - misses == %q, want %q", test.method, test.path, misses, want)
+		}
+	}
+
+	misses = nil
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/users")
+	r.Group("/api").Handler(ctx)
+
+	if want := []string{"not_found GET /users 404"}; !reflect.DeepEqual(misses, want) {
+		t.Errorf("Group.Handler misses == %q, want %q", misses, want)
+	}
+
+	if kind := MissKind(100).String(); kind != "unknown" {
+		t.Errorf("MissKind(100).String() == %q, want %q", kind, "unknown")
+	}
+}
+
+func TestRouterNotFound(t *testing.T) {
+	for _, method := range httpMethods {
+		testRouterNotFoundByMethod(t, method)
+	}
+
+	router := New()
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+	host := "fast"
+	ctx := new(fasthttp.RequestCtx)
+
+	// Test other method than GET (want 308 instead of 301)
+	router.PATCH("/path", handlerFunc)
+
+	ctx.Request.Header.SetMethod(fasthttp.MethodPatch)
+	ctx.Request.SetRequestURI("/path/?key=val")
+	ctx.Request.SetHost(host)
+	router.Handler(ctx)
+	if !(ctx.Response.StatusCode() == fasthttp.StatusPermanentRedirect && string(ctx.Response.Header.Peek("Location")) == buildLocation(host, "/path?key=val")) {
+		t.Errorf("Custom NotFound handler failed: Code=%d, Header=%v", ctx.Response.StatusCode(), ctx.Response.Header.String())
+	}
+	ctx.Response.Reset()
+
+	// Test special case where no node for the prefix "/" exists
+	router = New()
+	router.GET("/a", handlerFunc)
+
+	ctx.Request.Header.SetMethod(fasthttp.MethodPatch)
+	ctx.Request.SetRequestURI("/")
+	router.Handler(ctx)
+	if !(ctx.Response.StatusCode() == fasthttp.StatusNotFound) {
+		t.Errorf("NotFound handling route / failed: Code=%d", ctx.Response.StatusCode())
+	}
+}
+
+func TestRouterNotFound_RedirectLoop(t *testing.T) {
+	router := New()
+	router.GET("/foo bar", func(_ *fasthttp.RequestCtx) {})
+	router.GET("/path", func(_ *fasthttp.RequestCtx) {})
+
+	ctx := new(fasthttp.RequestCtx)
+
+	// The request path is normalized to the registered one by fasthttp,
+	// so a redirection would point to the same request uri
+	ctx.Request.SetRequestURI("/foo%20bar")
+	router.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusNotFound {
+		t.Errorf("Response status code == %d, want %d (location: %s)", status, fasthttp.StatusNotFound, ctx.Response.Header.Peek("Location"))
+	}
+
+	ctx.Response.Reset()
+
+	// The case fixing is still redirected
+	ctx.Request.SetRequestURI("/PATH")
+	router.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusMovedPermanently {
+		t.Errorf("Response status code == %d, want %d", status, fasthttp.StatusMovedPermanently)
+	}
+}
+
+func TestRouterTryRedirect(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	router := New()
+	router.RedirectTrailingSlash = false
+	router.RedirectFixedPath = false
+	router.GET("/path", handlerFunc)
+	router.PUT("/items/{id}/", handlerFunc)
+	router.Route(fasthttp.MethodGet, "/exact", handlerFunc).Exact().Done()
+
+	redirected := false
+	router.NotFound = func(ctx *fasthttp.RequestCtx) {
+		if redirected = router.TryRedirect(ctx); !redirected {
+			ctx.SetStatusCode(fasthttp.StatusNotFound)
+		}
+	}
+
+	tests := []struct {
+		method   string
+		uri      string
+		code     int
+		location string
+	}{
+		{fasthttp.MethodGet, "/path/?key=val", fasthttp.StatusMovedPermanently, "/path?key=val"},
+		{fasthttp.MethodGet, "/PATH", fasthttp.StatusMovedPermanently, "/path"},
+		{fasthttp.MethodPut, "/items/1", fasthttp.StatusPermanentRedirect, "/items/1/"},
+		{fasthttp.MethodPut, "/ITEMS/1", fasthttp.StatusPermanentRedirect, "/items/1/"},
+		{fasthttp.MethodGet, "/exact/", fasthttp.StatusNotFound, ""},
+		{fasthttp.MethodGet, "/missing", fasthttp.StatusNotFound, ""},
+		{fasthttp.MethodPost, "/path/", fasthttp.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		redirected = false
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.uri)
+		router.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s %s: status code == %d, want %d", test.method, test.uri, status, test.code)
+		}
+
+		location := string(ctx.Response.Header.Peek(fasthttp.HeaderLocation))
+		if !strings.HasSuffix(location, test.location) || (test.location == "") != (location == "") {
+			t.Errorf("%s %s: location == %q, want %q", test.method, test.uri, location, test.location)
+		}
+
+		if want := test.location != ""; redirected != want {
+			t.Errorf("%s %s: TryRedirect() == %v, want %v", test.method, test.uri, redirected, want)
+		}
+	}
+}
+
+func TestRouterRedirectFixedPathAnyMethod(t *testing.T) {
+	r := New()
+	r.POST("/users", func(ctx *fasthttp.RequestCtx) {})
+	r.PUT("/users/{id}/avatar/", func(ctx *fasthttp.RequestCtx) {})
+
+	tests := []struct {
+		method    string
+		path      string
+		anyMethod bool
+		code      int
+		location  string
+	}{
+		{fasthttp.MethodGet, "/USERS", true, fasthttp.StatusMovedPermanently, "/users"},
+		{fasthttp.MethodDelete, "/Users?a=1", true, fasthttp.StatusPermanentRedirect, "/users?a=1"},
+		{fasthttp.MethodGet, "/USERS/5/Avatar", true, fasthttp.StatusMovedPermanently, "/users/5/avatar/"},
+		{fasthttp.MethodGet, "/users", true, fasthttp.StatusMethodNotAllowed, ""},
+		{fasthttp.MethodGet, "/missing", true, fasthttp.StatusNotFound, ""},
+		{fasthttp.MethodGet, "/USERS", false, fasthttp.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		r.RedirectFixedPathAnyMethod = test.anyMethod
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+
+		r.Handler(ctx)
+
+		if code := ctx.Response.StatusCode(); code != test.code {
+			t.Errorf("%s %s - status code == %d, want %d", test.method, test.path, code, test.code)
+		}
+
+		location := string(ctx.Response.Header.Peek(fasthttp.HeaderLocation))
+		if !strings.HasSuffix(location, test.location) || (test.location == "") != (location == "") {
+			t.Errorf("%s %s - location == %q, want %q", test.method, test.path, location, test.location)
+		}
+	}
+
+	if path, found := r.FindCaseInsensitivePath("/USERS/7/AVATAR/", false); !found || path != "/users/7/avatar/" {
+		t.Errorf("FindCaseInsensitivePath == (%q, %v), want (%q, true)", path, found, "/users/7/avatar/")
+	}
+
+	if path, found := r.FindCaseInsensitivePath("/USERS/7/AVATAR", false); found {
+		t.Errorf("Unexpected fixed path %q without fixing the trailing slash", path)
+	}
+}
+
+func TestRouterRootPath(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	tests := []struct {
+		uri                   string
+		rootRoute             bool
+		redirectTrailingSlash bool
+		redirectFixedPath     bool
+		code                  int
+		location              string
+	}{
+		{"/?key=val", true, true, true, fasthttp.StatusOK, ""},
+		{"/", true, true, true, fasthttp.StatusOK, ""},
+		{"//", true, true, true, fasthttp.StatusMovedPermanently, "/"},
+		{"//", true, true, false, fasthttp.StatusMovedPermanently, "/"},
+		{"//", true, false, true, fasthttp.StatusMovedPermanently, "/"},
+		{"//", true, false, false, fasthttp.StatusNotFound, ""},
+		{"///", true, true, true, fasthttp.StatusMovedPermanently, "/"},
+		{"///", true, true, false, fasthttp.StatusNotFound, ""},
+		{"//?key=val", true, true, true, fasthttp.StatusMovedPermanently, "/?key=val"},
+		{"/?key=val", false, true, true, fasthttp.StatusNotFound, ""},
+		{"/", false, true, true, fasthttp.StatusNotFound, ""},
+		{"//", false, true, true, fasthttp.StatusNotFound, ""},
+		{"///", false, true, true, fasthttp.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		router := New()
+		router.RedirectTrailingSlash = test.redirectTrailingSlash
+		router.RedirectFixedPath = test.redirectFixedPath
+		router.GET("/path", handlerFunc)
+
+		if test.rootRoute {
+			router.GET("/", handlerFunc)
+		}
+
+		request := "GET " + test.uri + " HTTP/1.1\r\nHost: fast\r\n\r\n"
+
+		assertWithTestServer(t, request, router.Handler, func(rw *readWriter) {
+			br := bufio.NewReader(&rw.w)
+			var resp fasthttp.Response
+			if err := resp.Read(br); err != nil {
+				t.Fatalf("Unexpected error when reading response: %s", err)
+			}
+
+			if status := resp.Header.StatusCode(); status != test.code {
+				t.Errorf("URI '%s' (root: %v, tsr: %v, fixed: %v) - Response status code == %d, want %d",
+					test.uri, test.rootRoute, test.redirectTrailingSlash, test.redirectFixedPath, status, test.code)
+			}
+
+			if test.location != "" {
+				want := "http://fast" + test.location
+
+				if location := string(resp.Header.Peek("Location")); location != want {
+					t.Errorf("URI '%s' (root: %v, tsr: %v, fixed: %v) - Location == %q, want %q",
+						test.uri, test.rootRoute, test.redirectTrailingSlash, test.redirectFixedPath, location, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouterCleanPath(t *testing.T) {
+	handlerFunc := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(fmt.Sprint(ctx.UserValue("id")))
+	}
+
+	tests := []struct {
+		uri       string
+		cleanPath bool
+		code      int
+		body      string
+		location  string
+	}{
+		{"/users//42", true, fasthttp.StatusOK, "42", ""},
+		{"/users//42", false, fasthttp.StatusNotFound, "", ""},
+		{"//users/42", true, fasthttp.StatusOK, "42", ""},
+		{"/a///b", true, fasthttp.StatusOK, "<nil>", ""},
+		{"/a///b", false, fasthttp.StatusNotFound, "", ""},
+		{"/c//", true, fasthttp.StatusMovedPermanently, "", "/c"},
+		{"/d//", true, fasthttp.StatusOK, "<nil>", ""},
+		{"//", true, fasthttp.StatusOK, "<nil>", ""},
+	}
+
+	for _, test := range tests {
+		router := New()
+		router.RedirectFixedPath = false
+		router.CleanPath = test.cleanPath
+		router.GET("/", handlerFunc)
+		router.GET("/users/{id}", handlerFunc)
+		router.GET("/a/b", handlerFunc)
+		router.GET("/c", handlerFunc)
+		router.GET("/d/", handlerFunc)
+
+		request := "GET " + test.uri + " HTTP/1.1\r\nHost: fast\r\n\r\n"
+
+		assertWithTestServer(t, request, router.Handler, func(rw *readWriter) {
+			br := bufio.NewReader(&rw.w)
+			var resp fasthttp.Response
+			if err := resp.Read(br); err != nil {
+				t.Fatalf("Unexpected error when reading response: %s", err)
+			}
+
+			if status := resp.Header.StatusCode(); status != test.code {
+				t.Errorf("URI '%s' (clean: %v) - Response status code == %d, want %d",
+					test.uri, test.cleanPath, status, test.code)
+			}
+
+			if test.code == fasthttp.StatusOK && string(resp.Body()) != test.body {
+				t.Errorf("URI '%s' (clean: %v) - Response body == %q, want %q",
+					test.uri, test.cleanPath, resp.Body(), test.body)
+			}
+
+			if test.location != "" {
+				want := "http://fast" + test.location
+
+				if location := string(resp.Header.Peek("Location")); location != want {
+					t.Errorf("URI '%s' (clean: %v) - Location == %q, want %q",
+						test.uri, test.cleanPath, location, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouterTrailingSlashRoutes(t *testing.T) {
+	handler := func(body string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(body)
+		}
+	}
+
+	router := New()
+	router.GET("/items/", handler("collection"))
+	router.GET("/items", handler("resource"))
+	router.GET("/users/{id}", handler("user"))
+	router.GET("/users/{id}/", handler("user-slash"))
+	router.GET("/other", handler("other"))
+
+	tests := []struct {
+		path     string
+		code     int
+		body     string
+		location string
+	}{
+		{"/items/", fasthttp.StatusOK, "collection", ""},
+		{"/items", fasthttp.StatusOK, "resource", ""},
+		{"/users/1", fasthttp.StatusOK, "user", ""},
+		{"/users/1/", fasthttp.StatusOK, "user-slash", ""},
+		{"/other/", fasthttp.StatusMovedPermanently, "", "/other"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		router.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s - Response status code == %d, want %d", test.path, status, test.code)
+		}
+
+		if test.location != "" {
+			if location := string(ctx.Response.Header.Peek("Location")); location != buildLocation("", test.location) {
+				t.Errorf("%s - Location == %q, want %q", test.path, location, test.location)
+			}
+		} else if body := string(ctx.Response.Body()); body != test.body {
+			t.Errorf("%s - Body == %q, want %q", test.path, body, test.body)
+		}
+	}
+}
+
+func TestRouterRedirectTrailingSlashMethods(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	router := New()
+	router.RedirectTrailingSlashMethods = []string{fasthttp.MethodGet, fasthttp.MethodHead}
+
+	for _, method := range []string{fasthttp.MethodGet, fasthttp.MethodPost} {
+		router.Handle(method, "/path", handlerFunc)
+		router.Handle(method, "/dir/", handlerFunc)
+	}
+
+	tests := []struct {
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{fasthttp.MethodGet, "/path/", fasthttp.StatusMovedPermanently, "/path"},
+		{fasthttp.MethodGet, "/dir", fasthttp.StatusMovedPermanently, "/dir/"},
+		{fasthttp.MethodPost, "/path/", fasthttp.StatusNotFound, ""},
+		{fasthttp.MethodPost, "/dir", fasthttp.StatusNotFound, ""},
+		{fasthttp.MethodPost, "/PATH", fasthttp.StatusPermanentRedirect, "/path"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		router.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s %s - Response status code == %d, want %d", test.method, test.path, status, test.code)
+		}
+
+		want := ""
+		if test.location != "" {
+			want = buildLocation("", test.location)
+		}
+
+		if location := string(ctx.Response.Header.Peek("Location")); location != want {
+			t.Errorf("%s %s - Location == %q, want %q", test.method, test.path, location, want)
+		}
+	}
+
+	router.RedirectTrailingSlashMethods = nil
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(fasthttp.MethodPost)
+	ctx.Request.SetRequestURI("/path/")
+	router.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusPermanentRedirect {
+		t.Errorf("Response status code == %d, want %d", status, fasthttp.StatusPermanentRedirect)
+	}
+}
+
+func TestRouterBadRequest(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	router := New()
+	router.GET("/", handlerFunc)
+	router.GET("/{name}", handlerFunc)
+
+	var checkHandling = func(path string, expectedStatusCode int) {
+		t.Helper()
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(path)
+		router.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != expectedStatusCode {
+			t.Errorf("Path %q - Response status code == %d, want %d", path, status, expectedStatusCode)
+		}
+	}
+
+	checkHandling("/name", fasthttp.StatusOK)
+	checkHandling("/na%00me", fasthttp.StatusBadRequest)
+	checkHandling("/"+strings.Repeat("a", 100), fasthttp.StatusOK)
+
+	router.MaxPathLength = 50
+
+	checkHandling("/"+strings.Repeat("a", 49), fasthttp.StatusOK)
+	checkHandling("/"+strings.Repeat("a", 50), fasthttp.StatusBadRequest)
+
+	router.BadRequestHandler = func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusRequestURITooLong)
+	}
+
+	checkHandling("/"+strings.Repeat("a", 50), fasthttp.StatusRequestURITooLong)
+	checkHandling("/?key=val", fasthttp.StatusOK)
+
+	assertWithTestServer(t, "GET name HTTP/1.1\r\n\r\n", router.Handler, func(rw *readWriter) {
+		br := bufio.NewReader(&rw.w)
+		var resp fasthttp.Response
+		if err := resp.Read(br); err != nil {
+			t.Fatalf("Unexpected error when reading response: %s", err)
+		}
+
+		if status := resp.Header.StatusCode(); status != fasthttp.StatusRequestURITooLong {
+			t.Errorf("Response status code == %d, want %d", status, fasthttp.StatusRequestURITooLong)
+		}
+	})
+}
+
+func TestRouterEmptyPath(t *testing.T) {
+	handlerFunc := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+	ctx.Request.SetRequestURI("?key=val")
+
+	if path := ctx.Request.URI().PathOriginal(); len(path) > 0 {
+		t.Fatalf("Unexpected original path %q, want empty", path)
+	}
+
+	router := New()
+	router.GET("/", handlerFunc)
+	router.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusNoContent {
+		t.Errorf("Response status code == %d, want %d", status, fasthttp.StatusNoContent)
+	}
+
+	ctx.Response.Reset()
+
+	router = New()
+	router.GET("/a", handlerFunc)
+	router.Handler(ctx)
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusNotFound {
+		t.Errorf("Response status code == %d, want %d", status, fasthttp.StatusNotFound)
+	}
+
+	if h, tsr := router.Lookup(fasthttp.MethodGet, "", ctx); h != nil || tsr {
+		t.Errorf("Lookup of empty path returned handler or tsr")
+	}
+}
+
+func TestRouterPathExtractor(t *testing.T) {
+	handler := func(name string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(name + " " + fmt.Sprint(ctx.UserValue("id")))
+		}
+	}
+
+	r := New()
+	r.PathExtractor = func(ctx *fasthttp.RequestCtx) string {
+		return string(ctx.Request.Header.Peek("X-Route-Path"))
+	}
+	r.GET("/", handler("root"))
+	r.GET("/users/{id}", handler("user"))
+
+	tests := []struct {
+		uri  string
+		path string
+		code int
+		body string
+	}{
+		{"/other", "/users/42", fasthttp.StatusOK, "user 42"},
+		{"/users/1", "/users/7", fasthttp.StatusOK, "user 7"},
+		{"/users/1", "", fasthttp.StatusOK, "root <nil>"},
+		{"/", "/missing", fasthttp.StatusNotFound, ""},
+		{"/", "users", fasthttp.StatusBadRequest, ""},
+		{"/", "/USERS/7", fasthttp.StatusNotFound, ""},
+		{"/", "/users/7/", fasthttp.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.uri)
+		ctx.Request.Header.Set("X-Route-Path", test.path)
+		r.Handler(ctx)
+
+		if ctx.Response.StatusCode() != test.code {
+			t.Errorf("Path %q - status code == %d, want %d", test.path, ctx.Response.StatusCode(), test.code)
+		} else if test.code == fasthttp.StatusOK && string(ctx.Response.Body()) != test.body {
+			t.Errorf("Path %q - body == %q, want %q", test.path, ctx.Response.Body(), test.body)
+		}
+	}
+}
+
+func TestRouterPathExtractorNoRedirect(t *testing.T) {
+	r := New()
+	r.PathExtractor = func(ctx *fasthttp.RequestCtx) string {
+		return strings.TrimPrefix(string(ctx.Request.URI().PathOriginal()), "/api")
+	}
+	r.GET("/users/", func(ctx *fasthttp.RequestCtx) {})
+	r.POST("/posts", func(ctx *fasthttp.RequestCtx) {})
+
+	// The fixed paths would lose the stripped prefix (e.g. '/users/')
+	tests := []struct {
+		method string
+		uri    string
+		code   int
+	}{
+		{fasthttp.MethodGet, "/api/users/", fasthttp.StatusOK},
+		{fasthttp.MethodGet, "/api/users", fasthttp.StatusNotFound},
+		{fasthttp.MethodGet, "/api/USERS/", fasthttp.StatusNotFound},
+		{fasthttp.MethodGet, "/api//users/", fasthttp.StatusNotFound},
+		{fasthttp.MethodPost, "/api/POSTS", fasthttp.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.uri)
+		r.Handler(ctx)
+
+		if ctx.Response.StatusCode() != test.code {
+			t.Errorf("%s %s - status code == %d, want %d", test.method, test.uri, ctx.Response.StatusCode(), test.code)
+		}
+
+		if location := ctx.Response.Header.Peek(fasthttp.HeaderLocation); len(location) > 0 {
+			t.Errorf("%s %s - unexpected redirect to %q", test.method, test.uri, location)
+		}
+
+		if r.TryRedirect(ctx) {
+			t.Errorf("%s %s - TryRedirect() == true, want false", test.method, test.uri)
+		}
+	}
+}
+
+func TestRouterNotFound_MethodWild(t *testing.T) {
+	postFound, anyFound := false, false
+
+	router := New()
+	router.ANY("/{path:*}", func(ctx *fasthttp.RequestCtx) { anyFound = true })
+	router.POST("/specific", func(ctx *fasthttp.RequestCtx) { postFound = true })
+
+	for i := 0; i < 100; i++ {
+		router.Handle(
+			randomHTTPMethod(),
+			fmt.Sprintf("/%d", rand.Int63()),
+			func(ctx *fasthttp.RequestCtx) {},
+		)
+	}
+
+	ctx := new(fasthttp.RequestCtx)
+	var request = func(method, path string) {
+		ctx.Request.Header.SetMethod(method)
+		ctx.Request.SetRequestURI(path)
+		router.Handler(ctx)
+	}
+
+	for _, method := range httpMethods {
+		request(method, "/specific")
+
+		if method == fasthttp.MethodPost {
+			if !postFound {
+				t.Errorf("Method '%s': not found", method)
+			}
+		} else {
+			if !anyFound {
+				t.Errorf("Method 'ANY' not found with request method %s", method)
+			}
+		}
+
+		status := ctx.Response.StatusCode()
+		if status != fasthttp.StatusOK {
+			t.Errorf("Response status code == %d, want %d", status, fasthttp.StatusOK)
+		}
+
+		postFound, anyFound = false, false
+		ctx.Response.Reset()
+	}
+}
+
+func TestRouterPanicHandler(t *testing.T) {
+	router := New()
+	panicHandled := false
+
+	router.PanicHandler = func(ctx *fasthttp.RequestCtx, p interface{}) {
+		panicHandled = true
+	}
+
+	router.Handle(fasthttp.MethodPut, "/user/{name}", func(ctx *fasthttp.RequestCtx) {
+		panic("oops!")
+	})
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.Header.SetMethod(fasthttp.MethodPut)
+	ctx.Request.SetRequestURI("/user/gopher")
+
+	defer func() {
+		if rcv := recover(); rcv != nil {
+			t.Fatal("handling panic failed")
+		}
+	}()
+
+	router.Handler(ctx)
+
+	if !panicHandled {
+		t.Fatal("simulating failed")
+	}
+}
+
+type testLogger struct {
+	logs []string
+}
+
+func (l *testLogger) Printf(format string, args ...interface{}) {
+	l.logs = append(l.logs, fmt.Sprintf(format, args...))
+}
+
+func TestRouterRecoverPanics(t *testing.T) {
+	router := New()
+	router.Handle(fasthttp.MethodPut, "/user/{name}", func(ctx *fasthttp.RequestCtx) {
+		panic("oops!")
+	})
+
+	newCtx := func(logger fasthttp.Logger) *fasthttp.RequestCtx {
+		req := new(fasthttp.Request)
+		req.Header.SetMethod(fasthttp.MethodPut)
+		req.SetRequestURI("/user/gopher")
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Init(req, nil, logger)
+
+		return ctx
+	}
+
+	if rcv := catchPanic(func() { router.Handler(newCtx(nil)) }); rcv != "oops!" {
+		t.Errorf("Expected the panic without recovery, got %v", rcv)
+	}
+
+	router.RecoverPanics = true
+
+	logger := new(testLogger)
+	ctx := newCtx(logger)
+
+	if rcv := catchPanic(func() { router.Handler(ctx) }); rcv != nil {
+		t.Fatalf("Unexpected panic %v", rcv)
+	}
+
+	if status := ctx.Response.StatusCode(); status != fasthttp.StatusInternalServerError {
+		t.Errorf("Status code == %d, want %d", status, fasthttp.StatusInternalServerError)
+	}
+
+	if len(logger.logs) != 1 || !strings.Contains(logger.logs[0], "panic recovered: oops!") ||
+		!strings.Contains(logger.logs[0], "goroutine") {
+		t.Errorf("Unexpected logs %q", logger.logs)
+	}
+
+	panicHandled := false
+	router.PanicHandler = func(ctx *fasthttp.RequestCtx, p interface{}) {
+		panicHandled = true
+	}
+
+	router.Handler(newCtx(nil))
+
+	if !panicHandled {
+		t.Error("Expected the panic to be handled by the PanicHandler")
+	}
+}
+
+func testRouterLookupByMethod(t *testing.T, method string) {
+	reqMethod := method
+	if method == MethodWild {
+		reqMethod = randomHTTPMethod()
+	}
+
+	routed := false
+	wantHandle := func(_ *fasthttp.RequestCtx) {
+		routed = true
+	}
+	wantParams := map[string]string{"name": "gopher"}
+
+	ctx := new(fasthttp.RequestCtx)
+	router := New()
+
+	// try empty router first
+	handle, tsr := router.Lookup(reqMethod, "/nope", ctx)
+	if handle != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	}
+	if tsr {
+		t.Error("Got wrong TSR recommendation!")
+	}
+
+	// insert route and try again
+	router.Handle(method, "/user/{name}", wantHandle)
+	handle, _ = router.Lookup(reqMethod, "/user/gopher", ctx)
+	if handle == nil {
+		t.Fatal("Got no handle!")
+	} else {
+		handle(nil)
+		if !routed {
+			t.Fatal("Routing failed!")
+		}
+	}
+
+	for expectedKey, expectedVal := range wantParams {
+		if ctx.UserValue(expectedKey) != expectedVal {
+			t.Errorf("The values %s = %s is not save in context", expectedKey, expectedVal)
+		}
+	}
+
+	routed = false
+
+	// route without param
+	router.Handle(method, "/user", wantHandle)
+	handle, _ = router.Lookup(reqMethod, "/user", ctx)
+	if handle == nil {
+		t.Fatal("Got no handle!")
+	} else {
+		handle(nil)
+		if !routed {
+			t.Fatal("Routing failed!")
+		}
+	}
+
+	for expectedKey, expectedVal := range wantParams {
+		if ctx.UserValue(expectedKey) != expectedVal {
+			t.Errorf("The values %s = %s is not save in context", expectedKey, expectedVal)
+		}
+	}
+
+	handle, tsr = router.Lookup(reqMethod, "/user/gopher/", ctx)
+	if handle != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	}
+	if !tsr {
+		t.Error("Got no TSR recommendation!")
+	}
+
+	handle, tsr = router.Lookup(reqMethod, "/nope", ctx)
+	if handle != nil {
+		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	}
+	if tsr {
+		t.Error("Got wrong TSR recommendation!")
+	}
+}
+
+func TestRouterLookupWithRedirect(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.GET("/dir/", handlerFunc)
+	router.GET("/", handlerFunc)
+	router.ANY("/any", handlerFunc)
+	router.CONNECT("/connect", handlerFunc)
+
+	tests := []struct {
+		method     string
+		path       string
+		found      bool
+		redirectTo string
+	}{
+		{fasthttp.MethodGet, "/path", true, ""},
+		{fasthttp.MethodGet, "/path/", false, "/path"},
+		{fasthttp.MethodGet, "/dir", false, "/dir/"},
+		{fasthttp.MethodGet, "/PATH", false, "/path"},
+		{fasthttp.MethodGet, "/DIR", false, "/dir/"},
+		{fasthttp.MethodGet, "/../path", false, "/path"},
+		{fasthttp.MethodGet, "/nope", false, ""},
+		{fasthttp.MethodPost, "/path", false, ""},
+		{fasthttp.MethodPost, "/any", true, ""},
+		{fasthttp.MethodPost, "/any/", false, "/any"},
+		{fasthttp.MethodGet, "/ANY", false, "/any"},
+		{fasthttp.MethodPost, "/ANY", false, "/any"},
+		{fasthttp.MethodConnect, "/connect/", false, ""},
+	}
+
+	for _, test := range tests {
+		handler, redirectTo := router.LookupWithRedirect(test.method, test.path, nil)
+
+		if (handler != nil) != test.found {
+			t.Errorf("%s %s - handler found == %v, want %v", test.method, test.path, handler != nil, test.found)
+		}
+
+		if redirectTo != test.redirectTo {
+			t.Errorf("%s %s - redirect == %q, want %q", test.method, test.path, redirectTo, test.redirectTo)
+		}
+	}
+
+	router.RedirectTrailingSlash = false
+	router.RedirectFixedPath = false
+
+	if _, redirectTo := router.LookupWithRedirect(fasthttp.MethodGet, "/path/", nil); redirectTo != "" {
+		t.Errorf("Unexpected redirect %q with disabled redirections", redirectTo)
+	}
+}
+
+func TestRouterFixedPathWildTree(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	router := New()
+	router.GET("/path", handlerFunc)
+	router.ANY("/any", handlerFunc)
+
+	tests := []struct {
+		method string
+		code   int
+	}{
+		{fasthttp.MethodGet, fasthttp.StatusMovedPermanently},
+		{fasthttp.MethodPost, fasthttp.StatusPermanentRedirect},
+		{"CUSTOM", fasthttp.StatusPermanentRedirect},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI("/ANY")
+		router.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s /ANY - status code == %d, want %d", test.method, status, test.code)
+		}
+
+		if location := string(ctx.Response.Header.Peek("Location")); location != buildLocation("", "/any") {
+			t.Errorf("%s /ANY - Location == %q, want %q", test.method, location, buildLocation("", "/any"))
+		}
+	}
+}
+
+func TestRouterHandlePriority(t *testing.T) {
+	idHandler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("id")
+	}
+	nameHandler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("name")
+	}
+
+	r := New()
+	r.HandlePriority(fasthttp.MethodGet, "/a/{id:[0-9]+}/x", idHandler, 0)
+	r.HandlePriority(fasthttp.MethodGet, "/a/{name:[a-z0-9]+}/x", nameHandler, 1)
+
+	v1 := r.Group("/v1")
+	v1.HandlePriority(fasthttp.MethodGet, "/b/{id:[0-9]+}/x", idHandler, 1)
+	v1.HandlePriority(fasthttp.MethodGet, "/b/{name:[a-z0-9]+}/x", nameHandler, 0)
+
+	r.CloneGroup(v1, "/v2", nil)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/a/42/x", "name"},
+		{"/a/abc/x", "name"},
+		{"/v1/b/42/x", "id"},
+		{"/v1/b/abc/x", "name"},
+		{"/v2/b/42/x", "id"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if body := string(ctx.Response.Body()); body != test.want {
+			t.Errorf("Path '%s' - matched route == %q, want %q", test.path, body, test.want)
+		}
+	}
+}
+
+func TestRouterHandleParams(t *testing.T) {
+	r := New()
+	r.HandleParams(fasthttp.MethodGet, "/users/{id}/posts/{post}", func(ctx *fasthttp.RequestCtx, ps radix.Params) {
+		ctx.SetBodyString(fmt.Sprint(ps))
+	})
+	r.HandleParams(fasthttp.MethodGet, "/health", func(ctx *fasthttp.RequestCtx, ps radix.Params) {
+		ctx.SetBodyString(fmt.Sprint(len(ps)))
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/users/42/posts/hello", "[{id 42} {post hello}]"},
+		{"/health", "0"},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if body := string(ctx.Response.Body()); body != test.want {
+			t.Errorf("Path '%s' - body == %q, want %q", test.path, body, test.want)
+		}
+	}
+
+	recv := catchPanic(func() {
+		r.HandleParams(fasthttp.MethodGet, "/nil", nil)
+	})
+
+	if want := "handler must not be nil"; fmt.Sprint(recv) != want {
+		t.Errorf("Expected panic %q, got %v", want, recv)
+	}
+}
+
+func TestRouterHandleTimeout(t *testing.T) {
+	r := New()
+	r.HandleTimeout(fasthttp.MethodGet, "/fast", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("fast")
+	}, 100*time.Millisecond)
+	r.HandleTimeout(fasthttp.MethodGet, "/slow", func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(200 * time.Millisecond)
+		ctx.SetBodyString("slow")
+	}, 10*time.Millisecond)
+
+	if err := catchPanic(func() {
+		r.HandleTimeout(fasthttp.MethodGet, "/nil", nil, time.Second)
+	}); err == nil {
+		t.Error("an error was expected with a nil handler")
+	}
+
+	tests := []struct {
+		uri        string
+		statusCode int
+		body       string
+	}{
+		{"GET /fast HTTP/1.1\r\n\r\n", fasthttp.StatusOK, "fast"},
+		{"GET /slow HTTP/1.1\r\n\r\n", fasthttp.StatusServiceUnavailable, fasthttp.StatusMessage(fasthttp.StatusServiceUnavailable)},
+	}
+
+	for _, test := range tests {
+		assertWithTestListener(t, test.uri, r.Handler, func(rw *readWriter) {
+			br := bufio.NewReader(&rw.w)
+			var resp fasthttp.Response
+			if err := resp.Read(br); err != nil {
+				t.Fatalf("Unexpected error when reading response: %s", err)
+			}
+			if resp.Header.StatusCode() != test.statusCode {
+				t.Errorf("Unexpected status code %d. Expected %d", resp.Header.StatusCode(), test.statusCode)
+			}
+			if string(resp.Body()) != test.body {
+				t.Errorf("Unexpected body %q. Expected %q", resp.Body(), test.body)
+			}
+		})
+	}
+
+	var rcv interface{}
+	r.PanicHandler = func(ctx *fasthttp.RequestCtx, p interface{}) {
+		rcv = p
+	}
+	r.HandleTimeout(fasthttp.MethodGet, "/panic", func(ctx *fasthttp.RequestCtx) {
+		panic("oops!")
+	}, time.Second)
+
+	// The ctx of a server, which bounds the handlers running
+	// in their own goroutine
+	req := new(fasthttp.Request)
+	req.SetRequestURI("/panic")
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(req, nil, nil)
+	r.Handler(ctx)
+
+	if rcv != "oops!" {
+		t.Errorf("PanicHandler() recovered %v, want %q", rcv, "oops!")
+	}
+}
+
+func TestRouterLookup(t *testing.T) {
+	for _, method := range httpMethods {
+		testRouterLookupByMethod(t, method)
+	}
+}
+
+func TestRouterMatchedRoutePath(t *testing.T) {
+	route1 := "/user/{name}"
+	routed1 := false
+	handle1 := func(ctx *fasthttp.RequestCtx) {
+		route := ctx.UserValue(MatchedRoutePathParam)
+		if route != route1 {
+			t.Fatalf("Wrong matched route: want %s, got %s", route1, route)
+		}
+		routed1 = true
+	}
+
+	route2 := "/user/{name}/details"
+	routed2 := false
+	handle2 := func(ctx *fasthttp.RequestCtx) {
+		route := ctx.UserValue(MatchedRoutePathParam)
+		if route != route2 {
+			t.Fatalf("Wrong matched route: want %s, got %s", route2, route)
+		}
+		routed2 = true
+	}
+
+	route3 := "/"
+	routed3 := false
+	handle3 := func(ctx *fasthttp.RequestCtx) {
+		route := ctx.UserValue(MatchedRoutePathParam)
+		if route != route3 {
+			t.Fatalf("Wrong matched route: want %s, got %s", route3, route)
+		}
+		routed3 = true
+	}
+
+	router := New()
+	router.SaveMatchedRoutePath = true
+	router.Handle(fasthttp.MethodGet, route1, handle1)
+	router.Handle(fasthttp.MethodGet, route2, handle2)
+	router.Handle(fasthttp.MethodGet, route3, handle3)
+
+	ctx := new(fasthttp.RequestCtx)
+
+	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+	ctx.Request.SetRequestURI("/user/gopher")
+	router.Handler(ctx)
+	if !routed1 || routed2 || routed3 {
+		t.Fatal("Routing failed!")
+	}
+
+	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+	ctx.Request.SetRequestURI("/user/gopher/details")
+	router.Handler(ctx)
+	if !routed2 || routed3 {
+		t.Fatal("Routing failed!")
+	}
+
+	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
+	ctx.Request.SetRequestURI("/")
+	router.Handler(ctx)
+	if !routed3 {
+		t.Fatal("Routing failed!")
+	}
+}
+
+func TestRouterServeFiles(t *testing.T) {
+	r := New()
+
+	recv := catchPanic(func() {
+		r.ServeFiles("/noFilepath", os.TempDir())
+	})
+	if recv == nil {
+		t.Fatal("registering path not ending with '{filepath:*}' did not panic")
+	}
+
+	body := []byte("fake ico")
+	if err := os.WriteFile(os.TempDir()+"/favicon.ico", body, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r.ServeFiles("/{filepath:*}", os.TempDir())
+
+	assertWithTestServer(t, "GET /favicon.ico HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
+		br := bufio.NewReader(&rw.w)
+		var resp fasthttp.Response
+		if err := resp.Read(br); err != nil {
+			t.Fatalf("Unexpected error when reading response: %s", err)
+		}
+		if resp.Header.StatusCode() != 200 {
+			t.Fatalf("Unexpected status code %d. Expected %d", resp.Header.StatusCode(), 200)
+		}
+		if !bytes.Equal(resp.Body(), body) {
+			t.Fatalf("Unexpected body %q. Expected %q", resp.Body(), string(body))
+		}
+	})
+}
+
+func TestRouterStatic(t *testing.T) {
+	r := New()
+
+	recv := catchPanic(func() {
+		r.Static("/static/{filepath:*}", os.TempDir())
+	})
+	if recv == nil {
+		t.Fatal("registering url prefix with wildcards did not panic")
+	}
+
+	body := []byte("fake ico")
+	if err := os.WriteFile(os.TempDir()+"/favicon.ico", body, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Static("/static", os.TempDir())
+
+	assertWithTestServer(t, "GET /static/favicon.ico HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
+		br := bufio.NewReader(&rw.w)
+		var resp fasthttp.Response
+		if err := resp.Read(br); err != nil {
+			t.Fatalf("Unexpected error when reading response: %s", err)
+		}
+		if resp.Header.StatusCode() != 200 {
+			t.Fatalf("Unexpected status code %d. Expected %d", resp.Header.StatusCode(), 200)
+		}
+		if !bytes.Equal(resp.Body(), body) {
+			t.Fatalf("Unexpected body %q. Expected %q", resp.Body(), string(body))
+		}
+	})
+}
+
+func TestRouterServeFS(t *testing.T) {
+	r := New()
+
+	recv := catchPanic(func() {
+		r.ServeFS("/noFilepath", fsTestFilesystem)
+	})
+	if recv == nil {
+		t.Fatal("registering path not ending with '{filepath:*}' did not panic")
+	}
+
+	body, err := os.ReadFile("LICENSE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.ServeFS("/{filepath:*}", fsTestFilesystem)
+
+	assertWithTestServer(t, "GET /LICENSE HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
+		br := bufio.NewReader(&rw.w)
+		var resp fasthttp.Response
+		if err := resp.Read(br); err != nil {
+			t.Fatalf("Unexpected error when reading response: %s", err)
+		}
+		if resp.Header.StatusCode() != 200 {
+			t.Fatalf("Unexpected status code %d. Expected %d", resp.Header.StatusCode(), 200)
+		}
+		if !bytes.Equal(resp.Body(), body) {
+			t.Fatalf("Unexpected body %q. Expected %q", resp.Body(), string(body))
+		}
+	})
+}
+
+func TestRouterServeFSIndexAndNotFound(t *testing.T) {
+	fsys := fstest.MapFS{
+		"docs/index.html": &fstest.MapFile{Data: []byte("<h1>docs</h1>")},
+		"docs/guide.txt":  &fstest.MapFile{Data: []byte("guide")},
+	}
+
+	r := New()
+	r.ServeFS("/assets/{filepath:*}", fsys)
+
+	tests := []struct {
+		path        string
+		code        int
+		body        string
+		contentType string
+	}{
+		{"/assets/docs/guide.txt", fasthttp.StatusOK, "guide", "text/plain; charset=utf-8"},
+		{"/assets/docs/", fasthttp.StatusOK, "<h1>docs</h1>", "text/html; charset=utf-8"},
+		{"/assets/docs/missing.txt", fasthttp.StatusNotFound, "", ""},
+	}
+
+	for _, test := range tests {
+		assertWithTestServer(t, "GET "+test.path+" HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
+			br := bufio.NewReader(&rw.w)
+			var resp fasthttp.Response
+			if err := resp.Read(br); err != nil {
+				t.Fatalf("Unexpected error when reading response: %s", err)
+			}
+
+			if resp.Header.StatusCode() != test.code {
+				t.Errorf("%s - Unexpected status code %d. Expected %d", test.path, resp.Header.StatusCode(), test.code)
+			}
+
+			if test.code != fasthttp.StatusOK {
+				return
+			}
+
+			if string(resp.Body()) != test.body {
+				t.Errorf("%s - Unexpected body %q. Expected %q", test.path, resp.Body(), test.body)
+			}
+
+			if contentType := string(resp.Header.ContentType()); contentType != test.contentType {
+				t.Errorf("%s - Unexpected content type %q. Expected %q", test.path, contentType, test.contentType)
+			}
+		})
+	}
+}
+
+func TestRouterServeFilesCompressed(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		"js/app.js":    "app()",
+		"js/app.js.br": "br app()",
+		"js/app.js.gz": "gzip app()",
+		"lib.js":       "lib()",
+		"lib.js.gz":    "gzip lib()",
+		"style.css":    "body{}",
+	}
+
+	for name, data := range files {
+		filename := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filename, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := New()
+	r.ServeFilesCompressed("/assets/{filepath:*}", root, []string{"br", "gzip"})
+	r.Group("/v2").ServeFilesCompressed("/{filepath:*}", root, []string{"gzip"})
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		code           int
+		body           string
+		encoding       string
+	}{
+		{"/assets/js/app.js", "gzip, deflate, br", fasthttp.StatusOK, "br app()", "br"},
+		{"/assets/js/app.js", "gzip", fasthttp.StatusOK, "gzip app()", "gzip"},
+		{"/assets/js/app.js", "", fasthttp.StatusOK, "app()", ""},
+		{"/assets/lib.js", "br, gzip", fasthttp.StatusOK, "gzip lib()", "gzip"},
+		{"/assets/style.css", "br, gzip", fasthttp.StatusOK, "body{}", ""},
+		{"/assets/missing.js", "br", fasthttp.StatusNotFound, "", ""},
+		{"/v2/js/app.js", "br, gzip", fasthttp.StatusOK, "gzip app()", "gzip"},
+	}
+
+	for _, test := range tests {
+		request := "GET " + test.path + " HTTP/1.1\r\n"
+		if test.acceptEncoding != "" {
+			request += "Accept-Encoding: " + test.acceptEncoding + "\r\n"
+		}
+
+		assertWithTestServer(t, request+"\r\n", r.Handler, func(rw *readWriter) {
+			br := bufio.NewReader(&rw.w)
+			var resp fasthttp.Response
+			if err := resp.Read(br); err != nil {
+				t.Fatalf("Unexpected error when reading response: %s", err)
+			}
+
+			if resp.Header.StatusCode() != test.code {
+				t.Errorf("%s (%s) - Unexpected status code %d. Expected %d", test.path, test.acceptEncoding, resp.Header.StatusCode(), test.code)
+			}
+
+			if test.code != fasthttp.StatusOK {
+				return
+			}
+
+			if string(resp.Body()) != test.body {
+				t.Errorf("%s (%s) - Unexpected body %q. Expected %q", test.path, test.acceptEncoding, resp.Body(), test.body)
+			}
+
+			if encoding := string(resp.Header.ContentEncoding()); encoding != test.encoding {
+				t.Errorf("%s (%s) - Unexpected Content-Encoding %q. Expected %q", test.path, test.acceptEncoding, encoding, test.encoding)
+			}
+
+			if contentType := string(resp.Header.ContentType()); test.encoding != "" && !strings.HasPrefix(contentType, "text/javascript") {
+				t.Errorf("%s (%s) - Unexpected Content-Type %q", test.path, test.acceptEncoding, contentType)
+			}
+
+			if vary := string(resp.Header.Peek(fasthttp.HeaderVary)); vary != fasthttp.HeaderAcceptEncoding {
+				t.Errorf("%s (%s) - Unexpected Vary %q", test.path, test.acceptEncoding, vary)
+			}
+		})
+	}
+
+	for _, encodings := range [][]string{nil, {"deflate"}} {
+		if recv := catchPanic(func() { New().ServeFilesCompressed("/assets/{filepath:*}", root, encodings) }); recv == nil {
+			t.Errorf("Expected a panic with the encodings %v", encodings)
+		}
+	}
+}
+
+func TestRouterServeFilesCached(t *testing.T) {
+	root := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(root, "app.js"), []byte("app()"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New()
+	r.ServeFilesCached("/static/{filepath:*}", root, time.Hour)
+	r.Group("/v2").ServeFilesCached("/{filepath:*}", root, 0)
+
+	get := func(path string, headers ...string) *fasthttp.Response {
+		request := "GET " + path + " HTTP/1.1\r\n"
+		for _, header := range headers {
+			request += header + "\r\n"
+		}
+
+		resp := new(fasthttp.Response)
+
+		assertWithTestServer(t, request+"\r\n", r.Handler, func(rw *readWriter) {
+			if err := resp.Read(bufio.NewReader(&rw.w)); err != nil {
+				t.Fatalf("Unexpected error when reading response: %s", err)
+			}
+		})
+
+		return resp
+	}
+
+	resp := get("/static/app.js")
+	etag := string(resp.Header.Peek(fasthttp.HeaderETag))
+	lastModified := string(resp.Header.Peek(fasthttp.HeaderLastModified))
+
+	if resp.StatusCode() != fasthttp.StatusOK || string(resp.Body()) != "app()" {
+		t.Fatalf("Unexpected response %d %q", resp.StatusCode(), resp.Body())
+	}
+
+	if etag == "" {
+		t.Fatal("Missing ETag header")
+	}
+
+	if cacheControl := string(resp.Header.Peek(fasthttp.HeaderCacheControl)); cacheControl != "public, max-age=3600" {
+		t.Errorf("Unexpected Cache-Control %q", cacheControl)
+	}
+
+	tests := []struct {
+		path         string
+		headers      []string
+		code         int
+		cacheControl string
+	}{
+		{"/static/app.js", []string{"If-None-Match: " + etag}, fasthttp.StatusNotModified, "public, max-age=3600"},
+		{"/static/app.js", []string{`If-None-Match: "other", ` + strings.TrimPrefix(etag, "W/")}, fasthttp.StatusNotModified, "public, max-age=3600"},
+		{"/static/app.js", []string{"If-None-Match: *"}, fasthttp.StatusNotModified, "public, max-age=3600"},
+		{"/static/app.js", []string{"If-Modified-Since: " + lastModified}, fasthttp.StatusNotModified, "public, max-age=3600"},
+		{"/static/app.js", []string{`If-None-Match: "other"`, "If-Modified-Since: " + lastModified}, fasthttp.StatusOK, "public, max-age=3600"},
+		{"/v2/app.js", []string{"If-None-Match: " + etag}, fasthttp.StatusNotModified, "no-cache"},
+		{"/v2/app.js", nil, fasthttp.StatusOK, "no-cache"},
+		{"/static/app.js", []string{"Range: bytes=0-1"}, fasthttp.StatusPartialContent, "public, max-age=3600"},
+		{"/static/app.js", []string{"Range: bytes=0-1", "If-None-Match: " + etag}, fasthttp.StatusNotModified, "public, max-age=3600"},
+		{"/static/missing.js", []string{"If-None-Match: *"}, fasthttp.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		resp := get(test.path, test.headers...)
+
+		if resp.StatusCode() != test.code {
+			t.Errorf("%s %v - Unexpected status code %d. Expected %d", test.path, test.headers, resp.StatusCode(), test.code)
+		}
+
+		if test.code == fasthttp.StatusNotModified && len(resp.Body()) != 0 {
+			t.Errorf("%s %v - Unexpected body %q", test.path, test.headers, resp.Body())
+		}
+
+		if test.code != fasthttp.StatusNotFound && string(resp.Header.Peek(fasthttp.HeaderETag)) != etag {
+			t.Errorf("%s %v - Unexpected ETag %q. Expected %q", test.path, test.headers, resp.Header.Peek(fasthttp.HeaderETag), etag)
+		}
+
+		if cacheControl := string(resp.Header.Peek(fasthttp.HeaderCacheControl)); cacheControl != test.cacheControl {
+			t.Errorf("%s %v - Unexpected Cache-Control %q. Expected %q", test.path, test.headers, cacheControl, test.cacheControl)
+		}
+	}
+
+	// The If-Modified-Since header of the request is kept
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/static/app.js")
+	ctx.Request.Header.Set(fasthttp.HeaderIfNoneMatch, `"other"`)
+	ctx.Request.Header.Set(fasthttp.HeaderIfModifiedSince, lastModified)
+	r.Handler(ctx)
+
+	if ifModifiedSince := string(ctx.Request.Header.Peek(fasthttp.HeaderIfModifiedSince)); ifModifiedSince != lastModified {
+		t.Errorf("Unexpected If-Modified-Since %q. Expected %q", ifModifiedSince, lastModified)
+	}
+
+	if recv := catchPanic(func() { New().ServeFilesCached("/static/{filepath:*}", root, -time.Second) }); recv == nil {
+		t.Error("Expected panic with a negative ttl")
+	}
+}
+
+func TestRouterServeSPA(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		"index.html":     "<h1>app</h1>",
+		"js/app.js":      "app()",
+		"docs/guide.txt": "guide",
+	}
+
+	for name, data := range files {
+		filename := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filename, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := New()
+	r.ServeSPA("/app/{filepath:*}", root, "index.html")
+	r.Group("/v2").ServeSPA("/{filepath:*}", root, "/index.html")
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/app/js/app.js", fasthttp.StatusOK, "app()"},
+		{"/app/docs/guide.txt", fasthttp.StatusOK, "guide"},
+		{"/app/users", fasthttp.StatusOK, "<h1>app</h1>"},
+		{"/app/users/42/posts/7", fasthttp.StatusOK, "<h1>app</h1>"},
+		{"/app/js/missing.js", fasthttp.StatusNotFound, ""},
+		{"/app/docs/missing.txt", fasthttp.StatusNotFound, ""},
+		{"/v2/js/app.js", fasthttp.StatusOK, "app()"},
+		{"/v2/settings/profile", fasthttp.StatusOK, "<h1>app</h1>"},
+		{"/v2/img/logo.png", fasthttp.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		assertWithTestServer(t, "GET "+test.path+" HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
+			br := bufio.NewReader(&rw.w)
+			var resp fasthttp.Response
+			if err := resp.Read(br); err != nil {
+				t.Fatalf("Unexpected error when reading response: %s", err)
+			}
+
+			if resp.Header.StatusCode() != test.code {
+				t.Errorf("%s - Unexpected status code %d. Expected %d", test.path, resp.Header.StatusCode(), test.code)
+			}
+
+			if test.code == fasthttp.StatusOK && string(resp.Body()) != test.body {
+				t.Errorf("%s - Unexpected body %q. Expected %q", test.path, resp.Body(), test.body)
+			}
+		})
+	}
+
+	recv := catchPanic(func() {
+		New().ServeSPA("/app/{filepath:*}", root, "")
+	})
+
+	if recv == nil {
+		t.Error("Expected a panic with an empty index file")
+	}
+}
+
+func TestRouterServeFilesCustom(t *testing.T) {
+	r := New()
+
+	root := os.TempDir()
+
+	fs := &fasthttp.FS{
+		Root: root,
+	}
+
+	recv := catchPanic(func() {
+		r.ServeFilesCustom("/noFilepath", fs)
+	})
+	if recv == nil {
+		t.Fatal("registering path not ending with '{filepath:*}' did not panic")
+	}
+	body := []byte("fake ico")
+	ioutil.WriteFile(root+"/favicon.ico", body, 0644)
+
+	r.ServeFilesCustom("/{filepath:*}", fs)
+
+	assertWithTestServer(t, "GET /favicon.ico HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
+		br := bufio.NewReader(&rw.w)
+		var resp fasthttp.Response
+		if err := resp.Read(br); err != nil {
+			t.Fatalf("Unexpected error when reading response: %s", err)
+		}
+		if resp.Header.StatusCode() != 200 {
+			t.Fatalf("Unexpected status code %d. Expected %d", resp.Header.StatusCode(), 200)
+		}
+		if !bytes.Equal(resp.Body(), body) {
+			t.Fatalf("Unexpected body %q. Expected %q", resp.Body(), string(body))
+		}
+	})
+}
+
+func TestRouterList(t *testing.T) {
+	expected := map[string][]string{
+		"GET":    {"/bar"},
+		"PATCH":  {"/foo"},
+		"POST":   {"/v1/users/{name}/{surname?}"},
+		"DELETE": {"/v1/users/{id?}"},
+	}
+
+	r := New()
+	r.GET("/bar", func(ctx *fasthttp.RequestCtx) {})
+	r.PATCH("/foo", func(ctx *fasthttp.RequestCtx) {})
+
+	v1 := r.Group("/v1")
+	v1.POST("/users/{name}/{surname?}", func(ctx *fasthttp.RequestCtx) {})
+	v1.DELETE("/users/{id?}", func(ctx *fasthttp.RequestCtx) {})
+
+	result := r.List()
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Router.List() == %v, want %v", result, expected)
+	}
+
+}
+
+func TestRouterClone(t *testing.T) {
+	handler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	}
+
+	r := New()
+	r.RedirectTrailingSlash = false
+	r.GET("/users/{id}", handler)
+	r.Handle("CUSTOM", "/users/{id?}", handler)
+
+	clone := r.Clone()
+	clone.POST("/users", handler)
+	clone.GET("/users/{id}/posts", handler)
+	clone.Handle("CUSTOM", "/items", handler)
+
+	if clone.RedirectTrailingSlash {
+		t.Error("Expected the settings to be cloned")
+	}
+
+	tests := []struct {
+		router *Router
+		method string
+		path   string
+		code   int
+	}{
+		{r, fasthttp.MethodGet, "/users/1", fasthttp.StatusNoContent},
+		{r, fasthttp.MethodPost, "/users", fasthttp.StatusMethodNotAllowed},
+		{r, fasthttp.MethodGet, "/users/1/posts", fasthttp.StatusNotFound},
+		{r, "CUSTOM", "/users", fasthttp.StatusNoContent},
+		{r, "CUSTOM", "/items", fasthttp.StatusNotFound},
+		{r, fasthttp.MethodGet, "/users/1/", fasthttp.StatusNotFound},
+		{clone, fasthttp.MethodGet, "/users/1", fasthttp.StatusNoContent},
+		{clone, fasthttp.MethodPost, "/users", fasthttp.StatusNoContent},
+		{clone, fasthttp.MethodGet, "/users/1/posts", fasthttp.StatusNoContent},
+		{clone, "CUSTOM", "/items", fasthttp.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		test.router.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s %s (clone: %v) - status code == %d, want %d",
+				test.method, test.path, test.router == clone, status, test.code)
+		}
+	}
+
+	if got, want := len(r.Export()), 2; got != want {
+		t.Errorf("Router routes == %d, want %d", got, want)
+	}
+
+	if got, want := len(clone.Export()), 5; got != want {
+		t.Errorf("Clone routes == %d, want %d", got, want)
+	}
+}
+
+func TestRouterTrustForwardedHost(t *testing.T) {
+	var requestHost interface{}
+
+	r := New()
+	r.GET("/", func(ctx *fasthttp.RequestCtx) {
+		requestHost = ctx.UserValue(RequestHostParam)
+	})
+
+	tests := []struct {
+		trust     bool
+		forwarded string
+		want      string
+	}{
+		{false, "", "fast"},
+		{false, "proxied.com", "fast"},
+		{true, "", "fast"},
+		{true, "proxied.com", "proxied.com"},
+		{true, " proxied.com , proxy.com", "proxied.com"},
+	}
+
+	for _, test := range tests {
+		r.TrustForwardedHost = test.trust
+		requestHost = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI("http://fast/")
+
+		if test.forwarded != "" {
+			ctx.Request.Header.Set(fasthttp.HeaderXForwardedHost, test.forwarded)
+		}
+
+		if host := r.RequestHost(ctx); host != test.want {
+			t.Errorf("Forwarded '%s' (trust: %v) - RequestHost() == %s, want %s", test.forwarded, test.trust, host, test.want)
+		}
+
+		r.Handler(ctx)
+
+		if test.trust && requestHost != test.want {
+			t.Errorf("Forwarded '%s' - user value == %v, want %s", test.forwarded, requestHost, test.want)
+		} else if !test.trust && requestHost != nil {
+			t.Errorf("Forwarded '%s' - unexpected user value %v", test.forwarded, requestHost)
+		}
+	}
+}
+
+func TestRouterDisableTSRMethods(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	r := New()
+	r.DisableTSRMethods = []string{fasthttp.MethodPost, "RPC"}
+
+	for _, method := range []string{fasthttp.MethodGet, fasthttp.MethodPost, "RPC"} {
+		r.Handle(method, "/path", handlerFunc)
+	}
+
+	tests := []struct {
+		method string
+		code   int
+	}{
+		{fasthttp.MethodGet, fasthttp.StatusMovedPermanently},
+		{fasthttp.MethodPost, fasthttp.StatusNotFound},
+		{"RPC", fasthttp.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI("/path/")
+		r.Handler(ctx)
+
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s /path/ - status code == %d, want %d", test.method, status, test.code)
+		}
+	}
+}
+
+func TestRouterLowercaseRoutes(t *testing.T) {
+	handler := func(name string) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(name + " " + fmt.Sprint(ctx.UserValue("id")))
+		}
+	}
+
+	r := New()
+	r.LowercaseRoutes = true
+	r.GET("/Users/{id}", handler("user"))
+	r.Group("/API").GET("/Items/{id?}", handler("item"))
+	r.ANY("/Static/{id:*}", handler("static"))
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/users/5", fasthttp.StatusOK, "user 5"},
+		{"/USERS/AbC", fasthttp.StatusOK, "user AbC"},
+		{"/api/items", fasthttp.StatusOK, "item <nil>"},
+		{"/Api/ITEMS/X1", fasthttp.StatusOK, "item X1"},
+		{"/STATIC/Css/App.CSS", fasthttp.StatusOK, "static Css/App.CSS"},
+		{"/usersx/5", fasthttp.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
+
+		if ctx.Response.StatusCode() != test.code {
+			t.Errorf("%s - status code == %d, want %d", test.path, ctx.Response.StatusCode(), test.code)
+		} else if test.code == fasthttp.StatusOK && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s - body == %q, want %q", test.path, ctx.Response.Body(), test.body)
+		}
+	}
+
+	recv := catchPanic(func() {
+		r.GET("/users/{id}", handler("duplicate"))
+	})
+
+	if want := "a handler is already registered for path '/users/{id}' by the router, registering it again by the router"; fmt.Sprint(recv) != want {
+		t.Errorf("Expected panic %q, got %v", want, recv)
+	}
+}
+
+func TestRouterMatrixParams(t *testing.T) {
+	var values map[string]interface{}
+
+	handler := func(ctx *fasthttp.RequestCtx) {
+		values = make(map[string]interface{})
+		ctx.VisitUserValues(func(key []byte, value interface{}) {
+			values[string(key)] = value
+		})
+	}
+
+	r := New()
+	r.MatrixParams = true
+	r.GET("/users/{id}", handler)
+	r.ANY("/files/{filepath:*}", handler)
+
+	tests := []struct {
+		path   string
+		code   int
+		values map[string]interface{}
+	}{
+		{"/users;active/42;v=1", fasthttp.StatusOK, map[string]interface{}{
+			"id":                                    "42",
+			radix.MatrixParamKey("users", "active"): "",
+			radix.MatrixParamKey("id", "v"):         "1",
+		}},
+		{"/users/7;v=2", fasthttp.StatusOK, map[string]interface{}{
+			"id":                            "7",
+			radix.MatrixParamKey("id", "v"): "2",
+		}},
+		{"/files/a;x=1/b", fasthttp.StatusOK, map[string]interface{}{
+			"filepath":                            "a/b",
+			radix.MatrixParamKey("filepath", "x"): "1",
+		}},
+		{"/posts;v=1", fasthttp.StatusNotFound, nil},
+	}
+
+	for _, test := range tests {
+		values = nil
+
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
 
-	// route without param
-	router.Handle(method, "/user", wantHandle)
-	handle, _ = router.Lookup(reqMethod, "/user", ctx)
-	if handle == nil {
-		t.Fatal("Got no handle!")
-	} else {
-		handle(nil)
-		if !routed {
-			t.Fatal("Routing failed!")
+		if ctx.Response.StatusCode() != test.code {
+			t.Errorf("%s - status code == %d, want %d", test.path, ctx.Response.StatusCode(), test.code)
+			continue
 		}
-	}
 
-	for expectedKey, expectedVal := range wantParams {
-		if ctx.UserValue(expectedKey) != expectedVal {
-			t.Errorf("The values %s = %s is not save in context", expectedKey, expectedVal)
+		for key, want := range test.values {
+			if got := values[key]; got != want {
+				t.Errorf("%s - user value %q == %v, want %v", test.path, key, got, want)
+			}
 		}
 	}
+}
 
-	handle, tsr = router.Lookup(reqMethod, "/user/gopher/", ctx)
-	if handle != nil {
-		t.Fatalf("Got handle for unregistered pattern: %v", handle)
-	}
-	if !tsr {
-		t.Error("Got no TSR recommendation!")
-	}
+func TestRouterMatchTracer(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
 
-	handle, tsr = router.Lookup(reqMethod, "/nope", ctx)
-	if handle != nil {
-		t.Fatalf("Got handle for unregistered pattern: %v", handle)
+	r := New()
+	r.GET("/users/{id}", handlerFunc)
+	r.ANY("/files/{filepath:*}", handlerFunc)
+
+	var traces [][]string
+	r.MatchTracer = func(path string, steps []string) {
+		traces = append(traces, append([]string{path}, steps...))
 	}
-	if tsr {
-		t.Error("Got wrong TSR recommendation!")
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/files/a")
+	r.Handler(ctx)
+
+	want := [][]string{
+		{"/files/a", "root '/users/'"},
+		{"/files/a", "root '/files'", "static '/'", "wildcard '{filepath:*}'"},
 	}
-}
 
-func TestRouterLookup(t *testing.T) {
-	for _, method := range httpMethods {
-		testRouterLookupByMethod(t, method)
+	if !reflect.DeepEqual(traces, want) {
+		t.Errorf("traces == %q, want %q", traces, want)
 	}
 }
 
-func TestRouterMatchedRoutePath(t *testing.T) {
-	route1 := "/user/{name}"
-	routed1 := false
-	handle1 := func(ctx *fasthttp.RequestCtx) {
-		route := ctx.UserValue(MatchedRoutePathParam)
-		if route != route1 {
-			t.Fatalf("Wrong matched route: want %s, got %s", route1, route)
+func TestRouterLookupParams(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	r := New()
+	r.GET("/users/{id:[0-9]+}/posts/{post}", handlerFunc)
+	r.GET("/items/{name}-{id}", handlerFunc)
+	r.GET("/static", handlerFunc)
+	r.ANY("/files/{filepath:*}", handlerFunc)
+
+	tests := []struct {
+		method string
+		path   string
+		found  bool
+		tsr    bool
+		params radix.Params
+	}{
+		{fasthttp.MethodGet, "/users/1/posts/hello", true, false, radix.Params{{Key: "id", Value: "1"}, {Key: "post", Value: "hello"}}},
+		{fasthttp.MethodGet, "/items/report-42", true, false, radix.Params{{Key: "name", Value: "report"}, {Key: "id", Value: "42"}}},
+		{fasthttp.MethodGet, "/static", true, false, nil},
+		{fasthttp.MethodDelete, "/files/a/b", true, false, radix.Params{{Key: "filepath", Value: "a/b"}}},
+		{fasthttp.MethodGet, "/users/1/posts/hello/", false, true, nil},
+		{fasthttp.MethodGet, "/users/gopher/posts/hello", false, false, nil},
+		{"CUSTOM", "/static", false, false, nil},
+	}
+
+	for _, test := range tests {
+		handler, params, tsr := r.LookupParams(test.method, test.path)
+
+		if (handler != nil) != test.found || tsr != test.tsr {
+			t.Errorf("LookupParams(%s, %s) found, tsr == %v, %v, want %v, %v", test.method, test.path, handler != nil, tsr, test.found, test.tsr)
 		}
-		routed1 = true
-	}
 
-	route2 := "/user/{name}/details"
-	routed2 := false
-	handle2 := func(ctx *fasthttp.RequestCtx) {
-		route := ctx.UserValue(MatchedRoutePathParam)
-		if route != route2 {
-			t.Fatalf("Wrong matched route: want %s, got %s", route2, route)
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("LookupParams(%s, %s) params == %v, want %v", test.method, test.path, params, test.params)
 		}
-		routed2 = true
 	}
+}
 
-	route3 := "/"
-	routed3 := false
-	handle3 := func(ctx *fasthttp.RequestCtx) {
-		route := ctx.UserValue(MatchedRoutePathParam)
-		if route != route3 {
-			t.Fatalf("Wrong matched route: want %s, got %s", route3, route)
+func TestRouterMatch(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	r := New()
+	r.GET("/users/{id:[0-9]+}", handlerFunc)
+	r.POST("/users/{id?}", handlerFunc)
+	r.ANY("/files/{filepath:*}", handlerFunc)
+	r.HandleWhen(fasthttp.MethodPut, "/admin", handlerFunc, func(_ *fasthttp.RequestCtx) bool { return false })
+
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{fasthttp.MethodGet, "/users/1", true},
+		{fasthttp.MethodGet, "/users/gopher", false},
+		{fasthttp.MethodGet, "/users/1/", false},
+		{fasthttp.MethodPost, "/users", true},
+		{fasthttp.MethodPost, "/users/gopher", true},
+		{fasthttp.MethodDelete, "/users/1", false},
+		{fasthttp.MethodDelete, "/files/a/b", true},
+		{fasthttp.MethodPut, "/admin", true},
+		{"CUSTOM", "/users/1", false},
+	}
+
+	for _, test := range tests {
+		if got := r.Match(test.method, test.path); got != test.want {
+			t.Errorf("Match(%s, %s) == %v, want %v", test.method, test.path, got, test.want)
 		}
-		routed3 = true
 	}
 
-	router := New()
-	router.SaveMatchedRoutePath = true
-	router.Handle(fasthttp.MethodGet, route1, handle1)
-	router.Handle(fasthttp.MethodGet, route2, handle2)
-	router.Handle(fasthttp.MethodGet, route3, handle3)
+	allocs := testing.AllocsPerRun(100, func() {
+		r.Match(fasthttp.MethodPost, "/users/gopher")
+	})
 
-	ctx := new(fasthttp.RequestCtx)
+	if allocs != 0 {
+		t.Errorf("Match allocs == %v, want 0", allocs)
+	}
+}
 
-	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
-	ctx.Request.SetRequestURI("/user/gopher")
-	router.Handler(ctx)
-	if !routed1 || routed2 || routed3 {
-		t.Fatal("Routing failed!")
+func TestRouterLenAndMethods(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	r := New()
+
+	if n, methods := r.Len(), r.Methods(); n != 0 || len(methods) != 0 {
+		t.Errorf("Empty router - Len() == %d, Methods() == %v", n, methods)
 	}
 
-	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
-	ctx.Request.SetRequestURI("/user/gopher/details")
-	router.Handler(ctx)
-	if !routed2 || routed3 {
-		t.Fatal("Routing failed!")
+	r.GET("/users/{id?}", handlerFunc)
+	r.GET("/items", handlerFunc)
+	r.POST("/items", handlerFunc)
+	r.ANY("/any", handlerFunc)
+	r.Handle("CUSTOM", "/custom", handlerFunc)
+
+	r.Mutable(true)
+	r.GET("/items", handlerFunc)
+
+	if n := r.Len(); n != 5 {
+		t.Errorf("Len() == %d, want %d", n, 5)
 	}
 
-	ctx.Request.Header.SetMethod(fasthttp.MethodGet)
-	ctx.Request.SetRequestURI("/")
-	router.Handler(ctx)
-	if !routed3 {
-		t.Fatal("Routing failed!")
+	want := []string{MethodWild, "CUSTOM", fasthttp.MethodGet, fasthttp.MethodPost}
+	if methods := r.Methods(); !reflect.DeepEqual(methods, want) {
+		t.Errorf("Methods() == %v, want %v", methods, want)
 	}
 }
 
-func TestRouterServeFiles(t *testing.T) {
+func TestRouterFallback(t *testing.T) {
+	handlerFunc := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("route")
+	}
+
 	r := New()
+	r.GET("/path", handlerFunc)
+	r.POST("/post", handlerFunc)
+	r.Fallback = func(ctx *fasthttp.RequestCtx) bool {
+		if string(ctx.Path()) != "/pages/about" {
+			return false
+		}
 
-	recv := catchPanic(func() {
-		r.ServeFiles("/noFilepath", os.TempDir())
-	})
-	if recv == nil {
-		t.Fatal("registering path not ending with '{filepath:*}' did not panic")
+		ctx.SetBodyString("fallback")
+
+		return true
 	}
 
-	body := []byte("fake ico")
-	if err := os.WriteFile(os.TempDir()+"/favicon.ico", body, 0644); err != nil {
-		t.Fatal(err)
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{fasthttp.MethodGet, "/path", fasthttp.StatusOK, "route"},
+		{fasthttp.MethodGet, "/path/", fasthttp.StatusMovedPermanently, ""},
+		{fasthttp.MethodGet, "/PATH", fasthttp.StatusMovedPermanently, ""},
+		{fasthttp.MethodGet, "/post", fasthttp.StatusMethodNotAllowed, fasthttp.StatusMessage(fasthttp.StatusMethodNotAllowed)},
+		{fasthttp.MethodGet, "/pages/about", fasthttp.StatusOK, "fallback"},
+		{fasthttp.MethodGet, "/pages/unknown", fasthttp.StatusNotFound, fasthttp.StatusMessage(fasthttp.StatusNotFound)},
 	}
 
-	r.ServeFiles("/{filepath:*}", os.TempDir())
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		r.Handler(ctx)
 
-	assertWithTestServer(t, "GET /favicon.ico HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
-		br := bufio.NewReader(&rw.w)
-		var resp fasthttp.Response
-		if err := resp.Read(br); err != nil {
-			t.Fatalf("Unexpected error when reading response: %s", err)
-		}
-		if resp.Header.StatusCode() != 200 {
-			t.Fatalf("Unexpected status code %d. Expected %d", resp.Header.StatusCode(), 200)
+		if status := ctx.Response.StatusCode(); status != test.code {
+			t.Errorf("%s %s - status code == %d, want %d", test.method, test.path, status, test.code)
 		}
-		if !bytes.Equal(resp.Body(), body) {
-			t.Fatalf("Unexpected body %q. Expected %q", resp.Body(), string(body))
+
+		if test.body != "" && string(ctx.Response.Body()) != test.body {
+			t.Errorf("%s %s - body == %q, want %q", test.method, test.path, ctx.Response.Body(), test.body)
 		}
-	})
+	}
 }
 
-func TestRouterServeFS(t *testing.T) {
+func TestRouterValidate(t *testing.T) {
+	handler := func(_ *fasthttp.RequestCtx) {}
+
 	r := New()
+	r.GET("/users/{id}", handler)
+	r.GET("/files/{id:[0-9]{2}}/{name}", handler)
+
+	if err := r.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	r.GET("/a/{id}/b/{id}", handler)
+	r.POST("/c/{id}-{id:[0-9]+}/{name?}", handler)
+
+	err := r.Validate()
+	want := "GET /a/{id}/b/{id}: duplicate param 'id'\nPOST /c/{id}-{id:[0-9]+}/{name?}: duplicate param 'id'"
+
+	if err == nil || err.Error() != want {
+		t.Errorf("Validate() == %v, want %s", err, want)
+	}
+
+	r = New()
+	r.RejectDuplicateParams = true
+	r.GET("/users/{id}", handler)
 
 	recv := catchPanic(func() {
-		r.ServeFS("/noFilepath", fsTestFilesystem)
+		r.GET("/a/{id}/b/{id}", handler)
 	})
-	if recv == nil {
-		t.Fatal("registering path not ending with '{filepath:*}' did not panic")
-	}
 
-	body, err := os.ReadFile("LICENSE")
-	if err != nil {
-		t.Fatal(err)
+	if want := "duplicate param 'id' in path '/a/{id}/b/{id}'"; fmt.Sprint(recv) != want {
+		t.Errorf("Expected panic %q, got %v", want, recv)
 	}
+}
 
-	r.ServeFS("/{filepath:*}", fsTestFilesystem)
+func TestRouterWouldConflict(t *testing.T) {
+	newRouter := func() *Router {
+		r := New()
+		r.GET("/users/{id}", func(ctx *fasthttp.RequestCtx) {})
+		r.GET("/files/{filepath:*}", func(ctx *fasthttp.RequestCtx) {})
+		r.POST("/items/{page?}", func(ctx *fasthttp.RequestCtx) {})
+
+		return r
+	}
+
+	r := newRouter()
+
+	tests := []struct {
+		method   string
+		path     string
+		conflict bool
+	}{
+		{fasthttp.MethodGet, "/users/{id}", true},
+		{fasthttp.MethodGet, "/users/{name}", true},
+		{fasthttp.MethodGet, "/files/{other:*}", true},
+		{fasthttp.MethodPost, "/items", true},
+		{fasthttp.MethodGet, "users", true},
+		{"", "/users", true},
+		{fasthttp.MethodGet, "/users/{id}/posts", false},
+		{fasthttp.MethodPut, "/users/{id}", false},
+		{fasthttp.MethodGet, "/items", false},
+		{"PURGE", "/users/{id}", false},
+	}
+
+	for _, test := range tests {
+		conflict, msg := r.WouldConflict(test.method, test.path)
+		if conflict != test.conflict {
+			t.Errorf("%s %s - conflict == %v (%q), want %v", test.method, test.path, conflict, msg, test.conflict)
+		}
 
-	assertWithTestServer(t, "GET /LICENSE HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
-		br := bufio.NewReader(&rw.w)
-		var resp fasthttp.Response
-		if err := resp.Read(br); err != nil {
-			t.Fatalf("Unexpected error when reading response: %s", err)
+		if conflict != (msg != "") {
+			t.Errorf("%s %s - unexpected message %q", test.method, test.path, msg)
 		}
-		if resp.Header.StatusCode() != 200 {
-			t.Fatalf("Unexpected status code %d. Expected %d", resp.Header.StatusCode(), 200)
+
+		if !conflict {
+			continue
 		}
-		if !bytes.Equal(resp.Body(), body) {
-			t.Fatalf("Unexpected body %q. Expected %q", resp.Body(), string(body))
+
+		if recv := catchPanic(func() { newRouter().Handle(test.method, test.path, func(ctx *fasthttp.RequestCtx) {}) }); fmt.Sprint(recv) != msg {
+			t.Errorf("%s %s - message == %q, want %q", test.method, test.path, msg, recv)
 		}
-	})
+	}
+
+	if r.Len() != 3 || len(r.Methods()) != 2 {
+		t.Errorf("WouldConflict registered routes: %v", r.List())
+	}
+
+	if handler, _ := r.Lookup(fasthttp.MethodPut, "/users/1", nil); handler != nil {
+		t.Error("WouldConflict registered the PUT route")
+	}
 }
 
-func TestRouterServeFilesCustom(t *testing.T) {
+func TestRouterUnbalancedBraces(t *testing.T) {
+	handler := func(_ *fasthttp.RequestCtx) {}
+
+	for _, path := range []string{"/a/{id/b", "/a/{id}}", "/a/{id?/b", "/a/{id:[0-9]{2}/b"} {
+		r := New()
+
+		recv := catchPanic(func() {
+			r.GET(path, handler)
+		})
+
+		if want := "unbalanced braces in path '" + path + "'"; fmt.Sprint(recv) != want {
+			t.Errorf("Expected panic %q, got %v", want, recv)
+		}
+	}
+}
+
+func TestRouterExportAndImport(t *testing.T) {
+	handlers := map[string]fasthttp.RequestHandler{}
+
+	handler := func(name string) fasthttp.RequestHandler {
+		h := func(ctx *fasthttp.RequestCtx) {
+			ctx.SetBodyString(name)
+		}
+		handlers[name] = h
+
+		return h
+	}
+
 	r := New()
+	r.GET("/bar", handler("GET /bar"))
+	r.PATCH("/foo", handler("PATCH /foo"))
+	r.DELETE("/users/{id?}", handler("DELETE /users/{id?}"))
 
-	root := os.TempDir()
+	expected := []RouteInfo{
+		{Method: "DELETE", Path: "/users/{id?}", Paths: []string{"/users", "/users/{id}"}},
+		{Method: "GET", Path: "/bar", Paths: []string{"/bar"}},
+		{Method: "PATCH", Path: "/foo", Paths: []string{"/foo"}},
+	}
 
-	fs := &fasthttp.FS{
-		Root: root,
+	routes := r.Export()
+	if !reflect.DeepEqual(routes, expected) {
+		t.Fatalf("Router.Export() == %v, want %v", routes, expected)
 	}
 
-	recv := catchPanic(func() {
-		r.ServeFilesCustom("/noFilepath", fs)
+	r2 := New()
+	r2.ImportFrom(routes, func(method, path string) fasthttp.RequestHandler {
+		return handlers[method+" "+path]
 	})
-	if recv == nil {
-		t.Fatal("registering path not ending with '{filepath:*}' did not panic")
+
+	if !reflect.DeepEqual(r2.List(), r.List()) {
+		t.Errorf("Router.List() == %v, want %v", r2.List(), r.List())
 	}
-	body := []byte("fake ico")
-	ioutil.WriteFile(root+"/favicon.ico", body, 0644)
 
-	r.ServeFilesCustom("/{filepath:*}", fs)
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/bar", "GET /bar"},
+		{"PATCH", "/foo", "PATCH /foo"},
+		{"DELETE", "/users", "DELETE /users/{id?}"},
+		{"DELETE", "/users/1", "DELETE /users/{id?}"},
+	}
 
-	assertWithTestServer(t, "GET /favicon.ico HTTP/1.1\r\n\r\n", r.Handler, func(rw *readWriter) {
-		br := bufio.NewReader(&rw.w)
-		var resp fasthttp.Response
-		if err := resp.Read(br); err != nil {
-			t.Fatalf("Unexpected error when reading response: %s", err)
-		}
-		if resp.Header.StatusCode() != 200 {
-			t.Fatalf("Unexpected status code %d. Expected %d", resp.Header.StatusCode(), 200)
-		}
-		if !bytes.Equal(resp.Body(), body) {
-			t.Fatalf("Unexpected body %q. Expected %q", resp.Body(), string(body))
+	for _, test := range tests {
+		ctx := new(fasthttp.RequestCtx)
+		ctx.Request.Header.SetMethod(test.method)
+		ctx.Request.SetRequestURI(test.path)
+		r2.Handler(ctx)
+
+		if body := string(ctx.Response.Body()); body != test.body {
+			t.Errorf("%s %s - body == %q, want %q", test.method, test.path, body, test.body)
 		}
-	})
-}
+	}
 
-func TestRouterList(t *testing.T) {
-	expected := map[string][]string{
-		"GET":    {"/bar"},
-		"PATCH":  {"/foo"},
-		"POST":   {"/v1/users/{name}/{surname?}"},
-		"DELETE": {"/v1/users/{id?}"},
+	if err := catchPanic(func() {
+		New().ImportFrom(routes, func(method, path string) fasthttp.RequestHandler { return nil })
+	}); err == nil {
+		t.Error("an error was expected with a nil handler")
 	}
+}
 
-	r := New()
-	r.GET("/bar", func(ctx *fasthttp.RequestCtx) {})
-	r.PATCH("/foo", func(ctx *fasthttp.RequestCtx) {})
+func TestRouterExportMutable(t *testing.T) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
 
-	v1 := r.Group("/v1")
-	v1.POST("/users/{name}/{surname?}", func(ctx *fasthttp.RequestCtx) {})
-	v1.DELETE("/users/{id?}", func(ctx *fasthttp.RequestCtx) {})
+	r := New()
+	r.Mutable(true)
+	r.GET("/bar", handlerFunc)
+	r.GET("/users/{id?}", handlerFunc)
+	r.GET("/bar", handlerFunc)
+	r.GET("/users/{id?}", handlerFunc)
 
-	result := r.List()
+	expected := []RouteInfo{
+		{Method: "GET", Path: "/bar", Paths: []string{"/bar"}},
+		{Method: "GET", Path: "/users/{id?}", Paths: []string{"/users", "/users/{id}"}},
+	}
 
-	if !reflect.DeepEqual(result, expected) {
-		t.Errorf("Router.List() == %v, want %v", result, expected)
+	if routes := r.Export(); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Router.Export() == %v, want %v", routes, expected)
 	}
 
+	if paths := r.List()["GET"]; !reflect.DeepEqual(paths, []string{"/bar", "/users/{id?}"}) {
+		t.Errorf("Router.List() == %v, want %v", paths, []string{"/bar", "/users/{id?}"})
+	}
 }
 
 func TestRouterSamePrefixParamRoute(t *testing.T) {
@@ -1139,6 +3852,47 @@ func BenchmarkAllowed(b *testing.B) {
 			_ = router.allowed("/path", fasthttp.MethodOptions)
 		}
 	})
+
+	for _, method := range httpMethods {
+		if method != fasthttp.MethodOptions {
+			router.Handle(method, "/users/{id}/{name}", handlerFunc)
+		}
+	}
+
+	b.Run("PathParams", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = router.allowed("/users/1/gopher", fasthttp.MethodOptions)
+		}
+	})
+}
+
+func BenchmarkRouterMatch(b *testing.B) {
+	handlerFunc := func(_ *fasthttp.RequestCtx) {}
+
+	r := New()
+	r.GET("/hello", handlerFunc)
+	r.GET("/users/{id}/{name}", handlerFunc)
+	r.ANY("/files/{filepath:*}", handlerFunc)
+
+	b.Run("Static", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = r.Match(fasthttp.MethodGet, "/hello")
+		}
+	})
+	b.Run("Params", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = r.Match(fasthttp.MethodGet, "/users/1/gopher")
+		}
+	})
+	b.Run("Wildcard", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = r.Match(fasthttp.MethodPost, "/files/a/b")
+		}
+	})
 }
 
 func BenchmarkRouterGet(b *testing.B) {
@@ -1232,12 +3986,17 @@ func BenchmarkRouterRedirectTrailingSlash(b *testing.B) {
 	r := New()
 	r.GET("/bench/", func(ctx *fasthttp.RequestCtx) {})
 
-	ctx := new(fasthttp.RequestCtx)
-	ctx.Request.Header.SetMethod("GET")
-	ctx.Request.SetRequestURI("/bench")
+	for _, uri := range []string{"/bench", "/bench?page=1&sort=name", "/BENCH/?page=1&sort=name"} {
+		b.Run(uri, func(b *testing.B) {
+			ctx := new(fasthttp.RequestCtx)
+			ctx.Request.Header.SetMethod("GET")
+			ctx.Request.SetRequestURI(uri)
 
-	for i := 0; i < b.N; i++ {
-		r.Handler(ctx)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r.Handler(ctx)
+			}
+		})
 	}
 }
 
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"time"
+
 	"github.com/fasthttp/router/radix"
 	"github.com/valyala/fasthttp"
 )
@@ -12,6 +14,19 @@ type Router struct {
 	treeMutable        bool
 	customMethodsIndex map[string]int
 	registeredPaths    map[string][]string
+	routeHandlers      map[string]map[string]routeHandler
+	optionalPaths      map[string]map[string]string
+	paramDecoders      map[string]ParamDecoderFunc
+	routeNames         map[string]RouteInfo
+	groupNotFound      []groupHandler
+	autoOptions        *radix.Tree
+	deferSort          bool
+
+	// The methods of the routes by path, to look up the allowed methods
+	// of a path at once, unless the routes could not live in a single tree
+	methodsTree   *radix.Tree
+	pathMethods   map[string][]string
+	noMethodsTree bool
 
 	// If enabled, adds the matched route path onto the ctx.UserValue context
 	// before invoking the handler.
@@ -19,13 +34,52 @@ type Router struct {
 	// registered when this option was enabled.
 	SaveMatchedRoutePath bool
 
+	// If enabled, adds the path prefix of the group of the matched route
+	// (e.g. '/api/v1') onto the ctx.UserValue context before invoking
+	// the handler, for the routes registered with a group with prefix.
+	// It's only added to handlers of routes that were registered
+	// when this option was enabled.
+	SaveMatchedGroupPrefix bool
+
 	// Enables automatic redirection if the current route can't be matched but a
 	// handler for the path with (without) the trailing slash exists.
 	// For example if /foo/ is requested but a route only exists for /foo, the
 	// client is redirected to /foo with http status code 301 for GET requests
 	// and 308 for all other request methods.
+	// The root path with a trailing slash (//) is redirected to / as well,
+	// but the root path / itself is never redirected.
+	// If both /foo and /foo/ are registered, they are distinct routes,
+	// so none of them is redirected to the other one.
 	RedirectTrailingSlash bool
 
+	// Limits the trailing slash redirection to the request methods in the list,
+	// for example to only redirect the safe methods (GET and HEAD).
+	// If nil, the redirection applies to all methods.
+	RedirectTrailingSlashMethods []string
+
+	// The request methods whose routes never redirect a trailing slash,
+	// like CONNECT or custom RPC methods, so their trees don't record the
+	// trailing slash redirections, which saves memory.
+	// It must be set before registering the routes of the methods.
+	DisableTSRMethods []string
+
+	// If enabled, the static parts of the routes are lowercased when
+	// registering them, and the request paths are matched case-insensitively,
+	// so registering '/Users/{id}' and '/users/{id}' conflicts and
+	// '/USERS/5' matches '/users/{id}'. The param values keep their case.
+	// Unlike RedirectFixedPath, the request is not redirected.
+	// It must be set before registering any route.
+	LowercaseRoutes bool
+
+	// If enabled, the matrix params of each request path segment
+	// (e.g. '/users;active/42;v=1') are removed before matching the path,
+	// and saved as ctx.UserValue with the key '<segment>;<key>', where the
+	// segment is the param name of a param segment of the matched route
+	// (e.g. 'id;v' for '/users/{id}'), or its pattern text otherwise
+	// (e.g. 'users;active'). See radix.MatrixParamKey.
+	// It must be set before registering any route.
+	MatrixParams bool
+
 	// If enabled, the router tries to fix the current request path, if no
 	// handle is registered for it.
 	// First superfluous path elements like ../ or // are removed.
@@ -37,6 +91,68 @@ type Router struct {
 	// RedirectTrailingSlash is independent of this option.
 	RedirectFixedPath bool
 
+	// If enabled along with RedirectFixedPath, the fixed path is also looked
+	// up in the routes of the other methods, when it's not found in the routes
+	// of the request method. For example a GET request to /USERS is redirected
+	// to /users if there is only a POST route for /users, where it's replied
+	// with 405 Method Not Allowed, instead of being not found.
+	RedirectFixedPathAnyMethod bool
+
+	// If enabled, the repeated slashes of the request path are collapsed
+	// before matching it, instead of redirecting to the fixed path.
+	// For example /users//42 matches /users/{id} and /a///b matches /a/b.
+	// The handlers still see the original request path.
+	CleanPath bool
+
+	// If set, it returns the path to route for the request, instead of the
+	// original path of the request uri (e.g. a path sent by a proxy in a
+	// header). The returned path is validated like the request path, and an
+	// empty path is routed as the root path.
+	// The path auto-correction (RedirectTrailingSlash and RedirectFixedPath)
+	// is disabled, since a path fixed from the returned one could not be
+	// mapped back onto the request uri (e.g. if a prefix is stripped).
+	PathExtractor func(ctx *fasthttp.RequestCtx) string
+
+	// If enabled, the percent-encoded chars of the path param values are
+	// decoded before invoking the handler (and the ParamDecoders), so '{name}'
+	// captures 'hello world' from '/hello%20world'. The routes are still
+	// matched against the raw request path, so an encoded slash (%2F) doesn't
+	// split a path segment. An invalid encoding is handled like a
+	// ParamDecoder error. It's disabled by default, so the values are raw.
+	DecodeParams bool
+
+	// If greater than zero, registering a route panics if the regex of any
+	// of its params compiles to a program with more instructions
+	// (see radix.Tree.MaxRegexProgramSize).
+	MaxRegexProgramSize int
+
+	// If enabled, registering a route with the same param name more than once
+	// in its path (e.g. /a/{id}/b/{id}) panics, since the last value would
+	// overwrite the others in the ctx.UserValue.
+	// Router.Validate reports them as well.
+	RejectDuplicateParams bool
+
+	// If enabled, the host of the request is taken from the X-Forwarded-Host
+	// header, when present, instead of the Host header. The resolved host is
+	// saved in the ctx.UserValue with the key RequestHostParam before invoking
+	// the handler, so it's available to middleware.
+	// Only enable it behind a trusted proxy which sets the header, since
+	// otherwise the clients could spoof it.
+	TrustForwardedHost bool
+
+	// If enabled, the scheme of the request is taken from the
+	// X-Forwarded-Proto header, when present, to check if the request is
+	// secure for the routes registered with RouteBuilder.Secure.
+	// Only enable it behind a trusted proxy which terminates TLS and sets
+	// the header, since otherwise the clients could spoof it.
+	TrustForwardedProto bool
+
+	// If enabled, the insecure requests of the routes registered with
+	// RouteBuilder.Secure are redirected to the same URL with the https
+	// scheme, instead of replying with 403 Forbidden.
+	// The host of the redirection is resolved by Router.RequestHost.
+	RedirectInsecure bool
+
 	// If enabled, the router checks if another method is allowed for the
 	// current route, if the current request can not be routed.
 	// If this is the case, the request is answered with 'Method Not Allowed'
@@ -49,23 +165,81 @@ type Router struct {
 	// Custom OPTIONS handlers take priority over automatic replies.
 	HandleOPTIONS bool
 
+	// If enabled, the "Allow" header is automatically set before calling
+	// the custom OPTIONS handler of the path, so it could only add
+	// its own headers (e.g. CORS).
+	AutoAllowWithCustomOPTIONS bool
+
+	// If enabled, the HEAD method is advertised in the "Allow" header
+	// for every path which has a GET handler.
+	AdvertiseHEAD bool
+
+	// If enabled, the HEAD requests of the paths without a HEAD handler
+	// are served by their GET handler, whose response body is skipped
+	// while keeping its headers, including the "Content-Length".
+	AutoHEAD bool
+
 	// An optional fasthttp.RequestHandler that is called on automatic OPTIONS requests.
 	// The handler is only called if HandleOPTIONS is true and no OPTIONS
 	// handler for the specific path was set.
 	// The "Allowed" header is set before calling the handler.
 	GlobalOPTIONS fasthttp.RequestHandler
 
+	// If enabled, the router replies with 501 Not Implemented to the requests
+	// with a method unknown by the router, which is neither a standard method
+	// nor a registered custom method, if no ANY route matches the path.
+	// The "Allow" header is set with the allowed methods of the path, if any.
+	UnknownMethod501 bool
+
+	// Configurable function which is called when no matching route is found,
+	// neither a redirection nor a 405/OPTIONS reply applies, right before
+	// the NotFound handler (e.g. to look up database-backed pages).
+	// It must return true if it handled the request, otherwise the request
+	// is handled by the NotFound handler, so it must not write the response.
+	Fallback func(ctx *fasthttp.RequestCtx) bool
+
 	// Configurable fasthttp.RequestHandler which is called when no matching route is
 	// found. If it is not set, default NotFound is used.
+	// The NotFound handlers of the groups take precedence for their paths.
 	NotFound fasthttp.RequestHandler
 
+	// The body of the default NotFound response, instead of the status
+	// message, with the given content type if not empty (e.g. a JSON error
+	// for an API). It's not used when the NotFound handler is set.
+	NotFoundBody        []byte
+	NotFoundContentType string
+
+	// If greater than zero, the requests with a longer path are
+	// rejected as bad requests before routing them.
+	MaxPathLength int
+
+	// Configurable fasthttp.RequestHandler which is called when the request path
+	// is not valid, before routing it. A valid path begins with '/' (or it's
+	// the server-wide '*'), has no null bytes and doesn't exceed MaxPathLength.
+	// The empty path is valid, since it's routed as the root path.
+	// If it is not set, ctx.Error with fasthttp.StatusBadRequest is used.
+	BadRequestHandler fasthttp.RequestHandler
+
 	// Configurable fasthttp.RequestHandler which is called when a request
 	// cannot be routed and HandleMethodNotAllowed is true.
 	// If it is not set, ctx.Error with fasthttp.StatusMethodNotAllowed is used.
 	// The "Allow" header with allowed request methods is set before the handler
-	// is called.
+	// is called, and the allowed methods are also stored as []string under
+	// the AllowedMethodsParam user value.
 	MethodNotAllowed fasthttp.RequestHandler
 
+	// The body of the default 'Method Not Allowed' response, instead of the
+	// status message, with the given content type if not empty, like
+	// NotFoundBody. The "Allow" header is still set.
+	// It's not used when the MethodNotAllowed handler is set.
+	MethodNotAllowedBody        []byte
+	MethodNotAllowedContentType string
+
+	// Configurable handler which is called when a param decoder, registered
+	// with Router.ParamDecoder, fails to decode a param value.
+	// If it is not set, ctx.Error with fasthttp.StatusBadRequest is used.
+	ParamDecodeError func(*fasthttp.RequestCtx, error)
+
 	// Function to handle panics recovered from http handlers.
 	// It should be used to generate a error page and return the http error code
 	// 500 (Internal Server Error).
@@ -73,12 +247,254 @@ type Router struct {
 	// unrecovered panics.
 	PanicHandler func(*fasthttp.RequestCtx, interface{})
 
+	// If enabled, the panics recovered from http handlers are handled even
+	// without PanicHandler, by logging them with their stack trace with the
+	// ctx logger and replying 500 (Internal Server Error).
+	// If PanicHandler is set, it's used instead of the default recovery.
+	// When both are unset, the panics are not recovered.
+	RecoverPanics bool
+
+	// Function to wrap each named group middleware, added with
+	// Group.AddNamedMiddleware, when a route is registered.
+	// The returned handler runs the middleware, so it's useful to trace
+	// them (e.g. with a span per middleware). The unnamed ones are not wrapped.
+	MiddlewareWrapper func(name string, next fasthttp.RequestHandler) fasthttp.RequestHandler
+
+	// Function to debug which route matches a request, which is called with
+	// the steps of each tree lookup done by the Handler, so up to twice per
+	// request (method and ANY trees). The steps are the tree nodes compared
+	// in order (e.g. "static '/users/'" or "param '{id}'").
+	// It's disabled by default, since the steps are allocated on each request.
+	// When it's not set, the lookups only check it once per compared node.
+	MatchTracer func(path string, steps []string)
+
+	// Function which is called for every request which could not be
+	// dispatched to a route, with the kind of the miss (e.g. to count the
+	// not found method and path combinations in the metrics).
+	// It's called after the request is replied by the corresponding
+	// handler or redirection, which still work as usual, so it could read
+	// the response. The requests handled by the Fallback are not misses.
+	OnMiss func(ctx *fasthttp.RequestCtx, kind MissKind)
+
 	// Cached value of global (*) allowed methods
 	globalAllowed string
 }
 
+// groupHandler is a handler of the paths under a group prefix
+type groupHandler struct {
+	prefix  string
+	handler fasthttp.RequestHandler
+}
+
+// routeHandler is the handler of a registered route,
+// as it was given to the router
+type routeHandler struct {
+	handler   fasthttp.RequestHandler
+	predicate radix.Predicate
+	priority  int
+
+	// If true, the route is only matched by its exact path,
+	// without any redirection to it
+	exact bool
+
+	// If true, the requests are not redirected to the route
+	// by RedirectFixedPath
+	noFixedPath bool
+
+	// The matchers of the route params by key
+	matchers map[string]radix.Matcher
+
+	// The config of the automatic OPTIONS replies of the route path, if any
+	autoOptions *CORSConfig
+
+	// The group which registered the route, or nil for the router,
+	// to describe it in the conflict errors
+	group *Group
+
+	// The default values of the optional params (e.g. '{page?=1}')
+	defaults []paramDefault
+}
+
+// paramDefault is the default value of an optional param,
+// used when the param is absent from the request path
+type paramDefault struct {
+	key   string
+	value string
+}
+
+// Route is a route definition to register routes in bulk with Group.Routes
+type Route struct {
+	// Method is the HTTP method of the route
+	Method string
+
+	// Path is the path of the route, relative to the group
+	Path string
+
+	// Handler is the request handler of the route
+	Handler fasthttp.RequestHandler
+}
+
+// RouteSpec is a declarative route definition to register routes in bulk
+// with Router.Register, e.g. from generated code
+type RouteSpec struct {
+	// Method is the HTTP method of the route
+	Method string
+
+	// Path is the path of the route, relative to the group
+	Path string
+
+	// Handler is the request handler of the route
+	Handler fasthttp.RequestHandler
+
+	// Middleware are the middleware of the route, which run inside
+	// the middleware of its group, so the first one is the outermost
+	Middleware []Middleware
+
+	// Name is the optional name of the route, to look it up
+	// with Router.NamedRoute
+	Name string
+}
+
+// RouteBuilder configures a route before registering it with Done,
+// chaining its setters:
+//
+//	router.Route(fasthttp.MethodGet, "/users/{id}", getUser).
+//		Name("user").
+//		Timeout(time.Second).
+//		Done()
+type RouteBuilder struct {
+	group   *Group
+	method  string
+	path    string
+	handler fasthttp.RequestHandler
+
+	name        string
+	timeout     time.Duration
+	middleware  []Middleware
+	predicate   radix.Predicate
+	priority    int
+	maxBodySize int
+	exact       bool
+	noFixedPath bool
+	secure      bool
+	matchers    map[string]radix.Matcher
+	autoOptions *CORSConfig
+
+	registered bool
+}
+
+// MissKind is the kind of a request which could not be dispatched to a route
+type MissKind uint8
+
+// CORSConfig is the config of the CORS preflight replies of a route,
+// registered with RouteBuilder.AutoOptions
+type CORSConfig struct {
+	// AllowOrigins are the origins allowed to request the route.
+	// If empty, or if it includes "*", all the origins are allowed.
+	AllowOrigins []string
+
+	// AllowHeaders are the request headers allowed in the requests
+	// of the route, besides the CORS-safelisted ones
+	AllowHeaders []string
+
+	// AllowCredentials allows the requests with credentials
+	// (e.g. cookies), so the origin is never replied as "*"
+	AllowCredentials bool
+
+	// MaxAge is how long the preflight reply could be cached,
+	// or zero to not send it
+	MaxAge time.Duration
+}
+
+// MediaTypeHandler is the request handler of a media type, to register
+// a route negotiated by the Accept header with Router.HandleNegotiated
+type MediaTypeHandler struct {
+	// MediaType is the media type served by the handler (e.g. application/json)
+	MediaType string
+
+	// Handler is the request handler of the media type
+	Handler fasthttp.RequestHandler
+}
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	// Method is the HTTP method of the route
+	Method string `json:"method"`
+
+	// Path is the path of the route as it was registered
+	Path string `json:"path"`
+
+	// Paths are the paths registered in the tree for the route,
+	// which are the expanded optional paths
+	Paths []string `json:"paths"`
+}
+
+// RequestMeta is the data saved by the router for the request,
+// apart from the path params. Each field is empty if it's not saved.
+type RequestMeta struct {
+	// MatchedRoutePath is the path of the matched route,
+	// if Router.SaveMatchedRoutePath is set
+	MatchedRoutePath string
+
+	// MatchedGroupPrefix is the path prefix of the group of the matched
+	// route, if Router.SaveMatchedGroupPrefix or Group.SaveMatchedGroupPrefix is set
+	MatchedGroupPrefix string
+
+	// RequestHost is the host of the request,
+	// if Router.TrustForwardedHost is set
+	RequestHost string
+
+	// AllowedMethods are the allowed methods of the path,
+	// when the Router.MethodNotAllowed handler is called
+	AllowedMethods []string
+}
+
+// ParamDecoderFunc decodes the raw value of a path param
+type ParamDecoderFunc func(value string) (interface{}, error)
+
+// Middleware wraps a request handler with additional behaviour
+type Middleware func(fasthttp.RequestHandler) fasthttp.RequestHandler
+
+// namedMiddleware is a group middleware with its name,
+// which is empty for the unnamed ones
+type namedMiddleware struct {
+	name       string
+	middleware Middleware
+}
+
+// ErrRequestHandler is a request handler which returns an error,
+// which is passed to the Group.ErrorHandler
+type ErrRequestHandler func(ctx *fasthttp.RequestCtx) error
+
 // Group is a sub-router to group paths
 type Group struct {
-	router *Router
-	prefix string
+	router     *Router
+	prefix     string
+	middleware []namedMiddleware
+
+	// The buffer of the full paths of the group routes, which begin
+	// with the prefix, so they are built without allocating each one
+	paths []byte
+
+	// If enabled, adds the matched route path onto the ctx.UserValue context
+	// before invoking the handler of the group routes.
+	// It has no effect when Router.SaveMatchedRoutePath is enabled,
+	// since the router already saves it for all routes.
+	// The matched route path is only added to handlers of routes that were
+	// registered when this option was enabled.
+	SaveMatchedRoutePath bool
+
+	// If enabled, adds the path prefix of the group onto the ctx.UserValue
+	// context before invoking the handler of the group routes, like
+	// Router.SaveMatchedGroupPrefix. It's inherited by the subgroups,
+	// which save their own prefix, and only used by the routes
+	// registered afterwards.
+	SaveMatchedGroupPrefix bool
+
+	// Configurable function to handle the errors returned by the handlers
+	// registered with HandleErr and its shortcuts (e.g. GETErr).
+	// If it's nil, the errors are replied with 500 Internal Server Error.
+	// It's inherited by the subgroups, and only used by the routes
+	// registered afterwards.
+	ErrorHandler func(ctx *fasthttp.RequestCtx, err error)
 }
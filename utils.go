@@ -1,6 +1,23 @@
 package router
 
-import "strings"
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fasthttp/router/radix"
+	strconvpkg "github.com/savsgio/gotils/strconv"
+	gstrings "github.com/savsgio/gotils/strings"
+	"github.com/valyala/bytebufferpool"
+	"github.com/valyala/fasthttp"
+)
 
 func validatePath(path string) {
 	switch {
@@ -8,3 +25,733 @@ func validatePath(path string) {
 		panic("path must begin with '/' in path '" + path + "'")
 	}
 }
+
+// isValidMethod checks if the method is an uppercase HTTP token,
+// since the methods are matched case-sensitively, so a lowercase or
+// whitespace-padded method (e.g. 'get' or ' GET') would never match
+func isValidMethod(method string) bool {
+	for i := 0; i < len(method); i++ {
+		c := method[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`~", c) > -1:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// isValidMethodSet checks if each method of the set of methods
+// (e.g. 'GET|HEAD') is valid, see isValidMethod
+func isValidMethodSet(methods string) bool {
+	for _, method := range strings.Split(methods, "|") {
+		if len(method) == 0 || !isValidMethod(method) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// duplicateParamKey returns the first param key which appears
+// more than once in the path, or an empty string if there is none
+func duplicateParamKey(path string) string {
+	keys := radix.PathParamKeys(path)
+
+	for i, key := range keys {
+		for _, prevKey := range keys[:i] {
+			if key == prevKey {
+				return key
+			}
+		}
+	}
+
+	return ""
+}
+
+// pathMatchers returns the param matchers of the params of the path,
+// which could be an optional path without some of the route params
+func pathMatchers(path string, matchers map[string]radix.Matcher) map[string]radix.Matcher {
+	keys := radix.PathParamKeys(path)
+	pm := make(map[string]radix.Matcher, len(matchers))
+
+	for key, m := range matchers {
+		if gstrings.Include(keys, key) {
+			pm[key] = m
+		}
+	}
+
+	return pm
+}
+
+// hasParamKey checks if the path has a param with the given key,
+// including the optional ones
+func hasParamKey(path, key string) bool {
+	paths := getOptionalPaths(path)
+	if len(paths) == 0 {
+		paths = append(paths, path)
+	}
+
+	for _, p := range paths {
+		if gstrings.Include(radix.PathParamKeys(p), key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// positionalParams returns the path with its params named by their position
+// (e.g. '/users/{id:[0-9]+}' is '/users/{0:[0-9]+}'), so the paths which
+// only differ by the param names are equal
+func positionalParams(path string) string {
+	if strings.IndexByte(path, '{') == -1 {
+		return path
+	}
+
+	b := make([]byte, 0, len(path))
+	depth, n := 0, 0
+
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+
+		switch {
+		case c == '{':
+			depth++
+
+			if depth == 1 {
+				b = append(b, c)
+				b = strconv.AppendInt(b, int64(n), 10)
+				n++
+
+				// Skip the name
+				for i+1 < len(path) && path[i+1] != ':' && path[i+1] != '}' {
+					i++
+				}
+
+				continue
+			}
+		case c == '}':
+			depth--
+		}
+
+		b = append(b, c)
+	}
+
+	return string(b)
+}
+
+// hasPathPrefix checks if the path is under the given group prefix,
+// which must match whole path segments (e.g. '/api' matches '/api/users'
+// but not '/apis'). The prefix is matched segment by segment, so its param
+// segments match any segment (e.g. '/users/{id}' matches '/users/5/posts'),
+// without checking their regex, and the optional ones could be absent.
+func hasPathPrefix(path, prefix string) bool {
+	if strings.IndexByte(prefix, '{') == -1 {
+		if !strings.HasPrefix(path, prefix) {
+			return false
+		}
+
+		return len(path) == len(prefix) || path[len(prefix)] == '/' || strings.HasSuffix(prefix, "/")
+	}
+
+	return hasSegmentsPrefix(path, prefix)
+}
+
+// hasSegmentsPrefix checks if the path is under the prefix like
+// hasPathPrefix, matching the first segment of the prefix and then the rest.
+// The path is empty or begins with '/', like the prefix.
+func hasSegmentsPrefix(path, prefix string) bool {
+	switch prefix {
+	case "":
+		return true
+	case "/":
+		return len(path) > 0
+	}
+
+	end := prefixSegmentEnd(prefix)
+	segment, rest := prefix[1:end], prefix[end:]
+
+	if isOptionalSegment(segment) && hasSegmentsPrefix(path, rest) {
+		return true
+	} else if len(path) == 0 {
+		return false
+	}
+
+	valueEnd := strings.IndexByte(path[1:], '/') + 1
+	if valueEnd == 0 {
+		valueEnd = len(path)
+	}
+
+	value := path[1:valueEnd]
+
+	if strings.IndexByte(segment, '{') == -1 {
+		if value != segment {
+			return false
+		}
+	} else if value == "" {
+		return false
+	}
+
+	return hasSegmentsPrefix(path[valueEnd:], rest)
+}
+
+// prefixSegmentEnd returns the end index of the first segment of the prefix,
+// skipping the slashes inside the param braces (e.g. a regex)
+func prefixSegmentEnd(prefix string) int {
+	braces := 0
+
+	for i := 1; i < len(prefix); i++ {
+		switch prefix[i] {
+		case '{':
+			braces++
+		case '}':
+			braces--
+		case '/':
+			if braces == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(prefix)
+}
+
+// isOptionalSegment checks if the path segment is an optional param
+// (e.g. '{tab?}', '{tab?:[a-z]+}' or '{page?=1}')
+func isOptionalSegment(segment string) bool {
+	if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+		return false
+	}
+
+	key := segment[1:]
+	if i := strings.IndexAny(key, ":}"); i > -1 {
+		key = key[:i]
+	}
+
+	return strings.IndexByte(key, '?') > -1
+}
+
+// staticPath returns the files path for the given url prefix,
+// appending the filepath wildcard suffix
+func staticPath(urlPrefix string) string {
+	return prefixPath(urlPrefix, filepathSuffix)
+}
+
+// mountPath returns the mount path for the given prefix,
+// appending the mount wildcard suffix
+func mountPath(prefix string) string {
+	return prefixPath(prefix, mountSuffix)
+}
+
+// prefixPath returns the path for the given url prefix with the given suffix
+func prefixPath(urlPrefix, suffix string) string {
+	validatePath(urlPrefix)
+
+	if strings.ContainsAny(urlPrefix, "{}") {
+		panic("url prefix must not contain wildcards in path '" + urlPrefix + "'")
+	}
+
+	return strings.TrimSuffix(urlPrefix, "/") + suffix
+}
+
+// isValidRequestPath checks if the request path could be routed.
+// It must begin with '/' (or be the server-wide '*'), must not contain
+// null bytes, neither encoded, and must not exceed the max length,
+// if greater than zero.
+func isValidRequestPath(path string, maxLength int) bool {
+	switch {
+	case maxLength > 0 && len(path) > maxLength:
+		return false
+	case path[0] != '/' && path != "*":
+		return false
+	default:
+		return strings.IndexByte(path, 0) == -1 && !strings.Contains(path, "%00")
+	}
+}
+
+// replyBody replies with the status code and the given body, or its status
+// message if nil, keeping the headers already set (e.g. "Allow").
+// The content type is only set if not empty.
+func replyBody(ctx *fasthttp.RequestCtx, code int, body []byte, contentType string) {
+	ctx.SetStatusCode(code)
+
+	if body == nil {
+		ctx.SetBodyString(fasthttp.StatusMessage(code))
+		return
+	}
+
+	ctx.SetBody(body)
+
+	if contentType != "" {
+		ctx.SetContentType(contentType)
+	}
+}
+
+// defaultErrorHandler replies the errors returned by the group handlers
+// with 500 Internal Server Error, without exposing them
+func defaultErrorHandler(ctx *fasthttp.RequestCtx, _ error) {
+	ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+}
+
+// defaultPanicHandler logs the recovered panic with its stack trace,
+// and replies with 500 Internal Server Error
+func defaultPanicHandler(ctx *fasthttp.RequestCtx, rcv interface{}) {
+	replyPanic(ctx, ctx.Logger(), rcv)
+}
+
+// replyPanic logs the recovered panic with its stack trace into the logger,
+// and replies with 500 Internal Server Error
+func replyPanic(ctx *fasthttp.RequestCtx, logger fasthttp.Logger, rcv interface{}) {
+	logger.Printf("panic recovered: %v\n%s", rcv, debug.Stack())
+	ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+}
+
+// newParamHandler returns a handler which calls the given params-aware
+// handler with the params saved by the router for the request
+func newParamHandler(handler radix.ParamHandler) fasthttp.RequestHandler {
+	if handler == nil {
+		panic("handler must not be nil")
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		var ps radix.Params
+		if d := getRequestData(ctx); d != nil {
+			ps = d.params
+		}
+
+		handler(ctx, ps)
+	}
+}
+
+// newMountHandler returns a handler which strips the mount prefix
+// from the request path before invoking the given handler,
+// restoring the original path once it returns
+func newMountHandler(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	if handler == nil {
+		panic("handler must not be nil")
+	}
+
+	return func(ctx *fasthttp.RequestCtx) {
+		uri := ctx.Request.URI()
+
+		original := bytebufferpool.Get()
+		original.Write(uri.PathOriginal())
+
+		defer func() {
+			uri.SetPathBytes(original.B)
+			bytebufferpool.Put(original)
+		}()
+
+		path, _ := ctx.UserValue(mountPathParam).(string)
+		uri.SetPath("/" + path)
+
+		handler(ctx)
+	}
+}
+
+// newFilesFS returns the default file system settings to serve files
+// from the given root path
+func newFilesFS(rootPath string) *fasthttp.FS {
+	return &fasthttp.FS{
+		Root:               rootPath,
+		IndexNames:         []string{"index.html"},
+		GenerateIndexPages: true,
+		AcceptByteRange:    true,
+	}
+}
+
+// newFilesystemFS returns the default file system settings to serve files
+// from the given file system
+func newFilesystemFS(filesystem fs.FS) *fasthttp.FS {
+	return &fasthttp.FS{
+		FS:                 filesystem,
+		Root:               "",
+		AllowEmptyRoot:     true,
+		IndexNames:         []string{"index.html"},
+		GenerateIndexPages: true,
+		AcceptByteRange:    true,
+		Compress:           true,
+		CompressBrotli:     true,
+	}
+}
+
+// newFilesHandler returns the handler to serve files with the given
+// file system settings. The path must end with "/{filepath:*}"
+func newFilesHandler(path string, fs *fasthttp.FS) fasthttp.RequestHandler {
+	if !strings.HasSuffix(path, filepathSuffix) {
+		panic("path must end with " + filepathSuffix + " in path '" + path + "'")
+	}
+
+	prefix := path[:len(path)-len(filepathSuffix)]
+	stripSlashes := strings.Count(prefix, "/")
+
+	if fs.PathRewrite == nil && stripSlashes > 0 {
+		fs.PathRewrite = fasthttp.NewPathSlashesStripper(stripSlashes)
+	}
+
+	return fs.NewRequestHandler()
+}
+
+// newSPAHandler returns the handler to serve the files of a single-page app,
+// which serves the index file when a file without extension is not found.
+// The path must end with "/{filepath:*}"
+func newSPAHandler(path string, fs *fasthttp.FS, indexFile string) fasthttp.RequestHandler {
+	if indexFile == "" {
+		panic("index file must not be empty in path '" + path + "'")
+	}
+
+	handler := newFilesHandler(path, fs)
+	indexPath := path[:len(path)-len(filepathSuffix)] + "/" + strings.TrimPrefix(indexFile, "/")
+
+	return func(ctx *fasthttp.RequestCtx) {
+		handler(ctx)
+
+		if ctx.Response.StatusCode() != fasthttp.StatusNotFound {
+			return
+		}
+
+		if filepath, _ := ctx.UserValue("filepath").(string); pathpkg.Ext(filepath) != "" {
+			// A missing asset
+			return
+		}
+
+		requestURI := append([]byte(nil), ctx.Request.RequestURI()...)
+
+		ctx.Response.Reset()
+		ctx.Request.URI().SetPath(indexPath)
+		handler(ctx)
+
+		ctx.Request.SetRequestURIBytes(requestURI)
+	}
+}
+
+// newCompressedFilesHandler returns the handler to serve files like
+// newFilesHandler, serving the pre-compressed sibling of the requested file
+// for the first of the given encodings accepted by the client, if present
+func newCompressedFilesHandler(path, rootPath string, fs *fasthttp.FS, encodings []string) fasthttp.RequestHandler {
+	if len(encodings) == 0 {
+		panic("encodings must not be empty in path '" + path + "'")
+	}
+
+	suffixes := make([]string, len(encodings))
+
+	for i, encoding := range encodings {
+		suffix, ok := compressedFileSuffixes[encoding]
+		if !ok {
+			panic("unsupported encoding '" + encoding + "' in path '" + path + "'")
+		}
+
+		suffixes[i] = suffix
+	}
+
+	handler := newFilesHandler(path, fs)
+	prefix := path[:len(path)-len(filepathSuffix)]
+
+	return func(ctx *fasthttp.RequestCtx) {
+		ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderAcceptEncoding)
+
+		name, _ := ctx.UserValue("filepath").(string)
+
+		for i, encoding := range encodings {
+			if !ctx.Request.Header.HasAcceptEncoding(encoding) {
+				continue
+			}
+
+			compressedName := pathpkg.Clean("/"+name) + suffixes[i]
+
+			info, err := os.Stat(filepath.Join(rootPath, filepath.FromSlash(compressedName)))
+			if err != nil || info.IsDir() {
+				continue
+			}
+
+			requestURI := append([]byte(nil), ctx.Request.RequestURI()...)
+
+			ctx.Request.URI().SetPath(prefix + compressedName)
+			handler(ctx)
+
+			ctx.Request.SetRequestURIBytes(requestURI)
+
+			if status := ctx.Response.StatusCode(); status == fasthttp.StatusOK || status == fasthttp.StatusPartialContent {
+				ctx.Response.Header.Set(fasthttp.HeaderContentEncoding, encoding)
+
+				if contentType := mime.TypeByExtension(pathpkg.Ext(name)); contentType != "" {
+					ctx.Response.Header.SetContentType(contentType)
+				}
+			}
+
+			return
+		}
+
+		handler(ctx)
+	}
+}
+
+// newCachedFilesHandler returns the handler to serve files like
+// newFilesHandler, with the ETag and Cache-Control headers for the given ttl,
+// replying the conditional requests which match the ETag with 304 Not Modified.
+// The ETag is based on the size and modification time of the file served by
+// the fasthttp.FS, which caches them, so the file is not stat'ed again.
+func newCachedFilesHandler(path string, fs *fasthttp.FS, ttl time.Duration) fasthttp.RequestHandler {
+	if ttl < 0 {
+		panic("ttl must not be negative in path '" + path + "'")
+	}
+
+	cacheControl := "no-cache"
+	if ttl > 0 {
+		cacheControl = "public, max-age=" + strconv.FormatInt(int64(ttl/time.Second), 10)
+	}
+
+	handler := newFilesHandler(path, fs)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		// The file is always served, so the conditional request is checked
+		// with the ETag and modification time of the response. The header
+		// is restored once served, to keep the request as is.
+		ifModifiedSince := bytebufferpool.Get()
+		defer bytebufferpool.Put(ifModifiedSince)
+
+		if v := ctx.Request.Header.Peek(fasthttp.HeaderIfModifiedSince); len(v) > 0 {
+			ifModifiedSince.Write(v)
+			ctx.Request.Header.Del(fasthttp.HeaderIfModifiedSince)
+		}
+
+		handler(ctx)
+
+		if len(ifModifiedSince.B) > 0 {
+			ctx.Request.Header.SetBytesV(fasthttp.HeaderIfModifiedSince, ifModifiedSince.B)
+		}
+
+		etag, lastModified, ok := responseETag(&ctx.Response)
+		if !ok {
+			return
+		}
+
+		var notModified bool
+
+		if ifNoneMatch := ctx.Request.Header.Peek(fasthttp.HeaderIfNoneMatch); len(ifNoneMatch) > 0 {
+			// If-None-Match takes precedence over If-Modified-Since
+			notModified = matchETag(strconvpkg.B2S(ifNoneMatch), etag)
+		} else if len(ifModifiedSince.B) > 0 {
+			since, err := fasthttp.ParseHTTPDate(ifModifiedSince.B)
+			notModified = err == nil && !since.Before(lastModified)
+		}
+
+		if notModified {
+			ctx.NotModified()
+		}
+
+		ctx.Response.Header.Set(fasthttp.HeaderETag, etag)
+		ctx.Response.Header.Set(fasthttp.HeaderCacheControl, cacheControl)
+	}
+}
+
+// responseETag returns the weak ETag of the file served in the response,
+// based on its size and modification time, and the modification time.
+// It returns false if the response is not a served file.
+func responseETag(resp *fasthttp.Response) (string, time.Time, bool) {
+	var size int64
+
+	switch resp.StatusCode() {
+	case fasthttp.StatusOK:
+		size = int64(resp.Header.ContentLength())
+	case fasthttp.StatusPartialContent:
+		// The size of the whole file follows the range (e.g. 'bytes 0-9/42')
+		contentRange := strconvpkg.B2S(resp.Header.Peek(fasthttp.HeaderContentRange))
+
+		n, err := strconv.ParseInt(contentRange[strings.LastIndexByte(contentRange, '/')+1:], 10, 64)
+		if err != nil {
+			return "", time.Time{}, false
+		}
+
+		size = n
+	default:
+		return "", time.Time{}, false
+	}
+
+	lastModified, err := fasthttp.ParseHTTPDate(resp.Header.Peek(fasthttp.HeaderLastModified))
+	if err != nil || size < 0 {
+		return "", time.Time{}, false
+	}
+
+	etag := `W/"` + strconv.FormatInt(size, 16) + "-" + strconv.FormatInt(lastModified.Unix(), 16) + `"`
+
+	return etag, lastModified, true
+}
+
+// matchETag checks if the If-None-Match header value matches the ETag,
+// comparing them weakly
+func matchETag(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newPreflightHandler returns the handler which replies to the CORS
+// preflight requests with the given config. The "Allow" header must be
+// already set with the allowed methods of the path.
+func newPreflightHandler(config CORSConfig) fasthttp.RequestHandler {
+	anyOrigin := len(config.AllowOrigins) == 0 || gstrings.Include(config.AllowOrigins, "*")
+	allowHeaders := strings.Join(config.AllowHeaders, ", ")
+	maxAge := strconv.FormatInt(int64(config.MaxAge/time.Second), 10)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+
+		origin := strconvpkg.B2S(ctx.Request.Header.Peek(fasthttp.HeaderOrigin))
+		if origin == "" || (!anyOrigin && !gstrings.Include(config.AllowOrigins, origin)) {
+			return
+		}
+
+		if anyOrigin && !config.AllowCredentials {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowOrigin, "*")
+		} else {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowOrigin, origin)
+			ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderOrigin)
+		}
+
+		ctx.Response.Header.SetBytesV(fasthttp.HeaderAccessControlAllowMethods, ctx.Response.Header.Peek("Allow"))
+
+		if allowHeaders != "" {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowHeaders, allowHeaders)
+		}
+
+		if config.AllowCredentials {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlAllowCredentials, "true")
+		}
+
+		if config.MaxAge > 0 {
+			ctx.Response.Header.Set(fasthttp.HeaderAccessControlMaxAge, maxAge)
+		}
+	}
+}
+
+// newTimeoutHandler returns a handler which replies with
+// 503 Service Unavailable if the given handler doesn't return
+// before the timeout, or the handler itself if the timeout is not positive.
+// It wraps fasthttp.TimeoutWithCodeHandler, so the handlers running in their
+// own goroutine are bounded by the server concurrency, but the panics of the
+// handler are raised in the router goroutine, to be passed to PanicHandler.
+func newTimeoutHandler(handler fasthttp.RequestHandler, timeout time.Duration) fasthttp.RequestHandler {
+	if timeout <= 0 {
+		return handler
+	}
+
+	msg := fasthttp.StatusMessage(fasthttp.StatusServiceUnavailable)
+
+	return func(ctx *fasthttp.RequestCtx) {
+		var rcv interface{}
+		done := make(chan struct{})
+
+		fasthttp.TimeoutWithCodeHandler(func(ctx *fasthttp.RequestCtx) {
+			defer func() {
+				rcv = recover()
+				close(done)
+			}()
+
+			handler(ctx)
+		}, timeout, msg, fasthttp.StatusServiceUnavailable)(ctx)
+
+		select {
+		case <-done:
+			if rcv != nil {
+				// Propagate the panic to the router goroutine
+				panic(rcv)
+			}
+		default:
+			// The handler timed out, or it was not called
+			// since the server concurrency was reached
+		}
+	}
+}
+
+// newMaxBodySizeHandler returns a handler which replies with
+// 413 Request Entity Too Large if the request body exceeds the given size
+func newMaxBodySizeHandler(handler fasthttp.RequestHandler, size int) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if status := bodySizeStatus(ctx, size); status != fasthttp.StatusOK {
+			ctx.Error(fasthttp.StatusMessage(status), status)
+			return
+		}
+
+		handler(ctx)
+	}
+}
+
+// bodySizeStatus returns the status of the request body regarding the given
+// size: 200 OK, 413 Request Entity Too Large, or 400 Bad Request if a streamed
+// body could not be read. A declared length is checked without reading the
+// body, and a streamed body of unknown length is read up to the size,
+// keeping it as the request body.
+func bodySizeStatus(ctx *fasthttp.RequestCtx, size int) int {
+	length := ctx.Request.Header.ContentLength()
+	stream := ctx.RequestBodyStream()
+
+	switch {
+	case length > size:
+		return fasthttp.StatusRequestEntityTooLarge
+	case stream == nil:
+		// The body is already read
+		if len(ctx.PostBody()) > size {
+			return fasthttp.StatusRequestEntityTooLarge
+		}
+
+		return fasthttp.StatusOK
+	case length >= 0:
+		// The stream has the declared length
+		return fasthttp.StatusOK
+	}
+
+	body, err := io.ReadAll(io.LimitReader(stream, int64(size)+1))
+	if err != nil {
+		return fasthttp.StatusBadRequest
+	} else if len(body) > size {
+		return fasthttp.StatusRequestEntityTooLarge
+	}
+
+	ctx.Request.SetBody(body)
+
+	return fasthttp.StatusOK
+}
+
+// isRedirectLoop checks if the redirect target, once encoded in the
+// location uri, is the same as the original request path
+func isRedirectLoop(target []byte, path string) bool {
+	uri := fasthttp.AcquireURI()
+	uri.SetPathBytes(target)
+
+	loop := string(uri.RequestURI()) == path
+	fasthttp.ReleaseURI(uri)
+
+	return loop
+}
+
+// registrant describes the router or the group which registered the route
+func (rh routeHandler) registrant() string {
+	if rh.group == nil {
+		return "router"
+	}
+
+	return rh.group.description()
+}
+
+// toNamedMiddleware converts the given middleware to unnamed ones
+func toNamedMiddleware(middleware []Middleware) []namedMiddleware {
+	named := make([]namedMiddleware, len(middleware))
+	for i, m := range middleware {
+		named[i] = namedMiddleware{middleware: m}
+	}
+
+	return named
+}
@@ -15,3 +15,152 @@ func Test_validatePath(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+func Test_staticPath(t *testing.T) {
+	tests := []struct {
+		urlPrefix string
+		want      string
+	}{
+		{"/", "/{filepath:*}"},
+		{"/static", "/static/{filepath:*}"},
+		{"/static/", "/static/{filepath:*}"},
+	}
+
+	for _, test := range tests {
+		if got := staticPath(test.urlPrefix); got != test.want {
+			t.Errorf("staticPath(%q) == %q, want %q", test.urlPrefix, got, test.want)
+		}
+	}
+
+	if err := catchPanic(func() { staticPath("static") }); err == nil {
+		t.Error("an error was expected when a path does not begin with slash")
+	}
+
+	if err := catchPanic(func() { staticPath("/static/{filepath:*}") }); err == nil {
+		t.Error("an error was expected when a path contains wildcards")
+	}
+
+	if err := catchPanic(func() { staticPath("/static/{name}") }); err == nil {
+		t.Error("an error was expected when a path contains wildcards")
+	}
+}
+
+func Test_isRedirectLoop(t *testing.T) {
+	tests := []struct {
+		target string
+		path   string
+		want   bool
+	}{
+		{"/foo bar", "/foo%20bar", true},
+		{"/path", "/path", true},
+		{"/path", "/../path", false},
+		{"/path", "/PATH", false},
+	}
+
+	for _, test := range tests {
+		if got := isRedirectLoop([]byte(test.target), test.path); got != test.want {
+			t.Errorf("isRedirectLoop(%q, %q) == %v, want %v", test.target, test.path, got, test.want)
+		}
+	}
+}
+
+func Test_isValidRequestPath(t *testing.T) {
+	tests := []struct {
+		path      string
+		maxLength int
+		want      bool
+	}{
+		{"/", 0, true},
+		{"*", 0, true},
+		{"/path/to/file", 0, true},
+		{"/path/to/file", 13, true},
+		{"/path/to/file", 12, false},
+		{"path", 0, false},
+		{"**", 0, false},
+		{"/pa\x00th", 0, false},
+		{"/pa%00th", 0, false},
+	}
+
+	for _, test := range tests {
+		if got := isValidRequestPath(test.path, test.maxLength); got != test.want {
+			t.Errorf("isValidRequestPath(%q, %d) == %v, want %v", test.path, test.maxLength, got, test.want)
+		}
+	}
+}
+
+func Test_isValidMethod(t *testing.T) {
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{"GET", true},
+		{"PROPFIND", true},
+		{"M-SEARCH", true},
+		{"X_CUSTOM1", true},
+		{MethodWild, true},
+		{"get", false},
+		{"Post", false},
+		{" GET", false},
+		{"GET ", false},
+		{"GE T", false},
+		{"GET\t", false},
+		{"GET/", false},
+	}
+
+	for _, test := range tests {
+		if got := isValidMethod(test.method); got != test.want {
+			t.Errorf("isValidMethod(%q) == %v, want %v", test.method, got, test.want)
+		}
+	}
+}
+
+func Test_hasPathPrefix(t *testing.T) {
+	tests := []struct {
+		path   string
+		prefix string
+		want   bool
+	}{
+		{"/api", "/api", true},
+		{"/api/users", "/api", true},
+		{"/apis", "/api", false},
+		{"/anything", "/", true},
+		{"/users/5", "/users/{id}", true},
+		{"/users/5/posts", "/users/{id}", true},
+		{"/users", "/users/{id}", false},
+		{"/users/", "/users/{id}", false},
+		{"/accounts/5", "/users/{id}", false},
+		{"/users/5/posts/7/comments", "/users/{id}/posts/{post}", true},
+		{"/users/5/likes/7", "/users/{id}/posts/{post}", false},
+		{"/files/a.png", "/files/{name}.{ext}", true},
+		{"/dates/2024/01", "/dates/{year:[0-9]{4}}/{month}", true},
+		{"/settings/7", "/settings/{id}/{tab?}", true},
+		{"/settings/7/profile/edit", "/settings/{id}/{tab?}", true},
+		{"/settings", "/settings/{id}/{tab?}", false},
+		{"/pages", "/pages/{page?=1}", true},
+	}
+
+	for _, test := range tests {
+		if got := hasPathPrefix(test.path, test.prefix); got != test.want {
+			t.Errorf("hasPathPrefix(%q, %q) == %v, want %v", test.path, test.prefix, got, test.want)
+		}
+	}
+}
+
+func Test_positionalParams(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/users", "/users"},
+		{"/users/{id}", "/users/{0}"},
+		{"/users/{name}/posts/{post:[0-9]+}", "/users/{0}/posts/{1:[0-9]+}"},
+		{"/files/{name}.{ext:[a-z]{3}}", "/files/{0}.{1:[a-z]{3}}"},
+		{"/static/{filepath:*}", "/static/{0:*}"},
+	}
+
+	for _, test := range tests {
+		if got := positionalParams(test.path); got != test.want {
+			t.Errorf("positionalParams(%q) == %q, want %q", test.path, got, test.want)
+		}
+	}
+}